@@ -0,0 +1,121 @@
+package wmi
+
+import (
+	"context"
+	"sync"
+)
+
+// AsyncQuery is a query running in the background. Decoded objects are
+// delivered over the `Objects` channel which is closed when the query is
+// done. The result of the query is available with `Err` after that.
+//
+// The caller should either read all objects or cancel the query, otherwise
+// the query goroutine is blocked forever.
+type AsyncQuery struct {
+	objects  chan interface{}
+	progress chan int
+	done     chan struct{}
+	cancel   context.CancelFunc
+
+	mu    sync.Mutex
+	count int
+	err   error
+}
+
+// asyncProducer produces the query objects calling @emit for each of them.
+// It should stop if @emit returns an error and return that error.
+type asyncProducer func(ctx context.Context, emit func(obj interface{}) error) error
+
+// startAsyncQuery runs @produce in the background.
+func startAsyncQuery(ctx context.Context, produce asyncProducer) *AsyncQuery {
+	ctx, cancel := context.WithCancel(ctx)
+	q := &AsyncQuery{
+		objects:  make(chan interface{}),
+		progress: make(chan int, 1),
+		done:     make(chan struct{}),
+		cancel:   cancel,
+	}
+	go func() {
+		defer cancel()
+		err := produce(ctx, func(obj interface{}) error {
+			return q.emit(ctx, obj)
+		})
+
+		q.mu.Lock()
+		q.err = err
+		q.mu.Unlock()
+		close(q.objects)
+		close(q.progress)
+		close(q.done)
+	}()
+	return q
+}
+
+func (q *AsyncQuery) emit(ctx context.Context, obj interface{}) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	select {
+	case q.objects <- obj:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	q.mu.Lock()
+	q.count++
+	count := q.count
+	q.mu.Unlock()
+
+	// Keep the latest progress only, so nobody is blocked on it.
+	select {
+	case <-q.progress:
+	default:
+	}
+	q.progress <- count
+	return nil
+}
+
+// Objects returns the channel of decoded objects. It's closed when the query
+// is done.
+func (q *AsyncQuery) Objects() <-chan interface{} {
+	return q.objects
+}
+
+// Progress returns the channel of the number of objects delivered so far.
+// Only the latest value is kept, so it's fine not to read it at all. The
+// channel is closed when the query is done.
+func (q *AsyncQuery) Progress() <-chan int {
+	return q.progress
+}
+
+// Done returns the channel which is closed when the query is done.
+func (q *AsyncQuery) Done() <-chan struct{} {
+	return q.done
+}
+
+// Err returns the query error. It's nil until the query is done, then it's
+// nil on success, `context.Canceled` (or `DeadlineExceeded`) if the query
+// has been cancelled, or the query error.
+func (q *AsyncQuery) Err() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+// Count returns the number of objects delivered so far.
+func (q *AsyncQuery) Count() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// Cancel cancels the query. Objects not read yet are dropped.
+func (q *AsyncQuery) Cancel() {
+	q.cancel()
+}
+
+// Wait waits until the query is done and returns its error.
+func (q *AsyncQuery) Wait() error {
+	<-q.done
+	return q.Err()
+}
@@ -0,0 +1,144 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/bi-zone/go-ole/oleutil"
+	"github.com/hashicorp/go-multierror"
+)
+
+// QueryAsync starts the WQL query in the background and returns immediately.
+// The query is made with asynchronous `ExecQueryAsync` call, objects are
+// decoded into new values of the @elem type as soon as WMI delivers them to
+// the sink. If @elem is a pointer to the structure the pointers are
+// delivered, e.g.
+//
+//	q, err := conn.QueryAsync(ctx, "SELECT * FROM Win32_Process", &Win32_Process{})
+//	...
+//	for obj := range q.Objects() {
+//		p := obj.(*Win32_Process)
+//	}
+//	if err := q.Err(); err != nil {
+//		...
+//	}
+//
+// The query is cancelled on the WMI side as soon as @ctx is done (or
+// `AsyncQuery.Cancel` is called), even if WMI hasn't returned any objects
+// yet. Field mismatch errors don't stop the query, the last one is returned
+// by `AsyncQuery.Err` the same way as `Query` does. The call isn't retried
+// with the connection `RetryPolicy`.
+//
+// Several queries could run on the same connection concurrently, they don't
+// wait for each other.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/making-an-asynchronous-call-with-vbscript
+func (s *SWbemServicesConnection) QueryAsync(ctx context.Context, query string, elem interface{}) (*AsyncQuery, error) {
+	s.Lock()
+	if s.sWbemServices == nil {
+		s.Unlock()
+		return nil, ErrConnectionClosed
+	}
+	s.Unlock()
+
+	elemType := reflect.TypeOf(elem)
+	if elemType == nil {
+		return nil, ErrInvalidEntityType
+	}
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, ErrInvalidEntityType
+	}
+
+	return startAsyncQuery(ctx, func(ctx context.Context, emit func(obj interface{}) error) error {
+		return s.queryAsync(ctx, query, elemType, isPtr, emit)
+	}), nil
+}
+
+func (s *SWbemServicesConnection) queryAsync(
+	ctx context.Context,
+	query string,
+	elemType reflect.Type,
+	isPtr bool,
+	emit func(obj interface{}) error,
+) (err error) {
+	//  Be aware of reflections and COM usage.
+	defer func() {
+		if r := recover(); r != nil {
+			err = multierror.Append(err, fmt.Errorf("runtime panic; %v", r))
+		}
+	}()
+
+	services, err := s.acquireServices()
+	if err != nil {
+		return err
+	}
+	defer services.Release()
+
+	sink, err := newQuerySink()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if clErr := sink.close(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	observer := withContext(ctx, MultiObserver(&s.stats, s.Observer))
+	done := observe(observer, s.callInfo(OpExecQuery, query))
+	resultRaw, err := oleutil.CallMethod(services, "ExecQueryAsync", sink.sink, query, "WQL")
+	err = newWbemError("SWbemServices ExecQueryAsync", err)
+	done(0, err)
+	if err != nil {
+		return err
+	}
+	if err := resultRaw.Clear(); err != nil {
+		return err
+	}
+
+	objects := 0
+	doneEnum := observe(observer, s.callInfo(OpEnumerate, query))
+	defer func() {
+		doneEnum(objects, err)
+	}()
+
+	var errFieldMismatch error
+	for {
+		select {
+		case item := <-sink.objects():
+			ev := reflect.New(elemType)
+			err := s.decode(query, item, ev.Interface())
+			item.Release()
+			if err != nil {
+				var fieldMismatch ErrFieldMismatch
+				if !errors.As(err, &fieldMismatch) {
+					return err
+				}
+				errFieldMismatch = err
+			}
+			if !isPtr {
+				ev = ev.Elem()
+			}
+			objects++
+			if err := emit(ev.Interface()); err != nil {
+				return err
+			}
+		case err := <-sink.completed():
+			if err != nil {
+				return err
+			}
+			return errFieldMismatch
+		case <-ctx.Done():
+			// The call is cancelled by the sink close.
+			return ctx.Err()
+		}
+	}
+}
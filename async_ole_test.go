@@ -0,0 +1,84 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSWbemServicesConnection_QueryAsync(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	var expected []Win32_Process
+	if err := s.Query("SELECT * FROM Win32_Process", &expected); err != nil {
+		t.Fatalf("Query: %s", err)
+	}
+
+	// Run two queries at once on the same connection.
+	processes, err := s.QueryAsync(context.Background(), "SELECT * FROM Win32_Process", &Win32_Process{})
+	if err != nil {
+		t.Fatalf("QueryAsync: %s", err)
+	}
+	systems, err := s.QueryAsync(context.Background(), "SELECT * FROM Win32_OperatingSystem", Win32_OperatingSystem{})
+	if err != nil {
+		t.Fatalf("QueryAsync: %s", err)
+	}
+
+	n := 0
+	for obj := range processes.Objects() {
+		if p := obj.(*Win32_Process); p.Name == "" {
+			t.Errorf("Empty process %+v", p)
+		}
+		n++
+	}
+	if err := processes.Err(); err != nil {
+		t.Errorf("Process query failed; %s", err)
+	}
+	if n < len(expected)/2 {
+		t.Errorf("Too few processes returned; %d, expected about %d", n, len(expected))
+	}
+	for obj := range systems.Objects() {
+		_ = obj.(Win32_OperatingSystem)
+	}
+	if err := systems.Err(); err != nil || systems.Count() != 1 {
+		t.Errorf("Unexpected result of OS query; %d objects, error %v", systems.Count(), err)
+	}
+
+	// Cancel in the middle.
+	processes, err = s.QueryAsync(context.Background(), "SELECT * FROM Win32_Process", &Win32_Process{})
+	if err != nil {
+		t.Fatalf("QueryAsync: %s", err)
+	}
+	<-processes.Objects()
+	processes.Cancel()
+	if err := processes.Wait(); err != context.Canceled {
+		t.Errorf("Unexpected error of cancelled query; %v", err)
+	}
+
+	// Cancel before WMI returns anything, the call is cancelled on the WMI
+	// side.
+	ctx, cancel := context.WithCancel(context.Background())
+	files, err := s.QueryAsync(ctx, "SELECT * FROM CIM_DataFile", &struct{ Name string }{})
+	if err != nil {
+		t.Fatalf("QueryAsync: %s", err)
+	}
+	cancel()
+	select {
+	case <-files.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Query isn't cancelled")
+	}
+	if err := files.Err(); err != context.Canceled {
+		t.Errorf("Unexpected error of cancelled query; %v", err)
+	}
+
+	if _, err := s.QueryAsync(context.Background(), "SELECT * FROM Win32_Process", 42); err != ErrInvalidEntityType {
+		t.Errorf("Unexpected error of invalid type; %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// countingProducer emits numbers from 0 to n-1 and fails with err at the end.
+func countingProducer(n int, err error) asyncProducer {
+	return func(ctx context.Context, emit func(obj interface{}) error) error {
+		for i := 0; i < n; i++ {
+			if err := emit(i); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+}
+
+func TestAsyncQuery(t *testing.T) {
+	q := startAsyncQuery(context.Background(), countingProducer(5, nil))
+
+	var objects []interface{}
+	for obj := range q.Objects() {
+		objects = append(objects, obj)
+	}
+	if err := q.Wait(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(objects, []interface{}{0, 1, 2, 3, 4}) {
+		t.Errorf("Unexpected objects %v", objects)
+	}
+	if q.Count() != 5 {
+		t.Errorf("Unexpected count %d", q.Count())
+	}
+
+	// Only the latest progress is kept.
+	var progress []int
+	for p := range q.Progress() {
+		progress = append(progress, p)
+	}
+	if !reflect.DeepEqual(progress, []int{5}) {
+		t.Errorf("Unexpected progress %v", progress)
+	}
+}
+
+func TestAsyncQuery_Error(t *testing.T) {
+	q := startAsyncQuery(context.Background(), countingProducer(2, ErrInvalidQuery))
+	if q.Err() != nil {
+		// Can't be done since objects are not read yet.
+		t.Errorf("Error before the query is done; %v", q.Err())
+	}
+	n := 0
+	for range q.Objects() {
+		n++
+	}
+	if n != 2 || !errors.Is(q.Err(), ErrInvalidQuery) {
+		t.Errorf("Unexpected result; %d objects, error %v", n, q.Err())
+	}
+}
+
+func TestAsyncQuery_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := startAsyncQuery(ctx, countingProducer(1000, nil))
+
+	if obj := <-q.Objects(); obj != 0 {
+		t.Errorf("Unexpected object %v", obj)
+	}
+	cancel()
+	select {
+	case <-q.Done():
+	case obj, ok := <-q.Objects():
+		// The producer could be already sending the next object.
+		if ok && obj != 1 {
+			t.Errorf("Unexpected object %v", obj)
+		}
+		<-q.Done()
+	}
+	if q.Err() != context.Canceled {
+		t.Errorf("Unexpected error of cancelled query %v", q.Err())
+	}
+	if q.Count() > 2 {
+		t.Errorf("Too many objects delivered after cancel; %d", q.Count())
+	}
+
+	// Cancel without reading anything.
+	q = startAsyncQuery(context.Background(), countingProducer(1000, nil))
+	q.Cancel()
+	if err := q.Wait(); err != context.Canceled {
+		t.Errorf("Unexpected error of cancelled query %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Package audit finds the WMI event subscriptions used for persistence.
+//
+// A `Snapshot` of the filters, consumers and bindings is taken with `Collect`
+// (Windows only) or loaded from JSON, e.g. the one collected on another host.
+// `Config.Audit` runs the rules over the snapshot and returns the findings
+// with severity. Rules don't require WMI, so snapshots could be audited on any
+// OS.
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bi-zone/wmi"
+)
+
+// Severity is the severity of the finding.
+type Severity int
+
+// Severities in ascending order.
+const (
+	SeverityInfo Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"info", "low", "medium", "high", "critical"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// MarshalText returns the severity name.
+func (s Severity) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(severityNames) {
+		return nil, fmt.Errorf("audit: unknown severity %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText parses the severity name.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if strings.EqualFold(name, string(text)) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("audit: unknown severity %q", text)
+}
+
+// Finding is a suspicious object found by the rule.
+type Finding struct {
+	// Rule is the ID of the rule reported the finding.
+	Rule     string
+	Severity Severity
+	// Namespace is the namespace of the object.
+	Namespace string
+	// Path is the relative object path of the object.
+	Path    string
+	Message string
+}
+
+// Snapshot holds the permanent event subscription objects of the host.
+type Snapshot struct {
+	Host       string
+	Time       time.Time
+	Namespaces []Namespace
+}
+
+// Namespace holds the permanent event subscription objects of the namespace.
+type Namespace struct {
+	// Name is the full namespace name, e.g. `root\subscription`.
+	Name    string
+	Filters []wmi.EventFilter
+	// Consumers are the pointers to the standard consumer structures, e.g.
+	// *wmi.CommandLineEventConsumer.
+	Consumers []wmi.EventConsumer
+	Bindings  []wmi.FilterToConsumerBinding
+}
+
+// Default values of the `Config` fields.
+var (
+	DefaultNamespaces = []string{wmi.SubscriptionNamespace}
+
+	// DefaultCreatorSIDs are the SIDs of the LocalSystem, LocalService,
+	// NetworkService and the Administrators group.
+	DefaultCreatorSIDs = []string{"S-1-5-18", "S-1-5-19", "S-1-5-20", "S-1-5-32-544"}
+)
+
+// Config is the audit configuration. Zero value means the defaults.
+type Config struct {
+	// Rules are the rules to run, `DefaultRules` if nil.
+	Rules []Rule
+
+	// Namespaces are the namespaces the subscriptions are expected in,
+	// `DefaultNamespaces` if nil.
+	Namespaces []string
+
+	// CreatorSIDs are the SIDs of the expected subscription creators,
+	// `DefaultCreatorSIDs` if nil.
+	CreatorSIDs []string
+
+	// Allow are the relative object paths of the objects known to be
+	// legitimate, findings of them are not reported.
+	Allow []string
+
+	// MinSeverity is the minimal severity of the findings reported.
+	MinSeverity Severity
+}
+
+// Audit runs the default rules over the @s snapshot.
+func Audit(s *Snapshot) []Finding {
+	return (&Config{}).Audit(s)
+}
+
+// Audit runs the rules over the @s snapshot and returns the findings sorted by
+// severity (the most severe first), namespace and object path.
+func (c *Config) Audit(s *Snapshot) []Finding {
+	cfg := c.withDefaults()
+	allowed := make(map[string]bool, len(cfg.Allow))
+	for _, path := range cfg.Allow {
+		allowed[strings.ToLower(path)] = true
+	}
+
+	var findings []Finding
+	for i := range s.Namespaces {
+		ns := &s.Namespaces[i]
+		for _, rule := range cfg.Rules {
+			for _, f := range rule.Check(&cfg, ns) {
+				if f.Severity < cfg.MinSeverity || allowed[strings.ToLower(f.Path)] {
+					continue
+				}
+				f.Rule = rule.ID
+				if f.Namespace == "" {
+					f.Namespace = ns.Name
+				}
+				findings = append(findings, f)
+			}
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		switch {
+		case a.Severity != b.Severity:
+			return a.Severity > b.Severity
+		case a.Namespace != b.Namespace:
+			return a.Namespace < b.Namespace
+		default:
+			return a.Path < b.Path
+		}
+	})
+	return findings
+}
+
+func (c *Config) withDefaults() Config {
+	cfg := *c
+	if cfg.Rules == nil {
+		cfg.Rules = DefaultRules()
+	}
+	if cfg.Namespaces == nil {
+		cfg.Namespaces = DefaultNamespaces
+	}
+	if cfg.CreatorSIDs == nil {
+		cfg.CreatorSIDs = DefaultCreatorSIDs
+	}
+	return cfg
+}
+
+// isDefaultNamespace reports whether the @name is one of the expected
+// namespaces.
+func (c *Config) isDefaultNamespace(name string) bool {
+	for _, ns := range c.Namespaces {
+		if strings.EqualFold(ns, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAllowedCreator reports whether the @sid is one of the expected creators.
+func (c *Config) isAllowedCreator(sid string) bool {
+	for _, allowed := range c.CreatorSIDs {
+		if strings.EqualFold(allowed, sid) {
+			return true
+		}
+	}
+	return false
+}
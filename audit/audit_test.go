@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func loadSnapshot(t *testing.T) *Snapshot {
+	t.Helper()
+	data, err := ioutil.ReadFile("testdata/snapshot.json")
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	return &s
+}
+
+func TestAudit(t *testing.T) {
+	findings := Audit(loadSnapshot(t))
+
+	expected := []struct {
+		rule      string
+		severity  Severity
+		namespace string
+		path      string
+	}{
+		{"encoded-command", SeverityCritical, `root\subscription`, `CommandLineEventConsumer.Name="Updater"`},
+		{"script-consumer", SeverityHigh, `root\default`, `ActiveScriptEventConsumer.Name="Logon"`},
+		{"non-default-namespace", SeverityMedium, `root\default`, `ActiveScriptEventConsumer.Name="Logon"`},
+		{"non-default-namespace", SeverityMedium, `root\default`,
+			`__EventFilter.Name="Logon"`},
+		{"non-default-namespace", SeverityMedium, `root\default`,
+			`__FilterToConsumerBinding.Consumer="ActiveScriptEventConsumer.Name=\"Logon\"",Filter="__EventFilter.Name=\"Logon\""`},
+		{"command-line-consumer", SeverityMedium, `root\subscription`, `CommandLineEventConsumer.Name="Updater"`},
+		{"unusual-creator", SeverityMedium, `root\subscription`, `CommandLineEventConsumer.Name="Updater"`},
+		{"unusual-creator", SeverityMedium, `root\subscription`, `__EventFilter.Name="Updater"`},
+		{"unusual-creator", SeverityMedium, `root\subscription`,
+			`__FilterToConsumerBinding.Consumer="\\\\WS01\\ROOT\\subscription:CommandLineEventConsumer.Name=\"Updater\"",` +
+				`Filter="\\\\WS01\\ROOT\\subscription:__EventFilter.Name=\"Updater\""`},
+		{"orphaned-binding", SeverityLow, `root\subscription`,
+			`__FilterToConsumerBinding.Consumer="CommandLineEventConsumer.Name=\"Removed\"",Filter="__EventFilter.Name=\"Removed\""`},
+		{"unbound-object", SeverityInfo, `root\subscription`, `__EventFilter.Name="Unused"`},
+	}
+	if len(findings) != len(expected) {
+		for _, f := range findings {
+			t.Logf("%+v", f)
+		}
+		t.Fatalf("Unexpected number of findings %d; expected %d", len(findings), len(expected))
+	}
+	for i, exp := range expected {
+		f := findings[i]
+		if f.Rule != exp.rule || f.Severity != exp.severity || f.Namespace != exp.namespace || f.Path != exp.path {
+			t.Errorf("Unexpected finding %d %+v; expected %+v", i, f, exp)
+		}
+		if f.Message == "" {
+			t.Errorf("Finding %d has no message", i)
+		}
+	}
+}
+
+func TestConfig_Audit(t *testing.T) {
+	s := loadSnapshot(t)
+	c := Config{
+		Namespaces:  []string{`root\subscription`, `ROOT\default`},
+		CreatorSIDs: append([]string{"S-1-5-21-1-2-3-1001"}, DefaultCreatorSIDs...),
+		Allow:       []string{`activescripteventconsumer.name="logon"`},
+		MinSeverity: SeverityLow,
+	}
+	findings := c.Audit(s)
+	rules := map[string]int{}
+	for _, f := range findings {
+		rules[f.Rule]++
+	}
+	expected := map[string]int{"encoded-command": 1, "command-line-consumer": 1, "orphaned-binding": 1}
+	if len(rules) != len(expected) {
+		t.Errorf("Unexpected findings %+v", findings)
+	}
+	for rule, n := range expected {
+		if rules[rule] != n {
+			t.Errorf("Unexpected number of %s findings %d; expected %d", rule, rules[rule], n)
+		}
+	}
+
+	c = Config{Rules: []Rule{RuleScriptConsumer}}
+	if findings := c.Audit(s); len(findings) != 1 || findings[0].Rule != RuleScriptConsumer.ID {
+		t.Errorf("Unexpected findings %+v", findings)
+	}
+}
+
+func TestSeverity_Text(t *testing.T) {
+	data, err := json.Marshal(Finding{Severity: SeverityCritical})
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	var f Finding
+	if err := json.Unmarshal(data, &f); err != nil || f.Severity != SeverityCritical {
+		t.Errorf("Unexpected severity %s of %s; %v", f.Severity, data, err)
+	}
+	if err := f.Severity.UnmarshalText([]byte("severe")); err == nil {
+		t.Errorf("Unknown severity is accepted")
+	}
+	if _, err := Severity(42).MarshalText(); err == nil {
+		t.Errorf("Unknown severity is marshalled")
+	}
+}
@@ -0,0 +1,98 @@
+// +build windows
+
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bi-zone/wmi"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Collect takes the snapshot of the permanent event subscription objects in
+// the @namespaces of the @host (the local one if empty). All the namespaces
+// of the host are walked if none given. Namespaces failed to be read (e.g.
+// because of the access rights) are reported with the error along with the
+// snapshot of the rest of them.
+func Collect(host string, namespaces ...string) (snapshot *Snapshot, err error) {
+	if host == "" {
+		host = "."
+	}
+	services, err := wmi.NewSWbemServices()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if clErr := services.Close(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	var result error
+	if len(namespaces) == 0 {
+		namespaces, err = listNamespaces(services, host)
+		if namespaces == nil {
+			return nil, err
+		}
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	snapshot = &Snapshot{Host: host, Time: time.Now()}
+	for _, name := range namespaces {
+		ns, err := collectNamespace(services, host, name)
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf("audit: failed to collect %s; %w", name, err))
+			continue
+		}
+		snapshot.Namespaces = append(snapshot.Namespaces, *ns)
+	}
+	return snapshot, result
+}
+
+// listNamespaces returns all the namespaces of the @host including the `root`.
+// The namespaces accessible are returned along with
+// `wmi.ErrNamespaceAccessDenied`.
+func listNamespaces(services *wmi.SWbemServices, host string) (_ []string, err error) {
+	conn, err := services.ConnectServer(host, "root")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if clErr := conn.Close(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+	namespaces, err := conn.ListNamespaces("root", true)
+	if namespaces == nil && err != nil {
+		return nil, err
+	}
+	return append([]string{"root"}, namespaces...), err
+}
+
+// collectNamespace returns the subscription objects of the @name namespace.
+func collectNamespace(services *wmi.SWbemServices, host, name string) (_ *Namespace, err error) {
+	conn, err := services.ConnectServer(host, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if clErr := conn.Close(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	ns := Namespace{Name: name}
+	if ns.Filters, err = conn.EventFilters(); err != nil {
+		return nil, err
+	}
+	if ns.Consumers, err = conn.EventConsumers(); err != nil {
+		return nil, err
+	}
+	if ns.Bindings, err = conn.FilterToConsumerBindings(); err != nil {
+		return nil, err
+	}
+	return &ns, nil
+}
@@ -0,0 +1,26 @@
+// +build windows
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/bi-zone/wmi"
+)
+
+func TestCollect(t *testing.T) {
+	s, err := Collect("", wmi.SubscriptionNamespace, `root\cimv2`)
+	if err != nil {
+		t.Fatalf("Collect: %s", err)
+	}
+	if s.Host != "." || len(s.Namespaces) != 2 || s.Namespaces[0].Name != wmi.SubscriptionNamespace {
+		t.Fatalf("Unexpected snapshot %+v", s)
+	}
+	for _, f := range Audit(s) {
+		t.Logf("%s %s %s %s: %s", f.Severity, f.Rule, f.Namespace, f.Path, f.Message)
+	}
+
+	if _, err := Collect("", `root\missing`); err == nil {
+		t.Errorf("Missing namespace is collected")
+	}
+}
@@ -0,0 +1,314 @@
+package audit
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bi-zone/wmi"
+)
+
+// Rule is a check of the namespace objects.
+type Rule struct {
+	// ID is the short unique name of the rule, e.g. "script-consumer".
+	ID          string
+	Description string
+
+	// Check returns the findings of the @ns namespace objects. `Finding.Rule`
+	// and `Finding.Namespace` are set by the caller.
+	Check func(c *Config, ns *Namespace) []Finding
+}
+
+// DefaultRules returns the rules used if `Config.Rules` is nil.
+func DefaultRules() []Rule {
+	return []Rule{
+		RuleScriptConsumer,
+		RuleCommandLineConsumer,
+		RuleEncodedCommand,
+		RuleOrphanedBinding,
+		RuleCustomConsumer,
+		RuleUnboundObject,
+		RuleNonDefaultNamespace,
+		RuleUnusualCreator,
+	}
+}
+
+// RuleScriptConsumer reports `ActiveScriptEventConsumer`s, they run arbitrary
+// scripts and are rarely used legitimately.
+var RuleScriptConsumer = Rule{
+	ID:          "script-consumer",
+	Description: "ActiveScriptEventConsumer runs the script on every event",
+	Check: func(c *Config, ns *Namespace) []Finding {
+		var findings []Finding
+		for _, consumer := range ns.Consumers {
+			script, ok := consumer.(*wmi.ActiveScriptEventConsumer)
+			if !ok {
+				continue
+			}
+			source := "inline script"
+			if script.ScriptFileName != "" {
+				source = fmt.Sprintf("script file %q", script.ScriptFileName)
+			}
+			findings = append(findings, Finding{
+				Severity: SeverityHigh,
+				Path:     wmi.EventConsumerPath(consumer),
+				Message:  fmt.Sprintf("%s consumer runs %s", script.ScriptingEngine, source),
+			})
+		}
+		return findings
+	},
+}
+
+// RuleCommandLineConsumer reports `CommandLineEventConsumer`s.
+var RuleCommandLineConsumer = Rule{
+	ID:          "command-line-consumer",
+	Description: "CommandLineEventConsumer starts the process on every event",
+	Check: func(c *Config, ns *Namespace) []Finding {
+		var findings []Finding
+		for _, consumer := range ns.Consumers {
+			cmd, ok := consumer.(*wmi.CommandLineEventConsumer)
+			if !ok {
+				continue
+			}
+			findings = append(findings, Finding{
+				Severity: SeverityMedium,
+				Path:     wmi.EventConsumerPath(consumer),
+				Message:  fmt.Sprintf("consumer starts %q", commandLine(cmd)),
+			})
+		}
+		return findings
+	},
+}
+
+var (
+	powerShellRe = regexp.MustCompile(`(?i)\b(powershell|pwsh)(\.exe)?\b`)
+	// PowerShell accepts any prefix of -EncodedCommand, e.g. -enc or -e.
+	encodedArgRe    = regexp.MustCompile(`(?i)\s[-/]e[a-z]*\s+["']?[A-Za-z0-9+/]{20,}={0,2}`)
+	base64DecodeRe  = regexp.MustCompile(`(?i)FromBase64String`)
+	encodedCommands = []*regexp.Regexp{encodedArgRe, base64DecodeRe}
+)
+
+// RuleEncodedCommand reports the consumers running encoded PowerShell
+// commands or decoding base64 payloads.
+var RuleEncodedCommand = Rule{
+	ID:          "encoded-command",
+	Description: "consumer runs encoded PowerShell command or decodes base64 payload",
+	Check: func(c *Config, ns *Namespace) []Finding {
+		var findings []Finding
+		for _, consumer := range ns.Consumers {
+			var text string
+			switch consumer := consumer.(type) {
+			case *wmi.CommandLineEventConsumer:
+				text = commandLine(consumer)
+				if !powerShellRe.MatchString(text) && !base64DecodeRe.MatchString(text) {
+					continue
+				}
+			case *wmi.ActiveScriptEventConsumer:
+				text = consumer.ScriptText
+			default:
+				continue
+			}
+			for _, re := range encodedCommands {
+				if match := re.FindString(text); match != "" {
+					findings = append(findings, Finding{
+						Severity: SeverityCritical,
+						Path:     wmi.EventConsumerPath(consumer),
+						Message:  fmt.Sprintf("consumer runs encoded command %q", strings.TrimSpace(match)),
+					})
+					break
+				}
+			}
+		}
+		return findings
+	},
+}
+
+// RuleOrphanedBinding reports the bindings referring to the missing filters
+// or consumers of the standard classes. They are either leftovers or the
+// traces of the incomplete cleanup.
+var RuleOrphanedBinding = Rule{
+	ID:          "orphaned-binding",
+	Description: "binding refers to the missing filter or consumer",
+	Check: func(c *Config, ns *Namespace) []Finding {
+		var findings []Finding
+		for _, sub := range wmi.ResolvePermanentSubscriptions(ns.Filters, ns.Consumers, ns.Bindings) {
+			var missing []string
+			if sub.Filter == nil {
+				missing = append(missing, "filter "+sub.Binding.Filter)
+			}
+			if sub.Consumer == nil && isStandardConsumer(wmi.ObjectPathClass(sub.Binding.Consumer)) {
+				missing = append(missing, "consumer "+sub.Binding.Consumer)
+			}
+			if len(missing) == 0 {
+				continue
+			}
+			findings = append(findings, Finding{
+				Severity: SeverityLow,
+				Path:     sub.Binding.Path(),
+				Message:  "binding refers to the missing " + strings.Join(missing, " and "),
+			})
+		}
+		return findings
+	},
+}
+
+// RuleCustomConsumer reports the bindings to the consumers of the
+// non-standard classes. Such consumers are implemented by the third party
+// providers, so they should be reviewed manually.
+var RuleCustomConsumer = Rule{
+	ID:          "custom-consumer",
+	Description: "binding refers to the consumer of the non-standard class",
+	Check: func(c *Config, ns *Namespace) []Finding {
+		var findings []Finding
+		for _, b := range ns.Bindings {
+			if class := wmi.ObjectPathClass(b.Consumer); !isStandardConsumer(class) {
+				findings = append(findings, Finding{
+					Severity: SeverityMedium,
+					Path:     b.Path(),
+					Message:  fmt.Sprintf("binding delivers events to the %s consumer", class),
+				})
+			}
+		}
+		return findings
+	},
+}
+
+// RuleUnboundObject reports the filters and consumers not bound to each other.
+// They are harmless, but could be the part of the incomplete installation.
+var RuleUnboundObject = Rule{
+	ID:          "unbound-object",
+	Description: "filter or consumer isn't bound",
+	Check: func(c *Config, ns *Namespace) []Finding {
+		bound := make(map[string]bool)
+		for _, sub := range wmi.ResolvePermanentSubscriptions(ns.Filters, ns.Consumers, ns.Bindings) {
+			if sub.Filter != nil {
+				bound[sub.Filter.Path()] = true
+			}
+			if sub.Consumer != nil {
+				bound[wmi.EventConsumerPath(sub.Consumer)] = true
+			}
+		}
+
+		var findings []Finding
+		for _, f := range ns.Filters {
+			if !bound[f.Path()] {
+				findings = append(findings, Finding{
+					Severity: SeverityInfo,
+					Path:     f.Path(),
+					Message:  "filter isn't bound to any consumer",
+				})
+			}
+		}
+		for _, consumer := range ns.Consumers {
+			if !bound[wmi.EventConsumerPath(consumer)] {
+				findings = append(findings, Finding{
+					Severity: SeverityInfo,
+					Path:     wmi.EventConsumerPath(consumer),
+					Message:  "consumer isn't bound to any filter",
+				})
+			}
+		}
+		return findings
+	},
+}
+
+// RuleNonDefaultNamespace reports the objects registered out of the expected
+// namespaces (see `Config.Namespaces`), a common way to hide them from the
+// tools looking into `root\subscription` only.
+var RuleNonDefaultNamespace = Rule{
+	ID:          "non-default-namespace",
+	Description: "subscription object is registered in the non-default namespace",
+	Check: func(c *Config, ns *Namespace) []Finding {
+		if c.isDefaultNamespace(ns.Name) {
+			return nil
+		}
+		var findings []Finding
+		report := func(path string) {
+			findings = append(findings, Finding{
+				Severity: SeverityMedium,
+				Path:     path,
+				Message:  fmt.Sprintf("object is registered in %s namespace", ns.Name),
+			})
+		}
+		for _, f := range ns.Filters {
+			report(f.Path())
+		}
+		for _, consumer := range ns.Consumers {
+			report(wmi.EventConsumerPath(consumer))
+		}
+		for _, b := range ns.Bindings {
+			report(b.Path())
+		}
+		return findings
+	},
+}
+
+// RuleUnusualCreator reports the objects created by the users not listed in
+// `Config.CreatorSIDs`.
+var RuleUnusualCreator = Rule{
+	ID:          "unusual-creator",
+	Description: "subscription object is created by the unexpected user",
+	Check: func(c *Config, ns *Namespace) []Finding {
+		var findings []Finding
+		check := func(path string, creator []byte) {
+			if len(creator) == 0 {
+				findings = append(findings, Finding{
+					Severity: SeverityLow,
+					Path:     path,
+					Message:  "object has no creator SID",
+				})
+				return
+			}
+			sid, err := SIDString(creator)
+			switch {
+			case err != nil:
+				findings = append(findings, Finding{
+					Severity: SeverityLow,
+					Path:     path,
+					Message:  fmt.Sprintf("object has malformed creator SID; %s", err),
+				})
+			case !c.isAllowedCreator(sid):
+				findings = append(findings, Finding{
+					Severity: SeverityMedium,
+					Path:     path,
+					Message:  fmt.Sprintf("object is created by %s", sid),
+				})
+			}
+		}
+		for _, f := range ns.Filters {
+			check(f.Path(), f.CreatorSID)
+		}
+		for _, consumer := range ns.Consumers {
+			check(wmi.EventConsumerPath(consumer), consumerCreator(consumer))
+		}
+		for _, b := range ns.Bindings {
+			check(b.Path(), b.CreatorSID)
+		}
+		return findings
+	},
+}
+
+// commandLine returns the command line the consumer starts.
+func commandLine(c *wmi.CommandLineEventConsumer) string {
+	if c.CommandLineTemplate != "" {
+		return c.CommandLineTemplate
+	}
+	return c.ExecutablePath
+}
+
+// consumerCreator returns the CreatorSID of the standard consumer.
+func consumerCreator(c wmi.EventConsumer) []byte {
+	switch c := c.(type) {
+	case *wmi.CommandLineEventConsumer:
+		return c.CreatorSID
+	case *wmi.ActiveScriptEventConsumer:
+		return c.CreatorSID
+	case *wmi.LogFileEventConsumer:
+		return c.CreatorSID
+	case *wmi.NTEventLogEventConsumer:
+		return c.CreatorSID
+	case *wmi.SMTPEventConsumer:
+		return c.CreatorSID
+	}
+	return nil
+}
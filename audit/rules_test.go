@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/bi-zone/wmi"
+)
+
+func TestRuleEncodedCommand(t *testing.T) {
+	tests := []struct {
+		consumer wmi.EventConsumer
+		found    bool
+	}{
+		{&wmi.CommandLineEventConsumer{CommandLineTemplate: "powershell -e SQBFAFgAIAAoAE4AZQB3AC0ATwBiAGoA"}, true},
+		{&wmi.CommandLineEventConsumer{CommandLineTemplate: `pwsh.exe /EncodedCommand "SQBFAFgAIAAoAE4AZQB3AC0ATwBiAGoA"`}, true},
+		{&wmi.CommandLineEventConsumer{
+			CommandLineTemplate: `cmd /c powershell -c "[Convert]::FromBase64String('aGVsbG8=')"`,
+		}, true},
+		{&wmi.CommandLineEventConsumer{CommandLineTemplate: "powershell -ExecutionPolicy Bypass -File C:\\update.ps1"}, false},
+		{&wmi.CommandLineEventConsumer{ExecutablePath: `C:\Windows\System32\cscript.exe`}, false},
+		{&wmi.CommandLineEventConsumer{CommandLineTemplate: "tool.exe -enc SQBFAFgAIAAoAE4AZQB3AC0ATwBiAGoA"}, false},
+		{&wmi.ActiveScriptEventConsumer{
+			ScriptText: `CreateObject("WScript.Shell").Run "powershell -enc SQBFAFgAIAAoAE4AZQB3AC0ATwBiAGoA"`,
+		}, true},
+		{&wmi.LogFileEventConsumer{Text: "powershell -e SQBFAFgAIAAoAE4AZQB3AC0ATwBiAGoA"}, false},
+	}
+	for _, test := range tests {
+		ns := Namespace{Consumers: []wmi.EventConsumer{test.consumer}}
+		findings := RuleEncodedCommand.Check(&Config{}, &ns)
+		if found := len(findings) > 0; found != test.found {
+			t.Errorf("Unexpected findings %+v of %+v", findings, test.consumer)
+		}
+	}
+}
+
+func TestRuleCustomConsumer(t *testing.T) {
+	ns := Namespace{
+		Bindings: []wmi.FilterToConsumerBinding{
+			{Filter: `__EventFilter.Name="a"`, Consumer: `\\.\root\subscription:Vendor_Consumer.Name="a"`},
+			{Filter: `__EventFilter.Name="b"`, Consumer: `LogFileEventConsumer.Name="b"`},
+		},
+	}
+	findings := RuleCustomConsumer.Check(&Config{}, &ns)
+	if len(findings) != 1 || findings[0].Path != ns.Bindings[0].Path() {
+		t.Errorf("Unexpected findings %+v", findings)
+	}
+	// Custom consumers can't be resolved, but they aren't orphaned.
+	findings = RuleOrphanedBinding.Check(&Config{}, &ns)
+	if len(findings) != 2 || findings[0].Message != `binding refers to the missing filter __EventFilter.Name="a"` {
+		t.Errorf("Unexpected findings %+v", findings)
+	}
+}
+
+func TestRuleUnusualCreator(t *testing.T) {
+	ns := Namespace{
+		Filters: []wmi.EventFilter{
+			{Name: "system", CreatorSID: []byte{1, 1, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0}},
+			{Name: "malformed", CreatorSID: []byte{1, 2, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0}},
+			{Name: "none"},
+		},
+	}
+	findings := RuleUnusualCreator.Check(&Config{CreatorSIDs: DefaultCreatorSIDs}, &ns)
+	if len(findings) != 2 {
+		t.Fatalf("Unexpected findings %+v", findings)
+	}
+	for _, f := range findings {
+		if f.Severity != SeverityLow {
+			t.Errorf("Unexpected finding %+v", f)
+		}
+	}
+}
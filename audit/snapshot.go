@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bi-zone/wmi"
+)
+
+// MarshalJSON encodes the namespace. Consumers are encoded with the "Class"
+// property holding the consumer class.
+func (ns Namespace) MarshalJSON() ([]byte, error) {
+	type plain Namespace
+	consumers := make([]consumerJSON, len(ns.Consumers))
+	for i, c := range ns.Consumers {
+		consumers[i] = consumerJSON{c}
+	}
+	return json.Marshal(struct {
+		plain
+		Consumers []consumerJSON
+	}{plain(ns), consumers})
+}
+
+// UnmarshalJSON decodes the namespace encoded by MarshalJSON.
+func (ns *Namespace) UnmarshalJSON(data []byte) error {
+	type plain Namespace
+	var raw struct {
+		*plain
+		Consumers []consumerJSON
+	}
+	raw.plain = (*plain)(ns)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	ns.Consumers = make([]wmi.EventConsumer, len(raw.Consumers))
+	for i, c := range raw.Consumers {
+		ns.Consumers[i] = c.EventConsumer
+	}
+	return nil
+}
+
+// consumerJSON is the JSON representation of the consumer.
+type consumerJSON struct {
+	wmi.EventConsumer
+}
+
+func (c consumerJSON) MarshalJSON() ([]byte, error) {
+	props, err := json.Marshal(c.EventConsumer)
+	if err != nil {
+		return nil, err
+	}
+	class, err := json.Marshal(c.ConsumerClass())
+	if err != nil {
+		return nil, err
+	}
+	// Props are never empty as every consumer has Name.
+	res := append([]byte(`{"Class":`), class...)
+	res = append(res, ',')
+	return append(res, props[1:]...), nil
+}
+
+func (c *consumerJSON) UnmarshalJSON(data []byte) error {
+	var header struct {
+		Class string
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	consumer, err := newConsumer(header.Class)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, consumer); err != nil {
+		return err
+	}
+	c.EventConsumer = consumer
+	return nil
+}
+
+// newConsumer returns the pointer to the new consumer of the @class.
+func newConsumer(class string) (wmi.EventConsumer, error) {
+	consumers := []wmi.EventConsumer{
+		&wmi.CommandLineEventConsumer{},
+		&wmi.ActiveScriptEventConsumer{},
+		&wmi.LogFileEventConsumer{},
+		&wmi.NTEventLogEventConsumer{},
+		&wmi.SMTPEventConsumer{},
+	}
+	for _, c := range consumers {
+		if strings.EqualFold(c.ConsumerClass(), class) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("audit: unknown consumer class %q", class)
+}
+
+// isStandardConsumer reports whether the @class is one of the standard
+// consumer classes.
+func isStandardConsumer(class string) bool {
+	_, err := newConsumer(class)
+	return err == nil
+}
+
+// SIDString returns the string form (e.g. "S-1-5-18") of the binary
+// security identifier @sid.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/secauthz/sid-components
+func SIDString(sid []byte) (string, error) {
+	if len(sid) < 8 {
+		return "", errors.New("audit: SID is too short")
+	}
+	revision, count := sid[0], int(sid[1])
+	if len(sid) != 8+4*count {
+		return "", fmt.Errorf("audit: invalid SID length %d for %d sub-authorities", len(sid), count)
+	}
+	var authority uint64
+	for _, b := range sid[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+
+	var b strings.Builder
+	b.WriteString("S-")
+	b.WriteString(strconv.Itoa(int(revision)))
+	b.WriteByte('-')
+	if authority >= 1<<32 {
+		b.WriteString(fmt.Sprintf("0x%012X", authority))
+	} else {
+		b.WriteString(strconv.FormatUint(authority, 10))
+	}
+	for i := 0; i < count; i++ {
+		b.WriteByte('-')
+		b.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(sid[8+4*i:])), 10))
+	}
+	return b.String(), nil
+}
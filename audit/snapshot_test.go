@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bi-zone/wmi"
+)
+
+func TestNamespace_JSON(t *testing.T) {
+	ns := Namespace{
+		Name:    `root\subscription`,
+		Filters: []wmi.EventFilter{{Name: "f", Query: "SELECT * FROM __InstanceCreationEvent", CreatorSID: []byte{1}}},
+		Consumers: []wmi.EventConsumer{
+			&wmi.CommandLineEventConsumer{Name: "cmd", CommandLineTemplate: "cmd.exe"},
+			&wmi.SMTPEventConsumer{Name: "smtp", HeaderFields: []string{"X-Test: 1"}},
+		},
+		Bindings: []wmi.FilterToConsumerBinding{{Filter: `__EventFilter.Name="f"`, Consumer: `Vendor.Name="c"`}},
+	}
+	data, err := json.Marshal(ns)
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	var decoded Namespace
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, ns) {
+		t.Errorf("Unexpected decoded namespace %+v from %s", decoded, data)
+	}
+
+	invalid := `{"Name": "root", "Consumers": [{"Class": "Vendor_Consumer", "Name": "c"}]}`
+	if err := json.Unmarshal([]byte(invalid), &decoded); err == nil {
+		t.Errorf("Unknown consumer class is accepted")
+	}
+}
+
+func TestSIDString(t *testing.T) {
+	tests := []struct {
+		sid []byte
+		str string
+	}{
+		{[]byte{1, 1, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0}, "S-1-5-18"},
+		{[]byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0, 32, 2, 0, 0}, "S-1-5-32-544"},
+		{[]byte{1, 0, 0, 0, 0, 0, 0, 1}, "S-1-1"},
+		{[]byte{1, 0, 1, 0, 0, 0, 0, 0}, "S-1-0x010000000000"},
+	}
+	for _, test := range tests {
+		if s, err := SIDString(test.sid); err != nil || s != test.str {
+			t.Errorf("Unexpected SID %q; %v; expected %q", s, err, test.str)
+		}
+	}
+	for _, sid := range [][]byte{nil, {1, 1, 0, 0, 0, 0, 0, 5}} {
+		if _, err := SIDString(sid); err == nil {
+			t.Errorf("Invalid SID %v is accepted", sid)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package wmi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CIMType is a type of the WMI property, method parameter or qualifier.
+//
+// CIMType is marshalled to the text (and JSON) as a MOF type name, e.g.
+// "uint32" or "datetime".
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/wbemcli/ne-wbemcli-cimtype_enumeration
+type CIMType int
+
+// Supported CIM types. Values are the same as in `CIMTYPE_ENUMERATION`.
+const (
+	CIMTypeSint16    CIMType = 2
+	CIMTypeSint32    CIMType = 3
+	CIMTypeReal32    CIMType = 4
+	CIMTypeReal64    CIMType = 5
+	CIMTypeString    CIMType = 8
+	CIMTypeBoolean   CIMType = 11
+	CIMTypeObject    CIMType = 13
+	CIMTypeSint8     CIMType = 16
+	CIMTypeUint8     CIMType = 17
+	CIMTypeUint16    CIMType = 18
+	CIMTypeUint32    CIMType = 19
+	CIMTypeSint64    CIMType = 20
+	CIMTypeUint64    CIMType = 21
+	CIMTypeDateTime  CIMType = 101
+	CIMTypeReference CIMType = 102
+	CIMTypeChar16    CIMType = 103
+)
+
+var cimTypeNames = map[CIMType]string{
+	CIMTypeSint8:     "sint8",
+	CIMTypeUint8:     "uint8",
+	CIMTypeSint16:    "sint16",
+	CIMTypeUint16:    "uint16",
+	CIMTypeSint32:    "sint32",
+	CIMTypeUint32:    "uint32",
+	CIMTypeSint64:    "sint64",
+	CIMTypeUint64:    "uint64",
+	CIMTypeReal32:    "real32",
+	CIMTypeReal64:    "real64",
+	CIMTypeBoolean:   "boolean",
+	CIMTypeString:    "string",
+	CIMTypeDateTime:  "datetime",
+	CIMTypeReference: "ref",
+	CIMTypeChar16:    "char16",
+	CIMTypeObject:    "object",
+}
+
+// ParseCIMType returns CIMType by its MOF name (case insensitive).
+func ParseCIMType(name string) (CIMType, error) {
+	for t, n := range cimTypeNames {
+		if strings.EqualFold(n, name) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("wmi: unknown CIM type %q", name)
+}
+
+func (t CIMType) String() string {
+	if name, ok := cimTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("CIMType(%d)", int(t))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t CIMType) MarshalText() ([]byte, error) {
+	if _, ok := cimTypeNames[t]; !ok {
+		return nil, fmt.Errorf("wmi: unknown CIM type %d", int(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *CIMType) UnmarshalText(text []byte) error {
+	v, err := ParseCIMType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+// Qualifier is a WMI qualifier of a class, property or a method.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemqualifier
+type Qualifier struct {
+	Name  string
+	Value interface{}
+
+	IsAmended            bool `json:",omitempty"`
+	IsLocal              bool `json:",omitempty"`
+	IsOverridable        bool `json:",omitempty"`
+	PropagatesToInstance bool `json:",omitempty"`
+	PropagatesToSubclass bool `json:",omitempty"`
+}
+
+// Qualifiers is a set of qualifiers. Qualifier names are case insensitive.
+type Qualifiers []Qualifier
+
+// Get returns a qualifier by its @name.
+func (q Qualifiers) Get(name string) (Qualifier, bool) {
+	for _, v := range q {
+		if strings.EqualFold(v.Name, name) {
+			return v, true
+		}
+	}
+	return Qualifier{}, false
+}
+
+// Bool returns true if the boolean qualifier @name is set to true.
+func (q Qualifiers) Bool(name string) bool {
+	v, ok := q.Get(name)
+	if !ok {
+		return false
+	}
+	b, _ := v.Value.(bool)
+	return b
+}
+
+// String returns a value of the string qualifier @name or an empty string.
+func (q Qualifiers) String(name string) string {
+	v, ok := q.Get(name)
+	if !ok {
+		return ""
+	}
+	s, _ := v.Value.(string)
+	return s
+}
+
+// Strings returns a value of the string array qualifier @name.
+func (q Qualifiers) Strings(name string) []string {
+	v, ok := q.Get(name)
+	if !ok {
+		return nil
+	}
+	switch val := v.Value.(type) {
+	case []string:
+		return val
+	case []interface{}: // Typical for values decoded from JSON.
+		res := make([]string, 0, len(val))
+		for _, e := range val {
+			res = append(res, fmt.Sprint(e))
+		}
+		return res
+	case string:
+		return []string{val}
+	}
+	return nil
+}
+
+// PropertyDefinition describes a property of the class or a method parameter.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemproperty
+type PropertyDefinition struct {
+	Name    string
+	CIMType CIMType
+	IsArray bool `json:",omitempty"`
+
+	// Origin is a name of the class where the property has been introduced.
+	Origin string `json:",omitempty"`
+
+	// Value is a default value of the property (if any).
+	Value interface{} `json:",omitempty"`
+
+	Qualifiers Qualifiers `json:",omitempty"`
+}
+
+// IsKey returns true if the property is a key of the class.
+func (p PropertyDefinition) IsKey() bool {
+	return p.Qualifiers.Bool("key")
+}
+
+// Description returns property "Description" qualifier.
+// N.B. Usually it's available only with amended qualifiers.
+func (p PropertyDefinition) Description() string {
+	return p.Qualifiers.String("Description")
+}
+
+// Units returns property "Units" qualifier.
+func (p PropertyDefinition) Units() string {
+	return p.Qualifiers.String("Units")
+}
+
+// ValueMap returns property "ValueMap" qualifier. Elements of ValueMap
+// correspond to the elements of `Values`.
+func (p PropertyDefinition) ValueMap() []string {
+	return p.Qualifiers.Strings("ValueMap")
+}
+
+// Values returns property "Values" qualifier holding descriptions of the
+// property values.
+func (p PropertyDefinition) Values() []string {
+	return p.Qualifiers.Strings("Values")
+}
+
+// RefClass returns a class name of the reference or embedded object
+// property if it's defined in the "CIMTYPE" qualifier, e.g. "Win32_Account"
+// for "ref:Win32_Account" property.
+func (p PropertyDefinition) RefClass() string {
+	cimType := p.Qualifiers.String("CIMTYPE")
+	if idx := strings.Index(cimType, ":"); idx != -1 {
+		return cimType[idx+1:]
+	}
+	return p.Qualifiers.String("EmbeddedInstance")
+}
+
+// MethodDefinition describes a method of the class.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemmethod
+type MethodDefinition struct {
+	Name string
+
+	// Origin is a name of the class where the method has been introduced.
+	Origin string `json:",omitempty"`
+
+	// InParameters and OutParameters are ordered by the "ID" qualifier.
+	// OutParameters include "ReturnValue" if the method returns something.
+	InParameters  []PropertyDefinition `json:",omitempty"`
+	OutParameters []PropertyDefinition `json:",omitempty"`
+
+	Qualifiers Qualifiers `json:",omitempty"`
+}
+
+// Description returns method "Description" qualifier.
+func (m MethodDefinition) Description() string {
+	return m.Qualifiers.String("Description")
+}
+
+// IsStatic returns true if the method should be called on the class instead
+// of the class instance.
+func (m MethodDefinition) IsStatic() bool {
+	return m.Qualifiers.Bool("Static")
+}
+
+// ReturnValue returns the "ReturnValue" out parameter if the method has one.
+func (m MethodDefinition) ReturnValue() (PropertyDefinition, bool) {
+	for _, p := range m.OutParameters {
+		if strings.EqualFold(p.Name, "ReturnValue") {
+			return p, true
+		}
+	}
+	return PropertyDefinition{}, false
+}
+
+// ClassDefinition describes a WMI class: its properties, methods, qualifiers
+// and inheritance.
+//
+// ClassDefinition could be obtained using `SWbemServicesConnection.Get` with
+// a class name as a path or with `SWbemServicesConnection.GetClassDefinition`
+// to retrieve amended (localized) qualifiers as well. ClassDefinition is
+// serializable to JSON.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemobject
+type ClassDefinition struct {
+	Name      string
+	Namespace string `json:",omitempty"`
+	Server    string `json:",omitempty"`
+
+	// Superclass is a name of the immediate parent class.
+	Superclass string `json:",omitempty"`
+	// Derivation is a superclass chain from the immediate parent up to the
+	// root class.
+	Derivation []string `json:",omitempty"`
+
+	Qualifiers Qualifiers           `json:",omitempty"`
+	Properties []PropertyDefinition `json:",omitempty"`
+	Methods    []MethodDefinition   `json:",omitempty"`
+}
+
+// Property returns the class property by its @name.
+func (c ClassDefinition) Property(name string) (PropertyDefinition, bool) {
+	for _, p := range c.Properties {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return PropertyDefinition{}, false
+}
+
+// Method returns the class method by its @name.
+func (c ClassDefinition) Method(name string) (MethodDefinition, bool) {
+	for _, m := range c.Methods {
+		if strings.EqualFold(m.Name, name) {
+			return m, true
+		}
+	}
+	return MethodDefinition{}, false
+}
+
+// Keys returns names of the class key properties.
+func (c ClassDefinition) Keys() []string {
+	var keys []string
+	for _, p := range c.Properties {
+		if p.IsKey() {
+			keys = append(keys, p.Name)
+		}
+	}
+	return keys
+}
+
+// Description returns class "Description" qualifier.
+func (c ClassDefinition) Description() string {
+	return c.Qualifiers.String("Description")
+}
+
+// IsAbstract returns true if the class is abstract.
+func (c ClassDefinition) IsAbstract() bool {
+	return c.Qualifiers.Bool("abstract")
+}
+
+// IsAssociation returns true if the class is an association class.
+func (c ClassDefinition) IsAssociation() bool {
+	return c.Qualifiers.Bool("Association")
+}
+
+// sortParameters orders method parameters by their "ID" qualifier. Params
+// without ID (e.g. ReturnValue) go first.
+func sortParameters(params []PropertyDefinition) {
+	id := func(p PropertyDefinition) int64 {
+		q, ok := p.Qualifiers.Get("ID")
+		if !ok {
+			return -1
+		}
+		switch v := q.Value.(type) {
+		case int32:
+			return int64(v)
+		case float64: // Typical for values decoded from JSON.
+			return int64(v)
+		}
+		return -1
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		return id(params[i]) < id(params[j])
+	})
+}
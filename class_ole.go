@@ -0,0 +1,264 @@
+// +build windows
+
+package wmi
+
+import (
+	"fmt"
+
+	"github.com/bi-zone/go-ole"
+	"github.com/bi-zone/go-ole/oleutil"
+	"github.com/hashicorp/go-multierror"
+)
+
+// GetClassDefinition retrieves a definition of the @className class. If
+// @amended is set, amended (localized) qualifiers like "Description" or
+// "Values" are retrieved as well.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemservices-get
+func (s *SWbemServicesConnection) GetClassDefinition(className string, amended bool) (c *ClassDefinition, err error) {
+	s.Lock()
+	if s.sWbemServices == nil {
+		s.Unlock()
+		return nil, ErrConnectionClosed
+	}
+	s.Unlock()
+
+	//  Be aware of reflections and COM usage.
+	defer func() {
+		if r := recover(); r != nil {
+			err = multierror.Append(err, fmt.Errorf("runtime panic; %v", r))
+		}
+	}()
+
+	flags := 0
+	if amended {
+		flags = wbemFlagUseAmendedQualifiers
+	}
+	services, err := s.acquireServices()
+	if err != nil {
+		return nil, err
+	}
+	defer services.Release()
+
+	resultRaw, err := oleutil.CallMethod(services, "Get", className, flags)
+	if err != nil {
+		return nil, newWbemError("SWbemServices Get", err)
+	}
+	defer func() {
+		if clErr := resultRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	var class ClassDefinition
+	if err := class.UnmarshalOLE(s.Decoder, resultRaw.ToIDispatch()); err != nil {
+		return nil, err
+	}
+	return &class, nil
+}
+
+// UnmarshalOLE implements `wmi.Unmarshaler` for the SWbemObject holding a
+// class definition.
+func (c *ClassDefinition) UnmarshalOLE(d Decoder, src *ole.IDispatch) (err error) {
+	var system struct {
+		Path struct {
+			Class     string
+			Namespace string
+			Server    string
+		} `wmi:"Path_"`
+		Derivation []string `wmi:"Derivation_"`
+	}
+	if err := d.Unmarshal(src, &system); err != nil {
+		return err
+	}
+
+	res := ClassDefinition{
+		Name:       system.Path.Class,
+		Namespace:  system.Path.Namespace,
+		Server:     system.Path.Server,
+		Derivation: system.Derivation,
+	}
+	if len(system.Derivation) > 0 {
+		res.Superclass = system.Derivation[0]
+	}
+	if res.Qualifiers, err = unmarshalQualifiers(d, src); err != nil {
+		return fmt.Errorf("failed to unmarshal class qualifiers; %w", err)
+	}
+	if res.Properties, err = unmarshalProperties(d, src); err != nil {
+		return fmt.Errorf("failed to unmarshal class properties; %w", err)
+	}
+	if res.Methods, err = unmarshalMethods(d, src); err != nil {
+		return fmt.Errorf("failed to unmarshal class methods; %w", err)
+	}
+	*c = res
+	return nil
+}
+
+func unmarshalQualifiers(d Decoder, src *ole.IDispatch) (res Qualifiers, err error) {
+	err = forEachItem(src, "Qualifiers_", func(item *ole.IDispatch) error {
+		var q struct {
+			Name                 string
+			IsAmended            bool
+			IsLocal              bool
+			IsOverridable        bool
+			PropagatesToInstance bool
+			PropagatesToSubclass bool
+		}
+		if err := d.Unmarshal(item, &q); err != nil {
+			return err
+		}
+		value, err := oleValue(item, "Value")
+		if err != nil {
+			return err
+		}
+		res = append(res, Qualifier{
+			Name:                 q.Name,
+			Value:                value,
+			IsAmended:            q.IsAmended,
+			IsLocal:              q.IsLocal,
+			IsOverridable:        q.IsOverridable,
+			PropagatesToInstance: q.PropagatesToInstance,
+			PropagatesToSubclass: q.PropagatesToSubclass,
+		})
+		return nil
+	})
+	return res, err
+}
+
+func unmarshalProperties(d Decoder, src *ole.IDispatch) (res []PropertyDefinition, err error) {
+	err = forEachItem(src, "Properties_", func(item *ole.IDispatch) error {
+		var p struct {
+			Name    string
+			CIMType CIMType
+			IsArray bool
+			Origin  string
+		}
+		if err := d.Unmarshal(item, &p); err != nil {
+			return err
+		}
+		value, err := oleValue(item, "Value")
+		if err != nil {
+			return err
+		}
+		qualifiers, err := unmarshalQualifiers(d, item)
+		if err != nil {
+			return err
+		}
+		res = append(res, PropertyDefinition{
+			Name:       p.Name,
+			CIMType:    p.CIMType,
+			IsArray:    p.IsArray,
+			Origin:     p.Origin,
+			Value:      value,
+			Qualifiers: qualifiers,
+		})
+		return nil
+	})
+	return res, err
+}
+
+func unmarshalMethods(d Decoder, src *ole.IDispatch) (res []MethodDefinition, err error) {
+	err = forEachItem(src, "Methods_", func(item *ole.IDispatch) error {
+		var m struct {
+			Name   string
+			Origin string
+		}
+		if err := d.Unmarshal(item, &m); err != nil {
+			return err
+		}
+		method := MethodDefinition{
+			Name:   m.Name,
+			Origin: m.Origin,
+		}
+		var err error
+		if method.Qualifiers, err = unmarshalQualifiers(d, item); err != nil {
+			return err
+		}
+		if method.InParameters, err = unmarshalParameters(d, item, "InParameters"); err != nil {
+			return err
+		}
+		if method.OutParameters, err = unmarshalParameters(d, item, "OutParameters"); err != nil {
+			return err
+		}
+		res = append(res, method)
+		return nil
+	})
+	return res, err
+}
+
+// unmarshalParameters unmarshals properties of the __PARAMETERS object stored
+// in the @prop property of SWbemMethod @src.
+func unmarshalParameters(d Decoder, src *ole.IDispatch, prop string) (res []PropertyDefinition, err error) {
+	paramsRaw, err := oleutil.GetProperty(src, prop)
+	if err != nil {
+		return nil, newWbemError("GetProperty "+prop, err)
+	}
+	defer func() {
+		if clErr := paramsRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+	if paramsRaw.VT != ole.VT_DISPATCH {
+		return nil, nil // Method has no such parameters.
+	}
+
+	res, err = unmarshalProperties(d, paramsRaw.ToIDispatch())
+	if err != nil {
+		return nil, err
+	}
+	sortParameters(res)
+	return res, nil
+}
+
+// forEachItem calls @f for every item of the @collection property of the @src
+// object (e.g. "Properties_" of the SWbemObject).
+func forEachItem(src *ole.IDispatch, collection string, f func(item *ole.IDispatch) error) (err error) {
+	collectionRaw, err := oleutil.GetProperty(src, collection)
+	if err != nil {
+		return newWbemError("GetProperty "+collection, err)
+	}
+	defer func() {
+		if clErr := collectionRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+	if collectionRaw.VT != ole.VT_DISPATCH {
+		return fmt.Errorf("%s is not a collection; got %s", collection, collectionRaw.VT)
+	}
+
+	return oleutil.ForEach(collectionRaw.ToIDispatch(), func(v *ole.VARIANT) (err error) {
+		defer func() {
+			if clErr := v.Clear(); clErr != nil {
+				err = multierror.Append(err, clErr)
+			}
+		}()
+		return f(v.ToIDispatch())
+	})
+}
+
+// oleValue returns a Go value of the @prop property of the @src object.
+// Arrays are returned as []interface{}, objects are not supported and
+// returned as nil.
+func oleValue(src *ole.IDispatch, prop string) (val interface{}, err error) {
+	v, err := oleutil.GetProperty(src, prop)
+	if err != nil {
+		return nil, newWbemError("GetProperty "+prop, err)
+	}
+	defer func() {
+		if clErr := v.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	switch {
+	case v.VT&ole.VT_ARRAY != 0:
+		safeArray := v.ToArray()
+		if safeArray == nil {
+			return nil, nil
+		}
+		return safeArray.ToValueArray(), nil
+	case v.VT == ole.VT_DISPATCH || v.VT == ole.VT_UNKNOWN:
+		return nil, nil
+	}
+	return v.Value(), nil
+}
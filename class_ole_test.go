@@ -0,0 +1,63 @@
+// +build windows
+
+package wmi
+
+import (
+	"testing"
+)
+
+func TestSWbemServicesConnection_GetClassDefinition(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	class, err := s.GetClassDefinition("Win32_Process", true)
+	if err != nil {
+		t.Fatalf("Failed to get Win32_Process definition; %s", err)
+	}
+	if class.Name != "Win32_Process" || class.Superclass != "CIM_Process" {
+		t.Errorf("Got unexpected class; got %q: %q", class.Name, class.Superclass)
+	}
+	if len(class.Derivation) < 2 {
+		t.Errorf("Got unexpected Derivation; %v", class.Derivation)
+	}
+	if keys := class.Keys(); len(keys) != 1 || keys[0] != "Handle" {
+		t.Errorf("Got unexpected keys; %v", keys)
+	}
+	if class.Description() == "" {
+		t.Errorf("Amended class Description is empty")
+	}
+
+	pid, ok := class.Property("ProcessId")
+	if !ok {
+		t.Fatalf("Failed to find ProcessId property")
+	}
+	if pid.CIMType != CIMTypeUint32 || pid.IsArray {
+		t.Errorf("Got unexpected ProcessId type; %s, array: %v", pid.CIMType, pid.IsArray)
+	}
+
+	create, ok := class.Method("Create")
+	if !ok {
+		t.Fatalf("Failed to find Create method")
+	}
+	if !create.IsStatic() {
+		t.Errorf("Win32_Process.Create isn't static")
+	}
+	if len(create.InParameters) == 0 || create.InParameters[0].Name != "CommandLine" {
+		t.Errorf("Got unexpected Create in parameters; %+v", create.InParameters)
+	}
+	if _, ok := create.ReturnValue(); !ok {
+		t.Errorf("Failed to find Create ReturnValue")
+	}
+
+	// Get with class path should work as well but without amended qualifiers.
+	var notAmended ClassDefinition
+	if err := s.Get("Win32_Process", &notAmended); err != nil {
+		t.Fatalf("Failed to Get Win32_Process definition; %s", err)
+	}
+	if len(notAmended.Properties) != len(class.Properties) {
+		t.Errorf("Got different properties count; got %d, expected %d", len(notAmended.Properties), len(class.Properties))
+	}
+}
@@ -0,0 +1,147 @@
+package wmi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCIMType_Text(t *testing.T) {
+	for cimType, name := range cimTypeNames {
+		text, err := cimType.MarshalText()
+		if err != nil {
+			t.Errorf("Failed to marshal %d; %s", cimType, err)
+			continue
+		}
+		if string(text) != name {
+			t.Errorf("Unexpected CIMType text; got %q, expected %q", text, name)
+		}
+		var parsed CIMType
+		if err := parsed.UnmarshalText([]byte(name)); err != nil || parsed != cimType {
+			t.Errorf("Failed to parse %q; got %d, %v", name, parsed, err)
+		}
+	}
+	if _, err := ParseCIMType("uint128"); err == nil {
+		t.Errorf("Successfully parsed unknown CIM type")
+	}
+	if _, err := CIMType(42).MarshalText(); err == nil {
+		t.Errorf("Successfully marshalled unknown CIM type")
+	}
+}
+
+var testClass = ClassDefinition{
+	Name:       "Win32_Service",
+	Namespace:  `root\cimv2`,
+	Superclass: "Win32_BaseService",
+	Derivation: []string{"Win32_BaseService", "CIM_Service", "CIM_LogicalElement", "CIM_ManagedSystemElement"},
+	Qualifiers: Qualifiers{
+		{Name: "dynamic", Value: true},
+		{Name: "Description", Value: "The Win32_Service class represents a service.", IsAmended: true},
+	},
+	Properties: []PropertyDefinition{
+		{
+			Name:    "Name",
+			CIMType: CIMTypeString,
+			Origin:  "CIM_ManagedSystemElement",
+			Qualifiers: Qualifiers{
+				{Name: "key", Value: true},
+				{Name: "CIMTYPE", Value: "string"},
+			},
+		},
+		{
+			Name:    "ErrorControl",
+			CIMType: CIMTypeString,
+			Qualifiers: Qualifiers{
+				{Name: "ValueMap", Value: []string{"Ignore", "Normal"}},
+				{Name: "Values", Value: []interface{}{"Ignore", "Normal"}},
+			},
+		},
+		{
+			Name:    "InstallDate",
+			CIMType: CIMTypeDateTime,
+		},
+	},
+	Methods: []MethodDefinition{
+		{
+			Name: "ChangeStartMode",
+			InParameters: []PropertyDefinition{
+				{Name: "StartMode", CIMType: CIMTypeString, Qualifiers: Qualifiers{{Name: "ID", Value: int32(0)}}},
+			},
+			OutParameters: []PropertyDefinition{
+				{Name: "ReturnValue", CIMType: CIMTypeUint32},
+			},
+		},
+	},
+}
+
+func TestClassDefinition_JSON(t *testing.T) {
+	data, err := json.Marshal(testClass)
+	if err != nil {
+		t.Fatalf("Failed to marshal ClassDefinition; %s", err)
+	}
+	var got ClassDefinition
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Failed to unmarshal ClassDefinition; %s", err)
+	}
+
+	if got.Name != testClass.Name || got.Superclass != testClass.Superclass {
+		t.Errorf("Got unexpected class; got %q: %q", got.Name, got.Superclass)
+	}
+	if !reflect.DeepEqual(got.Derivation, testClass.Derivation) {
+		t.Errorf("Got unexpected Derivation; got %v", got.Derivation)
+	}
+	if keys := got.Keys(); !reflect.DeepEqual(keys, []string{"Name"}) {
+		t.Errorf("Got unexpected keys; got %v", keys)
+	}
+	prop, ok := got.Property("installdate")
+	if !ok || prop.CIMType != CIMTypeDateTime {
+		t.Errorf("Got unexpected InstallDate property; %+v", prop)
+	}
+	prop, _ = got.Property("ErrorControl")
+	if !reflect.DeepEqual(prop.ValueMap(), prop.Values()) || len(prop.Values()) != 2 {
+		t.Errorf("Got unexpected ValueMap/Values; got %v, %v", prop.ValueMap(), prop.Values())
+	}
+	method, ok := got.Method("ChangeStartMode")
+	if !ok {
+		t.Fatalf("Failed to find ChangeStartMode method")
+	}
+	if ret, ok := method.ReturnValue(); !ok || ret.CIMType != CIMTypeUint32 {
+		t.Errorf("Got unexpected ReturnValue; %+v", ret)
+	}
+	if got.Description() != testClass.Description() {
+		t.Errorf("Got unexpected Description; %q", got.Description())
+	}
+}
+
+func TestPropertyDefinition_RefClass(t *testing.T) {
+	cases := []struct {
+		prop     PropertyDefinition
+		expected string
+	}{
+		{PropertyDefinition{Qualifiers: Qualifiers{{Name: "CIMTYPE", Value: "ref:Win32_Account"}}}, "Win32_Account"},
+		{PropertyDefinition{Qualifiers: Qualifiers{{Name: "CIMTYPE", Value: "object:__EventFilter"}}}, "__EventFilter"},
+		{PropertyDefinition{Qualifiers: Qualifiers{{Name: "EmbeddedInstance", Value: "MSFT_Foo"}}}, "MSFT_Foo"},
+		{PropertyDefinition{Qualifiers: Qualifiers{{Name: "CIMTYPE", Value: "object"}}}, ""},
+	}
+	for _, c := range cases {
+		if got := c.prop.RefClass(); got != c.expected {
+			t.Errorf("Unexpected RefClass; got %q, expected %q", got, c.expected)
+		}
+	}
+}
+
+func TestSortParameters(t *testing.T) {
+	params := []PropertyDefinition{
+		{Name: "B", Qualifiers: Qualifiers{{Name: "ID", Value: int32(1)}}},
+		{Name: "A", Qualifiers: Qualifiers{{Name: "ID", Value: float64(0)}}},
+		{Name: "ReturnValue"},
+	}
+	sortParameters(params)
+	var names []string
+	for _, p := range params {
+		names = append(names, p.Name)
+	}
+	if expected := []string{"ReturnValue", "A", "B"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Unexpected parameters order; got %v, expected %v", names, expected)
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/bi-zone/wmi"
+)
+
+// generator renders Go code for the set of WMI class definitions.
+type generator struct {
+	pkg     string
+	methods bool
+
+	// classes holds all known definitions by lower case class name. It's used
+	// to resolve superclasses and embedded object types.
+	classes map[string]*wmi.ClassDefinition
+	// selected holds lower case names of the generated classes. pending are
+	// the classes of the embedded objects which are added to the output.
+	selected map[string]bool
+	pending  []string
+
+	buf     bytes.Buffer
+	imports map[string]bool
+	consts  map[string]bool
+}
+
+func newGenerator(pkg string, classes []wmi.ClassDefinition, methods bool) *generator {
+	g := &generator{
+		pkg:     pkg,
+		methods: methods,
+		classes: make(map[string]*wmi.ClassDefinition, len(classes)),
+		imports: make(map[string]bool),
+		consts:  make(map[string]bool),
+	}
+	for i := range classes {
+		g.classes[strings.ToLower(classes[i].Name)] = &classes[i]
+	}
+	return g
+}
+
+// Generate returns formatted Go source for the @names classes (in the given
+// order). The classes of the embedded objects are generated after them.
+func (g *generator) Generate(names []string) ([]byte, error) {
+	g.selected = make(map[string]bool, len(names))
+	g.pending = nil
+	for _, name := range names {
+		if _, ok := g.classes[strings.ToLower(name)]; !ok {
+			return nil, fmt.Errorf("unknown class %q", name)
+		}
+	}
+
+	var body bytes.Buffer
+	for _, name := range names {
+		if key := strings.ToLower(name); !g.selected[key] {
+			g.selected[key] = true
+			g.pending = append(g.pending, name)
+		}
+	}
+	for i := 0; i < len(g.pending); i++ {
+		class := g.classes[strings.ToLower(g.pending[i])]
+		g.buf.Reset()
+		g.genClass(class)
+		body.Write(g.buf.Bytes())
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by wmigen. DO NOT EDIT.\n\n")
+	if g.imports["github.com/bi-zone/wmi"] {
+		// Method wrappers are usable only on windows.
+		src.WriteString("// +build windows\n\n")
+	}
+	fmt.Fprintf(&src, "package %s\n\n", g.pkg)
+	if len(g.imports) > 0 {
+		// Standard library imports go first.
+		var std, other []string
+		for imp := range g.imports {
+			if strings.Contains(imp, ".") {
+				other = append(other, strconv.Quote(imp))
+			} else {
+				std = append(std, strconv.Quote(imp))
+			}
+		}
+		sort.Strings(std)
+		sort.Strings(other)
+		src.WriteString("import (\n")
+		src.WriteString(strings.Join(std, "\n"))
+		if len(std) > 0 && len(other) > 0 {
+			src.WriteString("\n\n")
+		}
+		src.WriteString(strings.Join(other, "\n"))
+		src.WriteString("\n)\n\n")
+	}
+	src.Write(body.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code; %s", err)
+	}
+	return formatted, nil
+}
+
+func (g *generator) genClass(class *wmi.ClassDefinition) {
+	typeName := goName(class.Name)
+	properties := g.allProperties(class)
+
+	doc := fmt.Sprintf("%s represents WMI class %s.", typeName, class.Name)
+	if d := class.Description(); d != "" {
+		doc += "\n\n" + d
+	}
+	g.comment("", doc)
+	fmt.Fprintf(&g.buf, "type %s struct {\n", typeName)
+	g.genFields(properties, false)
+	g.buf.WriteString("}\n\n")
+
+	for _, p := range properties {
+		g.genEnum(typeName+"_"+goName(p.Name), class.Name+"."+p.Name, p)
+	}
+	if g.methods {
+		for _, m := range g.allMethods(class) {
+			g.genMethod(class, typeName, m)
+		}
+	}
+}
+
+func (g *generator) genFields(properties []wmi.PropertyDefinition, params bool) {
+	first, prevDoc := true, false
+	for _, p := range properties {
+		if strings.HasPrefix(p.Name, "__") {
+			continue // Skip system properties.
+		}
+
+		goType, ok := g.goType(p, params)
+		doc := p.Description()
+		if units := p.Units(); units != "" {
+			doc = strings.TrimSpace(doc + "\nUnits: " + units + ".")
+		}
+		if !ok {
+			doc = fmt.Sprintf("%s of type %s is not supported by the decoder.", p.Name, cimTypeName(p))
+		}
+
+		// Separate documented fields with empty lines.
+		if !first && (doc != "" || prevDoc) {
+			g.buf.WriteString("\n")
+		}
+		first, prevDoc = false, doc != ""
+		g.comment("\t", doc)
+		if ok {
+			fmt.Fprintf(&g.buf, "%s %s `wmi:%q`\n", goName(p.Name), goType, p.Name)
+		}
+	}
+}
+
+func (g *generator) genMethod(class *wmi.ClassDefinition, typeName string, m wmi.MethodDefinition) {
+	name := typeName + "_" + goName(m.Name)
+	g.imports["github.com/bi-zone/wmi"] = true
+
+	inType, outType := "nil", "nil"
+	if len(m.InParameters) > 0 {
+		inType = name + "In"
+		g.comment("", fmt.Sprintf("%s holds in parameters of %s.%s method.", inType, class.Name, m.Name))
+		fmt.Fprintf(&g.buf, "type %s struct {\n", inType)
+		g.genFields(m.InParameters, true)
+		g.buf.WriteString("}\n\n")
+	}
+	if len(m.OutParameters) > 0 {
+		outType = name + "Out"
+		g.comment("", fmt.Sprintf("%s holds out parameters of %s.%s method.", outType, class.Name, m.Name))
+		fmt.Fprintf(&g.buf, "type %s struct {\n", outType)
+		g.genFields(m.OutParameters, false)
+		g.buf.WriteString("}\n\n")
+		for _, p := range m.OutParameters {
+			g.genEnum(outType+"_"+goName(p.Name), class.Name+"."+m.Name+" "+p.Name, p)
+		}
+	}
+
+	doc := fmt.Sprintf("%s executes %s.%s method", name, class.Name, m.Name)
+	args := []string{"conn *wmi.SWbemServicesConnection"}
+	path := strconv.Quote(class.Name)
+	if m.IsStatic() {
+		doc += "."
+	} else {
+		doc += " of the instance specified by @objectPath."
+		args = append(args, "objectPath string")
+		path = "objectPath"
+	}
+	if d := m.Description(); d != "" {
+		doc += "\n\n" + d
+	}
+	g.comment("", doc)
+
+	inArg := "nil"
+	if inType != "nil" {
+		args = append(args, "in "+inType)
+		inArg = "in"
+	}
+	if outType == "nil" {
+		fmt.Fprintf(&g.buf, "func %s(%s) error {\n", name, strings.Join(args, ", "))
+		fmt.Fprintf(&g.buf, "return conn.ExecMethod(%s, %q, %s, nil)\n}\n\n", path, m.Name, inArg)
+		return
+	}
+	fmt.Fprintf(&g.buf, "func %s(%s) (out %s, err error) {\n", name, strings.Join(args, ", "), outType)
+	fmt.Fprintf(&g.buf, "err = conn.ExecMethod(%s, %q, %s, &out)\nreturn out, err\n}\n\n", path, m.Name, inArg)
+}
+
+// genEnum generates constants from the ValueMap/Values qualifiers of the
+// property @p. @owner is a human-readable name of the property owner.
+func (g *generator) genEnum(prefix, owner string, p wmi.PropertyDefinition) {
+	valueMap, values := p.ValueMap(), p.Values()
+	if len(valueMap) == 0 && len(values) == 0 {
+		return
+	}
+
+	isString := p.CIMType == wmi.CIMTypeString
+	if !isString && !isInteger(p.CIMType) {
+		return
+	}
+	if len(valueMap) == 0 { // Values are indexes of Values elements.
+		if isString {
+			return
+		}
+		for i := range values {
+			valueMap = append(valueMap, strconv.Itoa(i))
+		}
+	}
+
+	var lines []string
+	for i, v := range valueMap {
+		var literal string
+		if isString {
+			literal = strconv.Quote(v)
+		} else {
+			if _, err := strconv.ParseInt(v, 0, 64); err != nil {
+				continue // Ranges like "7..32767" or "..".
+			}
+			literal = v
+		}
+
+		label := v
+		if len(values) == len(valueMap) {
+			label = values[i]
+		}
+		ident := goName(label)
+		if ident == "" || unicode.IsDigit(rune(ident[0])) {
+			ident = "Value" + ident
+		}
+		name := prefix + "_" + ident
+		if g.consts[name] {
+			continue // Duplicated label.
+		}
+		g.consts[name] = true
+		lines = append(lines, fmt.Sprintf("%s = %s // %s", name, literal, label))
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Fprintf(&g.buf, "// Values of %s.\nconst (\n", owner)
+	g.buf.WriteString(strings.Join(lines, "\n"))
+	g.buf.WriteString("\n)\n\n")
+}
+
+// allProperties returns class properties including the properties of the
+// superclasses missing in the definition (e.g. for definitions from MOF).
+func (g *generator) allProperties(class *wmi.ClassDefinition) []wmi.PropertyDefinition {
+	var chain []*wmi.ClassDefinition
+	seen := make(map[string]bool)
+	for c := class; c != nil && !seen[strings.ToLower(c.Name)]; c = g.classes[strings.ToLower(c.Superclass)] {
+		seen[strings.ToLower(c.Name)] = true
+		chain = append(chain, c)
+	}
+
+	var res []wmi.PropertyDefinition
+	idx := make(map[string]int)
+	for i := len(chain) - 1; i >= 0; i-- { // From the root to the class itself.
+		for _, p := range chain[i].Properties {
+			key := strings.ToLower(p.Name)
+			if j, ok := idx[key]; ok {
+				res[j] = mergeProperty(res[j], p) // Overridden property.
+				continue
+			}
+			idx[key] = len(res)
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// allMethods returns class methods including methods of the superclasses.
+func (g *generator) allMethods(class *wmi.ClassDefinition) []wmi.MethodDefinition {
+	var res []wmi.MethodDefinition
+	seen := make(map[string]bool)
+	for c := class; c != nil; c = g.classes[strings.ToLower(c.Superclass)] {
+		if seen["class "+strings.ToLower(c.Name)] {
+			break
+		}
+		seen["class "+strings.ToLower(c.Name)] = true
+		for _, m := range c.Methods {
+			if key := strings.ToLower(m.Name); !seen[key] {
+				seen[key] = true
+				res = append(res, m)
+			}
+		}
+	}
+	return res
+}
+
+// mergeProperty applies an override @p to the @base property keeping base
+// qualifiers missing in the override.
+func mergeProperty(base, p wmi.PropertyDefinition) wmi.PropertyDefinition {
+	qualifiers := append(wmi.Qualifiers(nil), p.Qualifiers...)
+	for _, q := range base.Qualifiers {
+		if _, ok := p.Qualifiers.Get(q.Name); !ok {
+			qualifiers = append(qualifiers, q)
+		}
+	}
+	p.Qualifiers = qualifiers
+	return p
+}
+
+// goType returns Go type for the property @p. Nullable properties are
+// represented with pointers. For method in parameters (@params) optional
+// parameters are pointers, so they aren't passed if not set.
+func (g *generator) goType(p wmi.PropertyDefinition, params bool) (string, bool) {
+	var base string
+	switch p.CIMType {
+	case wmi.CIMTypeSint8:
+		base = "int8"
+	case wmi.CIMTypeUint8:
+		base = "uint8"
+	case wmi.CIMTypeSint16:
+		base = "int16"
+	case wmi.CIMTypeUint16, wmi.CIMTypeChar16:
+		base = "uint16"
+	case wmi.CIMTypeSint32:
+		base = "int32"
+	case wmi.CIMTypeUint32:
+		base = "uint32"
+	case wmi.CIMTypeSint64:
+		base = "int64"
+	case wmi.CIMTypeUint64:
+		base = "uint64"
+	case wmi.CIMTypeReal32:
+		base = "float32"
+	case wmi.CIMTypeReal64:
+		base = "float64"
+	case wmi.CIMTypeBoolean:
+		base = "bool"
+	case wmi.CIMTypeString, wmi.CIMTypeReference:
+		base = "string" // References are kept as object paths.
+	case wmi.CIMTypeDateTime:
+		if isInterval(p) {
+			base = "string" // Intervals can't be represented as time.Time.
+		} else {
+			base = "time.Time"
+			g.imports["time"] = true
+		}
+	case wmi.CIMTypeObject:
+		embedded, ok := g.classes[strings.ToLower(p.RefClass())]
+		if !ok || p.IsArray {
+			return "", false
+		}
+		if key := strings.ToLower(embedded.Name); !g.selected[key] {
+			g.selected[key] = true
+			g.pending = append(g.pending, embedded.Name)
+		}
+		base = goName(embedded.Name)
+	default:
+		return "", false
+	}
+
+	switch {
+	case p.IsArray:
+		return "[]" + base, true
+	case strings.EqualFold(p.Name, "ReturnValue"):
+		return base, true
+	case params && !p.Qualifiers.Bool("Required"):
+		return "*" + base, true
+	case isNullable(p):
+		return "*" + base, true
+	}
+	return base, true
+}
+
+func isNullable(p wmi.PropertyDefinition) bool {
+	return !(p.IsKey() || p.Qualifiers.Bool("Required") || p.Qualifiers.Bool("not_null"))
+}
+
+func isInterval(p wmi.PropertyDefinition) bool {
+	return p.Qualifiers.Bool("Interval") || strings.EqualFold(p.Qualifiers.String("SubType"), "interval")
+}
+
+func isInteger(t wmi.CIMType) bool {
+	switch t {
+	case wmi.CIMTypeSint8, wmi.CIMTypeUint8, wmi.CIMTypeSint16, wmi.CIMTypeUint16,
+		wmi.CIMTypeSint32, wmi.CIMTypeUint32, wmi.CIMTypeSint64, wmi.CIMTypeUint64:
+		return true
+	}
+	return false
+}
+
+func cimTypeName(p wmi.PropertyDefinition) string {
+	name := p.CIMType.String()
+	if p.IsArray {
+		name += "[]"
+	}
+	return name
+}
+
+// goName converts WMI name into exported Go identifier, e.g.
+// "__EventFilter" -> "EventFilter", "Not Applicable" -> "NotApplicable".
+// Underscores inside the name are kept as is, so "Win32_Process" is left
+// untouched.
+func goName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range strings.TrimLeft(name, "_") {
+		switch {
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			if upper {
+				r = unicode.ToUpper(r)
+				upper = false
+			}
+			b.WriteRune(r)
+		default:
+			upper = true
+		}
+	}
+	return b.String()
+}
+
+// comment writes @text as a Go comment wrapped at 77 chars.
+func (g *generator) comment(indent, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	for i, paragraph := range strings.Split(text, "\n\n") {
+		if i > 0 {
+			fmt.Fprintf(&g.buf, "%s//\n", indent)
+		}
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if line != "" && len(line)+1+len(word) > 77 {
+				fmt.Fprintf(&g.buf, "%s// %s\n", indent, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		if line != "" {
+			fmt.Fprintf(&g.buf, "%s// %s\n", indent, line)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bi-zone/wmi"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerator_Golden(t *testing.T) {
+	classes, err := readDefinitions("testdata/classes.json")
+	if err != nil {
+		t.Fatalf("Failed to read definitions; %s", err)
+	}
+
+	src, err := newGenerator("sample", classes, true).Generate([]string{"Win32_Process", "Win32_ProcessStartup"})
+	if err != nil {
+		t.Fatalf("Failed to generate; %s", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments); err != nil {
+		t.Fatalf("Generated code doesn't parse; %s", err)
+	}
+
+	const golden = "testdata/classes.golden"
+	if *update {
+		if err := ioutil.WriteFile(golden, src, 0644); err != nil {
+			t.Fatalf("Failed to update golden file; %s", err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file; %s", err)
+	}
+	if !bytes.Equal(src, expected) {
+		t.Errorf("Generated code differs from %s; run `go test -update` and review the diff:\n%s", golden, src)
+	}
+}
+
+func TestGenerator_UnknownClass(t *testing.T) {
+	_, err := newGenerator("sample", nil, true).Generate([]string{"Win32_Process"})
+	if err == nil {
+		t.Errorf("Successfully generated unknown class")
+	}
+}
+
+func TestGenerator_NoMethods(t *testing.T) {
+	classes, err := readDefinitions("testdata/classes.json")
+	if err != nil {
+		t.Fatalf("Failed to read definitions; %s", err)
+	}
+	src, err := newGenerator("sample", classes, false).Generate([]string{"Win32_Process"})
+	if err != nil {
+		t.Fatalf("Failed to generate; %s", err)
+	}
+	if bytes.Contains(src, []byte("ExecMethod")) || bytes.Contains(src, []byte("+build windows")) {
+		t.Errorf("Got method wrappers with methods generation disabled:\n%s", src)
+	}
+}
+
+func TestGenerator_EmbeddedClass(t *testing.T) {
+	classes := []wmi.ClassDefinition{
+		{
+			Name: "Test_Outer",
+			Properties: []wmi.PropertyDefinition{
+				{Name: "Inner", CIMType: wmi.CIMTypeObject, Qualifiers: wmi.Qualifiers{{Name: "CIMTYPE", Value: "object:Test_Inner"}}},
+			},
+		},
+		{
+			Name: "Test_Inner",
+			Properties: []wmi.PropertyDefinition{
+				{Name: "Name", CIMType: wmi.CIMTypeString},
+			},
+		},
+	}
+	src, err := newGenerator("sample", classes, true).Generate([]string{"Test_Outer"})
+	if err != nil {
+		t.Fatalf("Failed to generate; %s", err)
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		t.Fatalf("Generated code doesn't parse; %s", err)
+	}
+	if _, err := (&types.Config{}).Check("sample", fset, []*ast.File{file}, nil); err != nil {
+		t.Errorf("Generated code doesn't compile; %s\n%s", err, src)
+	}
+	if bytes.Count(src, []byte("type Test_Inner struct")) != 1 {
+		t.Errorf("Embedded class isn't generated once:\n%s", src)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	cases := map[string]string{
+		"Win32_Process":             "Win32_Process",
+		"__EventFilter":             "EventFilter",
+		"Not Applicable":            "NotApplicable",
+		"dwFlags":                   "DwFlags",
+		"Power Save - Low Power":    "PowerSaveLowPower",
+		"Successful Completion (0)": "SuccessfulCompletion0",
+	}
+	for in, expected := range cases {
+		if got := goName(in); got != expected {
+			t.Errorf("Unexpected Go name for %q; got %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+func TestReadDefinitions_MOF(t *testing.T) {
+	classes, err := readDefinitions("testdata/classes.mof")
+	if err != nil {
+		t.Fatalf("Failed to read definitions; %s", err)
+	}
+	if len(classes) != 2 {
+		t.Fatalf("Unexpected classes count %d", len(classes))
+	}
+	item := classes[1]
+	if item.Name != "Test_Item" || item.Superclass != "Test_Base" || item.Namespace != `root\test` || item.Server != "." {
+		t.Errorf("Unexpected class header %+v", item)
+	}
+	parent, ok := item.Property("Parent")
+	if !ok || parent.CIMType != wmi.CIMTypeReference || parent.RefClass() != "Test_Base" {
+		t.Errorf("Unexpected Parent property %+v", parent)
+	}
+	create, ok := item.Method("Create")
+	if !ok || len(create.InParameters) != 1 || len(create.OutParameters) != 2 {
+		t.Fatalf("Unexpected Create method %+v", create)
+	}
+	if ret, ok := create.ReturnValue(); !ok || ret.CIMType != wmi.CIMTypeUint32 {
+		t.Errorf("Unexpected ReturnValue %+v", ret)
+	}
+
+	src, err := newGenerator("sample", classes, true).Generate([]string{"Test_Item"})
+	if err != nil {
+		t.Fatalf("Failed to generate; %s", err)
+	}
+	for _, s := range []string{"Name  string  `wmi:\"Name\"`", "Test_Item_State_Running = 1", "func Test_Item_Create("} {
+		if !bytes.Contains(src, []byte(s)) {
+			t.Errorf("Generated code doesn't contain %q:\n%s", s, src)
+		}
+	}
+}
+
+func TestReadDefinitions_Errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wmigen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"broken.mof":  "class Broken { uint32 Missing Semicolon };",
+		"broken.json": `{"Name": `,
+		"schema.xml":  "<class/>",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readDefinitions(path); err == nil {
+			t.Errorf("Invalid %s is read without errors", name)
+		}
+	}
+	if _, err := readDefinitions(filepath.Join(dir, "missing.mof")); err == nil {
+		t.Errorf("Missing file is read without errors")
+	}
+}
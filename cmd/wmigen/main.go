@@ -0,0 +1,133 @@
+/*
+Command wmigen generates Go structures for WMI classes to be used with the
+github.com/bi-zone/wmi package.
+
+Class definitions are read from JSON schema dumps (a single
+`wmi.ClassDefinition` or an array of them, e.g. obtained with
+`SWbemServicesConnection.GetClassDefinition` and encoding/json) or from MOF
+files (class declarations only, see github.com/bi-zone/wmi/mof), so the tool
+doesn't require Windows to run. The format is detected by the file extension.
+
+For every class wmigen generates:
+  - a structure with `wmi` tags and Go types matching property CIM types;
+    nullable properties are represented with pointers;
+  - doc comments from the "Description" and "Units" qualifiers (use amended
+    qualifiers on dump to get them);
+  - constants from the "ValueMap"/"Values" qualifiers;
+  - method wrappers calling `SWbemServicesConnection.ExecMethod` (optional).
+
+Classes of the embedded object properties are generated too, even if they
+aren't listed in the -class flag.
+
+Usage:
+	wmigen [flags] schema.json|schema.mof...
+
+Flags:
+	-pkg      package name of the generated file (default "main")
+	-o        output file (default stdout)
+	-class    comma separated list of classes to generate (default all)
+	-methods  generate method wrappers (default true)
+
+Example:
+	//go:generate wmigen -pkg sys -class Win32_Process,Win32_Service -o classes.go schema.json
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bi-zone/wmi"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("wmigen: ")
+
+	pkg := flag.String("pkg", "main", "package name of the generated file")
+	out := flag.String("o", "", "output file (default stdout)")
+	classList := flag.String("class", "", "comma separated list of classes to generate (default all)")
+	methods := flag.Bool("methods", true, "generate method wrappers")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: wmigen [flags] schema.json|schema.mof...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var classes []wmi.ClassDefinition
+	for _, path := range flag.Args() {
+		defs, err := readDefinitions(path)
+		if err != nil {
+			log.Fatalf("failed to read %s; %s", path, err)
+		}
+		classes = append(classes, defs...)
+	}
+
+	var names []string
+	if *classList != "" {
+		for _, name := range strings.Split(*classList, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	} else {
+		for _, c := range classes {
+			names = append(names, c.Name)
+		}
+	}
+
+	src, err := newGenerator(*pkg, classes, *methods).Generate(names)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = ioutil.WriteFile(*out, src, 0644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readDefinitions reads class definitions from the file. File format is
+// detected by the extension.
+func readDefinitions(path string) ([]wmi.ClassDefinition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return parseJSON(data)
+	case ".mof":
+		return parseMOF(path, data)
+	}
+	return nil, fmt.Errorf("unknown file format %q", filepath.Ext(path))
+}
+
+// parseJSON parses either a single class definition or an array of them.
+func parseJSON(data []byte) ([]wmi.ClassDefinition, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var classes []wmi.ClassDefinition
+		err := json.Unmarshal(data, &classes)
+		return classes, err
+	}
+	var class wmi.ClassDefinition
+	if err := json.Unmarshal(data, &class); err != nil {
+		return nil, err
+	}
+	return []wmi.ClassDefinition{class}, nil
+}
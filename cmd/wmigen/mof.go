@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bi-zone/wmi"
+	"github.com/bi-zone/wmi/mof"
+)
+
+// parseMOF parses class declarations from the MOF source. Instance
+// declarations are ignored.
+func parseMOF(filename string, data []byte) ([]wmi.ClassDefinition, error) {
+	f, err := mof.Parse(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	classes := make([]wmi.ClassDefinition, 0, len(f.Classes))
+	for _, c := range f.Classes {
+		class, err := convertClass(c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", c.Pos, err)
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
+
+// convertClass converts MOF class declaration to the class definition as if
+// it was obtained from WMI.
+func convertClass(c *mof.Class) (wmi.ClassDefinition, error) {
+	class := wmi.ClassDefinition{
+		Name:       c.Name,
+		Superclass: c.Superclass,
+		Qualifiers: convertQualifiers(c.Qualifiers),
+	}
+	class.Server, class.Namespace = splitNamespace(c.Namespace)
+
+	for _, p := range c.Properties {
+		prop, err := convertProperty(p)
+		if err != nil {
+			return class, err
+		}
+		prop.Origin = c.Name
+		class.Properties = append(class.Properties, prop)
+	}
+
+	for _, m := range c.Methods {
+		method := wmi.MethodDefinition{
+			Name:       m.Name,
+			Origin:     c.Name,
+			Qualifiers: convertQualifiers(m.Qualifiers),
+		}
+		for i, p := range m.Parameters {
+			param, err := convertProperty(p)
+			if err != nil {
+				return class, fmt.Errorf("method %s: %v", m.Name, err)
+			}
+			if _, ok := param.Qualifiers.Get("ID"); !ok {
+				param.Qualifiers = append(param.Qualifiers, wmi.Qualifier{Name: "ID", Value: int32(i)})
+			}
+			isIn, isOut := param.Qualifiers.Bool("In"), param.Qualifiers.Bool("Out")
+			if isIn || !isOut {
+				method.InParameters = append(method.InParameters, param)
+			}
+			if isOut {
+				method.OutParameters = append(method.OutParameters, param)
+			}
+		}
+		if m.ReturnType != "void" {
+			ret, err := convertProperty(&mof.Property{Name: "ReturnValue", Type: m.ReturnType, ClassName: m.ReturnClassName})
+			if err != nil {
+				return class, fmt.Errorf("method %s: %v", m.Name, err)
+			}
+			ret.Qualifiers = append(ret.Qualifiers, wmi.Qualifier{Name: "out", Value: true})
+			method.OutParameters = append(method.OutParameters, ret)
+		}
+		class.Methods = append(class.Methods, method)
+	}
+	return class, nil
+}
+
+// convertProperty converts property or parameter declaration. As WMI does,
+// it adds "CIMTYPE" qualifier holding the referenced or embedded class name.
+func convertProperty(p *mof.Property) (wmi.PropertyDefinition, error) {
+	cimType, err := wmi.ParseCIMType(p.Type)
+	if err != nil {
+		return wmi.PropertyDefinition{}, fmt.Errorf("property %s: %v", p.Name, err)
+	}
+	prop := wmi.PropertyDefinition{
+		Name:       p.Name,
+		CIMType:    cimType,
+		IsArray:    p.IsArray,
+		Qualifiers: convertQualifiers(p.Qualifiers),
+	}
+	if p.Default != nil && p.Default.Kind != mof.InstanceValue {
+		prop.Value = p.Default.Interface()
+	}
+
+	typeName := p.Type
+	if p.ClassName != "" {
+		typeName += ":" + p.ClassName
+	}
+	if _, ok := prop.Qualifiers.Get("CIMTYPE"); !ok {
+		prop.Qualifiers = append(prop.Qualifiers, wmi.Qualifier{Name: "CIMTYPE", Value: typeName})
+	}
+	return prop, nil
+}
+
+func convertQualifiers(list []*mof.Qualifier) wmi.Qualifiers {
+	var res wmi.Qualifiers
+	for _, q := range list {
+		qualifier := wmi.Qualifier{
+			Name:                 q.Name,
+			Value:                q.Value.Interface(),
+			IsOverridable:        true,
+			PropagatesToSubclass: true,
+		}
+		for _, flavor := range q.Flavors {
+			switch strings.ToLower(flavor) {
+			case "amended":
+				qualifier.IsAmended = true
+			case "disableoverride":
+				qualifier.IsOverridable = false
+			case "toinstance":
+				qualifier.PropagatesToInstance = true
+			case "restricted":
+				qualifier.PropagatesToSubclass = false
+			}
+		}
+		res = append(res, qualifier)
+	}
+	return res
+}
+
+// splitNamespace splits `\\server\root\cimv2` into the server name and the
+// namespace path.
+func splitNamespace(path string) (server, namespace string) {
+	if !strings.HasPrefix(path, `\\`) {
+		return "", path
+	}
+	path = path[2:]
+	if idx := strings.Index(path, `\`); idx != -1 {
+		return path[:idx], path[idx+1:]
+	}
+	return path, ""
+}
@@ -3,6 +3,7 @@
 package wmi
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -28,7 +29,19 @@ type SWbemServicesConnection struct {
 	sync.Mutex
 	Decoder
 
-	sWbemServices *ole.IDispatch
+	// RetryPolicy is an optional policy of retrying `Query`, `Get` and
+	// `ExecMethod` calls failed with transient errors. If nil, calls are not
+	// retried.
+	RetryPolicy *RetryPolicy
+
+	// Observer is an optional observer of the connection calls. Calls are
+	// counted in `Stats` regardless of it.
+	Observer Observer
+
+	sWbemServices     *ole.IDispatch
+	connectServerArgs []interface{}
+	security          SecurityOptions
+	stats             statsRecorder
 }
 
 // ConnectSWbemServices creates SWbemServices connection to the server defined
@@ -54,6 +67,16 @@ func ConnectSWbemServices(connectServerArgs ...interface{}) (conn *SWbemServices
 //
 // Ref: https://docs.microsoft.com/en-us/windows/desktop/wmisdk/swbemlocator-connectserver
 func (s *SWbemServices) ConnectServer(args ...interface{}) (c *SWbemServicesConnection, err error) {
+	return s.connectServer(s.Decoder, s.Observer, args...)
+}
+
+// connectServer is like ConnectServer but the connection is created with the
+// @decoder and @observer instead of the SWbemServices ones.
+func (s *SWbemServices) connectServer(
+	decoder Decoder,
+	observer Observer,
+	args ...interface{},
+) (c *SWbemServicesConnection, err error) {
 	//  Be aware of reflections and COM usage.
 	defer func() {
 		if r := recover(); r != nil {
@@ -70,9 +93,13 @@ func (s *SWbemServices) ConnectServer(args ...interface{}) (c *SWbemServicesConn
 		}
 	}()
 
+	host, namespace := connectTarget(args)
+	done := observe(observer, CallInfo{Operation: OpConnect, Host: host, Namespace: namespace})
 	serviceRaw, err := oleutil.CallMethod(s.sWbemLocator, "ConnectServer", args...)
+	err = newWbemError("SWbemServices ConnectServer", err)
+	done(0, err)
 	if err != nil {
-		return nil, fmt.Errorf("SWbemServices ConnectServer error; %v", err)
+		return nil, err
 	}
 	service := serviceRaw.ToIDispatch()
 	if service == nil {
@@ -84,13 +111,93 @@ func (s *SWbemServices) ConnectServer(args ...interface{}) (c *SWbemServicesConn
 	// so we have no need to care about of serviceRaw and moreover call clear on it.
 
 	conn := &SWbemServicesConnection{
-		Decoder:       s.Decoder,
-		sWbemServices: service,
+		Decoder:           decoder,
+		Observer:          observer,
+		sWbemServices:     service,
+		connectServerArgs: args,
 	}
 	conn.Decoder.Dereferencer = conn
 	return conn, nil
 }
 
+// reconnect replaces the connection SWbemServices object with a new one
+// connected using the same arguments. Calls in progress keep using the old
+// object until they return (see `acquireServices`).
+func (s *SWbemServicesConnection) reconnect() error {
+	done := s.observe(OpConnect, "")
+	conn, err := ConnectSWbemServices(s.connectServerArgs...)
+	done(0, err)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetSecurity(s.Security()); err != nil {
+		return multierror.Append(err, conn.Close())
+	}
+
+	s.Lock()
+	if s.sWbemServices != nil {
+		// Take over the new object leaving the single comshim reference.
+		s.sWbemServices.Release()
+		s.sWbemServices, conn.sWbemServices = conn.sWbemServices, nil
+		comshim.Done()
+	}
+	s.Unlock()
+
+	if conn.sWbemServices != nil { // Connection has been closed meanwhile.
+		_ = conn.Close()
+		return ErrConnectionClosed
+	}
+	return nil
+}
+
+// Security returns the security settings set with `SetSecurity`.
+func (s *SWbemServicesConnection) Security() SecurityOptions {
+	s.Lock()
+	defer s.Unlock()
+	return s.security
+}
+
+// Stats returns the counters of the connection calls.
+func (s *SWbemServicesConnection) Stats() Stats {
+	return s.stats.snapshot()
+}
+
+// observe notifies the connection observers about the @op call start and
+// returns the function to be invoked with the call results.
+func (s *SWbemServicesConnection) observe(op Operation, query string) func(objects int, err error) {
+	return observe(MultiObserver(&s.stats, s.Observer), s.callInfo(op, query))
+}
+
+// callInfo returns the info of the @op call on the connection.
+func (s *SWbemServicesConnection) callInfo(op Operation, query string) CallInfo {
+	host, namespace := connectTarget(s.connectServerArgs)
+	return CallInfo{
+		Operation: op,
+		Host:      host,
+		Namespace: namespace,
+		Query:     query,
+	}
+}
+
+// decode unmarshals @item returned by the @query (or object path) into @dst
+// notifying the observers.
+func (s *SWbemServicesConnection) decode(query string, item *ole.IDispatch, dst interface{}) error {
+	done := s.observe(OpDecode, query)
+	err := s.Unmarshal(item, dst)
+	done(1, err)
+	return err
+}
+
+// do invokes @f using the connection retry policy. Privilege errors are
+// reported as `PrivilegeError`.
+func (s *SWbemServicesConnection) do(f func() error) error {
+	err := s.RetryPolicy.do(context.Background(), f, s.reconnect)
+	if privileges := s.Security().Privileges; len(privileges) > 0 && errors.Is(err, ErrPrivilegeNotHeld) {
+		return &PrivilegeError{Privileges: privileges, Err: err}
+	}
+	return err
+}
+
 // Close will clear and release all of the SWbemServicesConnection resources.
 func (s *SWbemServicesConnection) Close() error {
 	s.Lock()
@@ -104,6 +211,19 @@ func (s *SWbemServicesConnection) Close() error {
 	return nil
 }
 
+// acquireServices returns the SWbemServices object referenced for the call,
+// so it isn't released by the concurrent `reconnect` or `Close`. The caller
+// should release it.
+func (s *SWbemServicesConnection) acquireServices() (*ole.IDispatch, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.sWbemServices == nil {
+		return nil, ErrConnectionClosed
+	}
+	s.sWbemServices.AddRef()
+	return s.sWbemServices, nil
+}
+
 // Query runs the WQL query using a SWbemServicesConnection instance and appends
 // the values to dst.
 //
@@ -113,6 +233,12 @@ func (s *SWbemServicesConnection) Close() error {
 //
 // Ref: https://docs.microsoft.com/en-us/windows/desktop/wmisdk/swbemservices-execquery
 func (s *SWbemServicesConnection) Query(query string, dst interface{}) error {
+	return s.QueryWithOptions(query, dst, nil)
+}
+
+// QueryWithOptions is the same as `Query` but passes @opts to the
+// `SWbemServices.ExecQuery` call.
+func (s *SWbemServicesConnection) QueryWithOptions(query string, dst interface{}, opts *QueryOptions) error {
 	s.Lock()
 	if s.sWbemServices == nil {
 		s.Unlock()
@@ -120,21 +246,12 @@ func (s *SWbemServicesConnection) Query(query string, dst interface{}) error {
 	}
 	s.Unlock()
 
-	sliceRefl := reflect.ValueOf(dst) // TODO: Double argument check?
-	if sliceRefl.Kind() != reflect.Ptr || sliceRefl.IsNil() {
-		return ErrInvalidEntityType
-	}
-	sliceRefl = sliceRefl.Elem() // "Dereference" pointer.
-
-	argType, elemType := checkMultiArg(sliceRefl)
-	if argType == multiArgTypeInvalid {
-		return ErrInvalidEntityType
+	qDst, err := newQueryDst(dst)
+	if err != nil {
+		return err
 	}
-
-	return s.query(query, &queryDst{
-		dst:         sliceRefl,
-		dsArgType:   argType,
-		dstElemType: elemType,
+	return s.do(func() error {
+		return s.query(query, qDst, opts)
 	})
 }
 
@@ -146,7 +263,13 @@ func (s *SWbemServicesConnection) Query(query string, dst interface{}) error {
 //
 // Get method reference:
 // https://docs.microsoft.com/en-us/windows/desktop/wmisdk/swbemservices-get
-func (s *SWbemServicesConnection) Get(path string, dst interface{}) (err error) {
+func (s *SWbemServicesConnection) Get(path string, dst interface{}) error {
+	return s.GetWithOptions(path, dst, nil)
+}
+
+// GetWithOptions is the same as `Get` but passes @opts to the
+// `SWbemServices.Get` call.
+func (s *SWbemServicesConnection) GetWithOptions(path string, dst interface{}, opts *QueryOptions) error {
 	s.Lock()
 	if s.sWbemServices == nil {
 		s.Unlock()
@@ -154,6 +277,12 @@ func (s *SWbemServicesConnection) Get(path string, dst interface{}) (err error)
 	}
 	s.Unlock()
 
+	return s.do(func() error {
+		return s.get(path, dst, opts)
+	})
+}
+
+func (s *SWbemServicesConnection) get(path string, dst interface{}, opts *QueryOptions) (err error) {
 	//  Be aware of reflections and COM usage.
 	defer func() {
 		if r := recover(); r != nil {
@@ -166,7 +295,7 @@ func (s *SWbemServicesConnection) Get(path string, dst interface{}) (err error)
 		return fmt.Errorf("dst should be a pointer to struct")
 	}
 
-	resultRaw, err := s.dereference(path)
+	resultRaw, err := s.getObject(path, opts)
 	if err != nil {
 		return err
 	}
@@ -177,7 +306,7 @@ func (s *SWbemServicesConnection) Get(path string, dst interface{}) (err error)
 		}
 	}()
 
-	return s.Unmarshal(result, dst)
+	return s.decode(path, result, dst)
 }
 
 // Dereference performs `SWbemServices.Get` on the given path, but returns the
@@ -201,7 +330,202 @@ func (s *SWbemServicesConnection) Dereference(referencePath string) (v *ole.VARI
 }
 
 func (s *SWbemServicesConnection) dereference(referencePath string) (v *ole.VARIANT, err error) {
-	return oleutil.CallMethod(s.sWbemServices, "Get", referencePath)
+	services, err := s.acquireServices()
+	if err != nil {
+		return nil, err
+	}
+	defer services.Release()
+
+	done := s.observe(OpGet, referencePath)
+	v, err = oleutil.CallMethod(services, "Get", referencePath)
+	err = newWbemError("SWbemServices Get", err)
+	done(0, err)
+	return v, err
+}
+
+// getObject performs `SWbemServices.Get` on the given path with @opts.
+func (s *SWbemServicesConnection) getObject(path string, opts *QueryOptions) (v *ole.VARIANT, err error) {
+	if opts == nil {
+		return s.dereference(path)
+	}
+	params, release, err := contextParams(opts, path, opts.getFlags(0))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	services, err := s.acquireServices()
+	if err != nil {
+		return nil, err
+	}
+	defer services.Release()
+
+	done := s.observe(OpGet, path)
+	v, err = oleutil.CallMethod(services, "Get", params...)
+	err = newWbemError("SWbemServices Get", err)
+	done(0, err)
+	return v, err
+}
+
+// PutFlag specifies the behaviour of `SWbemServicesConnection.Put` call.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemobject-put-
+type PutFlag int
+
+const (
+	// PutCreateOrUpdate creates the instance if it does not exist or
+	// overwrites it otherwise (WBEM_FLAG_CREATE_OR_UPDATE).
+	PutCreateOrUpdate PutFlag = 0x0
+	// PutUpdateOnly updates the existing instance only (WBEM_FLAG_UPDATE_ONLY).
+	PutUpdateOnly PutFlag = 0x1
+	// PutCreateOnly creates a new instance only (WBEM_FLAG_CREATE_ONLY).
+	PutCreateOnly PutFlag = 0x2
+)
+
+// SpawnInstance creates a new instance of the @className class and unmarshals
+// it into @dst. The instance isn't written to WMI, so the result just holds
+// the class default values. @dst should be a pointer to the structure type.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemobject-spawninstance-
+func (s *SWbemServicesConnection) SpawnInstance(className string, dst interface{}) (err error) {
+	s.Lock()
+	if s.sWbemServices == nil {
+		s.Unlock()
+		return ErrConnectionClosed
+	}
+	s.Unlock()
+
+	//  Be aware of reflections and COM usage.
+	defer func() {
+		if r := recover(); r != nil {
+			err = multierror.Append(err, fmt.Errorf("runtime panic; %v", r))
+		}
+	}()
+
+	instanceRaw, err := s.spawnInstance(className)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if clErr := instanceRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	return s.decode(className, instanceRaw.ToIDispatch(), dst)
+}
+
+// Put creates or updates an instance of the class named after the @src
+// structure type using @src field values. Returns the object path of the
+// written instance. @src should be a structure or a pointer to the structure.
+//
+// More info about fields marshalling is available in `Marshal` doc.
+//
+// N.B. The instance is written as a whole, so the properties missing in @src
+// are set to the class default values.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemobject-put-
+func (s *SWbemServicesConnection) Put(src interface{}, flags PutFlag) (string, error) {
+	v := reflect.Indirect(reflect.ValueOf(src))
+	if !v.IsValid() {
+		return "", ErrInvalidEntityType
+	}
+	return s.PutInstanceOf(v.Type().Name(), src, flags)
+}
+
+// PutInstanceOf is the same as `Put` but uses @className instead of structure
+// name as a class name.
+func (s *SWbemServicesConnection) PutInstanceOf(className string, src interface{}, flags PutFlag) (path string, err error) {
+	s.Lock()
+	if s.sWbemServices == nil {
+		s.Unlock()
+		return "", ErrConnectionClosed
+	}
+	s.Unlock()
+
+	//  Be aware of reflections and COM usage.
+	defer func() {
+		if r := recover(); r != nil {
+			err = multierror.Append(err, fmt.Errorf("runtime panic; %v", r))
+		}
+	}()
+
+	instanceRaw, err := s.spawnInstance(className)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if clErr := instanceRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+	instance := instanceRaw.ToIDispatch()
+
+	if err := Marshal(instance, src); err != nil {
+		return "", err
+	}
+
+	// result is a SWbemObjectPath
+	resultRaw, err := oleutil.CallMethod(instance, "Put_", int32(flags))
+	if err != nil {
+		return "", newWbemError("SWbemObject Put_", err)
+	}
+	defer func() {
+		if clErr := resultRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	return oleString(resultRaw.ToIDispatch(), "Path")
+}
+
+// Delete deletes an instance (or a class) specified by the object @path.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemservices-delete
+func (s *SWbemServicesConnection) Delete(path string) (err error) {
+	s.Lock()
+	if s.sWbemServices == nil {
+		s.Unlock()
+		return ErrConnectionClosed
+	}
+	s.Unlock()
+
+	//  Be aware of reflections and COM usage.
+	defer func() {
+		if r := recover(); r != nil {
+			err = multierror.Append(err, fmt.Errorf("runtime panic; %v", r))
+		}
+	}()
+
+	services, err := s.acquireServices()
+	if err != nil {
+		return err
+	}
+	defer services.Release()
+
+	resultRaw, err := oleutil.CallMethod(services, "Delete", path)
+	if err != nil {
+		return newWbemError("SWbemServices Delete", err)
+	}
+	return resultRaw.Clear()
+}
+
+// spawnInstance returns a new SWbemObject instance of the @className class.
+func (s *SWbemServicesConnection) spawnInstance(className string) (v *ole.VARIANT, err error) {
+	classRaw, err := s.dereference(className)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if clErr := classRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	v, err = oleutil.CallMethod(classRaw.ToIDispatch(), "SpawnInstance_")
+	if err != nil {
+		return nil, newWbemError("SWbemObject SpawnInstance_", err)
+	}
+	return v, nil
 }
 
 type queryDst struct {
@@ -210,7 +534,41 @@ type queryDst struct {
 	dstElemType reflect.Type
 }
 
-func (s *SWbemServicesConnection) query(query string, dst *queryDst) (err error) {
+func newQueryDst(dst interface{}) (*queryDst, error) {
+	sliceRefl := reflect.ValueOf(dst)
+	if sliceRefl.Kind() != reflect.Ptr || sliceRefl.IsNil() {
+		return nil, ErrInvalidEntityType
+	}
+	sliceRefl = sliceRefl.Elem() // "Dereference" pointer.
+
+	argType, elemType := checkMultiArg(sliceRefl)
+	if argType == multiArgTypeInvalid {
+		return nil, ErrInvalidEntityType
+	}
+	return &queryDst{
+		dst:         sliceRefl,
+		dsArgType:   argType,
+		dstElemType: elemType,
+	}, nil
+}
+
+func (s *SWbemServicesConnection) query(query string, dst *queryDst, opts *QueryOptions) error {
+	if opts == nil {
+		return s.fetch(dst, "ExecQuery", query)
+	}
+	params, release, err := contextParams(opts,
+		query, opts.queryLanguage(), opts.queryFlags(wbemFlagReturnImmediately))
+	if err != nil {
+		return err
+	}
+	defer release()
+	return s.fetch(dst, "ExecQuery", params...)
+}
+
+// fetch calls SWbemServices @method which returns SWbemObjectSet and
+// unmarshals the resulting objects into @dst. The call is observed as the
+// operation named after the @method with the first param as a query.
+func (s *SWbemServicesConnection) fetch(dst *queryDst, method string, params ...interface{}) (err error) {
 	//  Be aware of reflections and COM usage.
 	defer func() {
 		if r := recover(); r != nil {
@@ -218,8 +576,22 @@ func (s *SWbemServicesConnection) query(query string, dst *queryDst) (err error)
 		}
 	}()
 
+	var query string
+	if len(params) > 0 {
+		query, _ = params[0].(string)
+	}
+
+	services, err := s.acquireServices()
+	if err != nil {
+		return err
+	}
+	defer services.Release()
+
 	// result is a SWBemObjectSet
-	resultRaw, err := oleutil.CallMethod(s.sWbemServices, "ExecQuery", query)
+	done := s.observe(Operation(method), query)
+	resultRaw, err := oleutil.CallMethod(services, method, params...)
+	err = newWbemError("SWbemServices "+method, err)
+	done(0, err)
 	if err != nil {
 		return err
 	}
@@ -230,15 +602,56 @@ func (s *SWbemServicesConnection) query(query string, dst *queryDst) (err error)
 		}
 	}()
 
+	doneEnum := s.observe(OpEnumerate, query)
+	defer func() {
+		doneEnum(dst.dst.Len(), err)
+	}()
+
 	count, err := oleInt64(result, "Count")
 	if err != nil {
 		return err
 	}
 
-	enumProperty, err := result.GetProperty("_NewEnum")
+	// Initialize a slice with Count capacity
+	dst.dst.Set(reflect.MakeSlice(dst.dst.Type(), 0, int(count)))
+
+	var errFieldMismatch error
+	err = forEachObject(result, func(item *ole.IDispatch) error {
+		ev := reflect.New(dst.dstElemType)
+		if err := s.decode(query, item, ev.Interface()); err != nil {
+			var fieldMismatch ErrFieldMismatch
+			if errors.As(err, &fieldMismatch) {
+				// We continue loading entities even in the face of field mismatch errors.
+				// If we encounter any other error, that other error is returned. Otherwise,
+				// an ErrFieldMismatch is returned.
+				//
+				// Note that we are unmarshalling into the slice, so every element of the
+				// result will have the same error thus we can save the only error occurred.
+				errFieldMismatch = err
+			} else {
+				return err
+			}
+		}
+
+		if dst.dsArgType != multiArgTypeStructPtr {
+			ev = ev.Elem()
+		}
+		dst.dst.Set(reflect.Append(dst.dst, ev))
+		return nil
+	})
 	if err != nil {
 		return err
 	}
+	return errFieldMismatch
+}
+
+// forEachObject calls @f for every object of the SWbemObjectSet @set. Objects
+// are released after @f returns.
+func forEachObject(set *ole.IDispatch, f func(item *ole.IDispatch) error) (err error) {
+	enumProperty, err := set.GetProperty("_NewEnum")
+	if err != nil {
+		return newWbemError("SWbemObjectSet _NewEnum", err)
+	}
 	defer func() {
 		if clErr := enumProperty.Clear(); clErr != nil {
 			err = multierror.Append(err, clErr)
@@ -247,54 +660,29 @@ func (s *SWbemServicesConnection) query(query string, dst *queryDst) (err error)
 
 	enum, err := enumProperty.ToIUnknown().IEnumVARIANT(ole.IID_IEnumVariant)
 	if err != nil {
-		return err
+		return newWbemError("IUnknown QueryInterface", err)
 	}
 	if enum == nil {
 		return fmt.Errorf("can't get IEnumVARIANT, enum is nil")
 	}
 	defer enum.Release()
 
-	// Initialize a slice with Count capacity
-	dst.dst.Set(reflect.MakeSlice(dst.dst.Type(), 0, int(count)))
-
-	var errFieldMismatch error
 	for itemRaw, length, err := enum.Next(1); length > 0; itemRaw, length, err = enum.Next(1) {
 		if err != nil {
-			return err
+			return newWbemError("IEnumVARIANT Next", err)
 		}
 
 		// Closure for defer in the loop.
 		err := func() error {
 			item := itemRaw.ToIDispatch()
 			defer item.Release()
-
-			ev := reflect.New(dst.dstElemType)
-			if err = s.Unmarshal(item, ev.Interface()); err != nil {
-				if _, ok := err.(ErrFieldMismatch); ok {
-					// We continue loading entities even in the face of field mismatch errors.
-					// If we encounter any other error, that other error is returned. Otherwise,
-					// an ErrFieldMismatch is returned.
-					//
-					// Note that we are unmarshalling into the slice, so every element of the
-					// result will have the same error thus we can save the only error occurred.
-					errFieldMismatch = err
-				} else {
-					return err
-				}
-			}
-
-			if dst.dsArgType != multiArgTypeStructPtr {
-				ev = ev.Elem()
-			}
-			dst.dst.Set(reflect.Append(dst.dst, ev))
-
-			return nil
+			return f(item)
 		}()
 		if err != nil {
 			return err
 		}
 	}
-	return errFieldMismatch
+	return nil
 }
 
 type multiArgType int
@@ -329,7 +717,7 @@ func checkMultiArg(v reflect.Value) (m multiArgType, elemType reflect.Type) {
 func oleInt64(item *ole.IDispatch, prop string) (val int64, err error) {
 	v, err := oleutil.GetProperty(item, prop)
 	if err != nil {
-		return 0, err
+		return 0, newWbemError("GetProperty "+prop, err)
 	}
 	defer func() {
 		if clErr := v.Clear(); clErr != nil {
@@ -340,3 +728,17 @@ func oleInt64(item *ole.IDispatch, prop string) (val int64, err error) {
 	i := int64(v.Val)
 	return i, nil
 }
+
+func oleString(item *ole.IDispatch, prop string) (val string, err error) {
+	v, err := oleutil.GetProperty(item, prop)
+	if err != nil {
+		return "", newWbemError("GetProperty "+prop, err)
+	}
+	defer func() {
+		if clErr := v.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	return v.ToString(), nil
+}
@@ -3,6 +3,8 @@
 package wmi
 
 import (
+	"errors"
+	"os"
 	"os/user"
 	"strings"
 	"testing"
@@ -86,3 +88,177 @@ func TestSWbemServicesConnection_Get(t *testing.T) {
 		t.Errorf("Got unexpected user Domain; got %q, expected %q", currentUserAccount.Domain, osUserDomain)
 	}
 }
+
+// __EventFilter is used as a sample class that could be created and deleted
+// without any side effects.
+type __EventFilter struct {
+	Name           string
+	EventNamespace string
+	Query          string
+	QueryLanguage  string
+}
+
+// Run using: `TEST_PUT=1 go test -run TestSWbemServicesConnection_PutDelete`
+// Requires administrator rights.
+func TestSWbemServicesConnection_PutDelete(t *testing.T) {
+	if os.Getenv("TEST_PUT") == "" {
+		t.Skip("Skipping TestSWbemServicesConnection_PutDelete; $TEST_PUT is not set")
+	}
+	s, err := ConnectSWbemServices(nil, `root\subscription`)
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	var filter __EventFilter
+	if err := s.SpawnInstance("__EventFilter", &filter); err != nil {
+		t.Fatalf("Failed to spawn __EventFilter; %s", err)
+	}
+	filter.Name = "wmi_test_filter"
+	filter.EventNamespace = `root\cimv2`
+	filter.Query = "SELECT * FROM __InstanceModificationEvent WITHIN 5 WHERE TargetInstance ISA 'Win32_Service'"
+	filter.QueryLanguage = "WQL"
+
+	path, err := s.Put(filter, PutCreateOnly)
+	if err != nil {
+		t.Fatalf("Failed to put __EventFilter; %s", err)
+	}
+	if _, err := s.Put(&filter, PutCreateOnly); err == nil {
+		t.Errorf("Successfully created duplicated __EventFilter with PutCreateOnly")
+	}
+
+	var got __EventFilter
+	if err := s.Get(path, &got); err != nil {
+		t.Fatalf("Failed to get created __EventFilter %q; %s", path, err)
+	}
+	if got != filter {
+		t.Errorf("Got unexpected __EventFilter; got %+v, expected %+v", got, filter)
+	}
+
+	if err := s.Delete(path); err != nil {
+		t.Fatalf("Failed to delete __EventFilter %q; %s", path, err)
+	}
+	if err := s.Get(path, &got); err == nil {
+		t.Errorf("__EventFilter %q still exists after Delete", path)
+	}
+}
+
+func TestSWbemServicesConnection_Errors(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	var process Win32_Process
+	err = s.Get(`Win32_Process.Handle="4294967295"`, &process)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on Get; got %v", err)
+	}
+	var wbemErr *WbemError
+	if !errors.As(err, &wbemErr) || wbemErr.Operation != "SWbemServices Get" || wbemErr.Name() != "WBEM_E_NOT_FOUND" {
+		t.Errorf("Unexpected WbemError %#v", wbemErr)
+	}
+
+	var dst []Win32_Process
+	if err := s.Query("SELECT FROM WHERE", &dst); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery on Query; got %v", err)
+	}
+	if err := s.Query("SELECT * FROM Win32_NoSuchClass", &dst); !errors.Is(err, ErrInvalidClass) {
+		t.Errorf("Expected ErrInvalidClass on Query; got %v", err)
+	}
+
+	if _, err := s.Put(nil, PutCreateOnly); err != ErrInvalidEntityType {
+		t.Errorf("Expected ErrInvalidEntityType on Put of nil; got %v", err)
+	}
+
+	if _, err := ConnectSWbemServices(".", `root\NoSuchNamespace`); !errors.Is(err, ErrInvalidNamespace) {
+		t.Errorf("Expected ErrInvalidNamespace on ConnectServer; got %v", err)
+	}
+}
+
+func TestSWbemServicesConnection_Reconnect(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	s.RetryPolicy = DefaultRetryPolicy()
+
+	if err := s.reconnect(); err != nil {
+		t.Fatalf("Failed to reconnect; %s", err)
+	}
+	var dst []Win32_OperatingSystem
+	if err := s.Query(CreateQuery(&dst, ""), &dst); err != nil || len(dst) != 1 {
+		t.Fatalf("Failed to query after reconnect; %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	if err := s.reconnect(); err != ErrConnectionClosed {
+		t.Errorf("Unexpected reconnect error of closed connection; %v", err)
+	}
+}
+
+func TestSWbemServicesConnection_ReconnectConcurrent(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	errs := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			var err error
+			for j := 0; j < 10 && err == nil; j++ {
+				var dst []Win32_OperatingSystem
+				err = s.Query(CreateQuery(&dst, ""), &dst)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := s.reconnect(); err != nil {
+			t.Errorf("Failed to reconnect; %s", err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Query failed during reconnect; %s", err)
+		}
+	}
+}
+
+func TestSWbemServicesConnection_Options(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	opts := &QueryOptions{
+		UseAmendedQualifiers: true,
+		DirectRead:           true,
+		Context:              ProviderArchitecture(64),
+	}
+	var dst []Win32_OperatingSystem
+	if err := s.QueryWithOptions(CreateQuery(&dst, ""), &dst, opts); err != nil || len(dst) != 1 {
+		t.Fatalf("Failed to query with options; %v", err)
+	}
+
+	var process Win32_Process
+	if err := s.GetWithOptions(`Win32_Process.Handle="4"`, &process, opts); err != nil {
+		t.Errorf("Failed to get with options; %s", err)
+	}
+
+	var prototype []struct {
+		Class string `wmi:"__CLASS"`
+	}
+	if err := s.QueryWithOptions("SELECT Name FROM Win32_Process", &prototype, &QueryOptions{Prototype: true}); err != nil {
+		t.Fatalf("Failed to query prototype; %s", err)
+	}
+	if len(prototype) != 1 || prototype[0].Class != "__Generic" {
+		t.Errorf("Unexpected prototype %+v", prototype)
+	}
+}
@@ -1,5 +1,3 @@
-// +build windows
-
 package wmi
 
 import (
@@ -7,7 +5,6 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/bi-zone/go-ole"
@@ -71,23 +68,6 @@ type Decoder struct {
 	Dereferencer Dereferencer
 }
 
-// ErrFieldMismatch is returned when a field is to be loaded into a different
-// type than the one it was stored from, or when a field is missing or
-// unexported in the destination struct.
-// FieldType is the type of the struct pointed to by the destination argument.
-type ErrFieldMismatch struct {
-	FieldType reflect.Type
-	FieldName string
-	Reason    string
-}
-
-func (e ErrFieldMismatch) Error() string {
-	return fmt.Sprintf("wmi: cannot load field %q into a %q: %s",
-		e.FieldName, e.FieldType, e.Reason)
-}
-
-var timeType = reflect.TypeOf(time.Time{})
-
 // Unmarshal loads `ole.IDispatch` into a struct pointer.
 // N.B. Unmarshal supports only limited subset of structure field
 // types:
@@ -96,7 +76,7 @@ var timeType = reflect.TypeOf(time.Time{})
 //   - time.Time
 //   - string
 //   - bool
-//   - float32
+//   - float32, float64
 //   - a pointer to one of types above
 //   - a slice of one of thus types
 //   - structure types.
@@ -134,6 +114,36 @@ var timeType = reflect.TypeOf(time.Time{})
 //   Field1 int `wmi:"Field"`
 //   Field2 int `wmi:"Field"`
 func (d Decoder) Unmarshal(src *ole.IDispatch, dst interface{}) (err error) {
+	return d.unmarshal(dispatchSource{src}, dst)
+}
+
+// propertySource is an object the Decoder reads the properties from, e.g.
+// `ole.IDispatch` or `RecordedObject`.
+type propertySource interface {
+	// property returns the value of the @name property or error if the object
+	// has no such property. The value should be released after use.
+	property(name string) (propertyValue, error)
+
+	// unmarshalSelf unmarshals the object into @dst if it implements the
+	// custom decoding interface of the source. Returns false if it doesn't.
+	unmarshalSelf(d Decoder, dst interface{}) (bool, error)
+}
+
+// propertyValue is a value of the object property.
+type propertyValue interface {
+	fmt.Stringer // The value type name used in errors.
+
+	isNull() bool
+	// value returns the value to be unmarshalled as a simple type.
+	value() interface{}
+	// array returns the array elements, false if the value isn't an array.
+	array() ([]interface{}, bool)
+	// object returns the embedded object, false if the value isn't an object.
+	object() (propertySource, bool)
+	release() error
+}
+
+func (d Decoder) unmarshal(src propertySource, dst interface{}) (err error) {
 	defer func() {
 		// We use lots of reflection, so always be alert!
 		if r := recover(); r != nil {
@@ -142,8 +152,8 @@ func (d Decoder) Unmarshal(src *ole.IDispatch, dst interface{}) (err error) {
 	}()
 
 	// Checks whether the type can handle unmarshalling of himself.
-	if u, ok := dst.(Unmarshaler); ok {
-		return u.UnmarshalOLE(d, src)
+	if ok, err := src.unmarshalSelf(d, dst); ok {
+		return err
 	}
 
 	v := reflect.ValueOf(dst).Elem()
@@ -156,6 +166,7 @@ func (d Decoder) Unmarshal(src *ole.IDispatch, dst interface{}) (err error) {
 				FieldType: fType.Type,
 				FieldName: fType.Name,
 				Reason:    err.Error(),
+				Err:       err,
 			}
 		}
 	}
@@ -163,49 +174,50 @@ func (d Decoder) Unmarshal(src *ole.IDispatch, dst interface{}) (err error) {
 	return nil
 }
 
-func (d Decoder) unmarshalField(src *ole.IDispatch, f reflect.Value, fType reflect.StructField) (err error) {
+func (d Decoder) unmarshalField(src propertySource, f reflect.Value, fType reflect.StructField) (err error) {
 	fieldName, options := getFieldName(fType)
 	if !f.CanSet() || fieldName == "-" {
 		return nil
 	}
 
-	clearVariant := func(p *ole.VARIANT) {
-		if clErr := p.Clear(); clErr != nil {
+	release := func(p propertyValue) {
+		if clErr := p.release(); clErr != nil {
 			err = multierror.Append(err, clErr)
 		}
 	}
 
-	// Fetch property from the COM object.
-	prop, err := oleutil.GetProperty(src, fieldName)
+	// Fetch property from the object.
+	prop, err := src.property(fieldName)
 	if err != nil {
 		if d.AllowMissingFields {
 			return nil
 		}
-		return fmt.Errorf("no result field %q", fieldName)
+		return fmt.Errorf("no result field %q; %w", fieldName, err)
 	}
-	defer clearVariant(prop)
+	defer release(prop)
 
-	if prop.VT == ole.VT_NULL {
+	if prop.isNull() {
 		return nil
 	}
 
 	// If it's a reference field and we have Dereferencer - resolve it.
-	if options == "ref" {
+	if hasFieldOption(options, "ref") {
 		if d.Dereferencer == nil {
 			return errors.New("failed to dereference ref field; no Decoder.Dereferencer set")
 		}
-		refPath := prop.ToString()
-		prop, err = d.Dereferencer.Dereference(refPath)
+		refPath, _ := prop.value().(string)
+		ref, err := d.Dereferencer.Dereference(refPath)
 		if err != nil {
 			return err
 		}
-		defer clearVariant(prop)
+		prop = variantValue{ref}
+		defer release(prop)
 	}
 
 	return d.unmarshalValue(f, prop)
 }
 
-func (d Decoder) unmarshalValue(dst reflect.Value, prop *ole.VARIANT) error {
+func (d Decoder) unmarshalValue(dst reflect.Value, prop propertyValue) error {
 	isPtr := dst.Kind() == reflect.Ptr
 	fieldDstOrig := dst
 	if isPtr { // Create empty object for pointer receiver.
@@ -215,7 +227,7 @@ func (d Decoder) unmarshalValue(dst reflect.Value, prop *ole.VARIANT) error {
 	}
 
 	// First of all try to unmarshal it as a simple type.
-	err := unmarshalSimpleValue(dst, prop.Value())
+	err := unmarshalSimpleValue(dst, prop.value())
 	if err != errSimpleVariantsExceeded {
 		return err // Either nil and value set or unexpected error.
 	}
@@ -223,21 +235,21 @@ func (d Decoder) unmarshalValue(dst reflect.Value, prop *ole.VARIANT) error {
 	// Or we faced not so simple type. Do our best.
 	switch dst.Kind() {
 	case reflect.Slice:
-		safeArray := prop.ToArray()
-		if safeArray == nil {
-			return fmt.Errorf("can't unmarshal %s into slice", prop.VT)
+		arr, ok := prop.array()
+		if !ok {
+			return fmt.Errorf("can't unmarshal %s into slice", prop)
 		}
-		return unmarshalSlice(dst, safeArray)
+		return unmarshalSlice(dst, arr)
 	case reflect.Struct:
-		dispatch := prop.ToIDispatch()
-		if dispatch == nil {
-			return fmt.Errorf("can't unmarshal %s into struct", prop.VT)
+		obj, ok := prop.object()
+		if !ok {
+			return fmt.Errorf("can't unmarshal %s into struct", prop)
 		}
 		fieldPointer := dst.Addr().Interface()
-		return d.Unmarshal(dispatch, fieldPointer)
+		return d.unmarshal(obj, fieldPointer)
 	default:
 		// If we got nil value - handle it with magic config fields.
-		gotNilProp := reflect.TypeOf(prop.Value()) == nil
+		gotNilProp := reflect.TypeOf(prop.value()) == nil
 		if gotNilProp && (isPtr || d.NonePtrZero) {
 			ptrNeedZero := isPtr && d.PtrNil
 			nonPtrAllowNil := !isPtr && d.NonePtrZero
@@ -246,8 +258,65 @@ func (d Decoder) unmarshalValue(dst reflect.Value, prop *ole.VARIANT) error {
 			}
 			return nil
 		}
-		return fmt.Errorf("unsupported type (%T)", prop.Value())
+		return fmt.Errorf("unsupported type (%T)", prop.value())
+	}
+}
+
+// dispatchSource is a propertySource of the COM object.
+type dispatchSource struct {
+	*ole.IDispatch
+}
+
+func (src dispatchSource) property(name string) (propertyValue, error) {
+	prop, err := oleutil.GetProperty(src.IDispatch, name)
+	if err != nil {
+		return nil, newWbemError("GetProperty", err)
 	}
+	return variantValue{prop}, nil
+}
+
+func (src dispatchSource) unmarshalSelf(d Decoder, dst interface{}) (bool, error) {
+	if u, ok := dst.(Unmarshaler); ok {
+		return true, u.UnmarshalOLE(d, src.IDispatch)
+	}
+	return false, nil
+}
+
+// variantValue is a propertyValue of the COM object property.
+type variantValue struct {
+	*ole.VARIANT
+}
+
+func (v variantValue) String() string {
+	return v.VT.String()
+}
+
+func (v variantValue) isNull() bool {
+	return v.VT == ole.VT_NULL
+}
+
+func (v variantValue) value() interface{} {
+	return v.Value()
+}
+
+func (v variantValue) array() ([]interface{}, bool) {
+	safeArray := v.ToArray()
+	if safeArray == nil {
+		return nil, false
+	}
+	return safeArray.ToValueArray(), true
+}
+
+func (v variantValue) object() (propertySource, bool) {
+	dispatch := v.ToIDispatch()
+	if dispatch == nil {
+		return nil, false
+	}
+	return dispatchSource{dispatch}, true
+}
+
+func (v variantValue) release() error {
+	return v.Clear()
 }
 
 var (
@@ -293,11 +362,18 @@ func unmarshalSimpleValue(dst reflect.Value, value interface{}) error {
 		}
 	case float32:
 		switch dst.Kind() {
-		case reflect.Float32:
+		case reflect.Float32, reflect.Float64:
 			dst.SetFloat(float64(val))
 		default:
 			return errors.New("not a float32")
 		}
+	case float64:
+		switch dst.Kind() {
+		case reflect.Float64:
+			dst.SetFloat(val)
+		default:
+			return errors.New("not a float64")
+		}
 	case time.Time:
 		switch dst.Type() {
 		case timeType:
@@ -320,8 +396,7 @@ func unmarshalSimpleValue(dst reflect.Value, value interface{}) error {
 	return nil
 }
 
-func unmarshalSlice(fieldDst reflect.Value, safeArray *ole.SafeArrayConversion) error {
-	arr := safeArray.ToValueArray()
+func unmarshalSlice(fieldDst reflect.Value, arr []interface{}) error {
 	resultArr := reflect.MakeSlice(fieldDst.Type(), len(arr), len(arr))
 	for i, v := range arr {
 		s := resultArr.Index(i)
@@ -393,17 +468,3 @@ func unmarshalTime(fieldDst reflect.Value, val string) error {
 	fieldDst.Set(reflect.ValueOf(t))
 	return nil
 }
-
-func getFieldName(fType reflect.StructField) (name, options string) {
-	tag := fType.Tag.Get("wmi")
-	if idx := strings.Index(tag, ","); idx != -1 {
-		name = tag[:idx]
-		options = tag[idx+1:]
-	} else {
-		name = tag
-	}
-	if name == "" {
-		name = fType.Name
-	}
-	return
-}
@@ -0,0 +1,357 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultDeliveryBuffer = 64
+	defaultBatchSize      = 100
+	defaultFlushInterval  = time.Second
+)
+
+// DeliveryMode specifies how the events are delivered to the slow consumer.
+type DeliveryMode int
+
+// Delivery modes.
+const (
+	// DeliveryBlock delivers the events one by one blocking the receiving of
+	// the next event until the consumer reads the previous one. WMI queues the
+	// events meanwhile and drops them with WBEM_E_QUEUE_OVERFLOW if the queue
+	// is full.
+	DeliveryBlock DeliveryMode = iota
+	// DeliveryDropOldest buffers up to `DeliveryPolicy.BufferSize` events.
+	// The oldest buffered event is dropped if the buffer is full.
+	DeliveryDropOldest
+	// DeliveryDropNewest buffers up to `DeliveryPolicy.BufferSize` events.
+	// The new event is dropped if the buffer is full.
+	DeliveryDropNewest
+	// DeliveryBatch delivers the events in batches over the channel of
+	// slices (`chan []T` or `chan []*T`). A batch is delivered when it has
+	// `DeliveryPolicy.BufferSize` events or `DeliveryPolicy.FlushInterval`
+	// after its first event. Receiving is blocked while the consumer doesn't
+	// read the previous batch.
+	DeliveryBatch
+)
+
+var deliveryModeNames = map[DeliveryMode]string{
+	DeliveryBlock:      "block",
+	DeliveryDropOldest: "drop oldest",
+	DeliveryDropNewest: "drop newest",
+	DeliveryBatch:      "batch",
+}
+
+func (m DeliveryMode) String() string {
+	if name, ok := deliveryModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("DeliveryMode(%d)", int(m))
+}
+
+// DeliveryPolicy specifies how the events are delivered to the consumer. The
+// zero value is `DeliveryBlock` policy.
+//
+// Events buffered (or batched) but not delivered yet are dropped when the
+// subscription is cancelled or stopped by an error. If the subscription is
+// done because there are no more events (see `Replay`), they are delivered
+// before it's done.
+type DeliveryPolicy struct {
+	Mode DeliveryMode
+
+	// BufferSize is the size of the buffer of drop modes (default is 64) or
+	// the maximum batch size (default is 100). Drop modes hold one more
+	// event being sent to the consumer, so up to `BufferSize`+1 events are
+	// pending.
+	BufferSize int
+
+	// FlushInterval is the longest time the batch is collected, default is
+	// 1s. Used by `DeliveryBatch` only.
+	FlushInterval time.Duration
+
+	// Clock is used to wait for the batch flush. If nil, the system clock is
+	// used.
+	Clock Clock
+}
+
+// Validate checks the policy settings.
+func (p DeliveryPolicy) Validate() error {
+	if _, ok := deliveryModeNames[p.Mode]; !ok {
+		return fmt.Errorf("wmi: invalid delivery mode %d", p.Mode)
+	}
+	if p.BufferSize < 0 {
+		return fmt.Errorf("wmi: invalid delivery buffer size %d", p.BufferSize)
+	}
+	if p.FlushInterval < 0 {
+		return fmt.Errorf("wmi: invalid delivery flush interval %s", p.FlushInterval)
+	}
+	return nil
+}
+
+// eventType checks that @eventCh is a channel suitable for the policy and
+// returns the structure type of the events and whether they are delivered as
+// pointers.
+func (p DeliveryPolicy) eventType(eventCh interface{}) (elemType reflect.Type, isPtr bool, err error) {
+	if err := p.Validate(); err != nil {
+		return nil, false, err
+	}
+	chType := reflect.TypeOf(eventCh)
+	if chType == nil || chType.Kind() != reflect.Chan {
+		return nil, false, errors.New("eventCh has incorrect type; should be `chan T` or `chan *T`")
+	}
+	elemType = chType.Elem()
+	if p.Mode == DeliveryBatch {
+		if elemType.Kind() != reflect.Slice {
+			return nil, false, errors.New("eventCh has incorrect type; should be `chan []T` or `chan []*T`")
+		}
+		elemType = elemType.Elem()
+	} else if !isChannelTypeOK(eventCh) {
+		return nil, false, errors.New("eventCh has incorrect type; should be `chan T` or `chan *T`")
+	}
+
+	if isPtr = elemType.Kind() == reflect.Ptr; isPtr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, false, errors.New("eventCh has incorrect type; should be `chan []T` or `chan []*T`")
+	}
+	return elemType, isPtr, nil
+}
+
+// deliverer delivers the events to the consumer channel.
+type deliverer interface {
+	// deliver delivers, buffers or drops the event @ev according to the
+	// policy. Returns whether the event has been delivered or buffered, not
+	// dropped; @ok is false if the @ctx is done before that.
+	deliver(ctx context.Context, ev reflect.Value) (queued, ok bool)
+	// flush delivers the pending events after the last one. Returns false if
+	// the @ctx is done before that. No events are delivered after the flush.
+	flush(ctx context.Context) bool
+	// stop stops the delivery dropping the events not delivered yet.
+	stop()
+	// dropped returns the number of the events dropped so far.
+	dropped() uint64
+}
+
+// newDeliverer returns the deliverer of the events to the @events channel
+// according to the @policy. The delivery is stopped if the @ctx is done.
+func newDeliverer(ctx context.Context, policy DeliveryPolicy, events reflect.Value) deliverer {
+	switch policy.Mode {
+	case DeliveryDropOldest, DeliveryDropNewest:
+		size := policy.BufferSize
+		if size == 0 {
+			size = defaultDeliveryBuffer
+		}
+		return newBufferDeliverer(ctx, events, size, policy.Mode == DeliveryDropOldest)
+	case DeliveryBatch:
+		return newBatchDeliverer(ctx, policy, events)
+	}
+	return blockDeliverer{events: events}
+}
+
+// sendEvent sends @ev to the @events channel. Returns false if the @ctx is
+// done before that.
+func sendEvent(ctx context.Context, events, ev reflect.Value) bool {
+	idx, _, _ := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: events, Send: ev},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	})
+	return idx == 0
+}
+
+// blockDeliverer sends the events to the consumer directly.
+type blockDeliverer struct {
+	events reflect.Value
+}
+
+func (d blockDeliverer) deliver(ctx context.Context, ev reflect.Value) (queued, ok bool) {
+	ok = sendEvent(ctx, d.events, ev)
+	return ok, ok
+}
+
+func (blockDeliverer) flush(context.Context) bool { return true }
+func (blockDeliverer) stop()                      {}
+func (blockDeliverer) dropped() uint64            { return 0 }
+
+// bufferDeliverer buffers the events which are sent to the consumer by the
+// separate goroutine.
+type bufferDeliverer struct {
+	drops      uint64 // Accessed atomically, the first for 64-bit alignment.
+	events     reflect.Value
+	buffer     chan reflect.Value
+	dropOldest bool
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func newBufferDeliverer(ctx context.Context, events reflect.Value, size int, dropOldest bool) *bufferDeliverer {
+	ctx, cancel := context.WithCancel(ctx)
+	d := bufferDeliverer{
+		events:     events,
+		buffer:     make(chan reflect.Value, size),
+		dropOldest: dropOldest,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go d.forward(ctx)
+	return &d
+}
+
+func (d *bufferDeliverer) forward(ctx context.Context) {
+	defer close(d.done)
+	for {
+		select {
+		case ev, ok := <-d.buffer:
+			if !ok || !sendEvent(ctx, d.events, ev) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *bufferDeliverer) deliver(ctx context.Context, ev reflect.Value) (queued, ok bool) {
+	if ctx.Err() != nil {
+		return false, false
+	}
+	// The only sender, so there is a room in the buffer after the oldest
+	// event is dropped.
+	for {
+		select {
+		case d.buffer <- ev:
+			return true, true
+		default:
+		}
+		if !d.dropOldest {
+			atomic.AddUint64(&d.drops, 1)
+			return false, true
+		}
+		select {
+		case <-d.buffer:
+			atomic.AddUint64(&d.drops, 1)
+		default:
+		}
+	}
+}
+
+func (d *bufferDeliverer) flush(ctx context.Context) bool {
+	// The forwarding is finished when the buffer is drained.
+	close(d.buffer)
+	select {
+	case <-d.done:
+		return ctx.Err() == nil
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (d *bufferDeliverer) stop() {
+	d.cancel()
+	<-d.done
+}
+
+func (d *bufferDeliverer) dropped() uint64 {
+	return atomic.LoadUint64(&d.drops)
+}
+
+// batchDeliverer collects the events into batches which are sent to the
+// consumer by the separate goroutine.
+type batchDeliverer struct {
+	events        reflect.Value
+	batchType     reflect.Type
+	size          int
+	flushInterval time.Duration
+	clock         Clock
+	in            chan reflect.Value
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+func newBatchDeliverer(ctx context.Context, policy DeliveryPolicy, events reflect.Value) *batchDeliverer {
+	ctx, cancel := context.WithCancel(ctx)
+	d := batchDeliverer{
+		events:        events,
+		batchType:     events.Type().Elem(),
+		size:          policy.BufferSize,
+		flushInterval: policy.FlushInterval,
+		clock:         policy.Clock,
+		in:            make(chan reflect.Value),
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+	if d.size == 0 {
+		d.size = defaultBatchSize
+	}
+	if d.flushInterval == 0 {
+		d.flushInterval = defaultFlushInterval
+	}
+	if d.clock == nil {
+		d.clock = systemClock{}
+	}
+	go d.forward(ctx)
+	return &d
+}
+
+func (d *batchDeliverer) forward(ctx context.Context) {
+	defer close(d.done)
+	batch := reflect.MakeSlice(d.batchType, 0, d.size)
+	var flush <-chan time.Time
+	for {
+		select {
+		case ev, ok := <-d.in:
+			if !ok {
+				if batch.Len() > 0 {
+					sendEvent(ctx, d.events, batch)
+				}
+				return
+			}
+			batch = reflect.Append(batch, ev)
+			if flush == nil {
+				flush = d.clock.After(d.flushInterval)
+			}
+			if batch.Len() < d.size {
+				continue
+			}
+		case <-flush:
+		case <-ctx.Done():
+			return
+		}
+		if !sendEvent(ctx, d.events, batch) {
+			return
+		}
+		batch = reflect.MakeSlice(d.batchType, 0, d.size)
+		flush = nil
+	}
+}
+
+func (d *batchDeliverer) deliver(ctx context.Context, ev reflect.Value) (queued, ok bool) {
+	select {
+	case d.in <- ev:
+		return true, true
+	case <-ctx.Done():
+		return false, false
+	}
+}
+
+func (d *batchDeliverer) flush(ctx context.Context) bool {
+	// The forwarding is finished when the last batch is sent.
+	close(d.in)
+	select {
+	case <-d.done:
+		return ctx.Err() == nil
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (d *batchDeliverer) stop() {
+	d.cancel()
+	<-d.done
+}
+
+func (*batchDeliverer) dropped() uint64 { return 0 }
@@ -0,0 +1,219 @@
+package wmi
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tickClock is a Clock firing all the waits when the test sends to @ticks.
+type tickClock struct {
+	ticks chan time.Time
+}
+
+func (c *tickClock) Now() time.Time {
+	return time.Time{}
+}
+
+func (c *tickClock) After(time.Duration) <-chan time.Time {
+	return c.ticks
+}
+
+func TestDeliveryPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		policy DeliveryPolicy
+		ok     bool
+	}{
+		{DeliveryPolicy{}, true},
+		{DeliveryPolicy{Mode: DeliveryDropOldest, BufferSize: 10}, true},
+		{DeliveryPolicy{Mode: DeliveryBatch, FlushInterval: time.Second}, true},
+		{DeliveryPolicy{Mode: DeliveryMode(42)}, false},
+		{DeliveryPolicy{Mode: DeliveryDropNewest, BufferSize: -1}, false},
+		{DeliveryPolicy{Mode: DeliveryBatch, FlushInterval: -time.Second}, false},
+	}
+	for _, test := range tests {
+		if err := test.policy.Validate(); (err == nil) != test.ok {
+			t.Errorf("Unexpected result for %+v; %v", test.policy, err)
+		}
+	}
+}
+
+func TestDeliveryPolicy_EventType(t *testing.T) {
+	type T struct{}
+	tests := []struct {
+		mode    DeliveryMode
+		eventCh interface{}
+		isPtr   bool
+		ok      bool
+	}{
+		{DeliveryBlock, make(chan T), false, true},
+		{DeliveryDropOldest, make(chan *T), true, true},
+		{DeliveryBatch, make(chan []T), false, true},
+		{DeliveryBatch, make(chan []*T), true, true},
+
+		{DeliveryBlock, nil, false, false},
+		{DeliveryBlock, make(chan []T), false, false},
+		{DeliveryDropNewest, T{}, false, false},
+		{DeliveryBatch, make(chan T), false, false},
+		{DeliveryBatch, make(chan []int), false, false},
+		{DeliveryBatch, make(chan []**T), false, false},
+	}
+	for _, test := range tests {
+		policy := DeliveryPolicy{Mode: test.mode}
+		elemType, isPtr, err := policy.eventType(test.eventCh)
+		if (err == nil) != test.ok {
+			t.Errorf("Unexpected result for %s %T; %v", test.mode, test.eventCh, err)
+			continue
+		}
+		if err == nil && (elemType != reflect.TypeOf(T{}) || isPtr != test.isPtr) {
+			t.Errorf("Unexpected event type for %s %T; %s %v", test.mode, test.eventCh, elemType, isPtr)
+		}
+	}
+}
+
+func TestBufferDeliverer(t *testing.T) {
+	tests := []struct {
+		dropOldest bool
+		buffered   []int
+		queued     []bool
+	}{
+		{dropOldest: true, buffered: []int{3, 4}, queued: []bool{true, true, true, true}},
+		{dropOldest: false, buffered: []int{1, 2}, queued: []bool{true, true, false, false}},
+	}
+	for _, test := range tests {
+		// No forwarding, so the buffer is just filled.
+		d := bufferDeliverer{
+			buffer:     make(chan reflect.Value, 2),
+			dropOldest: test.dropOldest,
+		}
+		for i := 1; i <= 4; i++ {
+			queued, ok := d.deliver(context.Background(), reflect.ValueOf(i))
+			if !ok {
+				t.Fatalf("Event %d isn't delivered", i)
+			}
+			if queued != test.queued[i-1] {
+				t.Errorf("Unexpected queued result of event %d: %v", i, queued)
+			}
+		}
+		if d.dropped() != 2 {
+			t.Errorf("Unexpected number of dropped events %d", d.dropped())
+		}
+		var buffered []int
+		for len(d.buffer) > 0 {
+			buffered = append(buffered, int((<-d.buffer).Int()))
+		}
+		if !reflect.DeepEqual(buffered, test.buffered) {
+			t.Errorf("Unexpected buffered events %v; expected %v", buffered, test.buffered)
+		}
+	}
+}
+
+func TestSubscription_DropOldest(t *testing.T) {
+	events := make(chan fakeEvent)
+	sub, src, _ := startFakeSubscription(t, context.Background(), events, &SubscribeOptions{
+		PollTimeout: 10 * time.Millisecond,
+		Delivery:    DeliveryPolicy{Mode: DeliveryDropOldest, BufferSize: 1},
+	})
+	defer sub.Close()
+
+	// The receiving isn't blocked by the slow consumer.
+	const total = 5
+	for i := 1; i <= total; i++ {
+		src.events <- fakeEvent{ID: i}
+	}
+
+	// The latest event is always delivered.
+	received := 0
+	for e := range events {
+		received++
+		if e.ID == total {
+			break
+		}
+	}
+	if dropped := sub.Dropped(); dropped == 0 || int(dropped)+received != total {
+		t.Errorf("Unexpected number of dropped events %d; received %d", dropped, received)
+	}
+}
+
+func TestSubscription_DropNewestStats(t *testing.T) {
+	events := make(chan fakeEvent)
+	rec := &recordingObserver{}
+	sub, src, _ := startFakeSubscription(t, context.Background(), events, &SubscribeOptions{
+		PollTimeout: 10 * time.Millisecond,
+		Delivery:    DeliveryPolicy{Mode: DeliveryDropNewest, BufferSize: 1},
+	})
+	sub.observer = rec
+
+	const total = 5
+	for i := 1; i <= total; i++ {
+		src.events <- fakeEvent{ID: i}
+	}
+	src.events <- errNoEvents // The last event is processed.
+	if err := sub.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	counted := 0
+	for _, info := range rec.done {
+		if info.Operation == OpEvent {
+			counted += info.Objects
+		}
+	}
+	if dropped := sub.Dropped(); dropped == 0 || int(dropped)+counted != total {
+		t.Errorf("Unexpected number of counted events %d; dropped %d", counted, dropped)
+	}
+}
+
+func TestSubscription_Batch(t *testing.T) {
+	clock := &tickClock{ticks: make(chan time.Time)}
+	events := make(chan []*fakeEvent)
+	sub, src, released := startFakeSubscription(t, context.Background(), events, &SubscribeOptions{
+		PollTimeout: 10 * time.Millisecond,
+		Delivery: DeliveryPolicy{
+			Mode:       DeliveryBatch,
+			BufferSize: 2,
+			Clock:      clock,
+		},
+	})
+
+	// Full batch is delivered at once.
+	src.events <- fakeEvent{ID: 1}
+	src.events <- fakeEvent{ID: 2}
+	if batch := <-events; len(batch) != 2 || batch[0].ID != 1 || batch[1].ID != 2 {
+		t.Errorf("Unexpected batch %+v", batch)
+	}
+
+	// Incomplete batch is delivered after the flush interval.
+	src.events <- fakeEvent{ID: 3}
+	clock.ticks <- time.Time{}
+	if batch := <-events; len(batch) != 1 || batch[0].ID != 3 {
+		t.Errorf("Unexpected batch %+v", batch)
+	}
+
+	// The collected events are dropped on close.
+	src.events <- fakeEvent{ID: 4}
+	if err := sub.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+	if atomic.LoadInt32(released) != 1 {
+		t.Errorf("Subscription isn't released")
+	}
+	select {
+	case batch := <-events:
+		t.Errorf("Unexpected batch after close %+v", batch)
+	default:
+	}
+}
+
+func TestDeliveryMode_String(t *testing.T) {
+	if s := DeliveryDropNewest.String(); s != "drop newest" {
+		t.Errorf("Unexpected mode name %q", s)
+	}
+	if s := DeliveryMode(42).String(); s != "DeliveryMode(42)" {
+		t.Errorf("Unexpected mode name %q", s)
+	}
+}
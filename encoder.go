@@ -0,0 +1,205 @@
+// +build windows
+
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/bi-zone/go-ole"
+	"github.com/bi-zone/go-ole/oleutil"
+)
+
+// Marshaler is the interface implemented by types that can marshal themselves
+// into COM object.
+//
+// N.B. Marshaler is the opposite of `Unmarshaler` and currently is used only by
+// `SWbemServicesConnection.Put` family of calls.
+type Marshaler interface {
+	MarshalOLE(dst *ole.IDispatch) error
+}
+
+// Marshal sets properties of the `ole.IDispatch` object (usually an instance
+// of the `SWbemObject`) from the fields of @src. @src should be a structure or
+// a pointer to the structure.
+//
+// The field names are resolved the same way as `Decoder.Unmarshal` does, so
+// the types used for querying could be used for instance modification as is.
+// Marshal supports the following subset of field types:
+//   - all signed and unsigned integers
+//   - time.Time (marshalled as CIM_DATETIME string)
+//   - string
+//   - bool
+//   - float32, float64
+//   - a pointer to one of types above (nil pointers are skipped)
+//   - []string and []byte
+//   - slices of 64-bit integers and time.Time
+//
+// 64-bit integers are passed as decimal strings as WMI scripting API expects,
+// the same is done for the elements of 64-bit integer and datetime arrays.
+// Slices of other types (e.g. []uint32 or []bool) can't be passed through
+// the `ole` calls and are rejected with the error.
+// Fields tagged as references (",ref") should be strings holding the object
+// path of the referenced object. Fields tagged with ",omitempty" are skipped if
+// they hold the zero value (e.g. optional or read-only properties), so the
+// class default values are kept.
+//
+// To marshal more complex struct consider implementing `wmi.Marshaler`.
+func Marshal(dst *ole.IDispatch, src interface{}) (err error) {
+	defer func() {
+		// We use lots of reflection, so always be alert!
+		if r := recover(); r != nil {
+			err = fmt.Errorf("runtime panic: %v", r)
+		}
+	}()
+
+	if m, ok := src.(Marshaler); ok {
+		return m.MarshalOLE(dst)
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(src))
+	if v.Kind() != reflect.Struct {
+		return ErrInvalidEntityType
+	}
+	vType := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		fType := vType.Field(i)
+		if err = marshalField(dst, v.Field(i), fType); err != nil {
+			return ErrFieldMismatch{
+				FieldType: fType.Type,
+				FieldName: fType.Name,
+				Reason:    err.Error(),
+				Err:       err,
+			}
+		}
+	}
+	return nil
+}
+
+func marshalField(dst *ole.IDispatch, f reflect.Value, fType reflect.StructField) error {
+	fieldName, options := getFieldName(fType)
+	if fType.PkgPath != "" || fieldName == "-" {
+		return nil // Unexported or skipped field.
+	}
+	if hasFieldOption(options, "omitempty") && f.IsZero() {
+		return nil
+	}
+
+	value, ok, err := marshalValue(f)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if hasFieldOption(options, "ref") {
+		if _, isString := value.(string); !isString {
+			return errors.New("reference field should be a string object path")
+		}
+	}
+
+	prop, err := oleutil.PutProperty(dst, fieldName, value)
+	if err != nil {
+		return fmt.Errorf("failed to set property %q; %w", fieldName, newWbemError("PutProperty "+fieldName, err))
+	}
+	_ = prop.Clear() // Put returns nothing useful.
+	return nil
+}
+
+// basicTypes are the types of the basic kinds passed to `ole` as is.
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+var (
+	stringsType = reflect.TypeOf([]string(nil))
+	bytesType   = reflect.TypeOf([]byte(nil))
+)
+
+// marshalValue converts reflected field value into the value accepted by
+// the `ole` calls. Returns false if the field should be skipped.
+func marshalValue(f reflect.Value) (value interface{}, ok bool, err error) {
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return nil, false, nil
+		}
+		f = f.Elem()
+	}
+
+	switch f.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Bool, reflect.Float32, reflect.Float64, reflect.String:
+		// Named types, e.g. `type State uint32`, are unknown to `ole`.
+		return f.Convert(basicTypes[f.Kind()]).Interface(), true, nil
+	case reflect.Int:
+		if v := f.Int(); v >= math.MinInt32 && v <= math.MaxInt32 {
+			return int32(v), true, nil
+		}
+		return strconv.FormatInt(f.Int(), 10), true, nil
+	case reflect.Uint:
+		if v := f.Uint(); v <= math.MaxUint32 {
+			return uint32(v), true, nil
+		}
+		return strconv.FormatUint(f.Uint(), 10), true, nil
+	case reflect.Int64:
+		return strconv.FormatInt(f.Int(), 10), true, nil
+	case reflect.Uint64:
+		return strconv.FormatUint(f.Uint(), 10), true, nil
+	case reflect.Slice:
+		for _, t := range []reflect.Type{stringsType, bytesType} {
+			if f.Type().ConvertibleTo(t) {
+				return f.Convert(t).Interface(), true, nil
+			}
+		}
+		if isStringArrayElem(f.Type().Elem()) {
+			return marshalStringArray(f)
+		}
+		return nil, false, fmt.Errorf("unsupported slice type (%s); only arrays of strings, "+
+			"bytes, 64-bit integers and datetimes are supported", f.Type())
+	case reflect.Struct:
+		if t, isTime := f.Interface().(time.Time); isTime {
+			return formatDateTime(t), true, nil
+		}
+		return nil, false, errors.New("embedded objects are not supported; implement wmi.Marshaler")
+	}
+	return nil, false, fmt.Errorf("unsupported type (%s)", f.Type())
+}
+
+// isStringArrayElem reports whether the slice elements of type @t are passed
+// to WMI as strings.
+func isStringArrayElem(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Int64, reflect.Uint64:
+		return true
+	case reflect.Struct:
+		return t == timeType
+	}
+	return false
+}
+
+// marshalStringArray converts the slice @f of 64-bit integers, datetimes or
+// strings into the []string accepted by the `ole` calls.
+func marshalStringArray(f reflect.Value) (value interface{}, ok bool, err error) {
+	res := make([]string, f.Len())
+	for i := range res {
+		elem, _, err := marshalValue(f.Index(i))
+		if err != nil {
+			return nil, false, err
+		}
+		res[i] = elem.(string)
+	}
+	return res, true, nil
+}
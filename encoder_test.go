@@ -0,0 +1,284 @@
+// +build windows
+
+package wmi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	type process struct {
+		Name           string
+		ProcessId      uint32
+		KernelModeTime uint64
+		CreationDate   time.Time
+		Description    *string
+		CommandLine    *string
+		Skipped        int `wmi:"-"`
+	}
+	description := "Marshalled process"
+	src := process{
+		Name:           "test.exe",
+		ProcessId:      4242,
+		KernelModeTime: 1 << 40,
+		CreationDate:   time.Date(2020, 11, 12, 13, 14, 15, 16000, time.FixedZone("", 3*60*60)),
+		Description:    &description,
+		Skipped:        42,
+	}
+
+	instanceRaw, err := s.spawnInstance("Win32_Process")
+	if err != nil {
+		t.Fatalf("Failed to spawn Win32_Process; %s", err)
+	}
+	defer instanceRaw.Clear()
+	instance := instanceRaw.ToIDispatch()
+
+	if err := Marshal(instance, src); err != nil {
+		t.Fatalf("Failed to marshal; %s", err)
+	}
+
+	var dst process
+	if err := s.Unmarshal(instance, &dst); err != nil {
+		t.Fatalf("Failed to unmarshal; %s", err)
+	}
+	if dst.Name != src.Name || dst.ProcessId != src.ProcessId || dst.KernelModeTime != src.KernelModeTime {
+		t.Errorf("Got unexpected round trip result; got %+v, expected %+v", dst, src)
+	}
+	if !dst.CreationDate.Equal(src.CreationDate) {
+		t.Errorf("Got unexpected CreationDate; got %s, expected %s", dst.CreationDate, src.CreationDate)
+	}
+	if dst.Description == nil || *dst.Description != description {
+		t.Errorf("Got unexpected Description; got %v, expected %q", dst.Description, description)
+	}
+	if dst.CommandLine != nil && *dst.CommandLine != "" {
+		t.Errorf("Nil pointer field was marshalled; got %q", *dst.CommandLine)
+	}
+	if dst.Skipped != 0 {
+		t.Errorf("Skipped field was unmarshalled; got %d", dst.Skipped)
+	}
+}
+
+func TestMarshal_Unsupported(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	instanceRaw, err := s.spawnInstance("Win32_Process")
+	if err != nil {
+		t.Fatalf("Failed to spawn Win32_Process; %s", err)
+	}
+	defer instanceRaw.Clear()
+
+	var src struct {
+		Name []uint32
+	}
+	err = Marshal(instanceRaw.ToIDispatch(), src)
+	if _, ok := err.(ErrFieldMismatch); !ok || !strings.Contains(err.Error(), "[]uint32") {
+		t.Errorf("Unexpected error for unsupported field type; got %v", err)
+	}
+	// Property errors keep the HRESULT.
+	var mismatched struct {
+		ProcessId string
+	}
+	mismatched.ProcessId = "not a number"
+	err = Marshal(instanceRaw.ToIDispatch(), mismatched)
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for mismatched property type; got %v", err)
+	}
+}
+
+func TestMarshal_OmitEmpty(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	instanceRaw, err := s.spawnInstance("Win32_Process")
+	if err != nil {
+		t.Fatalf("Failed to spawn Win32_Process; %s", err)
+	}
+	defer instanceRaw.Clear()
+	instance := instanceRaw.ToIDispatch()
+
+	type process struct {
+		Name        string `wmi:",omitempty"`
+		Description string `wmi:",omitempty"`
+	}
+	if err := Marshal(instance, process{Name: "test.exe", Description: "Marshalled process"}); err != nil {
+		t.Fatalf("Failed to marshal; %s", err)
+	}
+	// Options are applied whatever their number and order are.
+	type reference struct {
+		Name        string `wmi:"Name,ref,omitempty"`
+		Description string `wmi:"Description,omitempty,ref"`
+	}
+	if err := Marshal(instance, reference{Name: "other.exe"}); err != nil {
+		t.Fatalf("Failed to marshal; %s", err)
+	}
+
+	var dst process
+	if err := s.Unmarshal(instance, &dst); err != nil {
+		t.Fatalf("Failed to unmarshal; %s", err)
+	}
+	if dst.Name != "other.exe" || dst.Description != "Marshalled process" {
+		t.Errorf("Empty field was marshalled; got %+v", dst)
+	}
+}
+
+func TestMarshal_NamedTypes(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	instanceRaw, err := s.spawnInstance("Win32_Process")
+	if err != nil {
+		t.Fatalf("Failed to spawn Win32_Process; %s", err)
+	}
+	defer instanceRaw.Clear()
+	instance := instanceRaw.ToIDispatch()
+
+	type (
+		name     string
+		priority uint32
+	)
+	type process struct {
+		Name      name
+		Priority  priority
+		ProcessId *priority
+	}
+	pid := priority(4242)
+	if err := Marshal(instance, process{Name: "test.exe", Priority: 8, ProcessId: &pid}); err != nil {
+		t.Fatalf("Failed to marshal; %s", err)
+	}
+
+	var dst process
+	if err := s.Unmarshal(instance, &dst); err != nil {
+		t.Fatalf("Failed to unmarshal; %s", err)
+	}
+	if dst.Name != "test.exe" || dst.Priority != 8 || dst.ProcessId == nil || *dst.ProcessId != pid {
+		t.Errorf("Got unexpected round trip result %+v", dst)
+	}
+}
+
+func TestMarshal_Arrays(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	instanceRaw, err := s.spawnInstance("Win32_NetworkAdapterConfiguration")
+	if err != nil {
+		t.Fatalf("Failed to spawn Win32_NetworkAdapterConfiguration; %s", err)
+	}
+	defer instanceRaw.Clear()
+	instance := instanceRaw.ToIDispatch()
+
+	type address string
+	type adapter struct {
+		IPAddress            []address
+		DNSServerSearchOrder []string
+	}
+	src := adapter{
+		IPAddress:            []address{"10.0.0.1", "10.0.0.2"},
+		DNSServerSearchOrder: []string{"8.8.8.8"},
+	}
+	if err := Marshal(instance, src); err != nil {
+		t.Fatalf("Failed to marshal; %s", err)
+	}
+
+	var dst adapter
+	if err := s.Unmarshal(instance, &dst); err != nil {
+		t.Fatalf("Failed to unmarshal; %s", err)
+	}
+	if !reflect.DeepEqual(dst, src) {
+		t.Errorf("Got unexpected round trip result; got %+v, expected %+v", dst, src)
+	}
+
+	// Decoded integer arrays can't be marshalled back.
+	var costs struct {
+		GatewayCostMetric []uint16
+	}
+	if err := s.Unmarshal(instance, &costs); err != nil {
+		t.Fatalf("Failed to unmarshal; %s", err)
+	}
+	costs.GatewayCostMetric = append(costs.GatewayCostMetric, 1)
+	if err := Marshal(instance, costs); err == nil || !strings.Contains(err.Error(), "[]uint16") {
+		t.Errorf("Unexpected error for unsupported slice type; got %v", err)
+	}
+}
+
+func TestMarshalValue_StringArrays(t *testing.T) {
+	date := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	tests := []struct {
+		src      interface{}
+		expected []string
+	}{
+		{[]int64{-1, 1 << 40}, []string{"-1", "1099511627776"}},
+		{[]uint64{1 << 63}, []string{"9223372036854775808"}},
+		{[]time.Time{date}, []string{"20200102030405.000006+000"}},
+	}
+	for _, test := range tests {
+		value, ok, err := marshalValue(reflect.ValueOf(test.src))
+		if err != nil || !ok {
+			t.Errorf("Failed to marshal %v; %v", test.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("Unexpected value of %v; got %#v, expected %#v", test.src, value, test.expected)
+		}
+	}
+	if _, _, err := marshalValue(reflect.ValueOf([]bool{true})); err == nil {
+		t.Errorf("Unsupported []bool is marshalled")
+	}
+}
+
+func TestHasFieldOption(t *testing.T) {
+	tests := []struct {
+		options string
+		option  string
+		has     bool
+	}{
+		{"", "ref", false},
+		{"ref", "ref", true},
+		{"omitempty,ref", "ref", true},
+		{"omitempty,ref", "omitempty", true},
+		{"omitempty,reference", "ref", false},
+	}
+	for _, test := range tests {
+		if has := hasFieldOption(test.options, test.option); has != test.has {
+			t.Errorf("hasFieldOption(%q, %q) = %v; expected %v", test.options, test.option, has, test.has)
+		}
+	}
+}
+
+func TestFormatDateTime(t *testing.T) {
+	cases := []struct {
+		t        time.Time
+		expected string
+	}{
+		{time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC), "20200102030405.000006+000"},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3*60*60)), "20200102030405.000000+180"},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("", -5*60*60)), "20200102030405.000000-300"},
+	}
+	for _, c := range cases {
+		if got := formatDateTime(c.t); got != c.expected {
+			t.Errorf("Unexpected CIM_DATETIME for %s; got %q, expected %q", c.t, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// +build windows
+
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	wbemFlagDeep    = 0x0
+	wbemFlagShallow = 0x1
+)
+
+// ErrNamespaceAccessDenied is returned by the recursive `ListNamespaces` call
+// if some of the nested namespaces have been skipped because of insufficient
+// access rights. All accessible namespaces are returned along with the error.
+type ErrNamespaceAccessDenied struct {
+	Namespaces []string
+}
+
+func (e ErrNamespaceAccessDenied) Error() string {
+	return fmt.Sprintf("wmi: access denied to %d namespace(s): %s",
+		len(e.Namespaces), strings.Join(e.Namespaces, ", "))
+}
+
+// ListNamespaces returns full names of the namespaces nested into the @root
+// namespace (e.g. `root\cimv2` for @root=`root`) of the connection server.
+// Nested namespaces are connected using the same credentials as the
+// connection itself.
+//
+// If @recursive is set, the whole namespace tree is walked. Namespaces that
+// can't be walked due to the access rights are skipped and reported with
+// `ErrNamespaceAccessDenied` along with the rest of the result.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/--namespace
+func (s *SWbemServicesConnection) ListNamespaces(root string, recursive bool) ([]string, error) {
+	if root == "" {
+		root = "root"
+	}
+	var result, denied []string
+	if err := s.walkNamespaces(root, recursive, &result, &denied); err != nil {
+		return nil, err
+	}
+	if len(denied) > 0 {
+		return result, ErrNamespaceAccessDenied{Namespaces: denied}
+	}
+	return result, nil
+}
+
+func (s *SWbemServicesConnection) walkNamespaces(namespace string, recursive bool, result, denied *[]string) (err error) {
+	conn, err := s.connectNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if clErr := conn.Close(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	var children []struct {
+		Name string
+	}
+	if err := conn.Query("SELECT Name FROM __NAMESPACE", &children); err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		name := namespace + `\` + child.Name
+		*result = append(*result, name)
+		if !recursive {
+			continue
+		}
+		if err := s.walkNamespaces(name, recursive, result, denied); err != nil {
+			if !isAccessDeniedError(err) {
+				return err
+			}
+			*denied = append(*denied, name)
+		}
+	}
+	return nil
+}
+
+// ListClasses returns names of the classes derived from @superclass in the
+// @namespace (if empty - the connection namespace is used). If @deep is not
+// set only direct subclasses are returned. If @superclass is empty the classes
+// are listed from the root of the hierarchy, i.e. all classes of the namespace
+// with @deep and only the top-level ones without it.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemservices-subclassesof
+func (s *SWbemServicesConnection) ListClasses(namespace, superclass string, deep bool) (classes []string, err error) {
+	s.Lock()
+	if s.sWbemServices == nil {
+		s.Unlock()
+		return nil, ErrConnectionClosed
+	}
+	s.Unlock()
+
+	conn := s
+	if namespace != "" {
+		conn, err = s.connectNamespace(namespace)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if clErr := conn.Close(); clErr != nil {
+				err = multierror.Append(err, clErr)
+			}
+		}()
+	}
+
+	var dst []struct {
+		System struct {
+			Class string
+		} `wmi:"Path_"`
+	}
+	qDst, err := newQueryDst(&dst)
+	if err != nil {
+		return nil, err
+	}
+	flags := wbemFlagShallow
+	if deep {
+		flags = wbemFlagDeep
+	}
+	if err := conn.fetch(qDst, "SubclassesOf", superclass, flags); err != nil {
+		return nil, err
+	}
+
+	classes = make([]string, 0, len(dst))
+	for _, c := range dst {
+		classes = append(classes, c.System.Class)
+	}
+	return classes, nil
+}
+
+// InstancesOf retrieves all instances of the @class and appends them to @dst
+// the same way as `Query` does. If @shallow is set, instances of the
+// subclasses are not returned.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemservices-instancesof
+func (s *SWbemServicesConnection) InstancesOf(class string, dst interface{}, shallow bool) error {
+	s.Lock()
+	if s.sWbemServices == nil {
+		s.Unlock()
+		return ErrConnectionClosed
+	}
+	s.Unlock()
+
+	qDst, err := newQueryDst(dst)
+	if err != nil {
+		return err
+	}
+	flags := wbemFlagDeep
+	if shallow {
+		flags = wbemFlagShallow
+	}
+	return s.fetch(qDst, "InstancesOf", class, flags)
+}
+
+// connectNamespace connects to the @namespace of the same server using the
+// same arguments and observer as the connection has been created with.
+func (s *SWbemServicesConnection) connectNamespace(namespace string) (conn *SWbemServicesConnection, err error) {
+	args := make([]interface{}, 2, len(s.connectServerArgs)+2)
+	copy(args, s.connectServerArgs)
+	if len(s.connectServerArgs) > 2 {
+		args = append(args, s.connectServerArgs[2:]...)
+	}
+	if args[0] == nil {
+		args[0] = "." // Connection to the local machine by default.
+	}
+	args[1] = namespace
+
+	services, err := NewSWbemServices()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := services.Close(); closeErr != nil {
+			err = multierror.Append(err, closeErr)
+		}
+	}()
+	conn, err = services.connectServer(s.Decoder, s.Observer, args...)
+	if err != nil {
+		return nil, err
+	}
+	conn.RetryPolicy = s.RetryPolicy
+	if err := conn.SetSecurity(s.Security()); err != nil {
+		return nil, multierror.Append(err, conn.Close())
+	}
+	return conn, nil
+}
+
+func isAccessDeniedError(err error) bool {
+	return errors.Is(err, ErrAccessDenied) || errors.Is(err, ErrCOMAccessDenied)
+}
@@ -0,0 +1,129 @@
+// +build windows
+
+package wmi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSWbemServicesConnection_ListNamespaces(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	namespaces, err := s.ListNamespaces("root", false)
+	if err != nil {
+		t.Fatalf("Failed to list namespaces; %s", err)
+	}
+	if !containsFold(namespaces, `root\cimv2`) {
+		t.Errorf("Failed to find root\\cimv2 in %v", namespaces)
+	}
+	for _, ns := range namespaces {
+		if strings.Count(ns, `\`) != 1 {
+			t.Errorf("Got nested namespace %q in non-recursive listing", ns)
+		}
+	}
+
+	all, err := s.ListNamespaces("root", true)
+	if err != nil {
+		if denied, ok := err.(ErrNamespaceAccessDenied); ok {
+			t.Logf("Some namespaces were skipped; %v", denied.Namespaces)
+		} else {
+			t.Fatalf("Failed to list namespaces recursively; %s", err)
+		}
+	}
+	if len(all) <= len(namespaces) {
+		t.Errorf("Recursive listing returned too few namespaces; got %d, non-recursive %d", len(all), len(namespaces))
+	}
+	for _, ns := range namespaces {
+		if !containsFold(all, ns) {
+			t.Errorf("Failed to find %q in recursive listing", ns)
+		}
+	}
+}
+
+func TestSWbemServicesConnection_ListNamespaces_Observer(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+	rec := &recordingObserver{}
+	s.Observer = rec
+
+	if _, err := s.ListNamespaces("root", false); err != nil {
+		t.Fatalf("Failed to list namespaces; %s", err)
+	}
+	var connects int
+	for _, info := range rec.done {
+		if info.Operation == OpConnect {
+			connects++
+			if info.Host != "." || info.Namespace != "root" || info.Err != nil {
+				t.Errorf("Unexpected connect call info %+v", info)
+			}
+		}
+	}
+	if connects != 1 {
+		t.Errorf("Unexpected %d observed connects", connects)
+	}
+}
+
+func TestSWbemServicesConnection_ListClasses(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	classes, err := s.ListClasses("", "CIM_Process", true)
+	if err != nil {
+		t.Fatalf("Failed to list CIM_Process subclasses; %s", err)
+	}
+	if !containsFold(classes, "Win32_Process") {
+		t.Errorf("Failed to find Win32_Process in %v", classes)
+	}
+
+	classes, err = s.ListClasses(`root\subscription`, "__EventConsumer", true)
+	if err != nil {
+		t.Fatalf("Failed to list __EventConsumer subclasses; %s", err)
+	}
+	if !containsFold(classes, "CommandLineEventConsumer") {
+		t.Errorf("Failed to find CommandLineEventConsumer in %v", classes)
+	}
+}
+
+func TestSWbemServicesConnection_InstancesOf(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	var dst []Win32_OperatingSystem
+	if err := s.InstancesOf("Win32_OperatingSystem", &dst, false); err != nil {
+		t.Fatalf("Failed to get Win32_OperatingSystem instances; %s", err)
+	}
+	if len(dst) != 1 {
+		t.Errorf("Got unexpected number of Win32_OperatingSystem instances; got %d, expected 1", len(dst))
+	}
+
+	var processes []struct{ Name string }
+	if err := s.InstancesOf("CIM_Process", &processes, true); err != nil {
+		t.Fatalf("Failed to get CIM_Process instances; %s", err)
+	}
+	if len(processes) != 0 {
+		t.Errorf("Got %d instances of abstract CIM_Process with shallow flag", len(processes))
+	}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
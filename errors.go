@@ -0,0 +1,261 @@
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bi-zone/go-ole"
+)
+
+// WbemError is an error returned by the WMI call. It carries the HRESULT of
+// the failed call, so it could be checked against the sentinel errors below
+// using `errors.Is`, e.g.
+//
+//	err := conn.Get(`Win32_Process.Handle="42"`, &process)
+//	if errors.Is(err, wmi.ErrNotFound) {
+//		// No such process.
+//	}
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/wmi-error-constants
+type WbemError struct {
+	// HResult is the error code. For exceptions raised by the WMI scripting
+	// API it's the exception SCODE (e.g. WBEM_E_NOT_FOUND) instead of the
+	// DISP_E_EXCEPTION.
+	HResult uint32
+
+	// Operation is the failed call, e.g. "SWbemServices ExecQuery".
+	Operation string
+
+	// Description is the error description provided by WMI (if any).
+	Description string
+
+	// Err is the original error (usually *ole.OleError).
+	Err error
+}
+
+// Sentinel errors to be used with `errors.Is`. Only HRESULT is compared, so
+// e.g. any `WbemError` with WBEM_E_NOT_FOUND code matches `ErrNotFound`.
+var (
+	ErrFailed                  = &WbemError{HResult: 0x80041001}
+	ErrNotFound                = &WbemError{HResult: 0x80041002}
+	ErrAccessDenied            = &WbemError{HResult: 0x80041003}
+	ErrProviderFailure         = &WbemError{HResult: 0x80041004}
+	ErrTypeMismatch            = &WbemError{HResult: 0x80041005}
+	ErrOutOfMemory             = &WbemError{HResult: 0x80041006}
+	ErrInvalidParameter        = &WbemError{HResult: 0x80041008}
+	ErrNotAvailable            = &WbemError{HResult: 0x80041009}
+	ErrNotSupported            = &WbemError{HResult: 0x8004100C}
+	ErrInvalidNamespace        = &WbemError{HResult: 0x8004100E}
+	ErrInvalidObject           = &WbemError{HResult: 0x8004100F}
+	ErrInvalidClass            = &WbemError{HResult: 0x80041010}
+	ErrProviderNotFound        = &WbemError{HResult: 0x80041011}
+	ErrProviderLoadFailure     = &WbemError{HResult: 0x80041013}
+	ErrTransportFailure        = &WbemError{HResult: 0x80041015}
+	ErrInvalidOperation        = &WbemError{HResult: 0x80041016}
+	ErrInvalidQuery            = &WbemError{HResult: 0x80041017}
+	ErrInvalidQueryType        = &WbemError{HResult: 0x80041018}
+	ErrAlreadyExists           = &WbemError{HResult: 0x80041019}
+	ErrInvalidSyntax           = &WbemError{HResult: 0x80041021}
+	ErrIllegalNull             = &WbemError{HResult: 0x80041028}
+	ErrInvalidMethod           = &WbemError{HResult: 0x8004102E}
+	ErrInvalidMethodParameters = &WbemError{HResult: 0x8004102F}
+	ErrInvalidProperty         = &WbemError{HResult: 0x80041031}
+	ErrCallCancelled           = &WbemError{HResult: 0x80041032}
+	ErrShuttingDown            = &WbemError{HResult: 0x80041033}
+	ErrInvalidObjectPath       = &WbemError{HResult: 0x8004103A}
+	ErrServerTooBusy           = &WbemError{HResult: 0x80041045}
+	ErrUnparsableQuery         = &WbemError{HResult: 0x80041058}
+	ErrPrivilegeNotHeld        = &WbemError{HResult: 0x80041062}
+	ErrTimedOut                = &WbemError{HResult: 0x80041069}
+	ErrQuotaViolation          = &WbemError{HResult: 0x8004106C}
+	ErrConnectionFailed        = &WbemError{HResult: 0x80041070}
+	// ErrRetryLater is returned by `SWbemEventSource.NextEvent` on timeout
+	// (wbemErrTimedout in the scripting API terms).
+	ErrRetryLater         = &WbemError{HResult: 0x80043001}
+	ErrResourceContention = &WbemError{HResult: 0x80043002}
+
+	// COM and RPC errors.
+	ErrCOMAccessDenied      = &WbemError{HResult: 0x80070005}
+	ErrRPCCallRejected      = &WbemError{HResult: 0x80010001}
+	ErrRPCDisconnected      = &WbemError{HResult: 0x80010108}
+	ErrRPCServerUnavailable = &WbemError{HResult: 0x800706BA}
+	ErrRPCServerTooBusy     = &WbemError{HResult: 0x800706BB}
+	ErrRPCCallFailed        = &WbemError{HResult: 0x800706BE}
+	ErrRPCCallFailedDNE     = &WbemError{HResult: 0x800706BF}
+)
+
+type errorCode struct {
+	name        string
+	description string
+}
+
+var errorCodes = map[uint32]errorCode{
+	0x80041001: {"WBEM_E_FAILED", "Call failed"},
+	0x80041002: {"WBEM_E_NOT_FOUND", "Object cannot be found"},
+	0x80041003: {"WBEM_E_ACCESS_DENIED", "Current user does not have permission to perform the action"},
+	0x80041004: {"WBEM_E_PROVIDER_FAILURE", "Provider has failed at some time other than during initialization"},
+	0x80041005: {"WBEM_E_TYPE_MISMATCH", "Type mismatch occurred"},
+	0x80041006: {"WBEM_E_OUT_OF_MEMORY", "Not enough memory for the operation"},
+	0x80041007: {"WBEM_E_INVALID_CONTEXT", "The SWbemNamedValue object is not valid"},
+	0x80041008: {"WBEM_E_INVALID_PARAMETER", "One of the parameters to the call is not correct"},
+	0x80041009: {"WBEM_E_NOT_AVAILABLE", "Resource, typically a remote server, is not currently available"},
+	0x8004100A: {"WBEM_E_CRITICAL_ERROR", "Internal, critical, and unexpected error occurred"},
+	0x8004100B: {"WBEM_E_INVALID_STREAM", "One or more network packets were corrupted during a remote session"},
+	0x8004100C: {"WBEM_E_NOT_SUPPORTED", "Feature or operation is not supported"},
+	0x8004100D: {"WBEM_E_INVALID_SUPERCLASS", "Parent class specified is not valid"},
+	0x8004100E: {"WBEM_E_INVALID_NAMESPACE", "Namespace specified cannot be found"},
+	0x8004100F: {"WBEM_E_INVALID_OBJECT", "Specified instance is not valid"},
+	0x80041010: {"WBEM_E_INVALID_CLASS", "Specified class is not valid"},
+	0x80041011: {"WBEM_E_PROVIDER_NOT_FOUND", "Provider referenced in the schema does not have a corresponding registration"},
+	0x80041012: {"WBEM_E_INVALID_PROVIDER_REGISTRATION", "Provider referenced in the schema has an incorrect or incomplete registration"},
+	0x80041013: {"WBEM_E_PROVIDER_LOAD_FAILURE", "COM cannot locate a provider referenced in the schema"},
+	0x80041014: {"WBEM_E_INITIALIZATION_FAILURE", "Component, such as a provider, failed to initialize for internal reasons"},
+	0x80041015: {"WBEM_E_TRANSPORT_FAILURE", "Networking error that prevents normal operation has occurred"},
+	0x80041016: {"WBEM_E_INVALID_OPERATION", "Requested operation is not valid"},
+	0x80041017: {"WBEM_E_INVALID_QUERY", "Query was not syntactically valid"},
+	0x80041018: {"WBEM_E_INVALID_QUERY_TYPE", "Requested query language is not supported"},
+	0x80041019: {"WBEM_E_ALREADY_EXISTS", "In a put operation, the object already exists"},
+	0x8004101A: {"WBEM_E_OVERRIDE_NOT_ALLOWED", "Not possible to perform the add operation on this qualifier"},
+	0x8004101D: {"WBEM_E_UNEXPECTED", "Unexpected error occurred"},
+	0x8004101E: {"WBEM_E_ILLEGAL_OPERATION", "Operation is not valid"},
+	0x8004101F: {"WBEM_E_CANNOT_BE_KEY", "Property cannot be part of the key"},
+	0x80041020: {"WBEM_E_INCOMPLETE_CLASS", "Class was made abstract when its parent class is not abstract"},
+	0x80041021: {"WBEM_E_INVALID_SYNTAX", "Query is syntactically not valid"},
+	0x80041023: {"WBEM_E_READ_ONLY", "Property is read-only"},
+	0x80041024: {"WBEM_E_PROVIDER_NOT_CAPABLE", "Provider cannot perform the requested operation"},
+	0x80041025: {"WBEM_E_CLASS_HAS_CHILDREN", "Attempt was made to make a change that invalidates a subclass"},
+	0x80041026: {"WBEM_E_CLASS_HAS_INSTANCES", "Attempt was made to delete or modify a class that has instances"},
+	0x80041027: {"WBEM_E_QUERY_NOT_IMPLEMENTED", "Query is not implemented by the provider"},
+	0x80041028: {"WBEM_E_ILLEGAL_NULL", "Value of Nothing/NULL was specified for a property that must have a value"},
+	0x8004102B: {"WBEM_E_VALUE_OUT_OF_RANGE", "Value is out of range"},
+	0x8004102D: {"WBEM_E_INVALID_CIM_TYPE", "CIM type specified is not valid"},
+	0x8004102E: {"WBEM_E_INVALID_METHOD", "Requested method is not available"},
+	0x8004102F: {"WBEM_E_INVALID_METHOD_PARAMETERS", "Parameters provided for the method are not valid"},
+	0x80041030: {"WBEM_E_SYSTEM_PROPERTY", "There was an attempt to get qualifiers on a system property"},
+	0x80041031: {"WBEM_E_INVALID_PROPERTY", "Property type is not recognized"},
+	0x80041032: {"WBEM_E_CALL_CANCELLED", "Asynchronous process has been canceled"},
+	0x80041033: {"WBEM_E_SHUTTING_DOWN", "User has requested an operation while WMI is in the process of shutting down"},
+	0x80041035: {"WBEM_E_UNSUPPORTED_PARAMETER", "One or more parameter values are not supported"},
+	0x8004103A: {"WBEM_E_INVALID_OBJECT_PATH", "Object path is not syntactically valid"},
+	0x8004103B: {"WBEM_E_OUT_OF_DISK_SPACE", "Insufficient resources to complete the operation"},
+	0x80041044: {"WBEM_E_TOO_MUCH_DATA", "Reply to the client request was too large"},
+	0x80041045: {"WBEM_E_SERVER_TOO_BUSY", "WMI is temporarily unable to service requests"},
+	0x80041055: {"WBEM_E_METHOD_NOT_IMPLEMENTED", "Attempt was made to execute a method not marked with [implemented]"},
+	0x80041056: {"WBEM_E_METHOD_DISABLED", "Attempt was made to execute a method marked with [disabled]"},
+	0x80041058: {"WBEM_E_UNPARSABLE_QUERY", "Query cannot be parsed"},
+	0x80041059: {"WBEM_E_NOT_EVENT_CLASS", "FROM clause of a filtering query references a class that is not an event class"},
+	0x8004105A: {"WBEM_E_MISSING_GROUP_WITHIN", "GROUP BY clause was used without the corresponding GROUP WITHIN clause"},
+	0x80041061: {"WBEM_E_QUEUE_OVERFLOW", "Asynchronous delivery queue overflow occurred"},
+	0x80041062: {"WBEM_E_PRIVILEGE_NOT_HELD", "Operation failed because the client did not have the necessary security privilege"},
+	0x80041063: {"WBEM_E_INVALID_OPERATOR", "Operator is not valid for this property type"},
+	0x80041064: {"WBEM_E_LOCAL_CREDENTIALS", "User specified a username/password/authority on a local connection"},
+	0x80041067: {"WBEM_E_CLIENT_TOO_SLOW", "Client was not retrieving objects quickly enough from an enumeration"},
+	0x80041068: {"WBEM_E_NULL_SECURITY_DESCRIPTOR", "Null security descriptor was used"},
+	0x80041069: {"WBEM_E_TIMED_OUT", "Operation timed out"},
+	0x8004106A: {"WBEM_E_INVALID_ASSOCIATION", "Association is not valid"},
+	0x8004106C: {"WBEM_E_QUOTA_VIOLATION", "Quota violation occurred"},
+	0x8004106F: {"WBEM_E_HANDLE_OUT_OF_DATE", "Handle is out of date"},
+	0x80041070: {"WBEM_E_CONNECTION_FAILED", "Connection to the server failed"},
+	0x80041081: {"WBEM_E_PROVIDER_SUSPENDED", "Provider is suspended"},
+	0x80041087: {"WBEM_E_ENCRYPTED_CONNECTION_REQUIRED", "Encrypted connection is required"},
+	0x80043001: {"WBEM_E_RETRY_LATER", "Operation timed out, retry later"},
+	0x80043002: {"WBEM_E_RESOURCE_CONTENTION", "Resource contention occurred"},
+
+	0x80004001: {"E_NOTIMPL", "Not implemented"},
+	0x80004005: {"E_FAIL", "Unspecified error"},
+	0x80070005: {"E_ACCESSDENIED", "Access is denied"},
+	0x8007000E: {"E_OUTOFMEMORY", "Not enough memory"},
+	0x80070035: {"ERROR_BAD_NETPATH", "The network path was not found"},
+	0x80070057: {"E_INVALIDARG", "One or more arguments are not valid"},
+	0x8007052E: {"ERROR_LOGON_FAILURE", "The user name or password is incorrect"},
+	0x80010001: {"RPC_E_CALL_REJECTED", "Call was rejected by callee"},
+	0x80010105: {"RPC_E_SERVERFAULT", "The server threw an exception"},
+	0x80010108: {"RPC_E_DISCONNECTED", "The object invoked has disconnected from its clients"},
+	0x8001010A: {"RPC_E_SERVERCALL_RETRYLATER", "The message filter indicated that the application is busy"},
+	0x800706BA: {"RPC_S_SERVER_UNAVAILABLE", "The RPC server is unavailable"},
+	0x800706BB: {"RPC_S_SERVER_TOO_BUSY", "The RPC server is too busy to complete this operation"},
+	0x800706BE: {"RPC_S_CALL_FAILED", "The remote procedure call failed"},
+	0x800706BF: {"RPC_S_CALL_FAILED_DNE", "The remote procedure call failed and did not execute"},
+	0x800706D9: {"EPT_S_NOT_REGISTERED", "There are no more endpoints available from the endpoint mapper"},
+	0x80020006: {"DISP_E_UNKNOWNNAME", "Unknown name"},
+	0x80020009: {"DISP_E_EXCEPTION", "Exception occurred"},
+}
+
+// Name returns the symbolic name of the error code, e.g. "WBEM_E_NOT_FOUND",
+// or an empty string if the code is unknown.
+func (e *WbemError) Name() string {
+	return errorCodes[e.HResult].name
+}
+
+func (e *WbemError) Error() string {
+	var b strings.Builder
+	if e.Operation != "" {
+		b.WriteString(e.Operation + " error; ")
+	}
+	if name := e.Name(); name != "" {
+		b.WriteString(name + " ")
+	}
+	fmt.Fprintf(&b, "(0x%08X)", e.HResult)
+
+	description := strings.TrimSpace(e.Description)
+	if description == "" {
+		description = errorCodes[e.HResult].description
+	}
+	if description != "" {
+		b.WriteString(": " + description)
+	}
+	return b.String()
+}
+
+// Is reports whether @target is a `WbemError` with the same HRESULT.
+func (e *WbemError) Is(target error) bool {
+	t, ok := target.(*WbemError)
+	return ok && t.HResult == e.HResult
+}
+
+// Unwrap returns the original error.
+func (e *WbemError) Unwrap() error {
+	return e.Err
+}
+
+// newWbemError wraps the error returned by the COM call @operation. COM errors
+// are converted to `WbemError`, other ones are just annotated with the
+// operation name. Returns nil if @err is nil.
+func newWbemError(operation string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var wbemErr *WbemError
+	if errors.As(err, &wbemErr) {
+		return err // Already wrapped.
+	}
+	code, ok := oleErrorCode(err)
+	if !ok {
+		return fmt.Errorf("%s error; %w", operation, err)
+	}
+	res := &WbemError{HResult: code, Operation: operation, Err: err}
+	var oleErr *ole.OleError
+	if errors.As(err, &oleErr) {
+		res.Description = oleErr.Description()
+	}
+	return res
+}
+
+// oleErrorCode returns HRESULT of the (possibly wrapped) COM error @err. For
+// the exceptions raised by the WMI scripting API the exception SCODE is
+// returned.
+func oleErrorCode(err error) (uint32, bool) {
+	var wbemErr *WbemError
+	if errors.As(err, &wbemErr) {
+		return wbemErr.HResult, true
+	}
+	var oleErr *ole.OleError
+	if !errors.As(err, &oleErr) {
+		return 0, false
+	}
+	if exception, ok := oleErr.SubError().(ole.EXCEPINFO); ok && exception.SCODE() != 0 {
+		return exception.SCODE(), true
+	}
+	return uint32(oleErr.Code()), true
+}
@@ -0,0 +1,97 @@
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bi-zone/go-ole"
+	"github.com/hashicorp/go-multierror"
+)
+
+func TestWbemError(t *testing.T) {
+	oleErr := ole.NewErrorWithDescription(0x80041002, "Not found ")
+	err := newWbemError("SWbemServices Get", oleErr)
+
+	var wbemErr *WbemError
+	if !errors.As(err, &wbemErr) {
+		t.Fatalf("Expected WbemError; got %T", err)
+	}
+	if wbemErr.HResult != 0x80041002 || wbemErr.Name() != "WBEM_E_NOT_FOUND" || wbemErr.Unwrap() != oleErr {
+		t.Errorf("Unexpected error %#v", wbemErr)
+	}
+	if expected := "SWbemServices Get error; WBEM_E_NOT_FOUND (0x80041002): Not found"; err.Error() != expected {
+		t.Errorf("Unexpected error text %q", err.Error())
+	}
+
+	// Sentinels should match through any wrapping.
+	wrapped := []error{
+		err,
+		fmt.Errorf("context; %w", err),
+		multierror.Append(err, errors.New("close failed")),
+		ErrFieldMismatch{FieldName: "Ref", Reason: err.Error(), Err: err},
+	}
+	for _, e := range wrapped {
+		if !errors.Is(e, ErrNotFound) {
+			t.Errorf("Wrapped error %q doesn't match ErrNotFound", e)
+		}
+		if errors.Is(e, ErrAccessDenied) {
+			t.Errorf("Wrapped error %q matches ErrAccessDenied", e)
+		}
+	}
+
+	// Second wrapping keeps the original operation.
+	if again := newWbemError("Other", err); again != err {
+		t.Errorf("Error wrapped twice; %s", again)
+	}
+}
+
+func TestWbemError_Text(t *testing.T) {
+	tests := []struct {
+		err      *WbemError
+		expected string
+	}{
+		{ErrRPCServerUnavailable, "RPC_S_SERVER_UNAVAILABLE (0x800706BA): The RPC server is unavailable"},
+		{&WbemError{HResult: 0x80041017, Operation: "SWbemServices ExecQuery"},
+			"SWbemServices ExecQuery error; WBEM_E_INVALID_QUERY (0x80041017): Query was not syntactically valid"},
+		{&WbemError{HResult: 0x8000FFFF}, "(0x8000FFFF)"},
+	}
+	for _, test := range tests {
+		if text := test.err.Error(); text != test.expected {
+			t.Errorf("Unexpected error text %q; expected %q", text, test.expected)
+		}
+	}
+}
+
+func TestNewWbemError(t *testing.T) {
+	if newWbemError("Op", nil) != nil {
+		t.Errorf("Non nil error for nil")
+	}
+
+	plain := errors.New("plain")
+	err := newWbemError("Op", plain)
+	if !errors.Is(err, plain) || err.Error() != "Op error; plain" {
+		t.Errorf("Unexpected error for non COM error; %v", err)
+	}
+	var wbemErr *WbemError
+	if errors.As(err, &wbemErr) {
+		t.Errorf("Non COM error converted to WbemError")
+	}
+
+	// All sentinels should have known names.
+	for _, sentinel := range []*WbemError{
+		ErrFailed, ErrNotFound, ErrAccessDenied, ErrProviderFailure, ErrTypeMismatch, ErrOutOfMemory,
+		ErrInvalidParameter, ErrNotAvailable, ErrNotSupported, ErrInvalidNamespace, ErrInvalidObject,
+		ErrInvalidClass, ErrProviderNotFound, ErrProviderLoadFailure, ErrTransportFailure,
+		ErrInvalidOperation, ErrInvalidQuery, ErrInvalidQueryType, ErrAlreadyExists, ErrInvalidSyntax,
+		ErrIllegalNull, ErrInvalidMethod, ErrInvalidMethodParameters, ErrInvalidProperty,
+		ErrCallCancelled, ErrShuttingDown, ErrInvalidObjectPath, ErrServerTooBusy, ErrUnparsableQuery,
+		ErrPrivilegeNotHeld, ErrTimedOut, ErrQuotaViolation, ErrConnectionFailed, ErrRetryLater,
+		ErrResourceContention, ErrCOMAccessDenied, ErrRPCCallRejected, ErrRPCDisconnected,
+		ErrRPCServerUnavailable, ErrRPCServerTooBusy, ErrRPCCallFailed, ErrRPCCallFailedDNE,
+	} {
+		if sentinel.Name() == "" {
+			t.Errorf("Sentinel 0x%08X has no name", sentinel.HResult)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// +build windows
+
+package wmi
+
+import (
+	"github.com/bi-zone/go-ole"
+)
+
+// Executor owns a single SWbemServicesConnection and a dedicated OS thread
+// with initialized COM. All calls are queued and run on that thread one by
+// one, so COM objects of the connection are never used from other threads.
+//
+// Executor is safe for concurrent use, but calls are serialized. Use several
+// executors (or a `Pool`) to run queries in parallel.
+type Executor struct {
+	thread *lockedThread
+	conn   *SWbemServicesConnection
+}
+
+// NewExecutor starts the executor thread and connects to the server defined
+// by @connectServerArgs on it. See `ConnectSWbemServices` for details.
+func NewExecutor(connectServerArgs ...interface{}) (*Executor, error) {
+	e := &Executor{}
+	thread, err := startThread(initCOM, ole.CoUninitialize)
+	if err != nil {
+		return nil, err
+	}
+	e.thread = thread
+
+	err = thread.run(func() (err error) {
+		e.conn, err = ConnectSWbemServices(connectServerArgs...)
+		return err
+	})
+	if err != nil {
+		thread.stop()
+		return nil, err
+	}
+	return e, nil
+}
+
+// initCOM initializes COM for the multithreaded apartment the same way as
+// `comshim` does.
+func initCOM() error {
+	if err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED); err != nil {
+		if oleErr, ok := err.(*ole.OleError); !ok || oleErr.Code() != 1 { // S_FALSE: already initialized.
+			return newWbemError("CoInitializeEx", err)
+		}
+	}
+	return nil
+}
+
+// Do runs @f with the executor connection on the executor thread, e.g. to
+// set the connection `Decoder` options. @f shouldn't keep the connection or
+// any COM objects obtained from it.
+func (e *Executor) Do(f func(conn *SWbemServicesConnection) error) error {
+	return e.thread.run(func() error {
+		return f(e.conn)
+	})
+}
+
+// Query runs the WQL query on the executor thread. See
+// `SWbemServicesConnection.Query` for details.
+func (e *Executor) Query(query string, dst interface{}) error {
+	return e.Do(func(conn *SWbemServicesConnection) error {
+		return conn.Query(query, dst)
+	})
+}
+
+// Get retrieves a single object on the executor thread. See
+// `SWbemServicesConnection.Get` for details.
+func (e *Executor) Get(path string, dst interface{}) error {
+	return e.Do(func(conn *SWbemServicesConnection) error {
+		return conn.Get(path, dst)
+	})
+}
+
+// ExecMethod executes a method on the executor thread. See
+// `SWbemServicesConnection.ExecMethod` for details.
+func (e *Executor) ExecMethod(objectPath, method string, in, out interface{}) error {
+	return e.Do(func(conn *SWbemServicesConnection) error {
+		return conn.ExecMethod(objectPath, method, in, out)
+	})
+}
+
+// Close closes the connection and stops the executor thread. Calls made after
+// Close fail with `ErrExecutorClosed`.
+func (e *Executor) Close() error {
+	err := e.Do(func(conn *SWbemServicesConnection) error {
+		return conn.Close()
+	})
+	e.thread.stop()
+	if err == ErrExecutorClosed {
+		return nil // Already closed.
+	}
+	return err
+}
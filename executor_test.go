@@ -0,0 +1,55 @@
+// +build windows
+
+package wmi
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestExecutor(t *testing.T) {
+	e, err := NewExecutor()
+	if err != nil {
+		t.Fatalf("NewExecutor: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var dst []Win32_OperatingSystem
+			errs <- e.Query(CreateQuery(&dst, ""), &dst)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Failed to query; %s", err)
+		}
+	}
+
+	var process Win32_Process
+	if err := e.Get(`Win32_Process.Handle="4"`, &process); err != nil {
+		t.Errorf("Failed to get; %s", err)
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Errorf("Second Close: %s", err)
+	}
+	var dst []Win32_OperatingSystem
+	if err := e.Query(CreateQuery(&dst, ""), &dst); err != ErrExecutorClosed {
+		t.Errorf("Unexpected error of closed executor; %v", err)
+	}
+}
+
+func TestExecutor_ConnectError(t *testing.T) {
+	if _, err := NewExecutor(".", `root\NoSuchNamespace`); err == nil {
+		t.Errorf("Connected to nonexistent namespace")
+	}
+}
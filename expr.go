@@ -0,0 +1,693 @@
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// CompileEventExpr compiles the filter expression @expr to the predicate of
+// the events of the @event type (a structure or a pointer to it). The
+// predicate accepts the pointers to such events. Fields of the event are
+// resolved at compile time, so the misspelled ones are reported as the error.
+//
+// The expression language is a small WQL-like one:
+//
+//	TargetInstance.Name IN ('cmd.exe', 'powershell.exe') AND NOT TargetInstance.CommandLine MATCHES '(?i)-enc\s'
+//	ProcessId > 4 AND Started = TRUE OR ParentProcessId IS NULL
+//	Time WITHIN 5m AND Time BETWEEN '09:00' AND '18:00'
+//
+// Supported constructs:
+//   - field paths: the property names (or the Go field names) of the
+//     structure fields separated by dots, resolved case insensitively and
+//     walking through the pointers and interfaces (e.g. `InstanceEvent.Target`);
+//   - literals: 'strings' (or "strings"), numbers, durations (e.g. 1h30m),
+//     TRUE, FALSE and NULL;
+//   - comparisons: =, !=, <>, <, <=, >, >=; strings are compared case
+//     insensitively as WQL does, times could be compared with RFC 3339
+//     strings, types implementing fmt.Stringer (e.g. `InstanceEventKind`)
+//     could be compared with strings;
+//   - `x IN (a, b, ...)` and `x NOT IN (...)` set membership;
+//   - `x MATCHES 'regexp'` with Go regexp syntax;
+//   - `x IS NULL` and `x IS NOT NULL` for nil pointers and interfaces;
+//   - `t WITHIN d` is true if the time t is within the duration d from now;
+//   - `x BETWEEN a AND b` inclusive range; if x is a time and a, b are
+//     'HH:MM[:SS]' strings, the time of day is checked (the range could wrap
+//     around midnight);
+//   - AND, OR, NOT and parentheses.
+//
+// Keywords are case insensitive.
+func CompileEventExpr(expr string, event interface{}) (EventPredicate, error) {
+	t := reflect.TypeOf(event)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, ErrInvalidEntityType
+	}
+	return compileExpr(expr, t, systemClock{})
+}
+
+// compileExpr compiles the @expr to the predicate of the pointers to the @t
+// structures. @clock is used to evaluate WITHIN.
+func compileExpr(expr string, t reflect.Type, clock Clock) (EventPredicate, error) {
+	tokens, err := lexExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := exprParser{tokens: tokens, eventType: t, clock: clock}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("wmi: invalid expression %q; %w", expr, err)
+	}
+	if tok := p.peek(); tok.kind != exprEOF {
+		return nil, fmt.Errorf("wmi: invalid expression %q; unexpected %s", expr, tok)
+	}
+	return func(event interface{}) bool {
+		return cond(reflect.ValueOf(event))
+	}, nil
+}
+
+type exprTokenKind int
+
+const (
+	exprEOF exprTokenKind = iota
+	exprIdent
+	exprString
+	exprNumber
+	exprDuration
+	exprPunct
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string // Unquoted for strings.
+	pos  int
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case exprEOF:
+		return "end of expression"
+	case exprString:
+		return fmt.Sprintf("string %q at %d", t.text, t.pos)
+	}
+	return fmt.Sprintf("%q at %d", t.text, t.pos)
+}
+
+// is reports whether the token is the @keyword identifier or the punctuation.
+func (t exprToken) is(keyword string) bool {
+	return (t.kind == exprIdent || t.kind == exprPunct) && strings.EqualFold(t.text, keyword)
+}
+
+// lexExpr splits the @expr into the tokens.
+func lexExpr(expr string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			for i++; i < len(expr) && expr[i] != c; i++ {
+				if expr[i] == '\\' && i+1 < len(expr) && (expr[i+1] == c || expr[i+1] == '\\') {
+					i++
+				}
+				b.WriteByte(expr[i])
+			}
+			if i == len(expr) {
+				return nil, fmt.Errorf("wmi: unterminated string at %d", start)
+			}
+			i++
+			tokens = append(tokens, exprToken{kind: exprString, text: b.String(), pos: start})
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(expr) && expr[i+1] >= '0' && expr[i+1] <= '9':
+			kind := exprNumber
+			for i++; i < len(expr) && (isExprIdentChar(expr[i]) || expr[i] == '.' ||
+				(expr[i] == '+' || expr[i] == '-') && (expr[i-1] == 'e' || expr[i-1] == 'E')); i++ {
+				if unicode.IsLetter(rune(expr[i])) && expr[i] != 'e' && expr[i] != 'E' {
+					kind = exprDuration
+				}
+			}
+			tokens = append(tokens, exprToken{kind: kind, text: expr[start:i], pos: start})
+		case isExprIdentChar(c):
+			for i++; i < len(expr) && (isExprIdentChar(expr[i]) || expr[i] == '.'); i++ {
+			}
+			tokens = append(tokens, exprToken{kind: exprIdent, text: expr[start:i], pos: start})
+		default:
+			op := string(c)
+			if i+1 < len(expr) {
+				switch two := expr[i : i+2]; two {
+				case "==", "!=", "<>", "<=", ">=":
+					op = two
+				}
+			}
+			switch op {
+			case "(", ")", ",", "=", "<", ">", "==", "!=", "<>", "<=", ">=":
+			default:
+				return nil, fmt.Errorf("wmi: unexpected %q at %d", op, start)
+			}
+			i += len(op)
+			tokens = append(tokens, exprToken{kind: exprPunct, text: op, pos: start})
+		}
+	}
+	return append(tokens, exprToken{kind: exprEOF, pos: len(expr)}), nil
+}
+
+func isExprIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// exprCond is the compiled condition evaluated on the event pointer.
+type exprCond func(event reflect.Value) bool
+
+// exprOperand is the compiled operand returning the normalized value (see
+// normalizeValue).
+type exprOperand func(event reflect.Value) interface{}
+
+type exprParser struct {
+	tokens    []exprToken
+	pos       int
+	eventType reflect.Type
+	clock     Clock
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != exprEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it's the @keyword.
+func (p *exprParser) accept(keyword string) bool {
+	if p.peek().is(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(keyword string) error {
+	if !p.accept(keyword) {
+		return fmt.Errorf("expected %s, got %s", keyword, p.peek())
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprCond, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(ev reflect.Value) bool { return l(ev) || right(ev) }
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprCond, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(ev reflect.Value) bool { return l(ev) && right(ev) }
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprCond, error) {
+	if p.accept("NOT") {
+		cond, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(ev reflect.Value) bool { return !cond(ev) }, nil
+	}
+	if p.accept("(") {
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return cond, p.expect(")")
+	}
+	return p.parseCondition()
+}
+
+// parseCondition parses the comparison or the other operand condition.
+func (p *exprParser) parseCondition() (exprCond, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.next()
+	switch {
+	case tok.is("IS"):
+		negate := p.accept("NOT")
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return func(ev reflect.Value) bool { return (left(ev) == nil) != negate }, nil
+	case tok.is("NOT"):
+		if err := p.expect("IN"); err != nil {
+			return nil, err
+		}
+		in, err := p.parseIn(left)
+		if err != nil {
+			return nil, err
+		}
+		return func(ev reflect.Value) bool { return !in(ev) }, nil
+	case tok.is("IN"):
+		return p.parseIn(left)
+	case tok.is("MATCHES"):
+		pattern := p.next()
+		if pattern.kind != exprString {
+			return nil, fmt.Errorf("expected regexp string, got %s", pattern)
+		}
+		re, err := regexp.Compile(pattern.text)
+		if err != nil {
+			return nil, err
+		}
+		return func(ev reflect.Value) bool {
+			s, ok := stringValue(left(ev))
+			return ok && re.MatchString(s)
+		}, nil
+	case tok.is("WITHIN"):
+		d := p.next()
+		if d.kind != exprDuration {
+			return nil, fmt.Errorf("expected duration, got %s", d)
+		}
+		window, err := time.ParseDuration(d.text)
+		if err != nil {
+			return nil, err
+		}
+		return func(ev reflect.Value) bool {
+			t, ok := left(ev).(time.Time)
+			if !ok {
+				return false
+			}
+			since := p.clock.Now().Sub(t)
+			return since <= window && since >= -window
+		}, nil
+	case tok.is("BETWEEN"):
+		return p.parseBetween(left)
+	case tok.kind == exprPunct && tok.text != "(" && tok.text != ")" && tok.text != ",":
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		op := tok.text
+		return func(ev reflect.Value) bool { return compareValues(left(ev), right(ev), op) }, nil
+	}
+	return nil, fmt.Errorf("expected operator, got %s", tok)
+}
+
+// parseIn parses the `(a, b, ...)` list of the IN condition.
+func (p *exprParser) parseIn(left exprOperand) (exprCond, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var set []exprOperand
+	for {
+		item, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, item)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return func(ev reflect.Value) bool {
+		v := left(ev)
+		for _, item := range set {
+			if compareValues(v, item(ev), "=") {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// parseBetween parses the `a AND b` range of the BETWEEN condition.
+func (p *exprParser) parseBetween(left exprOperand) (exprCond, error) {
+	fromTok := p.peek()
+	from, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("AND"); err != nil {
+		return nil, err
+	}
+	toTok := p.peek()
+	to, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	fromDay, fromErr := parseTimeOfDay(fromTok.text)
+	toDay, toErr := parseTimeOfDay(toTok.text)
+	isTimeOfDay := fromTok.kind == exprString && toTok.kind == exprString && fromErr == nil && toErr == nil
+	return func(ev reflect.Value) bool {
+		v := left(ev)
+		if t, ok := v.(time.Time); ok && isTimeOfDay {
+			day := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+				time.Duration(t.Second())*time.Second
+			if fromDay <= toDay {
+				return day >= fromDay && day <= toDay
+			}
+			return day >= fromDay || day <= toDay // Wraps around midnight.
+		}
+		return compareValues(v, from(ev), ">=") && compareValues(v, to(ev), "<=")
+	}, nil
+}
+
+// parseTimeOfDay parses the "HH:MM[:SS]" time of day.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+				time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time of day %q", s)
+}
+
+// parseOperand parses the literal or the field path.
+func (p *exprParser) parseOperand() (exprOperand, error) {
+	tok := p.next()
+	var value interface{}
+	switch tok.kind {
+	case exprString:
+		value = tok.text
+	case exprNumber:
+		f, _, err := big.ParseFloat(tok.text, 10, exprPrecision, big.ToNearestEven)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", tok)
+		}
+		value = exprNumberValue{f: f}
+	case exprDuration:
+		d, err := time.ParseDuration(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %s", tok)
+		}
+		value = exprNumberValue{f: new(big.Float).SetPrec(exprPrecision).SetInt64(int64(d))}
+	case exprIdent:
+		switch {
+		case tok.is("TRUE"):
+			value = true
+		case tok.is("FALSE"):
+			value = false
+		case tok.is("NULL"):
+			value = nil
+		default:
+			return p.parseField(tok)
+		}
+	default:
+		return nil, fmt.Errorf("expected operand, got %s", tok)
+	}
+	return func(reflect.Value) interface{} { return value }, nil
+}
+
+// parseField compiles the field path accessor.
+func (p *exprParser) parseField(tok exprToken) (exprOperand, error) {
+	path := strings.Split(tok.text, ".")
+	index, err := resolveFieldPath(p.eventType, path)
+	if err != nil {
+		return nil, fmt.Errorf("%w at %d", err, tok.pos)
+	}
+	return func(ev reflect.Value) interface{} {
+		return normalizeValue(index(ev))
+	}, nil
+}
+
+// resolveFieldPath returns the accessor of the @path field of the @t
+// structure values (or pointers to them). Interfaces are resolved at the run
+// time, the accessor returns the invalid value if the field is missed or the
+// pointer is nil.
+func resolveFieldPath(t reflect.Type, path []string) (func(v reflect.Value) reflect.Value, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if len(path) == 0 {
+		return func(v reflect.Value) reflect.Value { return v }, nil
+	}
+	if t.Kind() == reflect.Interface {
+		rest := path
+		return func(v reflect.Value) reflect.Value {
+			v = indirectValue(v)
+			if !v.IsValid() {
+				return v
+			}
+			index, err := resolveFieldPath(v.Type(), rest)
+			if err != nil {
+				return reflect.Value{}
+			}
+			return index(v)
+		}, nil
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return nil, fmt.Errorf("%s has no field %q", t, path[0])
+	}
+
+	field, ok := lookupField(t, path[0])
+	if !ok {
+		return nil, fmt.Errorf("%s has no field %q", t, path[0])
+	}
+	next, err := resolveFieldPath(field.Type, path[1:])
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value) reflect.Value {
+		v = indirectValue(v)
+		if !v.IsValid() {
+			return v
+		}
+		return next(v.FieldByIndex(field.Index))
+	}, nil
+}
+
+// lookupField returns the field of the @t structure mapped to the @name
+// property or named so, case insensitively.
+func lookupField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for _, f := range structFields(t) {
+		if strings.EqualFold(f.Name, name) || strings.EqualFold(f.StructField.Name, name) {
+			return f.StructField, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// indirectValue dereferences the pointers and interfaces of @v. Returns the
+// invalid value for nil ones.
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// exprPrecision is the precision of the numbers enough to hold any 64-bit
+// integer exactly.
+const exprPrecision = 128
+
+// exprNumberValue is the normalized number. @str is the String() of the
+// fmt.Stringer numeric types.
+type exprNumberValue struct {
+	f   *big.Float
+	str string
+}
+
+// exprNonOrdered is the normalized NaN or infinite float, it fails all the
+// comparisons except "!=".
+type exprNonOrdered struct{}
+
+// normalizeValue converts the field value @v to one of: nil, bool, string,
+// time.Time, exprNumberValue, exprNonOrdered or the value itself for the other
+// types.
+func normalizeValue(v reflect.Value) interface{} {
+	orig := v
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time)
+	}
+	var f *big.Float
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f = new(big.Float).SetPrec(exprPrecision).SetInt64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f = new(big.Float).SetPrec(exprPrecision).SetUint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(v.Float()) || math.IsInf(v.Float(), 0) {
+			return exprNonOrdered{}
+		}
+		f = new(big.Float).SetPrec(exprPrecision).SetFloat64(v.Float())
+	default:
+		return v.Interface()
+	}
+	n := exprNumberValue{f: f}
+	if s, ok := orig.Interface().(fmt.Stringer); ok && orig.Kind() != reflect.Ptr {
+		n.str = s.String()
+	} else if s, ok := v.Interface().(fmt.Stringer); ok {
+		n.str = s.String()
+	}
+	return n
+}
+
+// stringValue returns the string of the normalized value @v if it's a string
+// or a fmt.Stringer number.
+func stringValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case exprNumberValue:
+		return v.str, v.str != ""
+	}
+	return "", false
+}
+
+// compareValues reports whether the normalized values @a and @b satisfy the
+// comparison @op. Values of the incompatible types satisfy only "!=".
+func compareValues(a, b interface{}, op string) bool {
+	cmp, ok := orderValues(a, b)
+	switch op {
+	case "=", "==":
+		return ok && cmp == 0
+	case "!=", "<>":
+		return !ok || cmp != 0
+	}
+	if !ok || a == nil || b == nil {
+		return false
+	}
+	if _, isBool := a.(bool); isBool {
+		return false // Booleans are not ordered.
+	}
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// orderValues returns -1, 0 or 1 if @a is less than, equal or greater than @b,
+// false if they are not comparable.
+func orderValues(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0, true
+		}
+		return 0, false
+	}
+	switch a := a.(type) {
+	case exprNumberValue:
+		switch b := b.(type) {
+		case exprNumberValue:
+			return a.f.Cmp(b.f), true
+		case string:
+			if a.str != "" {
+				return compareStrings(a.str, b), true
+			}
+			if f, _, err := big.ParseFloat(b, 10, exprPrecision, big.ToNearestEven); err == nil {
+				return a.f.Cmp(f), true // E.g. uint64 values are strings in WMI.
+			}
+		}
+	case string:
+		switch b := b.(type) {
+		case string:
+			return compareStrings(a, b), true
+		case exprNumberValue, time.Time:
+			cmp, ok := orderValues(b, a)
+			return -cmp, ok
+		}
+	case bool:
+		if b, ok := b.(bool); ok && a == b {
+			return 0, true
+		} else if ok {
+			return 1, true
+		}
+	case time.Time:
+		var t time.Time
+		switch b := b.(type) {
+		case time.Time:
+			t = b
+		case string:
+			var err error
+			if t, err = parseExprTime(b); err != nil {
+				return 0, false
+			}
+		default:
+			return 0, false
+		}
+		switch {
+		case a.Before(t):
+			return -1, true
+		case a.After(t):
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// compareStrings compares the strings case insensitively.
+func compareStrings(a, b string) int {
+	if strings.EqualFold(a, b) {
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// parseExprTime parses the RFC 3339 time or date.
+func parseExprTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid time " + strconv.Quote(s))
+}
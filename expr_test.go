@@ -0,0 +1,154 @@
+package wmi
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+type exprTestProcess struct {
+	Name        string
+	CommandLine string `wmi:"CommandLine"`
+	ProcessId   uint32
+	ParentPid   *uint32 `wmi:"ParentProcessId"`
+	WorkingSet  uint64
+	CPU         float64
+	Elevated    bool
+	Started     time.Time
+	Kind        InstanceEventKind
+}
+
+func TestCompileEventExpr(t *testing.T) {
+	parent := uint32(4)
+	p := &exprTestProcess{
+		Name:        "PowerShell.exe",
+		CommandLine: "powershell.exe -enc SQBFAFgA",
+		ProcessId:   1234,
+		ParentPid:   &parent,
+		WorkingSet:  1 << 40,
+		CPU:         12.5,
+		Elevated:    true,
+		Started:     time.Date(2020, 5, 1, 23, 30, 0, 0, time.UTC),
+		Kind:        InstanceCreated,
+	}
+	tests := []struct {
+		expr   string
+		result bool
+	}{
+		{"Name = 'powershell.exe'", true},
+		{`name == "POWERSHELL.EXE"`, true},
+		{"Name <> 'cmd.exe'", true},
+		{"Name IN ('cmd.exe', 'powershell.exe')", true},
+		{"Name NOT IN ('cmd.exe', 'powershell.exe')", false},
+		{`CommandLine MATCHES '(?i)\s-e(nc)?\s'`, true},
+		{"CommandLine MATCHES '^cmd'", false},
+		{"ProcessId > 1000 AND ProcessId <= 1234", true},
+		{"ProcessId >= 1235", false},
+		{"ProcessId = '1234'", true},
+		{"ParentProcessId = 4", true},
+		{"ParentPid IS NOT NULL", true},
+		{"ParentProcessId IS NULL", false},
+		{"WorkingSet > 1000000000", true},
+		{"CPU BETWEEN 12 AND 13", true},
+		{"CPU < -1", false},
+		{"Elevated = TRUE", true},
+		{"NOT Elevated = FALSE", true},
+		{"Started > '2020-05-01'", true},
+		{"Started = '2020-05-01T23:30:00Z'", true},
+		{"Started BETWEEN '22:00' AND '06:00'", true},
+		{"Started BETWEEN '09:00' AND '18:00:00'", false},
+		{"Started WITHIN 1h", true},
+		{"Started WITHIN 10m", false},
+		{"Kind = 'created'", true},
+		{"Kind IN ('deleted', 'modified')", false},
+		{"Name = 'cmd.exe' OR ProcessId = 1234 AND Elevated = TRUE", true},
+		{"(Name = 'cmd.exe' OR ProcessId = 1234) AND Elevated = FALSE", false},
+		{"Name = ProcessId", false},
+		{"Name != ProcessId", true},
+		{"Elevated < TRUE", false},
+	}
+	clock := &fakeClock{now: p.Started.Add(30 * time.Minute)}
+	for _, test := range tests {
+		pred, err := compileExpr(test.expr, structType(p), clock)
+		if err != nil {
+			t.Errorf("Failed to compile %q; %s", test.expr, err)
+			continue
+		}
+		if result := pred(p); result != test.result {
+			t.Errorf("Unexpected result of %q: %v", test.expr, result)
+		}
+	}
+}
+
+func TestCompileEventExpr_InstanceEvent(t *testing.T) {
+	ev := NewInstanceEvent(Win32_Service{})
+	ev.Kind = InstanceModified
+	ev.Target.(*Win32_Service).Name = "Spooler"
+	ev.Target.(*Win32_Service).State = "Stopped"
+
+	pred, err := CompileEventExpr("Kind = 'modified' AND Target.Name = 'spooler' AND Previous.State IS NULL", ev)
+	if err != nil {
+		t.Fatalf("Failed to compile; %s", err)
+	}
+	if !pred(ev) {
+		t.Errorf("Event isn't matched")
+	}
+
+	// Target fields are resolved at the run time.
+	pred, err = CompileEventExpr("Target.Missing = 1", InstanceEvent{})
+	if err != nil {
+		t.Fatalf("Failed to compile; %s", err)
+	}
+	if pred(ev) {
+		t.Errorf("Missing field is matched")
+	}
+}
+
+func TestCompileEventExpr_NonOrdered(t *testing.T) {
+	type event struct {
+		Value float64
+	}
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		for _, expr := range []string{"Value > 1", "Value <= 1", "Value = 1", "Value BETWEEN 0 AND 1", "Value IN (1, 2)"} {
+			pred, err := CompileEventExpr(expr, event{})
+			if err != nil {
+				t.Fatalf("Failed to compile %q; %s", expr, err)
+			}
+			if pred(&event{Value: v}) {
+				t.Errorf("%q is true for %v", expr, v)
+			}
+		}
+		pred, _ := CompileEventExpr("Value != 1", event{})
+		if !pred(&event{Value: v}) {
+			t.Errorf("%v is equal to 1", v)
+		}
+	}
+}
+
+func TestCompileEventExpr_Errors(t *testing.T) {
+	tests := []string{
+		"",
+		"Missing = 1",
+		"Name.Length = 1",
+		"Name =",
+		"Elevated",
+		"Name = 'unterminated",
+		"Name ~ 'x'",
+		"Name MATCHES '('",
+		"Name MATCHES Name",
+		"Started WITHIN 5",
+		"Name IN ('a', 'b'",
+		"(Name = 'a'",
+		"Name = 'a' Name = 'b'",
+		"Name IS 'a'",
+		"ProcessId BETWEEN 1 OR 2",
+	}
+	for _, expr := range tests {
+		if _, err := CompileEventExpr(expr, &exprTestProcess{}); err == nil {
+			t.Errorf("Invalid expression %q is compiled", expr)
+		}
+	}
+	if _, err := CompileEventExpr("Name = 'a'", "not a struct"); err != ErrInvalidEntityType {
+		t.Errorf("Unexpected error for invalid type; %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package wmi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrInvalidEntityType is returned in case of unsupported destination type
+// given to the `Query` call.
+var ErrInvalidEntityType = errors.New("wmi: invalid entity type")
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ErrFieldMismatch is returned when a field is to be loaded into a different
+// type than the one it was stored from, or when a field is missing or
+// unexported in the destination struct.
+// FieldType is the type of the struct pointed to by the destination argument.
+type ErrFieldMismatch struct {
+	FieldType reflect.Type
+	FieldName string
+	Reason    string
+
+	// Err is the error caused the mismatch (if any), e.g. `WbemError` of
+	// the failed dereference.
+	Err error
+}
+
+func (e ErrFieldMismatch) Error() string {
+	return fmt.Sprintf("wmi: cannot load field %q into a %q: %s",
+		e.FieldName, e.FieldType, e.Reason)
+}
+
+// Unwrap returns the error caused the mismatch.
+func (e ErrFieldMismatch) Unwrap() error {
+	return e.Err
+}
+
+// CreateQuery returns a WQL query string that queries all columns of @src.
+//
+// @src could be T, *T, []T, or *[]T;
+//
+// @where is an optional string that is appended to the query, to be used with
+// WHERE clauses. In such a case, the "WHERE" string should appear at
+// the beginning.
+//
+//	type Win32_Product struct {
+//		Name            string
+//		InstallLocation string
+//	}
+//	var dst []Win32_Product
+//	query := wmi.CreateQuery(&dst, "WHERE InstallLocation != null")
+func CreateQuery(src interface{}, where string) string {
+	return CreateQueryFrom(src, structType(src).Name(), where)
+}
+
+// CreateQuery returns a WQL query string that queries all columns of @src from
+// class @from with condition @where (optional).
+//
+// N.B. The call is the same as `CreateQuery` but uses @from instead of structure
+// name as a class name.
+func CreateQueryFrom(src interface{}, from, where string) string {
+	t := structType(src)
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+
+	var b bytes.Buffer
+	b.WriteString("SELECT ")
+	// Unlike `structFields` unexported fields are selected as well, that's
+	// how the query has always been built.
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _ := getFieldName(t.Field(i))
+		if name == "-" {
+			continue
+		}
+		fields = append(fields, name)
+	}
+	b.WriteString(strings.Join(fields, ", "))
+	b.WriteString(" FROM ")
+	b.WriteString(from)
+	b.WriteString(" " + where)
+	return b.String()
+}
+
+// structType returns the type of the structure from T, *T, []T, or *[]T.
+// Typed nil pointers are accepted.
+func structType(src interface{}) reflect.Type {
+	t := reflect.TypeOf(src)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
+
+// structField is a structure field mapped to the WMI object property.
+type structField struct {
+	reflect.StructField
+
+	Name  string // WMI property name.
+	IsRef bool   // Field is tagged with ",ref" option.
+}
+
+// structFields returns the structure fields mapped to WMI object properties.
+// Unexported fields and fields tagged with "-" are skipped.
+func structFields(t reflect.Type) []structField {
+	var res []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, options := getFieldName(f)
+		if f.PkgPath != "" || name == "-" {
+			continue
+		}
+		res = append(res, structField{StructField: f, Name: name, IsRef: hasFieldOption(options, "ref")})
+	}
+	return res
+}
+
+func getFieldName(fType reflect.StructField) (name, options string) {
+	tag := fType.Tag.Get("wmi")
+	if idx := strings.Index(tag, ","); idx != -1 {
+		name = tag[:idx]
+		options = tag[idx+1:]
+	} else {
+		name = tag
+	}
+	if name == "" {
+		name = fType.Name
+	}
+	return
+}
+
+// hasFieldOption reports whether the comma-separated tag @options contain
+// the @option flag.
+func hasFieldOption(options, option string) bool {
+	for options != "" {
+		var next string
+		if idx := strings.Index(options, ","); idx != -1 {
+			options, next = options[:idx], options[idx+1:]
+		}
+		if options == option {
+			return true
+		}
+		options = next
+	}
+	return false
+}
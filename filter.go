@@ -0,0 +1,215 @@
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// EventPredicate reports whether the event should be delivered. @event is the
+// pointer to the decoded event structure, e.g. *Win32_ProcessStartTrace for
+// `chan Win32_ProcessStartTrace`.
+type EventPredicate func(event interface{}) bool
+
+// FilterPolicy is the policy of the events filtering in Go before they are
+// delivered to the channel (see `SubscribeOptions.Filter`). It's useful for
+// the conditions WQL can't express. The stages are applied in order: the
+// predicates and the expression, deduplication, sampling, then the rate
+// limit. Events rejected are counted by `Subscription.Filtered`.
+type FilterPolicy struct {
+	// Predicates are the predicates the event should satisfy, all of them.
+	Predicates []EventPredicate
+
+	// Expr is an optional expression the event should satisfy (see
+	// `CompileEventExpr` for the syntax). It's compiled on subscribe.
+	Expr string
+
+	// DedupKeys are the property names (or field paths, e.g.
+	// "TargetInstance.Name") identifying the event for deduplication.
+	// Events with the same key are dropped within `DedupWindow` after the
+	// delivered one.
+	DedupKeys []string
+
+	// DedupKey is an optional function returning the key of the event. It's
+	// used instead of `DedupKeys` if set.
+	DedupKey func(event interface{}) string
+
+	// DedupWindow is the deduplication window, required if the key is set.
+	DedupWindow time.Duration
+
+	// SampleEvery delivers every N-th event (the first one, N+1-th and so
+	// on), zero means all of them.
+	SampleEvery int
+
+	// RateLimit is the maximal number of the events delivered per
+	// `RateWindow`, the rest are dropped. Zero means no limit.
+	RateLimit int
+
+	// RateWindow is the window of the `RateLimit`, required if it's set.
+	RateWindow time.Duration
+
+	// Clock is used for the windows and `WITHIN` expressions. If nil, the
+	// system clock is used.
+	Clock Clock
+}
+
+// Validate checks the policy consistency.
+func (p *FilterPolicy) Validate() error {
+	if p.SampleEvery < 0 {
+		return fmt.Errorf("wmi: invalid SampleEvery %d", p.SampleEvery)
+	}
+	if p.RateLimit < 0 || p.RateLimit > 0 && p.RateWindow <= 0 {
+		return errors.New("wmi: RateLimit requires positive RateWindow")
+	}
+	if (len(p.DedupKeys) > 0 || p.DedupKey != nil) && p.DedupWindow <= 0 {
+		return errors.New("wmi: deduplication requires positive DedupWindow")
+	}
+	return nil
+}
+
+// eventFilter applies the FilterPolicy to the events of a single
+// subscription. It's used from the subscription goroutine only.
+type eventFilter struct {
+	predicates []EventPredicate
+	dedupKey   func(event reflect.Value) string
+	dedup      time.Duration
+	seen       map[string]time.Time // Dedup key to the delivery time.
+	nextSweep  time.Time
+	every      int
+	count      int
+	rateLimit  int
+	rateWindow time.Duration
+	rateStart  time.Time
+	rateCount  int
+	clock      Clock
+}
+
+// newEventFilter returns the filter of the @policy for the events of @t
+// structure type. Returns nil if the policy filters nothing.
+func newEventFilter(policy *FilterPolicy, t reflect.Type) (*eventFilter, error) {
+	if policy == nil {
+		return nil, nil
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	f := eventFilter{
+		predicates: policy.Predicates,
+		dedup:      policy.DedupWindow,
+		every:      policy.SampleEvery,
+		rateLimit:  policy.RateLimit,
+		rateWindow: policy.RateWindow,
+		clock:      policy.Clock,
+	}
+	if f.clock == nil {
+		f.clock = systemClock{}
+	}
+	if policy.Expr != "" {
+		pred, err := compileExpr(policy.Expr, t, f.clock)
+		if err != nil {
+			return nil, err
+		}
+		f.predicates = append(append([]EventPredicate(nil), f.predicates...), pred)
+	}
+
+	switch {
+	case policy.DedupKey != nil:
+		f.dedupKey = func(ev reflect.Value) string { return policy.DedupKey(ev.Interface()) }
+	case len(policy.DedupKeys) > 0:
+		key, err := dedupKeyFunc(t, policy.DedupKeys)
+		if err != nil {
+			return nil, err
+		}
+		f.dedupKey = key
+	}
+	if f.dedupKey != nil {
+		f.seen = make(map[string]time.Time)
+	}
+
+	if len(f.predicates) == 0 && f.dedupKey == nil && f.every <= 1 && f.rateLimit == 0 {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+// dedupKeyFunc returns the function building the key of the @t structure
+// pointer from the @keys field paths.
+func dedupKeyFunc(t reflect.Type, keys []string) (func(ev reflect.Value) string, error) {
+	fields := make([]func(v reflect.Value) reflect.Value, len(keys))
+	for i, key := range keys {
+		index, err := resolveFieldPath(t, strings.Split(key, "."))
+		if err != nil {
+			return nil, fmt.Errorf("wmi: invalid dedup key; %w", err)
+		}
+		fields[i] = index
+	}
+	return func(ev reflect.Value) string {
+		values := make([]string, len(fields))
+		for i, index := range fields {
+			if v := indirectValue(index(ev)); v.IsValid() {
+				values[i] = fmt.Sprint(v.Interface())
+			}
+		}
+		return strings.Join(values, ",")
+	}, nil
+}
+
+// accept reports whether the event pointer @ev should be delivered.
+func (f *eventFilter) accept(ev reflect.Value) bool {
+	if len(f.predicates) > 0 {
+		event := ev.Interface()
+		for _, pred := range f.predicates {
+			if !pred(event) {
+				return false
+			}
+		}
+	}
+
+	now := f.clock.Now()
+	var key string
+	if f.dedupKey != nil {
+		key = f.dedupKey(ev)
+		if last, ok := f.seen[key]; ok && now.Sub(last) < f.dedup {
+			return false
+		}
+		f.forgetBefore(now.Add(-f.dedup))
+	}
+
+	if f.every > 1 {
+		f.count++
+		if (f.count-1)%f.every != 0 {
+			return false
+		}
+	}
+
+	if f.rateLimit > 0 {
+		if f.rateStart.IsZero() || now.Sub(f.rateStart) >= f.rateWindow {
+			f.rateStart, f.rateCount = now, 0
+		}
+		if f.rateCount >= f.rateLimit {
+			return false
+		}
+		f.rateCount++
+	}
+
+	if f.dedupKey != nil {
+		f.seen[key] = now
+	}
+	return true
+}
+
+// forgetBefore drops the dedup keys delivered before the @t, so the keys
+// don't pile up. Keys are swept once per the dedup window.
+func (f *eventFilter) forgetBefore(t time.Time) {
+	if t.Before(f.nextSweep) {
+		return
+	}
+	f.nextSweep = t.Add(f.dedup)
+	for key, delivered := range f.seen {
+		if delivered.Before(t) {
+			delete(f.seen, key)
+		}
+	}
+}
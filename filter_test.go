@@ -0,0 +1,169 @@
+package wmi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFilterPolicy_Validate(t *testing.T) {
+	invalid := []FilterPolicy{
+		{SampleEvery: -1},
+		{RateLimit: -1},
+		{RateLimit: 10},
+		{DedupKeys: []string{"ID"}},
+		{DedupKey: func(interface{}) string { return "" }, DedupWindow: -time.Second},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Invalid policy %+v is accepted", p)
+		}
+	}
+	if _, err := newEventFilter(&FilterPolicy{DedupKeys: []string{"Missing"}, DedupWindow: time.Second},
+		reflect.TypeOf(fakeEvent{})); err == nil {
+		t.Errorf("Unknown dedup key is accepted")
+	}
+	if f, err := newEventFilter(&FilterPolicy{SampleEvery: 1}, reflect.TypeOf(fakeEvent{})); f != nil || err != nil {
+		t.Errorf("Unexpected filter of no-op policy %v; %v", f, err)
+	}
+}
+
+// acceptedIDs returns the IDs of the @ids fake events accepted by the @f. The
+// @clock is advanced by @step after each event.
+func acceptedIDs(f *eventFilter, clock *fakeClock, step time.Duration, ids ...int) []int {
+	var accepted []int
+	for _, id := range ids {
+		if f.accept(reflect.ValueOf(&fakeEvent{ID: id})) {
+			accepted = append(accepted, id)
+		}
+		clock.now = clock.now.Add(step)
+	}
+	return accepted
+}
+
+func TestEventFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   FilterPolicy
+		step     time.Duration
+		ids      []int
+		accepted []int
+	}{
+		{
+			name: "predicates",
+			policy: FilterPolicy{
+				Predicates: []EventPredicate{func(ev interface{}) bool { return ev.(*fakeEvent).ID%2 == 0 }},
+				Expr:       "ID > 2",
+			},
+			ids:      []int{1, 2, 3, 4, 5, 6},
+			accepted: []int{4, 6},
+		},
+		{
+			name:     "dedup",
+			policy:   FilterPolicy{DedupKeys: []string{"ID"}, DedupWindow: 3 * time.Second},
+			step:     time.Second,
+			ids:      []int{1, 1, 2, 1, 1, 2, 2},
+			accepted: []int{1, 2, 1, 2},
+		},
+		{
+			name: "dedup func",
+			policy: FilterPolicy{
+				DedupKey:    func(ev interface{}) string { return "all" },
+				DedupWindow: 2 * time.Second,
+			},
+			step:     time.Second,
+			ids:      []int{1, 2, 3, 4, 5},
+			accepted: []int{1, 3, 5},
+		},
+		{
+			name:     "sample",
+			policy:   FilterPolicy{SampleEvery: 3},
+			ids:      []int{1, 2, 3, 4, 5, 6, 7},
+			accepted: []int{1, 4, 7},
+		},
+		{
+			name:     "rate limit",
+			policy:   FilterPolicy{RateLimit: 2, RateWindow: 3 * time.Second},
+			step:     time.Second,
+			ids:      []int{1, 2, 3, 4, 5, 6, 7},
+			accepted: []int{1, 2, 4, 5, 7},
+		},
+		{
+			name: "stages",
+			policy: FilterPolicy{
+				Expr:        "ID < 100",
+				DedupKeys:   []string{"ID"},
+				DedupWindow: time.Hour,
+				SampleEvery: 2,
+			},
+			ids: []int{1, 1, 2, 100, 3, 3, 4},
+			// Duplicates and rejected events are not sampled, events
+			// dropped by sampling are not deduplicated.
+			accepted: []int{1, 3},
+		},
+	}
+	for _, test := range tests {
+		clock := &fakeClock{now: time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)}
+		test.policy.Clock = clock
+		f, err := newEventFilter(&test.policy, reflect.TypeOf(fakeEvent{}))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		accepted := acceptedIDs(f, clock, test.step, test.ids...)
+		if !reflect.DeepEqual(accepted, test.accepted) {
+			t.Errorf("%s: unexpected events accepted %v; expected %v", test.name, accepted, test.accepted)
+		}
+	}
+}
+
+func TestEventFilter_DedupForget(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)}
+	f, err := newEventFilter(&FilterPolicy{DedupKeys: []string{"ID"}, DedupWindow: time.Second, Clock: clock},
+		reflect.TypeOf(fakeEvent{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		acceptedIDs(f, clock, 100*time.Millisecond, i)
+	}
+	if len(f.seen) > 20 {
+		t.Errorf("Expired dedup keys are kept: %d", len(f.seen))
+	}
+}
+
+func TestSubscription_Filter(t *testing.T) {
+	events := make(chan fakeEvent)
+	sub, src, _ := startFakeSubscription(t, context.Background(), events, &SubscribeOptions{
+		Filter: &FilterPolicy{Expr: "ID IN (2, 4)"},
+	})
+	defer sub.Close()
+
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i := 1; i <= 5; i++ {
+			src.events <- fakeEvent{ID: i}
+		}
+	}()
+	for _, id := range []int{2, 4} {
+		if e := <-events; e.ID != id {
+			t.Errorf("Unexpected event %+v; expected %d", e, id)
+		}
+	}
+	// The last event is sent after the filtered 5.
+	<-sent
+	src.events <- fakeEvent{ID: 4}
+	if e := <-events; e.ID != 4 {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if n := sub.Filtered(); n != 3 {
+		t.Errorf("Unexpected number of filtered events %d", n)
+	}
+
+	if _, _, err := newSubscription(context.Background(), "SELECT * FROM fakeEvent", events,
+		&SubscribeOptions{Filter: &FilterPolicy{Expr: "Missing = 1"}}); err == nil {
+		t.Errorf("Invalid filter expression is accepted")
+	}
+}
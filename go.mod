@@ -4,7 +4,7 @@ go 1.15
 
 require (
 	github.com/bi-zone/go-ole v1.2.5
-	github.com/hashicorp/go-multierror v1.0.0
+	github.com/hashicorp/go-multierror v1.1.1
 	github.com/jeffreystoke/comshim v0.0.0-20201112193758-b0afaf23e130
 	golang.org/x/sys v0.0.0-20200806060901-a37d78b92225 // indirect
 )
@@ -0,0 +1,200 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// ErrHubClosed is returned by the closed `EventHub`.
+var ErrHubClosed = errors.New("wmi: event hub has been closed")
+
+// HubStats is a snapshot of the hub state.
+type HubStats struct {
+	Connections   int // Number of open connections.
+	Subscriptions int // Number of running subscriptions.
+	Reconnects    int // Total number of connections reestablished for the lost subscriptions.
+}
+
+// subscriptionHub runs subscriptions sharing a connection per key. It's the
+// engine of the EventHub.
+type subscriptionHub struct {
+	mu         sync.Mutex
+	closed     bool
+	conns      map[PoolKey]*hubConn
+	reconnects int
+}
+
+// hubBackend is a connection shared by the hub subscriptions.
+type hubBackend interface {
+	// notificationSource executes the @sub query returning the source of its
+	// events.
+	notificationSource(ctx context.Context, sub *Subscription) (eventSource, error)
+	reconnect() error
+	close() error
+}
+
+// hubConn is the hub connection for a single key.
+type hubConn struct {
+	key     PoolKey
+	backend hubBackend
+	subs    map[*Subscription]struct{}
+
+	mu  sync.Mutex
+	gen int // Incremented by every reconnect.
+}
+
+// stats returns the hub state.
+func (h *subscriptionHub) stats() HubStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := HubStats{Connections: len(h.conns), Reconnects: h.reconnects}
+	for _, c := range h.conns {
+		s.Subscriptions += len(c.subs)
+	}
+	return s
+}
+
+// close stops all the hub subscriptions waiting until they are done and marks
+// the hub closed.
+func (h *subscriptionHub) close() error {
+	h.mu.Lock()
+	h.closed = true
+	var subs []*Subscription
+	for _, c := range h.conns {
+		for sub := range c.subs {
+			subs = append(subs, sub)
+		}
+	}
+	h.mu.Unlock()
+
+	var err error
+	for _, sub := range subs {
+		if clErr := sub.Close(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}
+	return err
+}
+
+// subscribe starts the subscription to the events of the @query using the
+// connection for the @key. The connection is created with @dial if there is
+// no one.
+func (h *subscriptionHub) subscribe(
+	ctx context.Context,
+	key PoolKey,
+	query string,
+	eventCh interface{},
+	opts *SubscribeOptions,
+	dial func(key PoolKey) (hubBackend, error),
+) (*Subscription, error) {
+	sub, ctx, err := newSubscription(ctx, query, eventCh, opts)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := h.acquire(key, sub, dial)
+	if err != nil {
+		sub.cancel()
+		sub.finish(err, nil)
+		return nil, err
+	}
+
+	conn.mu.Lock()
+	gen := conn.gen
+	conn.mu.Unlock()
+	src, err := conn.backend.notificationSource(ctx, sub)
+	if err != nil {
+		// The subscription is already visible to close, finish it so that
+		// the concurrent close doesn't wait for it forever.
+		sub.cancel()
+		err = multierror.Append(err, h.release(conn, sub))
+		sub.finish(err, nil)
+		return nil, err
+	}
+	sub.reopen = func() (eventSource, error) {
+		if err := h.reconnect(conn, &gen); err != nil {
+			return nil, err
+		}
+		return conn.backend.notificationSource(ctx, sub)
+	}
+	sub.start(ctx, src, func() error {
+		return h.release(conn, sub)
+	})
+	return sub, nil
+}
+
+// acquire returns the connection for the @key registering the @sub on it.
+func (h *subscriptionHub) acquire(key PoolKey, sub *Subscription, dial func(key PoolKey) (hubBackend, error)) (*hubConn, error) {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil, ErrHubClosed
+	}
+	if conn := h.conns[key]; conn != nil {
+		conn.subs[sub] = struct{}{}
+		h.mu.Unlock()
+		return conn, nil
+	}
+	h.mu.Unlock()
+
+	backend, err := dial(key)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil, multierror.Append(ErrHubClosed, backend.close())
+	}
+	conn := h.conns[key]
+	if conn != nil {
+		// Dialed concurrently, use the one registered first. The redundant
+		// connection has never been used, so its close error is ignored.
+		conn.subs[sub] = struct{}{}
+		h.mu.Unlock()
+		_ = backend.close()
+		return conn, nil
+	}
+	conn = &hubConn{key: key, backend: backend, subs: make(map[*Subscription]struct{})}
+	if h.conns == nil {
+		h.conns = make(map[PoolKey]*hubConn)
+	}
+	h.conns[key] = conn
+	conn.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return conn, nil
+}
+
+// release unregisters the @sub closing the @conn if it was the last one.
+func (h *subscriptionHub) release(conn *hubConn, sub *Subscription) error {
+	h.mu.Lock()
+	delete(conn.subs, sub)
+	if len(conn.subs) > 0 {
+		h.mu.Unlock()
+		return nil
+	}
+	delete(h.conns, conn.key)
+	h.mu.Unlock()
+	return conn.backend.close()
+}
+
+// reconnect reestablishes the @conn unless it has been reestablished since the
+// subscription generation @gen. @gen is updated to the current one.
+func (h *subscriptionHub) reconnect(conn *hubConn, gen *int) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.gen == *gen {
+		if err := conn.backend.reconnect(); err != nil {
+			return err
+		}
+		conn.gen++
+		h.mu.Lock()
+		h.reconnects++
+		h.mu.Unlock()
+	}
+	*gen = conn.gen
+	return nil
+}
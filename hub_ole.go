@@ -0,0 +1,118 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// EventHub runs multiple event subscriptions sharing a single connection per
+// `PoolKey` (server, namespace and credentials). Every subscription delivers
+// the events to its own channel and has its own lifecycle: it's stopped by its
+// context or `Subscription.Close` without affecting the others. The
+// connection is opened by the first subscription and closed when the last one
+// is done. Its zero value is a usable hub.
+//
+// If the connection is lost, it's reestablished once for all the
+// subscriptions resubscribing with `SubscribeOptions.Resubscribe` policy.
+type EventHub struct {
+	// Decoder is used to decode the events of all the subscriptions.
+	Decoder Decoder
+
+	// Observer is an optional observer of the hub connections calls and
+	// events delivery.
+	Observer Observer
+
+	// Security is the security settings applied to the hub connections.
+	Security SecurityOptions
+
+	hub subscriptionHub
+}
+
+// Subscribe subscribes to the events of the notification @query using the
+// hub connection for the @key, e.g.
+//
+//	var hub wmi.EventHub
+//	defer hub.Close()
+//	key := wmi.PoolKey{Namespace: `root\cimv2`}
+//	starts := make(chan Win32_ProcessStartTrace)
+//	sub1, err := hub.Subscribe(ctx, key, "SELECT * FROM Win32_ProcessStartTrace", starts, nil)
+//	...
+//	stops := make(chan Win32_ProcessStopTrace)
+//	sub2, err := hub.Subscribe(ctx, key, "SELECT * FROM Win32_ProcessStopTrace", stops, nil)
+//	...
+//
+// @eventCh and @opts are the same as of `SWbemServicesConnection.Subscribe`.
+// The subscription is stopped if the @ctx is done or `Subscription.Close` is
+// called.
+func (h *EventHub) Subscribe(
+	ctx context.Context,
+	key PoolKey,
+	query string,
+	eventCh interface{},
+	opts *SubscribeOptions,
+) (*Subscription, error) {
+	return h.hub.subscribe(ctx, key, query, eventCh, opts, h.dial)
+}
+
+// Stats returns the hub state.
+func (h *EventHub) Stats() HubStats {
+	return h.hub.stats()
+}
+
+// Close stops all the hub subscriptions waiting until they are done and marks
+// the hub closed.
+func (h *EventHub) Close() error {
+	return h.hub.close()
+}
+
+func (h *EventHub) dial(key PoolKey) (hubBackend, error) {
+	services, err := NewSWbemServices()
+	if err != nil {
+		return nil, err
+	}
+	services.Decoder = h.Decoder
+	services.Observer = h.Observer
+	conn, err := services.ConnectServer(key.connectServerArgs()...)
+	if clErr := services.Close(); clErr != nil {
+		err = multierror.Append(err, clErr)
+	}
+	if err != nil {
+		if conn != nil {
+			_ = conn.Close()
+		}
+		return nil, err
+	}
+	if err := conn.SetSecurity(h.Security); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return hubConnection{conn}, nil
+}
+
+// hubConnection is a hubBackend of the SWbemServicesConnection.
+type hubConnection struct {
+	*SWbemServicesConnection
+}
+
+func (c hubConnection) notificationSource(ctx context.Context, sub *Subscription) (eventSource, error) {
+	c.Lock()
+	closed := c.sWbemServices == nil
+	c.Unlock()
+	if closed {
+		return nil, ErrConnectionClosed
+	}
+	sub.observer = withContext(ctx, MultiObserver(&c.stats, c.Observer))
+	sub.info = c.callInfo(OpEvent, sub.query)
+	src, err := c.execNotificationQuery(sub)
+	if err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+func (c hubConnection) close() error {
+	return c.Close()
+}
@@ -0,0 +1,63 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventHub(t *testing.T) {
+	type event struct {
+		Instance struct {
+			Year uint32
+		} `wmi:"TargetInstance"`
+	}
+
+	var hub EventHub
+	hub.Decoder = DefaultClient.Decoder
+	defer hub.Close()
+	opts := &SubscribeOptions{PollTimeout: 100 * time.Millisecond}
+
+	var chans []chan event
+	var subs []*Subscription
+	for i := 0; i < 2; i++ {
+		events := make(chan event)
+		sub, err := hub.Subscribe(context.Background(), PoolKey{}, localTimeEventQuery, events, opts)
+		if err != nil {
+			t.Fatalf("Subscribe: %s", err)
+		}
+		chans = append(chans, events)
+		subs = append(subs, sub)
+	}
+	if s := hub.Stats(); s.Connections != 1 || s.Subscriptions != 2 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+
+	for i, events := range chans {
+		select {
+		case e := <-events:
+			if e.Instance.Year != uint32(time.Now().Year()) {
+				t.Errorf("Unexpected event %+v", e)
+			}
+		case <-subs[i].Done():
+			t.Fatalf("Subscription is done; %v", subs[i].Err())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No events received")
+		}
+	}
+
+	if err := subs[0].Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+	if s := hub.Stats(); s.Connections != 1 || s.Subscriptions != 1 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+	if err := hub.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+	if s := hub.Stats(); s != (HubStats{}) {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+}
@@ -0,0 +1,290 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeHubBackend creates a fake event source for every query.
+type fakeHubBackend struct {
+	mu         sync.Mutex
+	sources    map[string]*fakeEventSource
+	err        error
+	closeErr   error
+	reconnects int32
+	closed     int32
+}
+
+func newFakeHubBackend() *fakeHubBackend {
+	return &fakeHubBackend{sources: make(map[string]*fakeEventSource)}
+}
+
+func (b *fakeHubBackend) notificationSource(_ context.Context, sub *Subscription) (eventSource, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+	src := newFakeEventSource()
+	b.sources[sub.query] = src
+	return src, nil
+}
+
+func (b *fakeHubBackend) source(query string) *fakeEventSource {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sources[query]
+}
+
+func (b *fakeHubBackend) reconnect() error {
+	atomic.AddInt32(&b.reconnects, 1)
+	return nil
+}
+
+func (b *fakeHubBackend) close() error {
+	atomic.AddInt32(&b.closed, 1)
+	return b.closeErr
+}
+
+// fakeHubDialer dials the fake backends recording them by key.
+type fakeHubDialer struct {
+	mu       sync.Mutex
+	backends map[PoolKey]*fakeHubBackend
+	dials    int
+}
+
+func (d *fakeHubDialer) dial(key PoolKey) (hubBackend, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.backends == nil {
+		d.backends = make(map[PoolKey]*fakeHubBackend)
+	}
+	b := newFakeHubBackend()
+	d.backends[key] = b
+	d.dials++
+	return b, nil
+}
+
+func (d *fakeHubDialer) backend(key PoolKey) *fakeHubBackend {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.backends[key]
+}
+
+func TestSubscriptionHub(t *testing.T) {
+	var hub subscriptionHub
+	dialer := fakeHubDialer{}
+	cimv2, subscription := PoolKey{Namespace: `root\cimv2`}, PoolKey{Namespace: `root\subscription`}
+	opts := &SubscribeOptions{PollTimeout: 10 * time.Millisecond}
+
+	starts, stops, filters := make(chan fakeEvent), make(chan *fakeEvent), make(chan fakeEvent)
+	startSub, err := hub.subscribe(context.Background(), cimv2, "starts", starts, opts, dialer.dial)
+	if err != nil {
+		t.Fatalf("subscribe: %s", err)
+	}
+	stopSub, err := hub.subscribe(context.Background(), cimv2, "stops", stops, opts, dialer.dial)
+	if err != nil {
+		t.Fatalf("subscribe: %s", err)
+	}
+	filterSub, err := hub.subscribe(context.Background(), subscription, "filters", filters, opts, dialer.dial)
+	if err != nil {
+		t.Fatalf("subscribe: %s", err)
+	}
+	if dialer.dials != 2 {
+		t.Errorf("Unexpected number of dials %d", dialer.dials)
+	}
+	if s := hub.stats(); s != (HubStats{Connections: 2, Subscriptions: 3}) {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+
+	// Events are delivered to the own channels.
+	backend := dialer.backend(cimv2)
+	backend.source("starts").events <- fakeEvent{ID: 1}
+	backend.source("stops").events <- fakeEvent{ID: 2}
+	if e := <-starts; e.ID != 1 {
+		t.Errorf("Unexpected start event %+v", e)
+	}
+	if e := <-stops; e.ID != 2 {
+		t.Errorf("Unexpected stop event %+v", e)
+	}
+
+	// Closing one subscription doesn't affect the others.
+	if err := startSub.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+	backend.source("stops").events <- fakeEvent{ID: 3}
+	if e := <-stops; e.ID != 3 {
+		t.Errorf("Unexpected stop event %+v", e)
+	}
+	if atomic.LoadInt32(&backend.closed) != 0 {
+		t.Errorf("Connection in use is closed")
+	}
+
+	// The connection is closed with the last subscription.
+	if err := stopSub.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+	if atomic.LoadInt32(&backend.closed) != 1 {
+		t.Errorf("Unused connection isn't closed")
+	}
+	if s := hub.stats(); s != (HubStats{Connections: 1, Subscriptions: 1}) {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+
+	if err := hub.close(); err != nil {
+		t.Errorf("close: %s", err)
+	}
+	waitDone(t, filterSub)
+	if atomic.LoadInt32(&dialer.backend(subscription).closed) != 1 {
+		t.Errorf("Connection isn't closed with the hub")
+	}
+	if s := hub.stats(); s != (HubStats{}) {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+	if _, err := hub.subscribe(context.Background(), cimv2, "starts", starts, opts, dialer.dial); err != ErrHubClosed {
+		t.Errorf("Unexpected error of the closed hub %v", err)
+	}
+}
+
+func TestSubscriptionHub_Reconnect(t *testing.T) {
+	var hub subscriptionHub
+	defer hub.close()
+	dialer := fakeHubDialer{}
+	key := PoolKey{}
+
+	var subs []*Subscription
+	var chans []chan fakeEvent
+	for _, query := range []string{"first", "second"} {
+		events := make(chan fakeEvent)
+		sub, err := hub.subscribe(context.Background(), key, query, events, &SubscribeOptions{
+			PollTimeout: 10 * time.Millisecond,
+			Resubscribe: &RetryPolicy{InitialBackoff: time.Second, Clock: &fakeClock{}},
+		}, dialer.dial)
+		if err != nil {
+			t.Fatalf("subscribe: %s", err)
+		}
+		subs = append(subs, sub)
+		chans = append(chans, events)
+	}
+
+	// The connection is reestablished once for both subscriptions.
+	backend := dialer.backend(key)
+	for _, query := range []string{"first", "second"} {
+		backend.source(query).events <- ErrRPCDisconnected
+	}
+	for _, sub := range subs {
+		if gap := <-sub.Gaps(); !errors.Is(gap.Err, ErrRPCDisconnected) {
+			t.Errorf("Unexpected gap %+v", gap)
+		}
+	}
+	if n := atomic.LoadInt32(&backend.reconnects); n != 1 {
+		t.Errorf("Unexpected number of reconnects %d", n)
+	}
+	if s := hub.stats(); s != (HubStats{Connections: 1, Subscriptions: 2, Reconnects: 1}) {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+
+	for i, query := range []string{"first", "second"} {
+		backend.source(query).events <- fakeEvent{ID: i}
+		if e := <-chans[i]; e.ID != i {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	}
+}
+
+func TestSubscriptionHub_Failed(t *testing.T) {
+	var hub subscriptionHub
+	testErr := errors.New("test")
+	events := make(chan fakeEvent)
+
+	_, err := hub.subscribe(context.Background(), PoolKey{}, "", events, nil, func(PoolKey) (hubBackend, error) {
+		return nil, testErr
+	})
+	if err != testErr {
+		t.Errorf("Unexpected dial error %v", err)
+	}
+
+	backend := newFakeHubBackend()
+	backend.err = testErr
+	_, err = hub.subscribe(context.Background(), PoolKey{}, "", events, nil, func(PoolKey) (hubBackend, error) {
+		return backend, nil
+	})
+	if !errors.Is(err, testErr) {
+		t.Errorf("Unexpected query error %v", err)
+	}
+	if atomic.LoadInt32(&backend.closed) != 1 {
+		t.Errorf("Connection isn't closed")
+	}
+	if s := hub.stats(); s != (HubStats{}) {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+}
+
+func TestSubscriptionHub_ConcurrentDial(t *testing.T) {
+	var hub subscriptionHub
+	dialer := fakeHubDialer{}
+	first, second := &Subscription{}, &Subscription{}
+	redundant := newFakeHubBackend()
+	redundant.closeErr = errors.New("test")
+
+	// The connection is registered by the other subscription while dialing.
+	var registered *hubConn
+	conn, err := hub.acquire(PoolKey{}, first, func(key PoolKey) (hubBackend, error) {
+		var err error
+		if registered, err = hub.acquire(key, second, dialer.dial); err != nil {
+			t.Fatalf("acquire: %s", err)
+		}
+		return redundant, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to use the registered connection; %s", err)
+	}
+	if conn != registered || len(conn.subs) != 2 {
+		t.Errorf("Subscription isn't registered on the existing connection")
+	}
+	if atomic.LoadInt32(&redundant.closed) != 1 {
+		t.Errorf("Redundant connection isn't closed")
+	}
+}
+
+// blockingHubBackend fails the notification queries when they're cancelled.
+type blockingHubBackend struct {
+	*fakeHubBackend
+	entered chan struct{}
+}
+
+func (b *blockingHubBackend) notificationSource(ctx context.Context, _ *Subscription) (eventSource, error) {
+	close(b.entered)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSubscriptionHub_CloseFailedSubscribe(t *testing.T) {
+	var hub subscriptionHub
+	backend := &blockingHubBackend{fakeHubBackend: newFakeHubBackend(), entered: make(chan struct{})}
+	subscribed := make(chan error, 1)
+	go func() {
+		_, err := hub.subscribe(context.Background(), PoolKey{}, "", make(chan fakeEvent), nil,
+			func(PoolKey) (hubBackend, error) { return backend, nil })
+		subscribed <- err
+	}()
+	<-backend.entered
+
+	closed := make(chan error, 1)
+	go func() { closed <- hub.close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Hub isn't closed")
+	}
+	if err := <-subscribed; !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected subscribe error %v", err)
+	}
+	if atomic.LoadInt32(&backend.closed) != 1 {
+		t.Errorf("Connection isn't closed")
+	}
+}
@@ -0,0 +1,258 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// InstanceEventKind is the kind of the intrinsic instance event.
+type InstanceEventKind int
+
+// Instance event kinds.
+const (
+	// InstanceOperation means any of the instance events. It's used to
+	// query all of them, decoded events are always of the specific kind.
+	InstanceOperation InstanceEventKind = iota
+	InstanceCreated
+	InstanceModified
+	InstanceDeleted
+)
+
+var instanceEventClasses = map[InstanceEventKind]string{
+	InstanceOperation: "__InstanceOperationEvent",
+	InstanceCreated:   "__InstanceCreationEvent",
+	InstanceModified:  "__InstanceModificationEvent",
+	InstanceDeleted:   "__InstanceDeletionEvent",
+}
+
+var instanceEventNames = map[InstanceEventKind]string{
+	InstanceOperation: "operation",
+	InstanceCreated:   "created",
+	InstanceModified:  "modified",
+	InstanceDeleted:   "deleted",
+}
+
+func (k InstanceEventKind) String() string {
+	if name, ok := instanceEventNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("InstanceEventKind(%d)", int(k))
+}
+
+// Class returns the name of the intrinsic event class of the kind, e.g.
+// "__InstanceCreationEvent".
+func (k InstanceEventKind) Class() string {
+	return instanceEventClasses[k]
+}
+
+// instanceEventKind returns the kind of the intrinsic event @class.
+func instanceEventKind(class string) (InstanceEventKind, error) {
+	for kind, name := range instanceEventClasses {
+		if kind != InstanceOperation && name == class {
+			return kind, nil
+		}
+	}
+	return 0, fmt.Errorf("wmi: %q is not an instance event class", class)
+}
+
+// InstanceEventQuery returns a WQL query of the intrinsic @kind events of the
+// @src class instances. @src could be T, *T, []T, or *[]T, the structure name
+// is used as the class name. @within is the polling interval for the classes
+// without event providers, zero means no polling.
+//
+//	query := wmi.InstanceEventQuery(Win32_Service{}, wmi.InstanceModified, 5*time.Second)
+//	// SELECT * FROM __InstanceModificationEvent WITHIN 5 WHERE TargetInstance ISA 'Win32_Service'
+func InstanceEventQuery(src interface{}, kind InstanceEventKind, within time.Duration) string {
+	return InstanceEventQueryFrom(structType(src).Name(), kind, within)
+}
+
+// InstanceEventQueryFrom returns a WQL query of the intrinsic @kind events of
+// the @class instances. See `InstanceEventQuery` for details.
+func InstanceEventQueryFrom(class string, kind InstanceEventKind, within time.Duration) string {
+	query := "SELECT * FROM " + kind.Class()
+	if within > 0 {
+		query += " WITHIN " + strconv.FormatFloat(within.Seconds(), 'f', -1, 64)
+	}
+	return query + " WHERE TargetInstance ISA '" + class + "'"
+}
+
+// InstanceEvent is the intrinsic event of the instance creation, modification
+// or deletion.
+//
+// `Target` and `Previous` are the pointers to the instance structures. The
+// structure type is defined by `Target` set before decoding (see
+// `NewInstanceEvent`), subscriptions of `SubscribeInstanceEvents` do it
+// automatically.
+type InstanceEvent struct {
+	Kind InstanceEventKind
+
+	// Time is the time the event has been generated (TIME_CREATED).
+	Time time.Time
+
+	// Target is the created, modified or deleted instance.
+	Target interface{}
+
+	// Previous is the instance before the modification, nil for the
+	// events of other kinds.
+	Previous interface{}
+}
+
+// NewInstanceEvent returns the event to decode the events of the @src class
+// instances. @src could be T, *T, []T, or *[]T.
+func NewInstanceEvent(src interface{}) *InstanceEvent {
+	return &InstanceEvent{Target: reflect.New(structType(src)).Interface()}
+}
+
+// ChangedProperties returns the names of the properties differ between
+// `Previous` and `Target` instances. All properties are considered changed
+// for the events without the previous instance.
+func (e *InstanceEvent) ChangedProperties() []string {
+	return changedProperties(e.Previous, e.Target)
+}
+
+// changedProperties returns the names of the properties differ between
+// structures (or structure pointers) @prev and @cur.
+func changedProperties(prev, cur interface{}) []string {
+	curV := reflect.Indirect(reflect.ValueOf(cur))
+	if curV.Kind() != reflect.Struct {
+		return nil
+	}
+	prevV := reflect.Indirect(reflect.ValueOf(prev))
+	if prevV.Kind() != reflect.Struct || prevV.Type() != curV.Type() {
+		prevV = reflect.Value{}
+	}
+
+	var changed []string
+	for _, f := range structFields(curV.Type()) {
+		if prevV.IsValid() && propertyEqual(prevV.FieldByIndex(f.Index), curV.FieldByIndex(f.Index)) {
+			continue
+		}
+		changed = append(changed, f.Name)
+	}
+	return changed
+}
+
+// propertyEqual reports whether the property values @a and @b are equal.
+// Times are compared regardless of their locations.
+func propertyEqual(a, b reflect.Value) bool {
+	if a.Type() == timeType {
+		return a.Interface().(time.Time).Equal(b.Interface().(time.Time))
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// filetimeEpoch is the difference between FILETIME and Unix epochs in 100ns
+// intervals.
+const filetimeEpoch = 116444736000000000
+
+// filetimeToTime converts the FILETIME value @ft (e.g. TIME_CREATED of the
+// event) to time.
+func filetimeToTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, (int64(ft)-filetimeEpoch)*100)
+}
+
+// instanceEventRaw returns the type of the structure to decode the event of
+// the @kind with @targetType instances.
+func instanceEventRaw(targetType reflect.Type, kind InstanceEventKind) reflect.Type {
+	fields := []reflect.StructField{
+		{Name: "Target", Type: targetType, Tag: `wmi:"TargetInstance"`},
+	}
+	if kind == InstanceModified {
+		fields = append(fields, reflect.StructField{Name: "Previous", Type: targetType, Tag: `wmi:"PreviousInstance"`})
+	}
+	return reflect.StructOf(fields)
+}
+
+// set fills the event with the @raw event of the @kind created at @created
+// FILETIME. @raw is a pointer to the `instanceEventRaw` structure.
+func (e *InstanceEvent) set(kind InstanceEventKind, created uint64, raw reflect.Value) {
+	e.Kind = kind
+	e.Time = filetimeToTime(created)
+	raw = raw.Elem()
+	e.Target = raw.Field(0).Addr().Interface()
+	e.Previous = nil
+	if kind == InstanceModified {
+		e.Previous = raw.Field(1).Addr().Interface()
+	}
+}
+
+// targetType returns the structure type of the event instances.
+func (e *InstanceEvent) targetType() (reflect.Type, error) {
+	t := reflect.TypeOf(e.Target)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("wmi: InstanceEvent.Target should be set to the structure pointer before decoding")
+	}
+	return t.Elem(), nil
+}
+
+var instanceEventType = reflect.TypeOf(InstanceEvent{})
+
+// newInstanceEventSubscription creates the subscription to the intrinsic
+// @kind events of the @src class instances. @eventCh should be a channel of
+// `InstanceEvent` or `*InstanceEvent` (or their slices for the batch
+// delivery).
+func newInstanceEventSubscription(
+	ctx context.Context,
+	src interface{},
+	kind InstanceEventKind,
+	within time.Duration,
+	eventCh interface{},
+	opts *SubscribeOptions,
+) (*Subscription, context.Context, error) {
+	targetType := structType(src)
+	if targetType.Kind() != reflect.Struct {
+		return nil, nil, ErrInvalidEntityType
+	}
+	query := InstanceEventQueryFrom(targetType.Name(), kind, within)
+	sub, ctx, err := newSubscription(ctx, query, eventCh, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sub.elemType != instanceEventType {
+		sub.cancel()
+		return nil, nil, errors.New("eventCh has incorrect type; should be `chan InstanceEvent` or `chan *InstanceEvent`")
+	}
+	sub.prepareEvent = func(ev reflect.Value) {
+		ev.Interface().(*InstanceEvent).Target = reflect.New(targetType).Interface()
+	}
+	return sub, ctx, nil
+}
+
+// UnmarshalRecorded decodes the recorded intrinsic instance event the same way
+// as `UnmarshalOLE` does.
+func (e *InstanceEvent) UnmarshalRecorded(d Decoder, src *RecordedObject) error {
+	return e.unmarshal(d, src)
+}
+
+// unmarshal decodes the event from the @src object. `Target` should be set to
+// the pointer to the instance structure before the call.
+func (e *InstanceEvent) unmarshal(d Decoder, src propertySource) error {
+	targetType, err := e.targetType()
+	if err != nil {
+		return err
+	}
+	var header struct {
+		Class   string `wmi:"__CLASS"`
+		Created uint64 `wmi:"TIME_CREATED"`
+	}
+	if err := d.unmarshal(src, &header); err != nil {
+		return err
+	}
+	kind, err := instanceEventKind(header.Class)
+	if err != nil {
+		return err
+	}
+	raw := reflect.New(instanceEventRaw(targetType, kind))
+	if err := d.unmarshal(src, raw.Interface()); err != nil {
+		return err
+	}
+	e.set(kind, header.Created, raw)
+	return nil
+}
@@ -0,0 +1,89 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+	"time"
+
+	"github.com/bi-zone/go-ole"
+)
+
+// UnmarshalOLE decodes the intrinsic instance event. `Target` should be set to
+// the pointer to the instance structure before the call (see
+// `NewInstanceEvent`).
+func (e *InstanceEvent) UnmarshalOLE(d Decoder, src *ole.IDispatch) error {
+	return e.unmarshal(d, dispatchSource{src})
+}
+
+// SubscribeInstanceEvents is a wrapper around
+// DefaultClient.SubscribeInstanceEvents.
+func SubscribeInstanceEvents(
+	ctx context.Context,
+	src interface{},
+	kind InstanceEventKind,
+	within time.Duration,
+	eventCh interface{},
+	opts *SubscribeOptions,
+	connectServerArgs ...interface{},
+) (*Subscription, error) {
+	return DefaultClient.SubscribeInstanceEvents(ctx, src, kind, within, eventCh, opts, connectServerArgs...)
+}
+
+// SubscribeInstanceEvents connects to the server defined by @connectServerArgs
+// and subscribes to the intrinsic events of the @src class instances the same
+// way as `SWbemServicesConnection.SubscribeInstanceEvents` does. The
+// connection is closed when the subscription is done.
+func (c *Client) SubscribeInstanceEvents(
+	ctx context.Context,
+	src interface{},
+	kind InstanceEventKind,
+	within time.Duration,
+	eventCh interface{},
+	opts *SubscribeOptions,
+	connectServerArgs ...interface{},
+) (*Subscription, error) {
+	sub, ctx, err := newInstanceEventSubscription(ctx, src, kind, within, eventCh, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.startSubscription(ctx, sub, func(conn *SWbemServicesConnection) error {
+		return conn.subscribe(ctx, sub, conn.Close)
+	}, connectServerArgs...)
+}
+
+// SubscribeInstanceEvents subscribes to the intrinsic @kind events of the @src
+// class instances (see `InstanceEventQuery`), e.g.
+//
+//	events := make(chan wmi.InstanceEvent)
+//	sub, err := conn.SubscribeInstanceEvents(ctx, Win32_Service{}, wmi.InstanceOperation, 5*time.Second, events, nil)
+//	...
+//	defer sub.Close()
+//	for {
+//		select {
+//		case e := <-events:
+//			service := e.Target.(*Win32_Service)
+//			log.Printf("%s %s %v", service.Name, e.Kind, e.ChangedProperties())
+//		case <-sub.Done():
+//			return sub.Err()
+//		}
+//	}
+//
+// @src could be T, *T, []T, or *[]T, @eventCh should be a channel of
+// `InstanceEvent` or `*InstanceEvent`. Event `Target` and `Previous` are
+// decoded into *T. See `SWbemServicesConnection.Subscribe` for the
+// subscription details.
+func (s *SWbemServicesConnection) SubscribeInstanceEvents(
+	ctx context.Context,
+	src interface{},
+	kind InstanceEventKind,
+	within time.Duration,
+	eventCh interface{},
+	opts *SubscribeOptions,
+) (*Subscription, error) {
+	sub, ctx, err := newInstanceEventSubscription(ctx, src, kind, within, eventCh, opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSubscription(ctx, sub)
+}
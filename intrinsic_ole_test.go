@@ -0,0 +1,46 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscribeInstanceEvents(t *testing.T) {
+	type Win32_LocalTime struct {
+		Year   uint32
+		Second uint32
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events := make(chan InstanceEvent)
+	sub, err := SubscribeInstanceEvents(ctx, Win32_LocalTime{}, InstanceModified, 0, events,
+		&SubscribeOptions{PollTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("SubscribeInstanceEvents: %s", err)
+	}
+	defer sub.Close()
+
+	select {
+	case e := <-events:
+		target, ok := e.Target.(*Win32_LocalTime)
+		if !ok || e.Kind != InstanceModified || target.Year != uint32(time.Now().Year()) {
+			t.Errorf("Unexpected event %+v", e)
+		}
+		if _, ok := e.Previous.(*Win32_LocalTime); !ok {
+			t.Errorf("Unexpected previous instance %+v", e.Previous)
+		}
+		if time.Since(e.Time) > time.Minute {
+			t.Errorf("Unexpected event time %s", e.Time)
+		}
+		changed := e.ChangedProperties()
+		if len(changed) == 0 || changed[len(changed)-1] != "Second" {
+			t.Errorf("Unexpected changed properties %v", changed)
+		}
+	case <-sub.Done():
+		t.Fatalf("Subscription is done; %v", sub.Err())
+	}
+}
@@ -0,0 +1,147 @@
+package wmi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Win32_Service struct {
+	Name      string
+	State     string
+	Started   bool
+	StartTime time.Time
+	Internal  int `wmi:"-"`
+}
+
+func TestInstanceEventQuery(t *testing.T) {
+	tests := []struct {
+		src    interface{}
+		kind   InstanceEventKind
+		within time.Duration
+		query  string
+	}{
+		{
+			Win32_Service{}, InstanceModified, 5 * time.Second,
+			"SELECT * FROM __InstanceModificationEvent WITHIN 5 WHERE TargetInstance ISA 'Win32_Service'",
+		},
+		{
+			&[]Win32_Service{}, InstanceOperation, 1500 * time.Millisecond,
+			"SELECT * FROM __InstanceOperationEvent WITHIN 1.5 WHERE TargetInstance ISA 'Win32_Service'",
+		},
+		{
+			&Win32_Service{}, InstanceCreated, 0,
+			"SELECT * FROM __InstanceCreationEvent WHERE TargetInstance ISA 'Win32_Service'",
+		},
+		{
+			(*Win32_Service)(nil), InstanceDeleted, 0,
+			"SELECT * FROM __InstanceDeletionEvent WHERE TargetInstance ISA 'Win32_Service'",
+		},
+	}
+	for _, test := range tests {
+		if q := InstanceEventQuery(test.src, test.kind, test.within); q != test.query {
+			t.Errorf("Unexpected query %q; expected %q", q, test.query)
+		}
+	}
+}
+
+func TestInstanceEventKind(t *testing.T) {
+	for _, kind := range []InstanceEventKind{InstanceCreated, InstanceModified, InstanceDeleted} {
+		parsed, err := instanceEventKind(kind.Class())
+		if err != nil || parsed != kind {
+			t.Errorf("Unexpected kind of %q: %s; %v", kind.Class(), parsed, err)
+		}
+	}
+	if _, err := instanceEventKind(InstanceOperation.Class()); err == nil {
+		t.Errorf("Abstract event class is accepted")
+	}
+	if _, err := instanceEventKind("__MethodInvocationEvent"); err == nil {
+		t.Errorf("Unexpected event class is accepted")
+	}
+	if s := InstanceDeleted.String(); s != "deleted" {
+		t.Errorf("Unexpected kind name %q", s)
+	}
+}
+
+func TestInstanceEvent_ChangedProperties(t *testing.T) {
+	started := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := &Win32_Service{Name: "svc", State: "Stopped", StartTime: started, Internal: 1}
+	cur := &Win32_Service{Name: "svc", State: "Running", Started: true, StartTime: started.Local(), Internal: 2}
+
+	e := InstanceEvent{Kind: InstanceModified, Target: cur, Previous: prev}
+	if changed := e.ChangedProperties(); !reflect.DeepEqual(changed, []string{"State", "Started"}) {
+		t.Errorf("Unexpected changed properties %v", changed)
+	}
+	e = InstanceEvent{Kind: InstanceCreated, Target: cur}
+	if changed := e.ChangedProperties(); !reflect.DeepEqual(changed, []string{"Name", "State", "Started", "StartTime"}) {
+		t.Errorf("Unexpected changed properties %v", changed)
+	}
+	if changed := (&InstanceEvent{}).ChangedProperties(); changed != nil {
+		t.Errorf("Unexpected changed properties %v", changed)
+	}
+}
+
+func TestNewInstanceEvent_NilPointer(t *testing.T) {
+	e := NewInstanceEvent((*Win32_Service)(nil))
+	if _, ok := e.Target.(*Win32_Service); !ok {
+		t.Errorf("Unexpected target %T", e.Target)
+	}
+}
+
+func TestInstanceEvent_Set(t *testing.T) {
+	e := NewInstanceEvent(Win32_Service{})
+	targetType, err := e.targetType()
+	if err != nil {
+		t.Fatalf("targetType: %s", err)
+	}
+
+	raw := reflect.New(instanceEventRaw(targetType, InstanceModified))
+	raw.Elem().Field(0).Set(reflect.ValueOf(Win32_Service{State: "Running"}))
+	raw.Elem().Field(1).Set(reflect.ValueOf(Win32_Service{State: "Stopped"}))
+	// 2020-01-01 00:00:00 UTC.
+	e.set(InstanceModified, 132223104000000000, raw)
+
+	if e.Kind != InstanceModified || !e.Time.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if e.Target.(*Win32_Service).State != "Running" || e.Previous.(*Win32_Service).State != "Stopped" {
+		t.Errorf("Unexpected instances %+v %+v", e.Target, e.Previous)
+	}
+
+	raw = reflect.New(instanceEventRaw(targetType, InstanceDeleted))
+	if raw.Elem().NumField() != 1 {
+		t.Errorf("Previous instance is decoded for the deletion event")
+	}
+	e.set(InstanceDeleted, 0, raw)
+	if e.Previous != nil || !e.Time.IsZero() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	if _, err := (&InstanceEvent{}).targetType(); err == nil {
+		t.Errorf("Event without target is accepted")
+	}
+}
+
+func TestNewInstanceEventSubscription(t *testing.T) {
+	sub, _, err := newInstanceEventSubscription(context.Background(), Win32_Service{}, InstanceDeleted, time.Second,
+		make(chan *InstanceEvent), nil)
+	if err != nil {
+		t.Fatalf("newInstanceEventSubscription: %s", err)
+	}
+	defer sub.cancel()
+	if q := sub.Query(); q != "SELECT * FROM __InstanceDeletionEvent WITHIN 1 WHERE TargetInstance ISA 'Win32_Service'" {
+		t.Errorf("Unexpected query %q", q)
+	}
+	ev := reflect.New(sub.elemType)
+	sub.prepareEvent(ev)
+	if _, ok := ev.Interface().(*InstanceEvent).Target.(*Win32_Service); !ok {
+		t.Errorf("Unexpected event target %T", ev.Interface().(*InstanceEvent).Target)
+	}
+
+	_, _, err = newInstanceEventSubscription(context.Background(), Win32_Service{}, InstanceDeleted, time.Second,
+		make(chan Win32_Service), nil)
+	if err == nil {
+		t.Errorf("Channel of instances is accepted")
+	}
+}
@@ -0,0 +1,150 @@
+// +build windows
+
+package wmi
+
+import (
+	"fmt"
+
+	"github.com/bi-zone/go-ole"
+	"github.com/bi-zone/go-ole/oleutil"
+	"github.com/hashicorp/go-multierror"
+)
+
+// ExecMethod executes a @method of the object specified by @objectPath. For
+// static methods @objectPath should be a class name.
+//
+// @in is a structure (or a pointer to the structure) holding method in
+// parameters, it's marshalled the same way as `Put` does. @in could be nil
+// if the method has no in parameters. Out parameters (including
+// "ReturnValue") are unmarshalled into @out if it's not nil.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemobject-execmethod-
+func (s *SWbemServicesConnection) ExecMethod(objectPath, method string, in, out interface{}) error {
+	return s.ExecMethodWithOptions(objectPath, method, in, out, nil)
+}
+
+// ExecMethodWithOptions is the same as `ExecMethod` but passes @opts to the
+// `SWbemObject.ExecMethod_` call (and to the `SWbemServices.Get` call
+// retrieving the object).
+func (s *SWbemServicesConnection) ExecMethodWithOptions(objectPath, method string, in, out interface{}, opts *QueryOptions) error {
+	s.Lock()
+	if s.sWbemServices == nil {
+		s.Unlock()
+		return ErrConnectionClosed
+	}
+	s.Unlock()
+
+	return s.do(func() error {
+		return s.execMethod(objectPath, method, in, out, opts)
+	})
+}
+
+func (s *SWbemServicesConnection) execMethod(objectPath, method string, in, out interface{}, opts *QueryOptions) (err error) {
+	//  Be aware of reflections and COM usage.
+	defer func() {
+		if r := recover(); r != nil {
+			err = multierror.Append(err, fmt.Errorf("runtime panic; %v", r))
+		}
+	}()
+
+	objectRaw, err := s.getObject(objectPath, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if clErr := objectRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+	object := objectRaw.ToIDispatch()
+
+	params := []interface{}{method}
+	if in != nil {
+		inParamsRaw, err := spawnInParameters(object, method)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if clErr := inParamsRaw.Clear(); clErr != nil {
+				err = multierror.Append(err, clErr)
+			}
+		}()
+		inParams := inParamsRaw.ToIDispatch()
+		if err := Marshal(inParams, in); err != nil {
+			return err
+		}
+		params = append(params, inParams)
+	}
+	if opts != nil {
+		if in == nil {
+			params = append(params, (*ole.IDispatch)(nil)) // Nothing.
+		}
+		var release func()
+		params, release, err = contextParams(opts, append(params, opts.methodFlags(0))...)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	// result is a SWbemObject holding out parameters.
+	done := s.observe(OpExecMethod, objectPath+"."+method)
+	resultRaw, err := oleutil.CallMethod(object, "ExecMethod_", params...)
+	err = newWbemError("SWbemObject ExecMethod_", err)
+	done(0, err)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if clErr := resultRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	if out == nil || resultRaw.VT != ole.VT_DISPATCH {
+		return nil
+	}
+	return s.decode(objectPath+"."+method, resultRaw.ToIDispatch(), out)
+}
+
+// spawnInParameters returns an instance of the @method in parameters object.
+func spawnInParameters(object *ole.IDispatch, method string) (v *ole.VARIANT, err error) {
+	methodsRaw, err := oleutil.GetProperty(object, "Methods_")
+	if err != nil {
+		return nil, newWbemError("GetProperty Methods_", err)
+	}
+	defer func() {
+		if clErr := methodsRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	methodRaw, err := oleutil.CallMethod(methodsRaw.ToIDispatch(), "Item", method)
+	if err != nil {
+		return nil, newWbemError(fmt.Sprintf("SWbemMethodSet Item(%q)", method), err)
+	}
+	defer func() {
+		if clErr := methodRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	inDefRaw, err := oleutil.GetProperty(methodRaw.ToIDispatch(), "InParameters")
+	if err != nil {
+		return nil, newWbemError("GetProperty InParameters", err)
+	}
+	defer func() {
+		if clErr := inDefRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+	if inDefRaw.VT != ole.VT_DISPATCH {
+		return nil, fmt.Errorf("method %q has no in parameters", method)
+	}
+
+	v, err = oleutil.CallMethod(inDefRaw.ToIDispatch(), "SpawnInstance_")
+	if err != nil {
+		return nil, newWbemError("SWbemObject SpawnInstance_", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,82 @@
+// +build windows
+
+package wmi
+
+import (
+	"testing"
+)
+
+func TestSWbemServicesConnection_ExecMethod(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	var processes []struct {
+		Handle string
+	}
+	if err := s.Query("SELECT Handle FROM Win32_Process WHERE ProcessId = 4", &processes); err != nil {
+		t.Fatalf("Failed to query System process; %s", err)
+	}
+	if len(processes) != 1 {
+		t.Fatalf("Failed to find System process")
+	}
+
+	// Instance method with out parameters.
+	var owner struct {
+		ReturnValue uint32
+		Sid         *string
+	}
+	path := `Win32_Process.Handle="` + processes[0].Handle + `"`
+	if err := s.ExecMethod(path, "GetOwnerSid", nil, &owner); err != nil {
+		t.Fatalf("Failed to execute GetOwnerSid; %s", err)
+	}
+	if owner.ReturnValue == 0 && (owner.Sid == nil || *owner.Sid == "") {
+		t.Errorf("GetOwnerSid succeeded but returned empty SID")
+	}
+
+	// Method with in parameters.
+	var dir struct {
+		ReturnValue bool
+	}
+	in := struct {
+		Permissions uint32
+	}{Permissions: 1}
+	if err := s.ExecMethod(`Win32_Directory.Name="C:\\Windows"`, "GetEffectivePermission", in, &dir); err != nil {
+		t.Fatalf("Failed to execute GetEffectivePermission; %s", err)
+	}
+}
+
+func TestSWbemServicesConnection_ExecMethodWithOptions(t *testing.T) {
+	s, err := ConnectSWbemServices(".", `root\default`)
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	const hklm = 0x80000002
+	in := struct {
+		HDefKey     uint32
+		SSubKeyName string
+		SValueName  string
+	}{hklm, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, "ProductName"}
+	var out struct {
+		ReturnValue uint32
+		SValue      string
+	}
+	for _, bits := range []int{32, 64} {
+		opts := &QueryOptions{Context: ProviderArchitecture(bits)}
+		if err := s.ExecMethodWithOptions("StdRegProv", "GetStringValue", in, &out, opts); err != nil {
+			t.Fatalf("Failed to execute GetStringValue for %d bit; %s", bits, err)
+		}
+		if out.ReturnValue != 0 || out.SValue == "" {
+			t.Errorf("Unexpected result for %d bit; %+v", bits, out)
+		}
+	}
+
+	opts := &QueryOptions{Context: []NamedValue{{Name: "Bad", Value: struct{}{}}}}
+	if err := s.ExecMethodWithOptions("StdRegProv", "GetStringValue", in, &out, opts); err == nil {
+		t.Errorf("No error for invalid context")
+	}
+}
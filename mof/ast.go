@@ -0,0 +1,308 @@
+// Package mof implements a parser of the Managed Object Format (MOF) used to
+// describe WMI classes and instances. It works on any OS and doesn't require
+// WMI.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/managed-object-format--mof-
+package mof
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Position is a position of the MOF element in the source.
+type Position struct {
+	Filename string
+	Line     int // Starting at 1.
+	Column   int // Starting at 1, in bytes.
+}
+
+func (p Position) String() string {
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// File is a parsed MOF file.
+type File struct {
+	Filename string
+
+	// Decls holds all the file declarations in the source order. Elements are
+	// *Pragma, *QualifierDecl, *Class or *Instance.
+	Decls []Decl
+
+	// Shortcuts to the typed declarations.
+	Pragmas        []*Pragma
+	QualifierDecls []*QualifierDecl
+	Classes        []*Class
+	Instances      []*Instance
+}
+
+// Class returns a class declared in the file by its name (case insensitive).
+func (f *File) Class(name string) *Class {
+	for _, c := range f.Classes {
+		if equalFold(c.Name, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Decl is one of the top level MOF declarations.
+type Decl interface {
+	Position() Position
+}
+
+// Pragma is a compiler directive, e.g. `#pragma namespace("\\\\.\\root")`.
+type Pragma struct {
+	Pos  Position
+	Name string
+	Args []Value
+}
+
+// Position implements Decl.
+func (p *Pragma) Position() Position { return p.Pos }
+
+// QualifierDecl is a qualifier type declaration, e.g.
+//
+//	Qualifier Description : string = null, Scope(any), Flavor(Translatable);
+type QualifierDecl struct {
+	Pos     Position
+	Name    string
+	Type    string
+	IsArray bool
+	Default *Value
+	Scopes  []string
+	Flavors []string
+}
+
+// Position implements Decl.
+func (q *QualifierDecl) Position() Position { return q.Pos }
+
+// Qualifier is a qualifier applied to the class, property, method, etc.
+// Qualifiers without value (e.g. `[key]`) have boolean true value.
+type Qualifier struct {
+	Pos     Position
+	Name    string
+	Value   Value
+	Flavors []string
+}
+
+// Class is a class declaration.
+type Class struct {
+	Pos        Position
+	Name       string
+	Superclass string
+	Alias      string
+
+	// Namespace is set by the last `#pragma namespace` before the declaration.
+	Namespace string
+
+	Qualifiers []*Qualifier
+	Properties []*Property
+	Methods    []*Method
+}
+
+// Position implements Decl.
+func (c *Class) Position() Position { return c.Pos }
+
+// Property returns the class property by its name (case insensitive).
+func (c *Class) Property(name string) *Property {
+	for _, p := range c.Properties {
+		if equalFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Method returns the class method by its name (case insensitive).
+func (c *Class) Method(name string) *Method {
+	for _, m := range c.Methods {
+		if equalFold(m.Name, name) {
+			return m
+		}
+	}
+	return nil
+}
+
+// Property is a class property or a method parameter.
+type Property struct {
+	Pos  Position
+	Name string
+
+	// Type is a MOF data type name (e.g. "uint32" or "datetime"), "ref" for
+	// references or "object" for embedded objects.
+	Type string
+	// ClassName is a referenced class for "ref" properties or a class of
+	// the embedded object if it's declared with a class name as a type.
+	ClassName string
+
+	IsArray bool
+	// ArraySize is a size of the fixed size array, 0 for variable arrays.
+	ArraySize int
+
+	Default    *Value
+	Qualifiers []*Qualifier
+}
+
+// Method is a class method declaration.
+type Method struct {
+	Pos  Position
+	Name string
+
+	// ReturnType is a MOF type of the return value ("void" for none).
+	ReturnType string
+	// ReturnClassName is set for methods returning references or objects.
+	ReturnClassName string
+
+	Parameters []*Property
+	Qualifiers []*Qualifier
+}
+
+// Instance is an `instance of` declaration (or an embedded instance value).
+type Instance struct {
+	Pos   Position
+	Class string
+	Alias string
+
+	// Namespace is set by the last `#pragma namespace` before the declaration.
+	Namespace string
+
+	Qualifiers []*Qualifier
+	Properties []*PropertyValue
+}
+
+// Position implements Decl.
+func (i *Instance) Position() Position { return i.Pos }
+
+// Property returns the instance property value by the property name (case
+// insensitive).
+func (i *Instance) Property(name string) *PropertyValue {
+	for _, p := range i.Properties {
+		if equalFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// PropertyValue is a property initializer of the instance.
+type PropertyValue struct {
+	Pos        Position
+	Name       string
+	Value      Value
+	Qualifiers []*Qualifier
+}
+
+// ValueKind is a kind of MOF value.
+type ValueKind int
+
+// Possible value kinds.
+const (
+	NullValue ValueKind = iota
+	BooleanValue
+	IntegerValue
+	RealValue
+	StringValue
+	CharValue
+	AliasValue    // Reference to the aliased instance, e.g. `$filter`.
+	ArrayValue    // Array initializer, e.g. `{1, 2, 3}`.
+	InstanceValue // Embedded `instance of` declaration.
+)
+
+var valueKindNames = [...]string{"null", "boolean", "integer", "real", "string", "char", "alias", "array", "instance"}
+
+func (k ValueKind) String() string {
+	if int(k) < len(valueKindNames) {
+		return valueKindNames[k]
+	}
+	return fmt.Sprintf("ValueKind(%d)", int(k))
+}
+
+// Value is a MOF constant value.
+type Value struct {
+	Pos  Position
+	Kind ValueKind
+
+	// Literal holds the value of string, char and alias values (unescaped,
+	// without quotes or `$`), and the decimal representation of integer and
+	// real values.
+	Literal  string
+	Bool     bool
+	Array    []Value
+	Instance *Instance
+}
+
+// Int64 returns a value of the integer value.
+func (v Value) Int64() (int64, error) {
+	if v.Kind != IntegerValue {
+		return 0, fmt.Errorf("%s value is not an integer", v.Kind)
+	}
+	return strconv.ParseInt(v.Literal, 10, 64)
+}
+
+// Uint64 returns a value of the non negative integer value.
+func (v Value) Uint64() (uint64, error) {
+	if v.Kind != IntegerValue {
+		return 0, fmt.Errorf("%s value is not an integer", v.Kind)
+	}
+	return strconv.ParseUint(v.Literal, 10, 64)
+}
+
+// Float64 returns a value of the real or integer value.
+func (v Value) Float64() (float64, error) {
+	if v.Kind != RealValue && v.Kind != IntegerValue {
+		return 0, fmt.Errorf("%s value is not a number", v.Kind)
+	}
+	return strconv.ParseFloat(v.Literal, 64)
+}
+
+// Interface returns the value as a Go value:
+//   - nil for null;
+//   - bool for boolean;
+//   - int64 for integers (uint64 for integers out of int64 range);
+//   - float64 for reals;
+//   - string for strings, chars and aliases (with `$` prefix);
+//   - []interface{} for arrays;
+//   - *Instance for embedded instances.
+func (v Value) Interface() interface{} {
+	switch v.Kind {
+	case BooleanValue:
+		return v.Bool
+	case IntegerValue:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		u, _ := v.Uint64()
+		return u
+	case RealValue:
+		f, _ := v.Float64()
+		return f
+	case StringValue, CharValue:
+		return v.Literal
+	case AliasValue:
+		return "$" + v.Literal
+	case ArrayValue:
+		res := make([]interface{}, 0, len(v.Array))
+		for _, e := range v.Array {
+			res = append(res, e.Interface())
+		}
+		return res
+	case InstanceValue:
+		return v.Instance
+	}
+	return nil
+}
+
+// QualifierByName returns a qualifier from the list by its name (case
+// insensitive) or nil.
+func QualifierByName(qualifiers []*Qualifier, name string) *Qualifier {
+	for _, q := range qualifiers {
+		if equalFold(q.Name, name) {
+			return q
+		}
+	}
+	return nil
+}
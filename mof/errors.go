@@ -0,0 +1,46 @@
+package mof
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is a MOF syntax error.
+type Error struct {
+	Pos Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// ErrorList is a list of MOF syntax errors returned by `Parse`.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	const maxShown = 10
+	var msgs []string
+	for i, e := range l {
+		if i == maxShown {
+			msgs = append(msgs, fmt.Sprintf("(and %d more errors)", len(l)-maxShown))
+			break
+		}
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Err returns the list as an error or nil if the list is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
@@ -0,0 +1,305 @@
+package mof
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokChar
+	tokInteger
+	tokReal
+	tokAlias  // $name
+	tokPragma // #pragma
+	tokPunct  // One of `{}[]();,:=`
+)
+
+var tokenKindNames = [...]string{"EOF", "identifier", "string", "char", "integer", "real", "alias", "#pragma", "punctuation"}
+
+func (k tokenKind) String() string { return tokenKindNames[k] }
+
+type token struct {
+	kind tokenKind
+	pos  Position
+	// text holds identifier name, punctuation char, unescaped string/char
+	// value or decimal representation of the number.
+	text string
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "EOF"
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	case tokPunct, tokIdent:
+		return fmt.Sprintf("%q", t.text)
+	}
+	return fmt.Sprintf("%s %q", t.kind, t.text)
+}
+
+// is returns true if the token is the punctuation or keyword (case
+// insensitive) @s.
+func (t token) is(s string) bool {
+	return (t.kind == tokPunct || t.kind == tokIdent) && equalFold(t.text, s)
+}
+
+// lexer splits MOF source into tokens.
+type lexer struct {
+	src      []byte
+	filename string
+	offset   int
+	line     int
+	lineOff  int // Offset of the current line start.
+	errors   ErrorList
+}
+
+func newLexer(filename string, src []byte) *lexer {
+	return &lexer{src: src, filename: filename, line: 1}
+}
+
+func (l *lexer) pos() Position {
+	return Position{Filename: l.filename, Line: l.line, Column: l.offset - l.lineOff + 1}
+}
+
+func (l *lexer) errorf(pos Position, format string, args ...interface{}) {
+	l.errors = append(l.errors, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (l *lexer) peekByte(n int) byte {
+	if l.offset+n < len(l.src) {
+		return l.src[l.offset+n]
+	}
+	return 0
+}
+
+func (l *lexer) advance() {
+	if l.src[l.offset] == '\n' {
+		l.line++
+		l.lineOff = l.offset + 1
+	}
+	l.offset++
+}
+
+// skipSpace skips white spaces and comments.
+func (l *lexer) skipSpace() {
+	for l.offset < len(l.src) {
+		c := l.src[l.offset]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == '\v':
+			l.advance()
+		case c == '/' && l.peekByte(1) == '/':
+			for l.offset < len(l.src) && l.src[l.offset] != '\n' {
+				l.advance()
+			}
+		case c == '/' && l.peekByte(1) == '*':
+			start := l.pos()
+			l.advance()
+			l.advance()
+			for {
+				if l.offset >= len(l.src) {
+					l.errorf(start, "comment not terminated")
+					return
+				}
+				if l.src[l.offset] == '*' && l.peekByte(1) == '/' {
+					l.advance()
+					l.advance()
+					break
+				}
+				l.advance()
+			}
+		case c == 0xEF && l.peekByte(1) == 0xBB && l.peekByte(2) == 0xBF: // UTF-8 BOM.
+			l.offset += 3
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) next() token {
+	l.skipSpace()
+	pos := l.pos()
+	if l.offset >= len(l.src) {
+		return token{kind: tokEOF, pos: pos}
+	}
+
+	c := l.src[l.offset]
+	switch {
+	case isIdentStart(c):
+		return token{kind: tokIdent, pos: pos, text: l.ident()}
+	case c == '$':
+		l.advance()
+		if l.offset >= len(l.src) || !isIdentStart(l.src[l.offset]) {
+			l.errorf(pos, "invalid alias name")
+		}
+		return token{kind: tokAlias, pos: pos, text: l.ident()}
+	case c == '#':
+		l.advance()
+		name := l.ident()
+		if !equalFold(name, "pragma") {
+			l.errorf(pos, "unknown compiler directive #%s", name)
+		}
+		return token{kind: tokPragma, pos: pos, text: "#pragma"}
+	case c == '"':
+		return token{kind: tokString, pos: pos, text: l.quoted('"')}
+	case c == '\'':
+		return token{kind: tokChar, pos: pos, text: l.quoted('\'')}
+	case isDigit(c) || ((c == '-' || c == '+' || c == '.') && (isDigit(l.peekByte(1)) || l.peekByte(1) == '.')):
+		return l.number()
+	case strings.IndexByte("{}[]();,:=", c) != -1:
+		l.advance()
+		return token{kind: tokPunct, pos: pos, text: string(c)}
+	}
+
+	r, size := utf8.DecodeRune(l.src[l.offset:])
+	l.errorf(pos, "unexpected character %q", r)
+	for i := 0; i < size; i++ {
+		l.advance()
+	}
+	return l.next()
+}
+
+func (l *lexer) ident() string {
+	start := l.offset
+	for l.offset < len(l.src) && (isIdentStart(l.src[l.offset]) || isDigit(l.src[l.offset])) {
+		l.advance()
+	}
+	return string(l.src[start:l.offset])
+}
+
+// quoted reads a string or char literal with escape sequences.
+func (l *lexer) quoted(quote byte) string {
+	start := l.pos()
+	l.advance() // Opening quote.
+	var b strings.Builder
+	for {
+		if l.offset >= len(l.src) || l.src[l.offset] == '\n' {
+			l.errorf(start, "literal not terminated")
+			return b.String()
+		}
+		c := l.src[l.offset]
+		l.advance()
+		switch c {
+		case quote:
+			return b.String()
+		case '\\':
+			l.escape(&b)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (l *lexer) escape(b *strings.Builder) {
+	pos := l.pos()
+	if l.offset >= len(l.src) {
+		l.errorf(pos, "invalid escape sequence")
+		return
+	}
+	c := l.src[l.offset]
+	l.advance()
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\'', '\\':
+		b.WriteByte(c)
+	case 'x', 'X':
+		var r rune
+		digits := 0
+		for ; digits < 4 && isHexDigit(l.peekByte(0)); digits++ {
+			r = r*16 + rune(hexValue(l.src[l.offset]))
+			l.advance()
+		}
+		if digits == 0 {
+			l.errorf(pos, "invalid hex escape sequence")
+			return
+		}
+		b.WriteRune(r)
+	default:
+		l.errorf(pos, "unknown escape sequence \\%c", c)
+	}
+}
+
+// number reads integer (decimal, hex, octal or binary) or real literal and
+// normalizes it to the decimal representation.
+func (l *lexer) number() token {
+	pos := l.pos()
+	start := l.offset
+	for l.offset < len(l.src) {
+		c := l.src[l.offset]
+		isExpSign := (c == '-' || c == '+') && l.offset > start && (l.src[l.offset-1] == 'e' || l.src[l.offset-1] == 'E')
+		if !(isDigit(c) || isIdentStart(c) || c == '.' || isExpSign || (l.offset == start && (c == '-' || c == '+'))) {
+			break
+		}
+		l.advance()
+	}
+	text := string(l.src[start:l.offset])
+
+	sign, digits := "", text
+	if text[0] == '-' || text[0] == '+' {
+		sign, digits = text[:1], text[1:]
+		if sign == "+" {
+			sign = ""
+		}
+	}
+
+	lower := strings.ToLower(digits)
+	base := 10
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		base, digits = 16, digits[2:]
+	case strings.HasSuffix(lower, "b") && strings.Trim(lower[:len(lower)-1], "01") == "" && len(lower) > 1:
+		base, digits = 2, digits[:len(digits)-1]
+	case len(lower) > 1 && lower[0] == '0' && strings.Trim(lower, "01234567") == "":
+		base = 8
+	}
+	if i, ok := new(big.Int).SetString(digits, base); ok {
+		return token{kind: tokInteger, pos: pos, text: sign + i.String()}
+	}
+	if f, ok := new(big.Float).SetString(sign + digits); ok && base == 10 {
+		return token{kind: tokReal, pos: pos, text: f.Text('g', -1)}
+	}
+	l.errorf(pos, "invalid number %q", text)
+	return token{kind: tokInteger, pos: pos, text: "0"}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case isDigit(c):
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+func equalFold(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
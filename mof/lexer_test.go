@@ -0,0 +1,70 @@
+package mof
+
+import (
+	"testing"
+)
+
+func TestLexer(t *testing.T) {
+	src := "/* comment */ class Foo_1 // line comment\n" +
+		`$alias #pragma "a\"b\x41\n" 'c' 42 -0x1F 101b 017 +1.5 -2e-3 .5 { } [ ] ( ) ; , : =`
+	expected := []token{
+		{kind: tokIdent, text: "class"},
+		{kind: tokIdent, text: "Foo_1"},
+		{kind: tokAlias, text: "alias"},
+		{kind: tokPragma, text: "#pragma"},
+		{kind: tokString, text: "a\"bA\n"},
+		{kind: tokChar, text: "c"},
+		{kind: tokInteger, text: "42"},
+		{kind: tokInteger, text: "-31"},
+		{kind: tokInteger, text: "5"},
+		{kind: tokInteger, text: "15"},
+		{kind: tokReal, text: "1.5"},
+		{kind: tokReal, text: "-0.002"},
+		{kind: tokReal, text: "0.5"},
+	}
+	for _, p := range "{}[]();,:=" {
+		expected = append(expected, token{kind: tokPunct, text: string(p)})
+	}
+	expected = append(expected, token{kind: tokEOF})
+
+	l := newLexer("", []byte(src))
+	for i, exp := range expected {
+		tok := l.next()
+		if tok.kind != exp.kind || tok.text != exp.text {
+			t.Errorf("Unexpected token #%d; got %s, expected %s", i, tok, exp)
+		}
+	}
+	if len(l.errors) != 0 {
+		t.Errorf("Unexpected errors %v", l.errors)
+	}
+}
+
+func TestLexer_SignedNumber(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected token
+	}{
+		{"-1", token{kind: tokInteger, text: "-1"}},
+		{"+5 class", token{kind: tokInteger, text: "5"}},
+		{"-2e-3", token{kind: tokReal, text: "-0.002"}},
+		{"+1.5", token{kind: tokReal, text: "1.5"}},
+	}
+	for _, test := range tests {
+		l := newLexer("", []byte(test.src))
+		if tok := l.next(); tok.kind != test.expected.kind || tok.text != test.expected.text {
+			t.Errorf("Unexpected token of %q; got %s, expected %s", test.src, tok, test.expected)
+		}
+		if len(l.errors) != 0 {
+			t.Errorf("Unexpected errors of %q: %v", test.src, l.errors)
+		}
+	}
+}
+
+func TestLexer_Position(t *testing.T) {
+	l := newLexer("x.mof", []byte("a\n  /* multi\nline */ b"))
+	l.next()
+	tok := l.next()
+	if tok.pos.String() != "x.mof:3:9" {
+		t.Errorf("Unexpected position %s", tok.pos)
+	}
+}
@@ -0,0 +1,508 @@
+package mof
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// dataTypes are the MOF intrinsic data types.
+var dataTypes = map[string]bool{
+	"sint8": true, "uint8": true, "sint16": true, "uint16": true,
+	"sint32": true, "uint32": true, "sint64": true, "uint64": true,
+	"real32": true, "real64": true, "boolean": true, "string": true,
+	"datetime": true, "char16": true, "object": true,
+}
+
+// ParseFile reads and parses the MOF file. See `Parse` for details.
+func ParseFile(path string) (*File, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, src)
+}
+
+// Parse parses MOF source. @filename is used for positions only.
+//
+// Parse tries to recover after syntax errors skipping the broken
+// declaration, so it returns all the successfully parsed declarations along
+// with the `ErrorList` of all syntax errors found. `#pragma include` is not
+// resolved, the pragma is just recorded in the result.
+func Parse(filename string, src []byte) (*File, error) {
+	p := &parser{
+		lex:  newLexer(filename, src),
+		file: &File{Filename: filename},
+	}
+	p.next()
+	for p.tok.kind != tokEOF {
+		p.parseDecl()
+	}
+
+	return p.file, p.lex.errors.Err()
+}
+
+// ParseQualifiers parses a comma separated qualifier list without square
+// brackets, e.g. `Key, Description("Process name"), MaxLen(256)`.
+func ParseQualifiers(src string) (res []*Qualifier, err error) {
+	p := &parser{lex: newLexer("", []byte(src))}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			res, err = nil, p.lex.errors
+		}
+	}()
+	p.next()
+	if p.tok.kind == tokEOF {
+		return nil, nil
+	}
+	res = p.parseQualifierList("")
+	return res, p.lex.errors.Err()
+}
+
+// bailout is used to unwind the parser stack on the syntax error.
+type bailout struct{}
+
+type parser struct {
+	lex   *lexer
+	tok   token
+	depth int // Current depth of the braces.
+
+	file      *File
+	namespace string
+}
+
+func (p *parser) next() {
+	switch {
+	case p.tok.is("{"):
+		p.depth++
+	case p.tok.is("}"):
+		p.depth--
+	}
+	p.tok = p.lex.next()
+}
+
+func (p *parser) errorf(pos Position, format string, args ...interface{}) {
+	p.lex.errorf(pos, format, args...)
+	panic(bailout{})
+}
+
+func (p *parser) unexpected(expected string) {
+	p.errorf(p.tok.pos, "expected %s, got %s", expected, p.tok)
+}
+
+func (p *parser) expect(s string) Position {
+	pos := p.tok.pos
+	if !p.tok.is(s) {
+		p.unexpected(strconv.Quote(s))
+	}
+	p.next()
+	return pos
+}
+
+func (p *parser) ident(what string) (string, Position) {
+	tok := p.tok
+	if tok.kind != tokIdent {
+		p.unexpected(what)
+	}
+	p.next()
+	return tok.text, tok.pos
+}
+
+// parseDecl parses top level declaration. On error it skips the rest of the
+// declaration.
+func (p *parser) parseDecl() {
+	startDepth := p.depth
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.sync(startDepth)
+		}
+	}()
+
+	if p.tok.kind == tokPragma {
+		p.addDecl(p.parsePragma())
+		return
+	}
+	if p.tok.is("qualifier") {
+		p.addDecl(p.parseQualifierDecl())
+		return
+	}
+
+	var qualifiers []*Qualifier
+	if p.tok.is("[") {
+		qualifiers = p.parseQualifiers()
+	}
+	switch {
+	case p.tok.is("class"):
+		p.addDecl(p.parseClass(qualifiers))
+	case p.tok.is("instance"):
+		instance := p.parseInstance(qualifiers)
+		p.expect(";")
+		p.addDecl(instance)
+	default:
+		p.unexpected("class or instance declaration")
+	}
+}
+
+// sync skips tokens up to the end of the current declaration.
+func (p *parser) sync(depth int) {
+	for p.tok.kind != tokEOF {
+		if p.depth <= depth && p.tok.is(";") {
+			p.next()
+			return
+		}
+		p.next()
+	}
+}
+
+func (p *parser) addDecl(d Decl) {
+	f := p.file
+	f.Decls = append(f.Decls, d)
+	switch d := d.(type) {
+	case *Pragma:
+		f.Pragmas = append(f.Pragmas, d)
+	case *QualifierDecl:
+		f.QualifierDecls = append(f.QualifierDecls, d)
+	case *Class:
+		f.Classes = append(f.Classes, d)
+	case *Instance:
+		f.Instances = append(f.Instances, d)
+	}
+}
+
+// parsePragma parses `#pragma name(args)`. Unquoted identifiers are allowed
+// as args (e.g. `#pragma deleteclass("Foo", NOFAIL)`) and returned as strings.
+func (p *parser) parsePragma() *Pragma {
+	pragma := &Pragma{Pos: p.tok.pos}
+	p.next()
+	pragma.Name, _ = p.ident("pragma name")
+	if p.tok.is("(") {
+		p.next()
+		for !p.tok.is(")") {
+			if len(pragma.Args) > 0 {
+				p.expect(",")
+			}
+			if p.tok.kind == tokIdent {
+				pragma.Args = append(pragma.Args, Value{Pos: p.tok.pos, Kind: StringValue, Literal: p.tok.text})
+				p.next()
+				continue
+			}
+			pragma.Args = append(pragma.Args, p.parseValue())
+		}
+		p.next()
+	}
+	if p.tok.is(";") {
+		p.next()
+	}
+
+	if equalFold(pragma.Name, "namespace") && len(pragma.Args) == 1 {
+		p.namespace = pragma.Args[0].Literal
+	}
+	return pragma
+}
+
+// parseQualifierDecl parses
+//
+//	Qualifier Name : type[] = value, Scope(...), Flavor(...);
+func (p *parser) parseQualifierDecl() *QualifierDecl {
+	decl := &QualifierDecl{Pos: p.tok.pos}
+	p.next()
+	decl.Name, _ = p.ident("qualifier name")
+	p.expect(":")
+	decl.Type, _ = p.ident("qualifier type")
+	decl.Type = strings.ToLower(decl.Type)
+	if p.tok.is("[") {
+		p.next()
+		p.expect("]")
+		decl.IsArray = true
+	}
+	if p.tok.is("=") {
+		p.next()
+		v := p.parseValue()
+		decl.Default = &v
+	}
+	for p.tok.is(",") {
+		p.next()
+		name, pos := p.ident("Scope or Flavor")
+		p.expect("(")
+		var list []string
+		for !p.tok.is(")") {
+			if len(list) > 0 {
+				p.expect(",")
+			}
+			v, _ := p.ident(name)
+			list = append(list, v)
+		}
+		p.next()
+		switch {
+		case equalFold(name, "scope"):
+			decl.Scopes = list
+		case equalFold(name, "flavor"):
+			decl.Flavors = list
+		default:
+			p.errorf(pos, "expected Scope or Flavor, got %q", name)
+		}
+	}
+	p.expect(";")
+	return decl
+}
+
+// parseQualifiers parses `[Name(value): Flavor Flavor, Name{array}, Name]`.
+func (p *parser) parseQualifiers() []*Qualifier {
+	p.expect("[")
+	res := p.parseQualifierList("]")
+	p.next()
+	return res
+}
+
+// parseQualifierList parses comma separated qualifiers up to the @end
+// token (not consumed).
+func (p *parser) parseQualifierList(end string) []*Qualifier {
+	var res []*Qualifier
+	for {
+		q := &Qualifier{Pos: p.tok.pos}
+		q.Name, _ = p.ident("qualifier name")
+		switch {
+		case p.tok.is("("):
+			p.next()
+			q.Value = p.parseValue()
+			p.expect(")")
+		case p.tok.is("{"):
+			q.Value = p.parseValue()
+		default:
+			q.Value = Value{Pos: q.Pos, Kind: BooleanValue, Bool: true}
+		}
+		if p.tok.is(":") {
+			p.next()
+			for p.tok.kind == tokIdent {
+				q.Flavors = append(q.Flavors, p.tok.text)
+				p.next()
+			}
+		}
+		res = append(res, q)
+
+		if p.tok.is(end) || (end == "" && p.tok.kind == tokEOF) {
+			return res
+		}
+		p.expect(",")
+	}
+}
+
+// parseClass parses `class Name [as $Alias] [: Superclass] { features };`.
+func (p *parser) parseClass(qualifiers []*Qualifier) *Class {
+	class := &Class{Pos: p.tok.pos, Qualifiers: qualifiers, Namespace: p.namespace}
+	if len(qualifiers) > 0 {
+		class.Pos = qualifiers[0].Pos
+	}
+	p.expect("class")
+	class.Name, _ = p.ident("class name")
+	if p.tok.is("as") {
+		p.next()
+		class.Alias = p.alias()
+	}
+	if p.tok.is(":") {
+		p.next()
+		class.Superclass, _ = p.ident("superclass name")
+	}
+	p.expect("{")
+	for !p.tok.is("}") {
+		if p.tok.kind == tokEOF {
+			p.unexpected(`"}"`)
+		}
+		p.parseFeature(class)
+	}
+	p.next()
+	p.expect(";")
+	return class
+}
+
+// parseFeature parses a property, reference or method declaration.
+func (p *parser) parseFeature(class *Class) {
+	var qualifiers []*Qualifier
+	if p.tok.is("[") {
+		qualifiers = p.parseQualifiers()
+	}
+	pos := p.tok.pos
+	if len(qualifiers) > 0 {
+		pos = qualifiers[0].Pos
+	}
+	typ, className := p.parseType()
+	name, _ := p.ident("property or method name")
+
+	if p.tok.is("(") {
+		method := &Method{
+			Pos:             pos,
+			Name:            name,
+			ReturnType:      typ,
+			ReturnClassName: className,
+			Qualifiers:      qualifiers,
+		}
+		p.next()
+		for !p.tok.is(")") {
+			if len(method.Parameters) > 0 {
+				p.expect(",")
+			}
+			method.Parameters = append(method.Parameters, p.parseProperty(nil))
+		}
+		p.next()
+		p.expect(";")
+		class.Methods = append(class.Methods, method)
+		return
+	}
+
+	prop := &Property{Pos: pos, Name: name, Type: typ, ClassName: className, Qualifiers: qualifiers}
+	p.parsePropertyTail(prop)
+	p.expect(";")
+	class.Properties = append(class.Properties, prop)
+}
+
+// parseProperty parses a method parameter.
+func (p *parser) parseProperty(qualifiers []*Qualifier) *Property {
+	if p.tok.is("[") {
+		qualifiers = p.parseQualifiers()
+	}
+	prop := &Property{Pos: p.tok.pos, Qualifiers: qualifiers}
+	if len(qualifiers) > 0 {
+		prop.Pos = qualifiers[0].Pos
+	}
+	prop.Type, prop.ClassName = p.parseType()
+	prop.Name, _ = p.ident("parameter name")
+	p.parsePropertyTail(prop)
+	return prop
+}
+
+// parsePropertyTail parses optional array brackets and default value.
+func (p *parser) parsePropertyTail(prop *Property) {
+	if p.tok.is("[") {
+		p.next()
+		prop.IsArray = true
+		if p.tok.kind == tokInteger {
+			size, err := strconv.Atoi(p.tok.text)
+			if err != nil || size <= 0 {
+				p.errorf(p.tok.pos, "invalid array size %s", p.tok.text)
+			}
+			prop.ArraySize = size
+			p.next()
+		}
+		p.expect("]")
+	}
+	if p.tok.is("=") {
+		p.next()
+		v := p.parseValue()
+		prop.Default = &v
+	}
+}
+
+// parseType parses a data type, `ClassName ref` or embedded object class
+// name. Returns the type name and the class name (for refs and objects).
+func (p *parser) parseType() (typ, className string) {
+	name, _ := p.ident("type")
+	if p.tok.is("ref") {
+		p.next()
+		return "ref", name
+	}
+	lower := strings.ToLower(name)
+	if dataTypes[lower] || lower == "void" {
+		return lower, ""
+	}
+	return "object", name
+}
+
+// parseInstance parses `instance of Class [as $Alias] { Prop = value; ... }`
+// without the trailing semicolon.
+func (p *parser) parseInstance(qualifiers []*Qualifier) *Instance {
+	instance := &Instance{Pos: p.tok.pos, Qualifiers: qualifiers, Namespace: p.namespace}
+	if len(qualifiers) > 0 {
+		instance.Pos = qualifiers[0].Pos
+	}
+	p.expect("instance")
+	p.expect("of")
+	instance.Class, _ = p.ident("class name")
+	if p.tok.is("as") {
+		p.next()
+		instance.Alias = p.alias()
+	}
+	p.expect("{")
+	for !p.tok.is("}") {
+		if p.tok.kind == tokEOF {
+			p.unexpected(`"}"`)
+		}
+		prop := &PropertyValue{Pos: p.tok.pos}
+		if p.tok.is("[") {
+			prop.Qualifiers = p.parseQualifiers()
+		}
+		prop.Name, _ = p.ident("property name")
+		p.expect("=")
+		prop.Value = p.parseValue()
+		p.expect(";")
+		instance.Properties = append(instance.Properties, prop)
+	}
+	p.next()
+	return instance
+}
+
+func (p *parser) alias() string {
+	if p.tok.kind != tokAlias {
+		p.unexpected("alias")
+	}
+	name := p.tok.text
+	p.next()
+	return name
+}
+
+// parseValue parses a constant value, array or embedded instance.
+func (p *parser) parseValue() Value {
+	tok := p.tok
+	v := Value{Pos: tok.pos, Literal: tok.text}
+	switch tok.kind {
+	case tokString:
+		v.Kind = StringValue
+		p.next()
+		// Adjacent strings are concatenated.
+		for p.tok.kind == tokString {
+			v.Literal += p.tok.text
+			p.next()
+		}
+		return v
+	case tokChar:
+		v.Kind = CharValue
+	case tokInteger:
+		v.Kind = IntegerValue
+	case tokReal:
+		v.Kind = RealValue
+	case tokAlias:
+		v.Kind = AliasValue
+	case tokIdent:
+		switch {
+		case tok.is("true"), tok.is("false"):
+			v.Kind, v.Bool, v.Literal = BooleanValue, tok.is("true"), ""
+		case tok.is("null"):
+			v.Kind, v.Literal = NullValue, ""
+		case tok.is("instance"):
+			return Value{Pos: tok.pos, Kind: InstanceValue, Instance: p.parseInstance(nil)}
+		default:
+			p.unexpected("value")
+		}
+	case tokPunct:
+		if !tok.is("{") {
+			p.unexpected("value")
+		}
+		v.Kind, v.Literal = ArrayValue, ""
+		p.next()
+		for !p.tok.is("}") {
+			if len(v.Array) > 0 {
+				p.expect(",")
+			}
+			v.Array = append(v.Array, p.parseValue())
+		}
+	default:
+		p.unexpected("value")
+	}
+	p.next()
+	return v
+}
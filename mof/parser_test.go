@@ -0,0 +1,174 @@
+package mof
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFile(t *testing.T) {
+	f, err := ParseFile("testdata/sample.mof")
+	if err != nil {
+		t.Fatalf("Failed to parse; %s", err)
+	}
+	if len(f.Decls) != 9 || len(f.Pragmas) != 3 || len(f.QualifierDecls) != 2 ||
+		len(f.Classes) != 2 || len(f.Instances) != 2 {
+		t.Fatalf("Unexpected declarations count; got %d decls, %d pragmas, %d qualifiers, %d classes, %d instances",
+			len(f.Decls), len(f.Pragmas), len(f.QualifierDecls), len(f.Classes), len(f.Instances))
+	}
+
+	desc := f.QualifierDecls[0]
+	if desc.Name != "Description" || desc.Type != "string" || desc.Default == nil || desc.Default.Kind != NullValue ||
+		!reflect.DeepEqual(desc.Scopes, []string{"any"}) || !reflect.DeepEqual(desc.Flavors, []string{"Amended", "ToSubclass"}) {
+		t.Errorf("Unexpected qualifier declaration %+v", desc)
+	}
+	if valueMap := f.QualifierDecls[1]; !valueMap.IsArray || len(valueMap.Scopes) != 3 {
+		t.Errorf("Unexpected qualifier declaration %+v", valueMap)
+	}
+
+	base := f.Class("test_base")
+	if base == nil {
+		t.Fatalf("Test_Base class not found")
+	}
+	if base.Namespace != `\\.\root\cimv2` {
+		t.Errorf("Unexpected namespace %q", base.Namespace)
+	}
+	if q := QualifierByName(base.Qualifiers, "description"); q == nil ||
+		q.Value.Literal != "Base class for the test." || !reflect.DeepEqual(q.Flavors, []string{"Amended", "ToSubclass"}) {
+		t.Errorf("Unexpected Description qualifier %+v", q)
+	}
+	if q := QualifierByName(base.Qualifiers, "Abstract"); q == nil || q.Value.Interface() != true {
+		t.Errorf("Unexpected Abstract qualifier %+v", q)
+	}
+
+	item := f.Class("Test_Item")
+	if item.Alias != "Item" || item.Superclass != "Test_Base" {
+		t.Errorf("Unexpected class header %+v", item)
+	}
+	if len(item.Properties) != 10 || len(item.Methods) != 2 {
+		t.Fatalf("Unexpected features count; got %d properties and %d methods", len(item.Properties), len(item.Methods))
+	}
+	props := []struct {
+		name      string
+		typ       string
+		className string
+		arraySize int
+		value     interface{}
+	}{
+		{"State", "uint16", "", 0, int64(0)},
+		{"Ratio", "real64", "", 0, float64(1500)},
+		{"Offset", "sint32", "", 0, int64(-16)},
+		{"Bits", "uint8", "", 4, []interface{}{int64(1), int64(0), int64(15), int64(255)}},
+		{"Created", "datetime", "", 0, nil},
+		{"Letter", "char16", "", 0, "x"},
+		{"Enabled", "boolean", "", 0, true},
+		{"Parent", "ref", "Test_Base", 0, nil},
+		{"Embedded", "object", "Test_Base", 0, nil},
+		{"Any", "object", "", 0, nil},
+	}
+	for _, expected := range props {
+		p := item.Property(expected.name)
+		if p == nil {
+			t.Errorf("Property %s not found", expected.name)
+			continue
+		}
+		var value interface{}
+		if p.Default != nil {
+			value = p.Default.Interface()
+		}
+		if p.Type != expected.typ || p.ClassName != expected.className || p.ArraySize != expected.arraySize ||
+			!reflect.DeepEqual(value, expected.value) {
+			t.Errorf("Unexpected property %s; got %+v with value %#v", expected.name, p, value)
+		}
+	}
+	state := item.Property("State")
+	if q := QualifierByName(state.Qualifiers, "Values"); q == nil ||
+		!reflect.DeepEqual(q.Value.Interface(), []interface{}{"Unknown", "Running", "Stopped"}) {
+		t.Errorf("Unexpected Values qualifier %+v", q)
+	}
+
+	create := item.Method("Create")
+	if create.ReturnType != "uint32" || len(create.Parameters) != 3 {
+		t.Fatalf("Unexpected method %+v", create)
+	}
+	if p := create.Parameters[1]; p.Name != "Parent" || p.Type != "ref" || p.ClassName != "Test_Base" ||
+		QualifierByName(p.Qualifiers, "In") == nil || QualifierByName(p.Qualifiers, "Out") == nil {
+		t.Errorf("Unexpected parameter %+v", p)
+	}
+	if p := create.Parameters[2]; !p.IsArray || p.ArraySize != 0 {
+		t.Errorf("Unexpected parameter %+v", p)
+	}
+	if stop := item.Method("Stop"); stop.ReturnType != "void" || len(stop.Parameters) != 0 {
+		t.Errorf("Unexpected method %+v", stop)
+	}
+
+	filter := f.Instances[0]
+	if filter.Class != "__EventFilter" || filter.Alias != "Filter" || filter.Namespace != `\\.\root\subscription` {
+		t.Errorf("Unexpected instance header %+v", filter)
+	}
+	query := "SELECT * FROM __InstanceCreationEvent WITHIN 5 WHERE TargetInstance ISA 'Win32_Process'"
+	if v := filter.Property("Query"); v == nil || v.Value.Literal != query {
+		t.Errorf("Unexpected Query value %+v", v)
+	}
+
+	binding := f.Instances[1]
+	if v := binding.Property("Filter").Value; v.Kind != AliasValue || v.Interface() != "$Filter" {
+		t.Errorf("Unexpected Filter value %+v", v)
+	}
+	consumer := binding.Property("Consumer").Value
+	if consumer.Kind != InstanceValue || consumer.Instance.Class != "LogFileEventConsumer" {
+		t.Fatalf("Unexpected Consumer value %+v", consumer)
+	}
+	if v := consumer.Instance.Property("Name").Value.Literal; v != "LogA" {
+		t.Errorf("Unexpected consumer name %q", v)
+	}
+	if v := consumer.Instance.Property("Filename").Value.Literal; v != `C:\log.txt` {
+		t.Errorf("Unexpected consumer filename %q", v)
+	}
+	if v := binding.Property("DeliveryQoS").Value; v.Kind != NullValue {
+		t.Errorf("Unexpected DeliveryQoS value %+v", v)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	src := `
+class Broken {
+	uint32 Missing Semicolon
+	string Name;
+};
+
+class Good { string Name; };
+
+instance of Good { Name = ; };
+
+instance of Good { Name = "ok"; };
+`
+	f, err := Parse("broken.mof", []byte(src))
+	if err == nil {
+		t.Fatalf("Broken MOF parsed without errors")
+	}
+	errs, ok := err.(ErrorList)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Unexpected error %#v", err)
+	}
+	if errs[0].Pos.Line != 3 || errs[1].Pos.Line != 9 {
+		t.Errorf("Unexpected error positions; %s", err)
+	}
+	if !strings.HasPrefix(errs[0].Error(), "broken.mof:3:17: expected") {
+		t.Errorf("Unexpected error message %q", errs[0].Error())
+	}
+	if len(f.Classes) != 1 || f.Classes[0].Name != "Good" || len(f.Instances) != 1 {
+		t.Errorf("Parser failed to recover; got %d classes and %d instances", len(f.Classes), len(f.Instances))
+	}
+}
+
+func TestParse_LeadingSign(t *testing.T) {
+	for _, src := range []string{"-1", "+5 class"} {
+		if _, err := Parse("x", []byte(src)); err == nil {
+			t.Errorf("Invalid MOF %q parsed without errors", src)
+		}
+	}
+	if _, err := ParseQualifiers("-5"); err == nil {
+		t.Errorf("Invalid qualifiers parsed without errors")
+	}
+}
@@ -0,0 +1,270 @@
+package mof
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const indent = "    "
+
+// Fprint writes MOF source of the declarations to @w. Declarations are
+// separated with an empty line.
+//
+// Positions, namespaces and file level shortcuts are ignored, use `Pragma`
+// declarations to set the namespace.
+func Fprint(w io.Writer, decls ...Decl) error {
+	var b bytes.Buffer
+	for i, d := range decls {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		switch d := d.(type) {
+		case *Pragma:
+			printPragma(&b, d)
+		case *QualifierDecl:
+			printQualifierDecl(&b, d)
+		case *Class:
+			printClass(&b, d)
+		case *Instance:
+			printInstance(&b, d, "")
+			b.WriteString(";\n")
+		default:
+			return fmt.Errorf("mof: unsupported declaration %T", d)
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Format returns MOF source of the declarations. See `Fprint` for details.
+func Format(decls ...Decl) ([]byte, error) {
+	var b bytes.Buffer
+	err := Fprint(&b, decls...)
+	return b.Bytes(), err
+}
+
+func printPragma(b *bytes.Buffer, p *Pragma) {
+	b.WriteString("#pragma " + p.Name)
+	if len(p.Args) > 0 {
+		b.WriteByte('(')
+		printValues(b, p.Args, "")
+		b.WriteByte(')')
+	}
+	b.WriteByte('\n')
+}
+
+func printQualifierDecl(b *bytes.Buffer, q *QualifierDecl) {
+	b.WriteString("Qualifier " + q.Name + " : " + q.Type)
+	if q.IsArray {
+		b.WriteString("[]")
+	}
+	if q.Default != nil {
+		b.WriteString(" = " + q.Default.String())
+	}
+	if len(q.Scopes) > 0 {
+		b.WriteString(", Scope(" + strings.Join(q.Scopes, ", ") + ")")
+	}
+	if len(q.Flavors) > 0 {
+		b.WriteString(", Flavor(" + strings.Join(q.Flavors, ", ") + ")")
+	}
+	b.WriteString(";\n")
+}
+
+func printClass(b *bytes.Buffer, c *Class) {
+	if len(c.Qualifiers) > 0 {
+		b.WriteString(FormatQualifiers(c.Qualifiers) + "\n")
+	}
+	b.WriteString("class " + c.Name)
+	if c.Alias != "" {
+		b.WriteString(" as $" + c.Alias)
+	}
+	if c.Superclass != "" {
+		b.WriteString(" : " + c.Superclass)
+	}
+	b.WriteString("\n{\n")
+	for _, p := range c.Properties {
+		b.WriteString(indent)
+		printProperty(b, p)
+		b.WriteString(";\n")
+	}
+	for _, m := range c.Methods {
+		b.WriteString(indent)
+		if len(m.Qualifiers) > 0 {
+			b.WriteString(FormatQualifiers(m.Qualifiers) + " ")
+		}
+		b.WriteString(typeName(m.ReturnType, m.ReturnClassName) + " " + m.Name + "(")
+		for i, p := range m.Parameters {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			printProperty(b, p)
+		}
+		b.WriteString(");\n")
+	}
+	b.WriteString("};\n")
+}
+
+func printProperty(b *bytes.Buffer, p *Property) {
+	if len(p.Qualifiers) > 0 {
+		b.WriteString(FormatQualifiers(p.Qualifiers) + " ")
+	}
+	b.WriteString(typeName(p.Type, p.ClassName) + " " + p.Name)
+	if p.IsArray {
+		if p.ArraySize > 0 {
+			fmt.Fprintf(b, "[%d]", p.ArraySize)
+		} else {
+			b.WriteString("[]")
+		}
+	}
+	if p.Default != nil {
+		b.WriteString(" = ")
+		printValue(b, *p.Default, indent)
+	}
+}
+
+func typeName(typ, className string) string {
+	switch {
+	case typ == "ref" && className == "":
+		return "object ref"
+	case typ == "ref":
+		return className + " ref"
+	case typ == "object" && className != "":
+		return className
+	}
+	return typ
+}
+
+// printInstance prints the instance without the trailing semicolon.
+func printInstance(b *bytes.Buffer, inst *Instance, prefix string) {
+	if len(inst.Qualifiers) > 0 {
+		b.WriteString(FormatQualifiers(inst.Qualifiers) + "\n" + prefix)
+	}
+	b.WriteString("instance of " + inst.Class)
+	if inst.Alias != "" {
+		b.WriteString(" as $" + inst.Alias)
+	}
+	b.WriteString("\n" + prefix + "{\n")
+	for _, p := range inst.Properties {
+		b.WriteString(prefix + indent)
+		if len(p.Qualifiers) > 0 {
+			b.WriteString(FormatQualifiers(p.Qualifiers) + " ")
+		}
+		b.WriteString(p.Name + " = ")
+		printValue(b, p.Value, prefix+indent)
+		b.WriteString(";\n")
+	}
+	b.WriteString(prefix + "}")
+}
+
+// FormatQualifiers returns MOF source of the qualifier list including the
+// square brackets.
+func FormatQualifiers(qualifiers []*Qualifier) string {
+	var b bytes.Buffer
+	b.WriteByte('[')
+	for i, q := range qualifiers {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(q.Name)
+		switch {
+		case q.Value.Kind == BooleanValue && q.Value.Bool:
+			// Implicit true value.
+		case q.Value.Kind == ArrayValue:
+			printValue(&b, q.Value, "")
+		default:
+			b.WriteByte('(')
+			printValue(&b, q.Value, "")
+			b.WriteByte(')')
+		}
+		if len(q.Flavors) > 0 {
+			b.WriteString(" : " + strings.Join(q.Flavors, " "))
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// String returns MOF source of the value.
+func (v Value) String() string {
+	var b bytes.Buffer
+	printValue(&b, v, "")
+	return b.String()
+}
+
+func printValue(b *bytes.Buffer, v Value, prefix string) {
+	switch v.Kind {
+	case NullValue:
+		b.WriteString("null")
+	case BooleanValue:
+		if v.Bool {
+			b.WriteString("TRUE")
+		} else {
+			b.WriteString("FALSE")
+		}
+	case IntegerValue:
+		b.WriteString(v.Literal)
+	case RealValue:
+		b.WriteString(v.Literal)
+		if !strings.ContainsAny(v.Literal, ".eEnN") { // Keep it real on parse.
+			b.WriteString(".0")
+		}
+	case StringValue:
+		b.WriteString(quote(v.Literal, '"'))
+	case CharValue:
+		b.WriteString(quote(v.Literal, '\''))
+	case AliasValue:
+		b.WriteString("$" + v.Literal)
+	case ArrayValue:
+		b.WriteByte('{')
+		printValues(b, v.Array, prefix)
+		b.WriteByte('}')
+	case InstanceValue:
+		printInstance(b, v.Instance, prefix)
+	}
+}
+
+func printValues(b *bytes.Buffer, values []Value, prefix string) {
+	for i, v := range values {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		printValue(b, v, prefix)
+	}
+}
+
+// quote returns escaped MOF string or char literal.
+func quote(s string, quote byte) string {
+	var b strings.Builder
+	b.WriteByte(quote)
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"', '\'':
+			if byte(r) == quote {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\x%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte(quote)
+	return b.String()
+}
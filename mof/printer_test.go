@@ -0,0 +1,101 @@
+package mof
+
+import (
+	"testing"
+)
+
+func TestFormat_RoundTrip(t *testing.T) {
+	f, err := ParseFile("testdata/sample.mof")
+	if err != nil {
+		t.Fatalf("Failed to parse; %s", err)
+	}
+	src, err := Format(f.Decls...)
+	if err != nil {
+		t.Fatalf("Failed to format; %s", err)
+	}
+	f2, err := Parse("formatted.mof", src)
+	if err != nil {
+		t.Fatalf("Failed to parse formatted source; %s\n%s", err, src)
+	}
+	src2, err := Format(f2.Decls...)
+	if err != nil {
+		t.Fatalf("Failed to format; %s", err)
+	}
+	if string(src) != string(src2) {
+		t.Errorf("Formatted source changed after round trip:\n%s\n---\n%s", src, src2)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	class := &Class{
+		Name:       "Test_Item",
+		Superclass: "Test_Base",
+		Qualifiers: []*Qualifier{
+			{Name: "Dynamic", Value: Value{Kind: BooleanValue, Bool: true}},
+			{Name: "Description", Value: Value{Kind: StringValue, Literal: "Say \"hi\"\n"}, Flavors: []string{"Amended"}},
+		},
+		Properties: []*Property{
+			{Name: "Name", Type: "string", Qualifiers: []*Qualifier{{Name: "Key", Value: Value{Kind: BooleanValue, Bool: true}}}},
+			{Name: "Ratio", Type: "real64", Default: &Value{Kind: RealValue, Literal: "2"}},
+			{Name: "Parent", Type: "ref"},
+			{Name: "Items", Type: "object", ClassName: "Test_Base", IsArray: true},
+		},
+		Methods: []*Method{
+			{Name: "Stop", ReturnType: "uint32", Parameters: []*Property{{Name: "Force", Type: "boolean"}}},
+		},
+	}
+	instance := &Instance{
+		Class: "Test_Item",
+		Properties: []*PropertyValue{
+			{Name: "Name", Value: Value{Kind: StringValue, Literal: `C:\Temp`}},
+			{Name: "Tags", Value: Value{Kind: ArrayValue, Array: []Value{{Kind: IntegerValue, Literal: "1"}, {Kind: NullValue}}}},
+			{Name: "Child", Value: Value{Kind: InstanceValue, Instance: &Instance{
+				Class:      "Test_Base",
+				Properties: []*PropertyValue{{Name: "Name", Value: Value{Kind: CharValue, Literal: "'"}}},
+			}}},
+		},
+	}
+	src, err := Format(class, instance)
+	if err != nil {
+		t.Fatalf("Failed to format; %s", err)
+	}
+	expected := `[Dynamic, Description("Say \"hi\"\n") : Amended]
+class Test_Item : Test_Base
+{
+    [Key] string Name;
+    real64 Ratio = 2.0;
+    object ref Parent;
+    Test_Base Items[];
+    uint32 Stop(boolean Force);
+};
+
+instance of Test_Item
+{
+    Name = "C:\\Temp";
+    Tags = {1, null};
+    Child = instance of Test_Base
+    {
+        Name = '\'';
+    };
+};
+`
+	if string(src) != expected {
+		t.Errorf("Unexpected output:\n%s", src)
+	}
+}
+
+func TestParseQualifiers(t *testing.T) {
+	q, err := ParseQualifiers(`Key, Description("a, b") : Amended, ValueMap{"1", "2"}`)
+	if err != nil {
+		t.Fatalf("Failed to parse; %s", err)
+	}
+	if len(q) != 3 || q[1].Value.Literal != "a, b" || len(q[1].Flavors) != 1 || len(q[2].Value.Array) != 2 {
+		t.Errorf("Unexpected qualifiers %s", FormatQualifiers(q))
+	}
+	if q, err := ParseQualifiers(" "); err != nil || q != nil {
+		t.Errorf("Unexpected result for empty list; %v, %v", q, err)
+	}
+	if _, err := ParseQualifiers(`Key Description`); err == nil {
+		t.Errorf("Invalid qualifier list parsed without errors")
+	}
+}
@@ -0,0 +1,355 @@
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bi-zone/wmi/mof"
+)
+
+// MOFEncoder renders Go structures as MOF class declarations and `instance of`
+// blocks, e.g. to deploy custom classes with mofcomp or to seed test
+// fixtures. Rendering doesn't require WMI and works on any OS.
+//
+// Property names are resolved the same way as `CreateQuery` and
+// `Decoder.Unmarshal` do. Property qualifiers could be set with the "mof"
+// field tag holding MOF qualifier list, e.g.
+//
+//	type Test_Item struct {
+//		Name   string `mof:"Key, Description(\"Unique name.\")"`
+//		State  uint16 `mof:"ValueMap{\"0\", \"1\"}, Values{\"Stopped\", \"Running\"}"`
+//		Parent string `wmi:",ref" mof:"CIMTYPE(\"ref:Test_Item\")"`
+//	}
+//
+// Property types are inferred from Go types:
+//   - bool, intN, uintN, float32, float64 and string map to the matching CIM
+//     types, int and uint map to sint64 and uint64;
+//   - time.Time maps to datetime;
+//   - slices map to arrays ([]byte is uint8[]);
+//   - structures map to embedded objects of the structure type name;
+//   - fields tagged with ",ref" map to references, to the structure type class
+//     for structure fields or to `object ref` for strings.
+//
+// A special "CIMTYPE" qualifier (e.g. `CIMTYPE("uint32")` or
+// `CIMTYPE("ref:Win32_Process")`) overrides the inferred type and is not
+// rendered as a qualifier.
+type MOFEncoder struct {
+	// ClassName overrides the class name. The structure type name is used by
+	// default.
+	ClassName string
+
+	// Superclass is a superclass of the declared class (classes only).
+	Superclass string
+
+	// Qualifiers is a MOF qualifier list of the class or instances, e.g.
+	// `Dynamic, Provider("MyProvider")`.
+	Qualifiers string
+
+	// Namespace, if set, adds `#pragma namespace` before the declarations.
+	// Both `root\cimv2` and `\\.\root\cimv2` forms are accepted.
+	Namespace string
+}
+
+// MarshalMOFClass is a shortcut for `MOFEncoder{}.MarshalClass(src)`.
+func MarshalMOFClass(src interface{}) ([]byte, error) {
+	return MOFEncoder{}.MarshalClass(src)
+}
+
+// MarshalMOFInstances is a shortcut for `MOFEncoder{}.MarshalInstances(src)`.
+func MarshalMOFInstances(src interface{}) ([]byte, error) {
+	return MOFEncoder{}.MarshalInstances(src)
+}
+
+// MarshalClass returns MOF class declaration of the @src structure type. @src
+// could be T, *T, []T, or *[]T.
+func (e MOFEncoder) MarshalClass(src interface{}) ([]byte, error) {
+	class, err := e.Class(src)
+	if err != nil {
+		return nil, err
+	}
+	return mof.Format(e.withPragma(class)...)
+}
+
+// MarshalInstances returns `instance of` declarations of the @src values.
+// @src could be T, *T, []T, or *[]T.
+//
+// Nil pointers and slices are skipped (left unset), time.Time values are
+// rendered as CIM_DATETIME strings, reference fields should be strings
+// holding object paths or MOF aliases (e.g. "$Filter"), structures are
+// rendered as embedded instances.
+func (e MOFEncoder) MarshalInstances(src interface{}) ([]byte, error) {
+	instances, err := e.Instances(src)
+	if err != nil {
+		return nil, err
+	}
+	decls := make([]mof.Decl, 0, len(instances))
+	for _, inst := range instances {
+		decls = append(decls, inst)
+	}
+	return mof.Format(e.withPragma(decls...)...)
+}
+
+func (e MOFEncoder) withPragma(decls ...mof.Decl) []mof.Decl {
+	if e.Namespace == "" {
+		return decls
+	}
+	namespace := e.Namespace
+	if !strings.HasPrefix(namespace, `\\`) {
+		namespace = `\\.\` + namespace
+	}
+	pragma := &mof.Pragma{
+		Name: "namespace",
+		Args: []mof.Value{{Kind: mof.StringValue, Literal: namespace}},
+	}
+	return append([]mof.Decl{pragma}, decls...)
+}
+
+// Class returns MOF class declaration of the @src structure type. See
+// `MarshalClass` for details.
+func (e MOFEncoder) Class(src interface{}) (*mof.Class, error) {
+	t := structType(src)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, ErrInvalidEntityType
+	}
+	class := &mof.Class{Name: e.className(t), Superclass: e.Superclass}
+	if class.Name == "" {
+		return nil, errors.New("wmi: class name of anonymous structure is not set")
+	}
+	var err error
+	if class.Qualifiers, err = mof.ParseQualifiers(e.Qualifiers); err != nil {
+		return nil, fmt.Errorf("wmi: invalid class qualifiers; %w", err)
+	}
+
+	for _, f := range structFields(t) {
+		prop, err := mofProperty(f)
+		if err != nil {
+			return nil, ErrFieldMismatch{
+				FieldType: f.Type,
+				FieldName: f.StructField.Name,
+				Reason:    err.Error(),
+				Err:       err,
+			}
+		}
+		class.Properties = append(class.Properties, prop)
+	}
+	return class, nil
+}
+
+// Instances returns `instance of` declarations of the @src values. See
+// `MarshalInstances` for details.
+func (e MOFEncoder) Instances(src interface{}) ([]*mof.Instance, error) {
+	v := reflect.Indirect(reflect.ValueOf(src))
+	values := []reflect.Value{v}
+	if v.Kind() == reflect.Slice {
+		values = values[:0]
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, reflect.Indirect(v.Index(i)))
+		}
+	}
+
+	qualifiers, err := mof.ParseQualifiers(e.Qualifiers)
+	if err != nil {
+		return nil, fmt.Errorf("wmi: invalid instance qualifiers; %w", err)
+	}
+	var res []*mof.Instance
+	for _, v := range values {
+		if v.Kind() != reflect.Struct {
+			return nil, ErrInvalidEntityType
+		}
+		inst, err := mofInstance(v, e.className(v.Type()))
+		if err != nil {
+			return nil, err
+		}
+		inst.Qualifiers = qualifiers
+		res = append(res, inst)
+	}
+	return res, nil
+}
+
+func (e MOFEncoder) className(t reflect.Type) string {
+	if e.ClassName != "" {
+		return e.ClassName
+	}
+	return t.Name()
+}
+
+// mofProperty returns the property declaration of the structure field.
+func mofProperty(f structField) (*mof.Property, error) {
+	prop := &mof.Property{Name: f.Name}
+	qualifiers, err := mof.ParseQualifiers(f.Tag.Get("mof"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid qualifiers; %w", err)
+	}
+	var cimType string
+	for _, q := range qualifiers {
+		if strings.EqualFold(q.Name, "CIMTYPE") {
+			cimType = q.Value.Literal
+			continue
+		}
+		prop.Qualifiers = append(prop.Qualifiers, q)
+	}
+
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		prop.IsArray = true
+		t = t.Elem()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+
+	if cimType != "" {
+		prop.Type, prop.ClassName = cimType, ""
+		if idx := strings.Index(cimType, ":"); idx != -1 {
+			prop.Type, prop.ClassName = cimType[:idx], cimType[idx+1:]
+		}
+		if prop.Type != "ref" && prop.Type != "object" {
+			if _, err := ParseCIMType(prop.Type); err != nil {
+				return nil, err
+			}
+		}
+		return prop, nil
+	}
+
+	if f.IsRef {
+		switch {
+		case t.Kind() == reflect.String:
+			prop.Type = "ref"
+		case t.Kind() == reflect.Struct && t != timeType:
+			prop.Type, prop.ClassName = "ref", t.Name()
+		default:
+			return nil, errors.New("reference field should be a string or a structure")
+		}
+		return prop, nil
+	}
+
+	prop.Type, prop.ClassName, err = mofType(t)
+	return prop, err
+}
+
+// mofType returns MOF type of the scalar Go type.
+func mofType(t reflect.Type) (typ, className string, err error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", "", nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fmt.Sprintf("sint%d", t.Bits()), "", nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("uint%d", t.Bits()), "", nil
+	case reflect.Int:
+		return "sint64", "", nil
+	case reflect.Uint:
+		return "uint64", "", nil
+	case reflect.Float32, reflect.Float64:
+		return fmt.Sprintf("real%d", t.Bits()), "", nil
+	case reflect.String:
+		return "string", "", nil
+	case reflect.Struct:
+		if t == timeType {
+			return "datetime", "", nil
+		}
+		return "object", t.Name(), nil
+	}
+	return "", "", fmt.Errorf("unsupported type (%s); set CIMTYPE qualifier", t)
+}
+
+// mofInstance returns the instance declaration of the structure value @v.
+func mofInstance(v reflect.Value, className string) (*mof.Instance, error) {
+	if className == "" {
+		return nil, errors.New("wmi: class name of anonymous structure is not set")
+	}
+	inst := &mof.Instance{Class: className}
+	for _, f := range structFields(v.Type()) {
+		value, ok, err := mofValue(v.FieldByIndex(f.Index), f.IsRef)
+		if err != nil {
+			return nil, ErrFieldMismatch{
+				FieldType: f.Type,
+				FieldName: f.StructField.Name,
+				Reason:    err.Error(),
+				Err:       err,
+			}
+		}
+		if ok {
+			inst.Properties = append(inst.Properties, &mof.PropertyValue{Name: f.Name, Value: value})
+		}
+	}
+	return inst, nil
+}
+
+// mofValue returns MOF value of the field. Returns false if the field should
+// be skipped.
+func mofValue(f reflect.Value, isRef bool) (value mof.Value, ok bool, err error) {
+	if f.Kind() == reflect.Ptr || f.Kind() == reflect.Interface {
+		if f.IsNil() {
+			return value, false, nil
+		}
+		f = f.Elem()
+	}
+
+	switch f.Kind() {
+	case reflect.Bool:
+		return mof.Value{Kind: mof.BooleanValue, Bool: f.Bool()}, true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return mof.Value{Kind: mof.IntegerValue, Literal: strconv.FormatInt(f.Int(), 10)}, true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return mof.Value{Kind: mof.IntegerValue, Literal: strconv.FormatUint(f.Uint(), 10)}, true, nil
+	case reflect.Float32, reflect.Float64:
+		if v := f.Float(); math.IsNaN(v) || math.IsInf(v, 0) {
+			return value, false, fmt.Errorf("%v can't be represented in MOF", v)
+		}
+		literal := strconv.FormatFloat(f.Float(), 'g', -1, f.Type().Bits())
+		return mof.Value{Kind: mof.RealValue, Literal: literal}, true, nil
+	case reflect.String:
+		if s := f.String(); isRef && strings.HasPrefix(s, "$") {
+			return mof.Value{Kind: mof.AliasValue, Literal: s[1:]}, true, nil
+		}
+		return mof.Value{Kind: mof.StringValue, Literal: f.String()}, true, nil
+	case reflect.Slice:
+		if f.IsNil() {
+			return value, false, nil
+		}
+		value = mof.Value{Kind: mof.ArrayValue, Array: []mof.Value{}}
+		for i := 0; i < f.Len(); i++ {
+			elem, ok, err := mofValue(f.Index(i), isRef)
+			if err != nil {
+				return value, false, err
+			}
+			if !ok {
+				elem = mof.Value{Kind: mof.NullValue}
+			}
+			value.Array = append(value.Array, elem)
+		}
+		return value, true, nil
+	case reflect.Struct:
+		if t, isTime := f.Interface().(time.Time); isTime {
+			return mof.Value{Kind: mof.StringValue, Literal: formatDateTime(t)}, true, nil
+		}
+		if isRef {
+			return value, false, errors.New("reference should be an object path string")
+		}
+		inst, err := mofInstance(f, f.Type().Name())
+		if err != nil {
+			return value, false, err
+		}
+		return mof.Value{Kind: mof.InstanceValue, Instance: inst}, true, nil
+	}
+	return value, false, fmt.Errorf("unsupported type (%s)", f.Type())
+}
+
+// formatDateTime formats @t as CIM_DATETIME string. See `unmarshalTime` for the
+// format description.
+func formatDateTime(t time.Time) string {
+	_, offset := t.Zone()
+	return t.Format("20060102150405.000000") + fmt.Sprintf("%+04d", offset/60)
+}
@@ -0,0 +1,177 @@
+package wmi
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bi-zone/wmi/mof"
+)
+
+type Test_Base struct {
+	Name string `mof:"Key, Description(\"Unique \\\"name\\\".\")"`
+}
+
+type Test_Item struct {
+	Name     string `mof:"Key"`
+	State    uint16 `mof:"ValueMap{\"0\", \"1\"}, Values{\"Stopped\", \"Running\"}"`
+	Size     *uint64
+	Count    int
+	Ratio    float64
+	Enabled  bool
+	Created  time.Time
+	Tags     []string
+	Data     []byte
+	Parent   string    `wmi:",ref" mof:"CIMTYPE(\"ref:Test_Base\")"`
+	Owner    Test_Base `wmi:",ref"`
+	Any      string    `wmi:",ref"`
+	Embedded *Test_Base
+	Handle   interface{} `wmi:"ProcessHandle" mof:"CIMTYPE(\"uint32\")"`
+	Skipped  string      `wmi:"-"`
+	internal int
+}
+
+func TestMOFEncoder_MarshalClass(t *testing.T) {
+	e := MOFEncoder{
+		Superclass: "Test_Root",
+		Qualifiers: `Dynamic, Provider("TestProvider")`,
+		Namespace:  `root\test`,
+	}
+	src, err := e.MarshalClass([]Test_Item{})
+	if err != nil {
+		t.Fatalf("Failed to marshal; %s", err)
+	}
+	if nilSrc, err := e.MarshalClass((*Test_Item)(nil)); err != nil || string(nilSrc) != string(src) {
+		t.Errorf("Unexpected class of nil pointer; %v\n%s", err, nilSrc)
+	}
+	expected := `#pragma namespace("\\\\.\\root\\test")
+
+[Dynamic, Provider("TestProvider")]
+class Test_Item : Test_Root
+{
+    [Key] string Name;
+    [ValueMap{"0", "1"}, Values{"Stopped", "Running"}] uint16 State;
+    uint64 Size;
+    sint64 Count;
+    real64 Ratio;
+    boolean Enabled;
+    datetime Created;
+    string Tags[];
+    uint8 Data[];
+    Test_Base ref Parent;
+    Test_Base ref Owner;
+    object ref Any;
+    Test_Base Embedded;
+    uint32 ProcessHandle;
+};
+`
+	if string(src) != expected {
+		t.Errorf("Unexpected class MOF:\n%s", src)
+	}
+
+	// The result should be parseable.
+	f, err := mof.Parse("", src)
+	if err != nil {
+		t.Fatalf("Failed to parse marshalled class; %s", err)
+	}
+	if f.Classes[0].Namespace != `\\.\root\test` {
+		t.Errorf("Unexpected namespace %q", f.Classes[0].Namespace)
+	}
+
+	base, err := MarshalMOFClass(&Test_Base{})
+	if err != nil {
+		t.Fatalf("Failed to marshal; %s", err)
+	}
+	if expected := "class Test_Base\n{\n    [Key, Description(\"Unique \\\"name\\\".\")] string Name;\n};\n"; string(base) != expected {
+		t.Errorf("Unexpected class MOF:\n%s", base)
+	}
+}
+
+func TestMOFEncoder_MarshalClass_Errors(t *testing.T) {
+	if _, err := MarshalMOFClass(42); err != ErrInvalidEntityType {
+		t.Errorf("Unexpected error for non structure type; %v", err)
+	}
+	if _, err := MarshalMOFClass(struct{ A string }{}); err == nil {
+		t.Errorf("Successfully marshalled anonymous structure")
+	}
+
+	type Bad struct {
+		M map[string]string
+	}
+	var mismatch ErrFieldMismatch
+	if _, err := MarshalMOFClass(Bad{}); !errors.As(err, &mismatch) || mismatch.FieldName != "M" {
+		t.Errorf("Unexpected error for unsupported field; %v", err)
+	}
+	type BadTag struct {
+		A string `mof:"Key Description"`
+	}
+	var syntax mof.ErrorList
+	if _, err := MarshalMOFClass(BadTag{}); !errors.As(err, &mismatch) || mismatch.FieldName != "A" ||
+		!errors.As(err, &syntax) {
+		t.Errorf("Unexpected error for invalid qualifiers; %v", err)
+	}
+	if _, err := (MOFEncoder{Qualifiers: "("}).MarshalClass(Test_Base{}); err == nil {
+		t.Errorf("Successfully marshalled class with invalid qualifiers")
+	}
+}
+
+func TestMOFEncoder_MarshalInstances(t *testing.T) {
+	if _, err := MarshalMOFInstances(Test_Item{}); err == nil {
+		t.Errorf("Successfully marshalled structure value of reference field")
+	}
+	type Real struct {
+		Value float64
+	}
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		var mismatch ErrFieldMismatch
+		if _, err := MarshalMOFInstances(Real{v}); !errors.As(err, &mismatch) || mismatch.FieldName != "Value" {
+			t.Errorf("Unexpected error for %v value; %v", v, err)
+		}
+	}
+
+	type Instance struct {
+		Name    string
+		Created time.Time
+		Parent  string `wmi:",ref"`
+		Child   *Test_Base
+		Values  []*int
+	}
+	one := 1
+	inst := Instance{
+		Name:    "first\n\"quoted\" \\ path",
+		Created: time.Date(2020, 11, 12, 13, 14, 15, 16000, time.FixedZone("", 3*60*60)),
+		Parent:  "$Alias",
+		Child:   &Test_Base{Name: "child"},
+		Values:  []*int{&one, nil},
+	}
+	src, err := MOFEncoder{ClassName: "Test_Derived"}.MarshalInstances(&[]Instance{inst, {Name: "second"}})
+	if err != nil {
+		t.Fatalf("Failed to marshal; %s", err)
+	}
+	expected := `instance of Test_Derived
+{
+    Name = "first\n\"quoted\" \\ path";
+    Created = "20201112131415.000016+180";
+    Parent = $Alias;
+    Child = instance of Test_Base
+    {
+        Name = "child";
+    };
+    Values = {1, null};
+};
+
+instance of Test_Derived
+{
+    Name = "second";
+    Created = "00010101000000.000000+000";
+    Parent = "";
+};
+`
+	if string(src) != expected {
+		t.Errorf("Unexpected instances MOF:\n%s", src)
+	}
+	if _, err := mof.Parse("", src); err != nil {
+		t.Errorf("Failed to parse marshalled instances; %s", err)
+	}
+}
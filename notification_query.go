@@ -3,14 +3,13 @@
 package wmi
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/bi-zone/go-ole"
-	"github.com/bi-zone/go-ole/oleutil"
 	"github.com/hashicorp/go-multierror"
 	"github.com/jeffreystoke/comshim"
 )
@@ -20,23 +19,46 @@ var (
 	ErrAlreadyRunning = errors.New("already running")
 )
 
-const (
-	wbemErrTimedOut            = 0x80043001
-	defaultNotificationTimeout = time.Second
-)
-
 // NotificationQuery represents subscription to the WMI events.
 // For more info see https://docs.microsoft.com/en-us/windows/desktop/wmisdk/swbemservices-execnotificationquery
 type NotificationQuery struct {
+	// queryTimeoutMs is accessed atomically, so it's the first field to be
+	// 64-bit aligned.
+	queryTimeoutMs int64
+
 	Decoder
 
+	// Observer is an optional observer of the query calls and events
+	// delivery. Calls are counted in `Stats` regardless of it. Should be set
+	// before query being started.
+	Observer Observer
+
+	// Resubscribe is an optional policy of reestablishing the subscription
+	// lost because of the disconnect or WMI service restart (see
+	// `SubscribeOptions.Resubscribe`). Should be set before query being
+	// started.
+	Resubscribe *RetryPolicy
+
+	// Recorder is an optional recorder of the raw events received (see
+	// `Replay`). Should be set before query being started.
+	Recorder *Recorder
+
+	// Filter is an optional policy of filtering, deduplication and sampling
+	// of the events in Go (see `SubscribeOptions.Filter`). Should be set
+	// before query being started.
+	Filter *FilterPolicy
+
 	sync.Mutex
 	query             string
 	state             state
 	doneCh            chan struct{}
+	cancel            context.CancelFunc
 	eventCh           interface{}
+	delivery          DeliveryPolicy
 	connectServerArgs []interface{}
-	queryTimeoutMs    int64
+	stats             statsRecorder
+	gaps              chan Gap
+	subscription      atomic.Value // *Subscription
 }
 
 // NewNotificationQuery creates a NotificationQuery from the given WQL @query
@@ -48,13 +70,32 @@ type NotificationQuery struct {
 //
 // Returns error if @eventCh is not `chan T` nor `chan *T`.
 func NewNotificationQuery(eventCh interface{}, query string) (*NotificationQuery, error) {
-	if !isChannelTypeOK(eventCh) {
-		return nil, errors.New("eventCh has incorrect type; should be `chan T` or `chan *T`")
+	return NewNotificationQueryWithPolicy(eventCh, query, DeliveryPolicy{})
+}
+
+// NewNotificationQueryWithPolicy creates a NotificationQuery the same way as
+// `NewNotificationQuery` does, but the events are delivered according to the
+// @policy (see `DeliveryPolicy`). E.g. @eventCh should be `chan []T` or
+// `chan []*T` to receive the events in batches:
+//
+//	events := make(chan []Win32_ProcessStartTrace)
+//	q, err := NewNotificationQueryWithPolicy(events, query, DeliveryPolicy{
+//		Mode:          DeliveryBatch,
+//		BufferSize:    100,
+//		FlushInterval: time.Second,
+//	})
+//
+// Returns error if @policy is invalid or @eventCh type doesn't suit it.
+func NewNotificationQueryWithPolicy(eventCh interface{}, query string, policy DeliveryPolicy) (*NotificationQuery, error) {
+	if _, _, err := policy.eventType(eventCh); err != nil {
+		return nil, err
 	}
 	q := NotificationQuery{
-		state:   stateNotStarted,
-		eventCh: eventCh,
-		query:   query,
+		state:    stateNotStarted,
+		eventCh:  eventCh,
+		delivery: policy,
+		query:    query,
+		gaps:     make(chan Gap, 1),
 	}
 	q.SetNotificationTimeout(defaultNotificationTimeout)
 	return &q, nil
@@ -70,13 +111,11 @@ func NewNotificationQuery(eventCh interface{}, query string) (*NotificationQuery
 //
 // Setting it to negative Duration makes that interval infinite.
 func (q *NotificationQuery) SetNotificationTimeout(t time.Duration) {
-	q.Lock()
-	defer q.Unlock()
 	if t < 0 {
-		q.queryTimeoutMs = -1
+		atomic.StoreInt64(&q.queryTimeoutMs, -1)
 		return
 	}
-	q.queryTimeoutMs = int64(t / time.Millisecond)
+	atomic.StoreInt64(&q.queryTimeoutMs, int64(t/time.Millisecond))
 }
 
 // SetConnectServerArgs sets `SWbemLocator.ConnectServer` args. Args are
@@ -105,12 +144,15 @@ func (q *NotificationQuery) StartNotifications() (err error) {
 		q.Unlock()
 		return nil
 	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
 	q.doneCh = make(chan struct{})
 	q.state = stateStarted
 	q.Unlock()
 
 	// Mark as stopped on any return.
 	defer func() {
+		cancel()
 		q.state = stateStopped
 		close(q.doneCh)
 	}()
@@ -118,7 +160,7 @@ func (q *NotificationQuery) StartNotifications() (err error) {
 	//  Be aware of reflections and COM usage.
 	defer func() {
 		if r := recover(); r != nil {
-			err = multierror.Append(err, fmt.Errorf("runtime panic; %v", err))
+			err = multierror.Append(err, fmt.Errorf("runtime panic; %v", r))
 		}
 	}()
 
@@ -127,67 +169,86 @@ func (q *NotificationQuery) StartNotifications() (err error) {
 	defer comshim.Done()
 
 	// Connect to WMI service.
+	observer := MultiObserver(&q.stats, q.Observer)
+	host, namespace := connectTarget(q.connectServerArgs)
+	done := observe(observer, CallInfo{Operation: OpConnect, Host: host, Namespace: namespace})
 	service, err := ConnectSWbemServices(q.connectServerArgs...)
+	done(0, err)
 	if err != nil {
-		return fmt.Errorf("failed to connect WMI service; %s", err)
+		return fmt.Errorf("failed to connect WMI service; %w", err)
 	}
-	defer func() {
-		if clErr := service.Close(); clErr != nil {
-			err = multierror.Append(err, clErr)
-		}
-	}()
+	service.Observer = observer
 	q.Dereferencer = service
+	service.Decoder = q.Decoder
 
-	// Subscribe to the events. ExecNotificationQuery call must have that flags
-	// and no other.
-	sWbemEventSource, err := oleutil.CallMethod(
-		service.sWbemServices,
-		"ExecNotificationQuery",
-		q.query,
-		"WQL",
-		0x00000010|0x00000020, // WBEM_FLAG_RETURN_IMMEDIATELY | WBEM_FLAG_FORWARD_ONLY
-	)
+	// Subscribe to the events. Unlike `Subscribe` the query is stopped by the
+	// first decoding error.
+	sub, ctx, err := newSubscription(ctx, q.query, q.eventCh, &SubscribeOptions{
+		Resubscribe: q.Resubscribe,
+		Delivery:    q.delivery,
+		Recorder:    q.Recorder,
+		Filter:      q.Filter,
+	})
 	if err != nil {
-		return fmt.Errorf("ExecNotificationQuery failed; %s", err)
+		return multierror.Append(err, service.Close())
+	}
+	sub.failOnDecodeError = true
+	sub.pollTimeout = q.notificationTimeout
+	sub.gaps = q.gaps
+	q.subscription.Store(sub)
+	if err := service.subscribe(ctx, sub, service.Close); err != nil {
+		return multierror.Append(err, service.Close())
 	}
-	eventSource := sWbemEventSource.ToIDispatch()
-	defer eventSource.Release()
 
-	reflectedDoneChan := reflect.ValueOf(q.doneCh)
-	reflectedResChan := reflect.ValueOf(q.eventCh)
-	eventType := reflectedResChan.Type().Elem()
+	<-sub.Done()
+	if err := sub.Err(); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil // Query stopped.
+}
 
-	for {
-		// If it is a time to stop somebody will listen on doneCh.
-		select {
-		case q.doneCh <- struct{}{}:
-			return nil
-		default:
-		}
+// notificationTimeout returns the timeout set with `SetNotificationTimeout`.
+func (q *NotificationQuery) notificationTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&q.queryTimeoutMs)) * time.Millisecond
+}
 
-		// Or try to query new events waiting no longer than queryTimeoutMs.
-		eventIUnknown, err := eventSource.CallMethod("NextEvent", q.queryTimeoutMs)
-		if err != nil {
-			if isTimeoutError(err) {
-				continue
-			}
-			return fmt.Errorf("unexpected NextEvent error; %s", err)
-		}
-		event := eventIUnknown.ToIDispatch()
+// Health returns the health of the running query.
+func (q *NotificationQuery) Health() SubscriptionHealth {
+	if sub, ok := q.subscription.Load().(*Subscription); ok {
+		return sub.Health()
+	}
+	return SubscriptionHealth{}
+}
 
-		// Unmarshal event.
-		e := reflect.New(eventType)
-		if err := q.Unmarshal(event, e.Interface()); err != nil {
-			return fmt.Errorf("failed to unmarshal event; %s", err)
-		}
-		_ = eventIUnknown.Clear() // Nah. We can't handle it anyway.
+// Gaps returns the channel of the periods the events have been missed because
+// the subscription has been lost and reestablished (see `Resubscribe`). Only
+// the latest gap is kept, so it's fine not to read it at all. The channel is
+// closed when the running query stops.
+func (q *NotificationQuery) Gaps() <-chan Gap {
+	return q.gaps
+}
 
-		// Send to the user.
-		sent := trySend(reflectedResChan, reflectedDoneChan, e.Elem())
-		if !sent {
-			return nil // Query stopped
-		}
+// Dropped returns the number of the events dropped by the delivery policy of
+// the running query.
+func (q *NotificationQuery) Dropped() uint64 {
+	if sub, ok := q.subscription.Load().(*Subscription); ok {
+		return sub.Dropped()
 	}
+	return 0
+}
+
+// Filtered returns the number of the events rejected by the `Filter` policy of
+// the running query.
+func (q *NotificationQuery) Filtered() uint64 {
+	if sub, ok := q.subscription.Load().(*Subscription); ok {
+		return sub.Filtered()
+	}
+	return 0
+}
+
+// Stats returns the counters of the query calls and events.
+func (q *NotificationQuery) Stats() Stats {
+	return q.stats.snapshot()
 }
 
 // Stop stops the running query waiting until everything is released. It could
@@ -197,6 +258,7 @@ func (q *NotificationQuery) Stop() {
 	q.Lock()
 	defer q.Unlock()
 	if q.state == stateStarted {
+		q.cancel()
 		<-q.doneCh
 	}
 	q.state = stateStopped
@@ -209,49 +271,3 @@ const (
 	stateStarted
 	stateStopped
 )
-
-func isTimeoutError(err error) bool {
-	oleErr, ok := err.(*ole.OleError)
-	if !ok {
-		return false
-	}
-	exception, ok := oleErr.SubError().(ole.EXCEPINFO)
-	return ok && exception.SCODE() == wbemErrTimedOut
-}
-
-func isChannelTypeOK(eventCh interface{}) bool {
-	chT := reflect.TypeOf(eventCh)
-	if chT.Kind() != reflect.Chan {
-		return false
-	}
-	elemT := chT.Elem()
-	switch elemT.Kind() {
-	case reflect.Struct:
-		return true
-	case reflect.Ptr:
-		return elemT.Elem().Kind() == reflect.Struct
-	}
-	return false
-}
-
-// trySend does a send in select block like:
-//     select {
-//     case resCh <- resEl:
-//         return true
-//     case doneCh <- struct{}{}:
-//         return false
-//     }
-func trySend(resCh, doneCh, resEl reflect.Value) (sendSuccessful bool) {
-	resCase := reflect.SelectCase{
-		Dir:  reflect.SelectSend,
-		Chan: resCh,
-		Send: resEl,
-	}
-	doneCase := reflect.SelectCase{
-		Dir:  reflect.SelectSend,
-		Chan: doneCh,
-		Send: reflect.ValueOf(struct{}{}),
-	}
-	idx, _, _ := reflect.Select([]reflect.SelectCase{resCase, doneCase})
-	return idx == 0
-}
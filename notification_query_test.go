@@ -34,6 +34,30 @@ func TestNewNotificationQuery(t *testing.T) {
 	}
 }
 
+func TestNewNotificationQueryWithPolicy(t *testing.T) {
+	type T struct{}
+	batch := DeliveryPolicy{Mode: DeliveryBatch}
+	cases := []struct {
+		ch         interface{}
+		policy     DeliveryPolicy
+		shouldFail bool
+	}{
+		{make(chan []T), batch, false},
+		{make(chan []*T), batch, false},
+		{make(chan T), batch, true},
+		{make(chan T), DeliveryPolicy{Mode: DeliveryDropOldest}, false},
+		{make(chan T), DeliveryPolicy{Mode: DeliveryDropNewest, BufferSize: -1}, true},
+	}
+	for _, test := range cases {
+		_, err := NewNotificationQueryWithPolicy(test.ch, "any", test.policy)
+		if test.shouldFail && err == nil {
+			t.Errorf("Successfully created NotificationQuery with eventCh of type %T and %s policy", test.ch, test.policy.Mode)
+		} else if !test.shouldFail && err != nil {
+			t.Errorf("Failed to create NotificationQuery with eventCh of type %T and %s policy; %s", test.ch, test.policy.Mode, err)
+		}
+	}
+}
+
 func TestNotificationQuery(t *testing.T) {
 	type event struct {
 		Created  uint64 `wmi:"TIME_CREATED"`
@@ -0,0 +1,226 @@
+package wmi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Operation is a kind of the observed WMI call.
+type Operation string
+
+// Observed operations.
+const (
+	// OpConnect is `SWbemLocator.ConnectServer` call.
+	OpConnect Operation = "ConnectServer"
+	// OpExecQuery is `SWbemServices.ExecQuery` call. Results enumeration
+	// is observed separately as OpEnumerate.
+	OpExecQuery Operation = "ExecQuery"
+	// OpEnumerate is the enumeration of the query results including their
+	// decoding. CallInfo.Objects holds the number of objects enumerated.
+	OpEnumerate Operation = "Enumerate"
+	// OpGet is `SWbemServices.Get` call including the dereference of the
+	// reference fields. CallInfo.Query holds the object path.
+	OpGet Operation = "Get"
+	// OpExecMethod is `SWbemObject.ExecMethod_` call. CallInfo.Query holds
+	// the object path and the method name separated by ".".
+	OpExecMethod Operation = "ExecMethod"
+	// OpDecode is the decoding of a single object. CallInfo.Query holds the
+	// query (or the object path) returned the object.
+	OpDecode Operation = "Decode"
+	// OpExecNotificationQuery is `SWbemServices.ExecNotificationQuery` call.
+	OpExecNotificationQuery Operation = "ExecNotificationQuery"
+	// OpEvent is the delivery of a single event including its decoding.
+	OpEvent Operation = "Event"
+)
+
+// CallInfo describes the observed call.
+type CallInfo struct {
+	Operation Operation
+	Host      string // Server name, "." for the local one.
+	Namespace string
+	Query     string // Query text, object path, etc. depending on Operation.
+
+	// Context is the context of the call (e.g. of `Client.QueryContext`) if
+	// known, nil otherwise.
+	Context context.Context
+
+	// Results are set when the call is done.
+	Objects  int
+	Duration time.Duration
+	Err      error
+}
+
+// withOp returns a copy of the @info for the @op call.
+func (info CallInfo) withOp(op Operation, query string) CallInfo {
+	info.Operation = op
+	info.Query = query
+	return info
+}
+
+// Observer is notified about the WMI calls, e.g. to collect metrics or
+// tracing spans. It should be safe for concurrent use.
+type Observer interface {
+	// CallStarted is invoked before the call. The returned function (if not
+	// nil) is invoked when the call is done with the @info completed with
+	// the call results.
+	CallStarted(info CallInfo) (done func(info CallInfo))
+}
+
+// ObserverFunc is an Observer notified only when the calls are done.
+type ObserverFunc func(info CallInfo)
+
+// CallStarted implements Observer.
+func (f ObserverFunc) CallStarted(CallInfo) func(info CallInfo) {
+	return f
+}
+
+// MultiObserver returns an Observer notifying all the @observers. Nil
+// observers are skipped.
+func MultiObserver(observers ...Observer) Observer {
+	var res multiObserver
+	for _, o := range observers {
+		if o != nil {
+			res = append(res, o)
+		}
+	}
+	switch len(res) {
+	case 0:
+		return nil
+	case 1:
+		return res[0]
+	}
+	return res
+}
+
+type multiObserver []Observer
+
+func (m multiObserver) CallStarted(info CallInfo) func(info CallInfo) {
+	dones := make([]func(info CallInfo), 0, len(m))
+	for _, o := range m {
+		if done := o.CallStarted(info); done != nil {
+			dones = append(dones, done)
+		}
+	}
+	return func(info CallInfo) {
+		for _, done := range dones {
+			done(info)
+		}
+	}
+}
+
+// contextObserver is an Observer setting the context of the calls.
+type contextObserver struct {
+	ctx      context.Context
+	observer Observer
+}
+
+// withContext returns an Observer notifying @observer (if not nil) about the
+// calls done with the @ctx.
+func withContext(ctx context.Context, observer Observer) Observer {
+	if observer == nil {
+		return nil
+	}
+	return contextObserver{ctx: ctx, observer: observer}
+}
+
+func (o contextObserver) CallStarted(info CallInfo) func(info CallInfo) {
+	if info.Context == nil {
+		info.Context = o.ctx
+	}
+	done := o.observer.CallStarted(info)
+	if done == nil {
+		return nil
+	}
+	return func(info CallInfo) {
+		if info.Context == nil {
+			info.Context = o.ctx
+		}
+		done(info)
+	}
+}
+
+// observe notifies @observer (if not nil) about the call start and returns
+// the function to be invoked with the call results.
+func observe(observer Observer, info CallInfo) func(objects int, err error) {
+	if observer == nil {
+		return func(int, error) {}
+	}
+	start := time.Now()
+	done := observer.CallStarted(info)
+	return func(objects int, err error) {
+		if done == nil {
+			return
+		}
+		info.Objects = objects
+		info.Err = err
+		info.Duration = time.Since(start)
+		done(info)
+	}
+}
+
+// connectTarget returns the host and namespace of `SWbemLocator.ConnectServer`
+// args.
+func connectTarget(connectServerArgs []interface{}) (host, namespace string) {
+	if len(connectServerArgs) > 0 {
+		host, _ = connectServerArgs[0].(string)
+	}
+	if len(connectServerArgs) > 1 {
+		namespace, _ = connectServerArgs[1].(string)
+	}
+	if host == "" {
+		host = "."
+	}
+	if namespace == "" {
+		namespace = `root\cimv2`
+	}
+	return host, namespace
+}
+
+// OperationStats are counters of the operation calls.
+type OperationStats struct {
+	Calls    uint64
+	Errors   uint64
+	Objects  uint64
+	Duration time.Duration // Total duration of the calls.
+}
+
+// Stats are the call counters by operation.
+type Stats map[Operation]OperationStats
+
+// statsRecorder is an Observer counting the calls.
+type statsRecorder struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+func (r *statsRecorder) CallStarted(CallInfo) func(info CallInfo) {
+	return r.record
+}
+
+func (r *statsRecorder) record(info CallInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stats == nil {
+		r.stats = make(Stats)
+	}
+	s := r.stats[info.Operation]
+	s.Calls++
+	if info.Err != nil {
+		s.Errors++
+	}
+	s.Objects += uint64(info.Objects)
+	s.Duration += info.Duration
+	r.stats[info.Operation] = s
+}
+
+// snapshot returns a copy of the counters.
+func (r *statsRecorder) snapshot() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make(Stats, len(r.stats))
+	for op, s := range r.stats {
+		res[op] = s
+	}
+	return res
+}
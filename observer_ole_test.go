@@ -0,0 +1,117 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClient_Observer(t *testing.T) {
+	rec := &recordingObserver{}
+	c := Client{Observer: rec}
+
+	var dst []Win32_Process
+	if err := c.Query("SELECT * FROM Win32_Process", &dst); err != nil {
+		t.Fatalf("Query: %s", err)
+	}
+
+	stats := c.Stats()
+	if stats[OpConnect].Calls != 1 || stats[OpExecQuery].Calls != 1 || stats[OpEnumerate].Calls != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if s := stats[OpEnumerate]; s.Objects != uint64(len(dst)) || s.Duration <= 0 {
+		t.Errorf("Unexpected enumeration stats %+v", s)
+	}
+	if s := stats[OpDecode]; s.Calls != uint64(len(dst)) {
+		t.Errorf("Unexpected decode stats %+v", s)
+	}
+
+	var queries int
+	for _, info := range rec.done {
+		if info.Operation == OpExecQuery {
+			queries++
+			if info.Host != "." || info.Namespace != `root\cimv2` || info.Query != "SELECT * FROM Win32_Process" {
+				t.Errorf("Unexpected call info %+v", info)
+			}
+		}
+	}
+	if queries != 1 || len(rec.started) != len(rec.done) {
+		t.Errorf("Unexpected observed calls %d/%d", len(rec.started), len(rec.done))
+	}
+}
+
+func TestSWbemServicesConnection_Stats(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	var process Win32_Process
+	if err := s.Get(`Win32_Process.Handle="4"`, &process); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	_ = s.Get(`Win32_Process.Handle="4294967295"`, &process)
+
+	stats := s.Stats()
+	if s := stats[OpGet]; s.Calls != 2 || s.Errors != 1 {
+		t.Errorf("Unexpected Get stats %+v", s)
+	}
+	if s := stats[OpDecode]; s.Calls != 1 || s.Objects != 1 {
+		t.Errorf("Unexpected decode stats %+v", s)
+	}
+}
+
+func TestClient_QueryContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, 1))
+	defer cancel()
+
+	rec := &recordingObserver{}
+	c := Client{Observer: rec}
+	var dst []Win32_OperatingSystem
+	if err := c.QueryContext(ctx, "SELECT * FROM Win32_OperatingSystem", &dst); err != nil {
+		t.Fatalf("QueryContext: %s", err)
+	}
+	for _, info := range rec.done {
+		if info.Context != ctx {
+			t.Errorf("Unexpected context of %s call", info.Operation)
+		}
+	}
+
+	cancel()
+	err := c.QueryContext(ctx, "SELECT * FROM Win32_OperatingSystem", &dst)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error of cancelled query; %v", err)
+	}
+}
+
+func TestClient_QueryContext_SharedClient(t *testing.T) {
+	services, err := NewSWbemServices()
+	if err != nil {
+		t.Fatalf("NewSWbemServices: %s", err)
+	}
+	defer services.Close()
+
+	rec := &recordingObserver{}
+	c := Client{Observer: rec, SWbemServicesClient: services}
+	ctx := context.WithValue(context.Background(), struct{}{}, 1)
+	var dst []Win32_OperatingSystem
+	if err := c.QueryContext(ctx, "SELECT * FROM Win32_OperatingSystem", &dst); err != nil {
+		t.Fatalf("QueryContext: %s", err)
+	}
+	if len(rec.done) == 0 {
+		t.Fatalf("Calls aren't observed")
+	}
+	for _, info := range rec.done {
+		if info.Context != ctx {
+			t.Errorf("Unexpected context of %s call", info.Operation)
+		}
+	}
+	// The shared client isn't patched with the call observer.
+	if services.Observer != nil {
+		t.Errorf("Observer of the call is left on the shared client")
+	}
+}
@@ -0,0 +1,139 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingObserver records the calls started and done.
+type recordingObserver struct {
+	mu      sync.Mutex
+	started []CallInfo
+	done    []CallInfo
+}
+
+func (o *recordingObserver) CallStarted(info CallInfo) func(info CallInfo) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, info)
+	return func(info CallInfo) {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.done = append(o.done, info)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	rec := &recordingObserver{}
+	var funcCalls []CallInfo
+	observer := MultiObserver(nil, rec, ObserverFunc(func(info CallInfo) {
+		funcCalls = append(funcCalls, info)
+	}))
+
+	info := CallInfo{Operation: OpExecQuery, Host: ".", Namespace: `root\cimv2`, Query: "SELECT * FROM Win32_Process"}
+	done := observe(observer, info)
+	if !reflect.DeepEqual(rec.started, []CallInfo{info}) || len(rec.done) != 0 {
+		t.Fatalf("Unexpected calls started %+v", rec.started)
+	}
+
+	queryErr := errors.New("query failed")
+	time.Sleep(time.Millisecond)
+	done(42, queryErr)
+	if len(rec.done) != 1 || !reflect.DeepEqual(rec.done, funcCalls) {
+		t.Fatalf("Unexpected calls done %+v, %+v", rec.done, funcCalls)
+	}
+	result := rec.done[0]
+	if result.Objects != 42 || result.Err != queryErr || result.Duration < time.Millisecond ||
+		result.Query != info.Query || result.Operation != OpExecQuery {
+		t.Errorf("Unexpected call result %+v", result)
+	}
+
+	// Nil observers are fine.
+	if MultiObserver(nil, nil) != nil || MultiObserver(rec) != rec {
+		t.Errorf("Unexpected MultiObserver simplification")
+	}
+	observe(nil, info)(1, nil)
+}
+
+func TestWithContext(t *testing.T) {
+	if withContext(context.Background(), nil) != nil {
+		t.Errorf("Context of nil observer isn't nil")
+	}
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	rec := &recordingObserver{}
+	observer := withContext(ctx, rec)
+	observe(observer, CallInfo{Operation: OpExecQuery})(1, nil)
+	if len(rec.started) != 1 || rec.started[0].Context != ctx {
+		t.Errorf("Unexpected calls started %+v", rec.started)
+	}
+	if len(rec.done) != 1 || rec.done[0].Context != ctx {
+		t.Errorf("Unexpected calls done %+v", rec.done)
+	}
+
+	// Call context overrides the observer one.
+	callCtx := context.WithValue(ctx, ctxKey{}, "call")
+	observe(observer, CallInfo{Operation: OpGet, Context: callCtx})(0, nil)
+	if rec.started[1].Context != callCtx || rec.done[1].Context != callCtx {
+		t.Errorf("Call context is overridden")
+	}
+}
+
+func TestStatsRecorder(t *testing.T) {
+	var r statsRecorder
+	if stats := r.snapshot(); len(stats) != 0 {
+		t.Errorf("Unexpected initial stats %v", stats)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%5 == 0 {
+				err = ErrNotFound
+			}
+			observe(&r, CallInfo{Operation: OpGet})(0, err)
+			r.record(CallInfo{Operation: OpEnumerate, Objects: i, Duration: time.Second})
+		}(i)
+	}
+	wg.Wait()
+
+	stats := r.snapshot()
+	if stats[OpGet].Calls != 10 || stats[OpGet].Errors != 2 {
+		t.Errorf("Unexpected Get stats %+v", stats[OpGet])
+	}
+	if stats[OpEnumerate] != (OperationStats{Calls: 10, Objects: 45, Duration: 10 * time.Second}) {
+		t.Errorf("Unexpected Enumerate stats %+v", stats[OpEnumerate])
+	}
+
+	// Snapshot is a copy.
+	stats[OpGet] = OperationStats{}
+	if r.snapshot()[OpGet].Calls != 10 {
+		t.Errorf("Stats changed with the snapshot")
+	}
+}
+
+func TestConnectTarget(t *testing.T) {
+	tests := []struct {
+		args      []interface{}
+		host      string
+		namespace string
+	}{
+		{nil, ".", `root\cimv2`},
+		{[]interface{}{"server"}, "server", `root\cimv2`},
+		{[]interface{}{nil, `root\default`, "user"}, ".", `root\default`},
+	}
+	for _, test := range tests {
+		host, namespace := connectTarget(test.args)
+		if host != test.host || namespace != test.namespace {
+			t.Errorf("Unexpected target of %v; %q %q", test.args, host, namespace)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package wmi
+
+import (
+	"fmt"
+)
+
+const (
+	wbemQueryFlagPrototype       = 0x2
+	wbemFlagReturnImmediately    = 0x10
+	wbemFlagForwardOnly          = 0x20
+	wbemFlagDirectRead           = 0x200
+	wbemFlagUseAmendedQualifiers = 0x20000
+)
+
+// Well known context values names.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/requesting-wmi-data-on-a-64-bit-platform
+const (
+	ContextProviderArchitecture = "__ProviderArchitecture"
+	ContextRequiredArchitecture = "__RequiredArchitecture"
+)
+
+// NamedValue is a named context value passed to the WMI provider
+// (SWbemNamedValue). Supported value types are bool, string, []string and
+// numbers, `int` is passed as 32 bit integer.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemnamedvalueset
+type NamedValue struct {
+	Name  string
+	Value interface{}
+}
+
+// ProviderArchitecture returns the context values requesting the provider of
+// the @bits (32 or 64) architecture, e.g. to access 64 bit registry from the
+// 32 bit process.
+func ProviderArchitecture(bits int) []NamedValue {
+	return []NamedValue{
+		{Name: ContextProviderArchitecture, Value: bits},
+		{Name: ContextRequiredArchitecture, Value: true},
+	}
+}
+
+// QueryOptions are optional parameters of `ExecQuery`, `Get` and `ExecMethod`
+// calls. A nil *QueryOptions means the defaults.
+type QueryOptions struct {
+	// UseAmendedQualifiers requests amended (localized) qualifiers
+	// (wbemFlagUseAmendedQualifiers).
+	UseAmendedQualifiers bool
+
+	// DirectRead requests direct access to the provider of the class
+	// specified not regarding its parent or subclasses (wbemFlagDirectRead).
+	// Not used by `ExecMethod`.
+	DirectRead bool
+
+	// Prototype requests the prototype of the result set instead of the
+	// result itself (wbemQueryFlagPrototype). Used by `ExecQuery` only.
+	Prototype bool
+
+	// QueryLanguage is the query language, "WQL" if empty. Used by `ExecQuery`
+	// only.
+	QueryLanguage string
+
+	// Context is the context values passed to the provider (e.g. see
+	// `ProviderArchitecture`).
+	Context []NamedValue
+}
+
+// queryFlags returns the ExecQuery flags, @base flags are always set.
+func (o *QueryOptions) queryFlags(base int) int {
+	flags := o.getFlags(base)
+	if o != nil && o.Prototype {
+		flags |= wbemQueryFlagPrototype
+	}
+	return flags
+}
+
+// getFlags returns the Get flags, @base flags are always set.
+func (o *QueryOptions) getFlags(base int) int {
+	flags := o.methodFlags(base)
+	if o != nil && o.DirectRead {
+		flags |= wbemFlagDirectRead
+	}
+	return flags
+}
+
+// methodFlags returns the ExecMethod flags, @base flags are always set.
+func (o *QueryOptions) methodFlags(base int) int {
+	flags := base
+	if o != nil && o.UseAmendedQualifiers {
+		flags |= wbemFlagUseAmendedQualifiers
+	}
+	return flags
+}
+
+func (o *QueryOptions) queryLanguage() string {
+	if o == nil || o.QueryLanguage == "" {
+		return "WQL"
+	}
+	return o.QueryLanguage
+}
+
+// validate checks that the context values are supported.
+func (o *QueryOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	for _, v := range o.Context {
+		if v.Name == "" {
+			return fmt.Errorf("wmi: empty context value name")
+		}
+		switch v.Value.(type) {
+		case bool, string, []string,
+			int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64,
+			float32, float64:
+		default:
+			return fmt.Errorf("wmi: unsupported type %T of context value %q", v.Value, v.Name)
+		}
+	}
+	return nil
+}
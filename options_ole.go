@@ -0,0 +1,62 @@
+// +build windows
+
+package wmi
+
+import (
+	"github.com/bi-zone/go-ole"
+	"github.com/bi-zone/go-ole/oleutil"
+	"github.com/hashicorp/go-multierror"
+)
+
+// contextParams returns @params followed by the SWbemNamedValueSet of the
+// options context values (if any). @release should be called after the call
+// is done.
+func contextParams(opts *QueryOptions, params ...interface{}) (res []interface{}, release func(), err error) {
+	release = func() {}
+	if err := opts.validate(); err != nil {
+		return nil, release, err
+	}
+	if opts == nil || len(opts.Context) == 0 {
+		return params, release, nil
+	}
+
+	set, err := newNamedValueSet(opts.Context)
+	if err != nil {
+		return nil, release, err
+	}
+	return append(params, set), func() { set.Release() }, nil
+}
+
+// newNamedValueSet creates SWbemNamedValueSet holding @values.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemnamedvalueset
+func newNamedValueSet(values []NamedValue) (set *ole.IDispatch, err error) {
+	setIUnknown, err := oleutil.CreateObject("WbemScripting.SWbemNamedValueSet")
+	if err != nil {
+		return nil, newWbemError("CreateObject SWbemNamedValueSet", err)
+	} else if setIUnknown == nil {
+		return nil, ErrNilCreateObject
+	}
+	defer setIUnknown.Release()
+
+	set, err = setIUnknown.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return nil, newWbemError("SWbemNamedValueSet QueryInterface", err)
+	}
+	defer func() {
+		if err != nil {
+			set.Release()
+		}
+	}()
+
+	for _, v := range values {
+		valueRaw, err := oleutil.CallMethod(set, "Add", v.Name, v.Value)
+		if err != nil {
+			return nil, newWbemError("SWbemNamedValueSet Add", err)
+		}
+		if clErr := valueRaw.Clear(); clErr != nil {
+			return nil, multierror.Append(err, clErr)
+		}
+	}
+	return set, nil
+}
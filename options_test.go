@@ -0,0 +1,63 @@
+package wmi
+
+import (
+	"testing"
+)
+
+func TestQueryOptions_Flags(t *testing.T) {
+	var nilOpts *QueryOptions
+	if nilOpts.queryFlags(wbemFlagReturnImmediately) != wbemFlagReturnImmediately ||
+		nilOpts.getFlags(0) != 0 || nilOpts.methodFlags(0) != 0 || nilOpts.queryLanguage() != "WQL" {
+		t.Errorf("Unexpected defaults of nil options")
+	}
+
+	opts := &QueryOptions{
+		UseAmendedQualifiers: true,
+		DirectRead:           true,
+		Prototype:            true,
+		QueryLanguage:        "WQL2",
+	}
+	if flags := opts.queryFlags(wbemFlagReturnImmediately); flags != 0x20212 {
+		t.Errorf("Unexpected query flags 0x%X", flags)
+	}
+	if flags := opts.getFlags(0); flags != 0x20200 {
+		t.Errorf("Unexpected get flags 0x%X", flags)
+	}
+	if flags := opts.methodFlags(0); flags != 0x20000 {
+		t.Errorf("Unexpected method flags 0x%X", flags)
+	}
+	if opts.queryLanguage() != "WQL2" {
+		t.Errorf("Unexpected query language %q", opts.queryLanguage())
+	}
+}
+
+func TestQueryOptions_Validate(t *testing.T) {
+	var nilOpts *QueryOptions
+	if err := nilOpts.validate(); err != nil {
+		t.Errorf("Nil options are invalid; %s", err)
+	}
+
+	opts := &QueryOptions{Context: append(ProviderArchitecture(64),
+		NamedValue{Name: "Str", Value: "value"},
+		NamedValue{Name: "Strs", Value: []string{"a", "b"}},
+		NamedValue{Name: "Float", Value: 1.5},
+	)}
+	if err := opts.validate(); err != nil {
+		t.Errorf("Valid context is invalid; %s", err)
+	}
+	if opts.Context[0] != (NamedValue{Name: "__ProviderArchitecture", Value: 64}) {
+		t.Errorf("Unexpected architecture value %+v", opts.Context[0])
+	}
+
+	for _, v := range []NamedValue{
+		{Name: "", Value: 1},
+		{Name: "Struct", Value: struct{}{}},
+		{Name: "Nil", Value: nil},
+		{Name: "Ints", Value: []int{1}},
+	} {
+		opts := &QueryOptions{Context: []NamedValue{v}}
+		if err := opts.validate(); err == nil {
+			t.Errorf("Invalid value %+v is valid", v)
+		}
+	}
+}
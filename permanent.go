@@ -0,0 +1,354 @@
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SubscriptionNamespace is the namespace the permanent event subscriptions are
+// usually registered in.
+const SubscriptionNamespace = `root\subscription`
+
+// Classes of the permanent event subscription objects.
+const (
+	EventFilterClass             = "__EventFilter"
+	FilterToConsumerBindingClass = "__FilterToConsumerBinding"
+)
+
+// EventFilter is an instance of `__EventFilter` class defining the events
+// the permanent subscription is delivered.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/--eventfilter
+type EventFilter struct {
+	Name string
+
+	// Query is the event query, e.g.
+	// "SELECT * FROM __InstanceCreationEvent WITHIN 5 WHERE TargetInstance ISA 'Win32_Process'".
+	Query string
+
+	// QueryLanguage is the language of the Query, "WQL" if empty.
+	QueryLanguage string `wmi:",omitempty"`
+
+	// EventNamespace is the namespace of the events, the namespace of the
+	// filter is used if empty.
+	EventNamespace string `wmi:",omitempty"`
+
+	// CreatorSID is the binary SID of the user created the filter. It's set
+	// by WMI.
+	CreatorSID []byte `wmi:",omitempty"`
+}
+
+// Path returns the relative object path of the filter.
+func (f EventFilter) Path() string {
+	return objectPath(EventFilterClass, "Name", f.Name)
+}
+
+// EventConsumer is one of the standard event consumers: `CommandLineEventConsumer`,
+// `ActiveScriptEventConsumer`, `LogFileEventConsumer`, `NTEventLogEventConsumer`
+// or `SMTPEventConsumer`.
+type EventConsumer interface {
+	// ConsumerClass returns the consumer WMI class name.
+	ConsumerClass() string
+	// ConsumerName returns the consumer name which is its key.
+	ConsumerName() string
+}
+
+// EventConsumerPath returns the relative object path of the consumer @c.
+func EventConsumerPath(c EventConsumer) string {
+	return objectPath(c.ConsumerClass(), "Name", c.ConsumerName())
+}
+
+// CommandLineEventConsumer starts a process when an event is delivered.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/commandlineeventconsumer
+type CommandLineEventConsumer struct {
+	Name                string
+	CommandLineTemplate string `wmi:",omitempty"`
+	ExecutablePath      string `wmi:",omitempty"`
+	WorkingDirectory    string `wmi:",omitempty"`
+	RunInteractively    bool
+	KillTimeout         uint32
+	CreatorSID          []byte `wmi:",omitempty"`
+}
+
+// ActiveScriptEventConsumer runs a script when an event is delivered.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/activescripteventconsumer
+type ActiveScriptEventConsumer struct {
+	Name            string
+	ScriptingEngine string
+	ScriptText      string `wmi:",omitempty"`
+	ScriptFileName  string `wmi:",omitempty"`
+	KillTimeout     uint32
+	CreatorSID      []byte `wmi:",omitempty"`
+}
+
+// LogFileEventConsumer writes a line to the text file when an event is
+// delivered.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/logfileeventconsumer
+type LogFileEventConsumer struct {
+	Name            string
+	Filename        string
+	Text            string
+	MaximumFileSize uint64 `wmi:",omitempty"`
+	IsUnicode       bool
+	CreatorSID      []byte `wmi:",omitempty"`
+}
+
+// NTEventLogEventConsumer writes a message to the Windows event log when an
+// event is delivered.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/nteventlogeventconsumer
+type NTEventLogEventConsumer struct {
+	Name                     string
+	SourceName               string
+	EventID                  uint32
+	EventType                uint32
+	Category                 uint16
+	UNCServerName            string   `wmi:",omitempty"`
+	NumberOfInsertionStrings uint32   `wmi:",omitempty"`
+	InsertionStringTemplates []string `wmi:",omitempty"`
+	CreatorSID               []byte   `wmi:",omitempty"`
+}
+
+// SMTPEventConsumer sends an email message when an event is delivered.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/smtpeventconsumer
+type SMTPEventConsumer struct {
+	Name         string
+	SMTPServer   string
+	ToLine       string
+	CcLine       string   `wmi:",omitempty"`
+	BccLine      string   `wmi:",omitempty"`
+	FromLine     string   `wmi:",omitempty"`
+	ReplyToLine  string   `wmi:",omitempty"`
+	Subject      string   `wmi:",omitempty"`
+	Message      string   `wmi:",omitempty"`
+	HeaderFields []string `wmi:",omitempty"`
+	CreatorSID   []byte   `wmi:",omitempty"`
+}
+
+// ConsumerClass returns "CommandLineEventConsumer".
+func (CommandLineEventConsumer) ConsumerClass() string { return "CommandLineEventConsumer" }
+
+// ConsumerName returns the consumer name.
+func (c CommandLineEventConsumer) ConsumerName() string { return c.Name }
+
+// ConsumerClass returns "ActiveScriptEventConsumer".
+func (ActiveScriptEventConsumer) ConsumerClass() string { return "ActiveScriptEventConsumer" }
+
+// ConsumerName returns the consumer name.
+func (c ActiveScriptEventConsumer) ConsumerName() string { return c.Name }
+
+// ConsumerClass returns "LogFileEventConsumer".
+func (LogFileEventConsumer) ConsumerClass() string { return "LogFileEventConsumer" }
+
+// ConsumerName returns the consumer name.
+func (c LogFileEventConsumer) ConsumerName() string { return c.Name }
+
+// ConsumerClass returns "NTEventLogEventConsumer".
+func (NTEventLogEventConsumer) ConsumerClass() string { return "NTEventLogEventConsumer" }
+
+// ConsumerName returns the consumer name.
+func (c NTEventLogEventConsumer) ConsumerName() string { return c.Name }
+
+// ConsumerClass returns "SMTPEventConsumer".
+func (SMTPEventConsumer) ConsumerClass() string { return "SMTPEventConsumer" }
+
+// ConsumerName returns the consumer name.
+func (c SMTPEventConsumer) ConsumerName() string { return c.Name }
+
+// FilterToConsumerBinding is an instance of `__FilterToConsumerBinding` class
+// binding the filter to the consumer the filtered events are delivered to.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/--filtertoconsumerbinding
+type FilterToConsumerBinding struct {
+	// Filter is the object path of the `__EventFilter`.
+	Filter string
+	// Consumer is the object path of the consumer.
+	Consumer string
+
+	DeliverSynchronously    bool
+	MaintainSecurityContext bool
+	SlowDownProviders       bool
+	CreatorSID              []byte `wmi:",omitempty"`
+}
+
+// Path returns the relative object path of the binding.
+func (b FilterToConsumerBinding) Path() string {
+	return objectPath(FilterToConsumerBindingClass, "Consumer", b.Consumer, "Filter", b.Filter)
+}
+
+// PermanentSubscription is a binding joined with its filter and consumer.
+// Filter and Consumer are nil if the binding refers to the missing object
+// (or to the consumer of not a standard class).
+type PermanentSubscription struct {
+	Binding  FilterToConsumerBinding
+	Filter   *EventFilter
+	Consumer EventConsumer
+}
+
+// ResolvePermanentSubscriptions joins every binding of @bindings with its
+// filter and consumer from @filters and @consumers. Object paths are compared
+// the way WMI does: ignoring the server and namespace, the key order and the
+// case.
+func ResolvePermanentSubscriptions(
+	filters []EventFilter,
+	consumers []EventConsumer,
+	bindings []FilterToConsumerBinding,
+) []PermanentSubscription {
+	filterByPath := make(map[string]*EventFilter, len(filters))
+	for i := range filters {
+		filterByPath[mustObjectPathKey(filters[i].Path())] = &filters[i]
+	}
+	consumerByPath := make(map[string]EventConsumer, len(consumers))
+	for _, c := range consumers {
+		consumerByPath[mustObjectPathKey(EventConsumerPath(c))] = c
+	}
+
+	res := make([]PermanentSubscription, 0, len(bindings))
+	for _, b := range bindings {
+		sub := PermanentSubscription{Binding: b}
+		if key, err := objectPathKey(b.Filter); err == nil {
+			sub.Filter = filterByPath[key]
+		}
+		if key, err := objectPathKey(b.Consumer); err == nil {
+			sub.Consumer = consumerByPath[key]
+		}
+		res = append(res, sub)
+	}
+	return res
+}
+
+// objectPath returns the relative object path of the @class instance with
+// the @keyValues pairs of the key names and string values.
+func objectPath(class string, keyValues ...string) string {
+	var b strings.Builder
+	b.WriteString(class)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		if i == 0 {
+			b.WriteByte('.')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(keyValues[i])
+		b.WriteString(`="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(keyValues[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// ObjectPathClass returns the class of the WMI object @path, e.g.
+// "Win32_Process" for `\\.\root\cimv2:Win32_Process.Handle="4"`. Returns an
+// empty string if the path doesn't start with a valid class name.
+func ObjectPathClass(path string) string {
+	class, _ := splitObjectPath(path)
+	class = strings.TrimSpace(class)
+	if !isIdentifier(class) {
+		return ""
+	}
+	return class
+}
+
+// splitObjectPath splits the object @path into the class and the rest of it
+// starting from the "." or "=" key separator. The server and namespace are
+// dropped.
+func splitObjectPath(path string) (class, rest string) {
+	// Drop the server and namespace not looking into the key values.
+	if i := strings.IndexAny(path, `:"'`); i >= 0 && path[i] == ':' {
+		path = path[i+1:]
+	}
+	if i := strings.IndexAny(path, ".="); i >= 0 {
+		return path[:i], path[i:]
+	}
+	return path, ""
+}
+
+// isIdentifier reports whether @s is a valid class or property name.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// objectPathKey returns the normalized object @path to compare the paths: the
+// server and namespace are dropped, the keys are sorted, the quoted values are
+// unescaped and everything is lower cased.
+func objectPathKey(path string) (string, error) {
+	class, rest := splitObjectPath(path)
+	path = class + rest
+	if rest == "" {
+		return strings.ToLower(path), nil // Class path.
+	}
+	if rest == "=@" {
+		return strings.ToLower(path), nil // Singleton.
+	}
+	if class == "" || rest[0] != '.' {
+		return "", fmt.Errorf("wmi: invalid object path %q", path)
+	}
+
+	var keys []string
+	rest = rest[1:]
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return "", fmt.Errorf("wmi: invalid object path %q; no key value", path)
+		}
+		name := rest[:eq]
+		value, tail, err := objectPathValue(rest[eq+1:])
+		if err != nil {
+			return "", fmt.Errorf("wmi: invalid object path %q; %w", path, err)
+		}
+		keys = append(keys, strings.ToLower(strings.TrimSpace(name))+"="+strings.ToLower(value))
+		if tail != "" && tail[0] != ',' {
+			return "", fmt.Errorf("wmi: invalid object path %q; unexpected %q", path, tail)
+		}
+		rest = strings.TrimPrefix(tail, ",")
+	}
+	sort.Strings(keys)
+	return strings.ToLower(class) + "." + strings.Join(keys, ","), nil
+}
+
+// objectPathValue returns the key value at the start of the @s and the rest
+// of it. Quoted values are unescaped.
+func objectPathValue(s string) (value, tail string, err error) {
+	if !strings.HasPrefix(s, `"`) {
+		if i := strings.IndexByte(s, ','); i >= 0 {
+			return s[:i], s[i:], nil
+		}
+		return s, "", nil
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case c == '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated quoted value")
+}
+
+// mustObjectPathKey is objectPathKey of the @path built by objectPath.
+func mustObjectPathKey(path string) string {
+	key, err := objectPathKey(path)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
@@ -0,0 +1,176 @@
+// +build windows
+
+package wmi
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// N.B. Permanent subscription calls work with the namespace of the connection,
+// so it should be usually connected to `SubscriptionNamespace`.
+
+// EventFilters returns all the `__EventFilter` instances.
+func (s *SWbemServicesConnection) EventFilters() ([]EventFilter, error) {
+	var filters []EventFilter
+	if err := s.InstancesOf(EventFilterClass, &filters, false); err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
+
+// EventConsumers returns all the instances of the standard consumer classes.
+// Classes not registered in the namespace are skipped.
+func (s *SWbemServicesConnection) EventConsumers() ([]EventConsumer, error) {
+	var (
+		commandLine  []CommandLineEventConsumer
+		activeScript []ActiveScriptEventConsumer
+		logFile      []LogFileEventConsumer
+		ntEventLog   []NTEventLogEventConsumer
+		smtp         []SMTPEventConsumer
+	)
+	lists := []struct {
+		class string
+		dst   interface{}
+	}{
+		{CommandLineEventConsumer{}.ConsumerClass(), &commandLine},
+		{ActiveScriptEventConsumer{}.ConsumerClass(), &activeScript},
+		{LogFileEventConsumer{}.ConsumerClass(), &logFile},
+		{NTEventLogEventConsumer{}.ConsumerClass(), &ntEventLog},
+		{SMTPEventConsumer{}.ConsumerClass(), &smtp},
+	}
+	for _, list := range lists {
+		err := s.InstancesOf(list.class, list.dst, true)
+		if err != nil && !errors.Is(err, ErrInvalidClass) {
+			return nil, fmt.Errorf("wmi: failed to list %s; %w", list.class, err)
+		}
+	}
+
+	var consumers []EventConsumer
+	for i := range commandLine {
+		consumers = append(consumers, &commandLine[i])
+	}
+	for i := range activeScript {
+		consumers = append(consumers, &activeScript[i])
+	}
+	for i := range logFile {
+		consumers = append(consumers, &logFile[i])
+	}
+	for i := range ntEventLog {
+		consumers = append(consumers, &ntEventLog[i])
+	}
+	for i := range smtp {
+		consumers = append(consumers, &smtp[i])
+	}
+	return consumers, nil
+}
+
+// FilterToConsumerBindings returns all the `__FilterToConsumerBinding`
+// instances.
+func (s *SWbemServicesConnection) FilterToConsumerBindings() ([]FilterToConsumerBinding, error) {
+	var bindings []FilterToConsumerBinding
+	if err := s.InstancesOf(FilterToConsumerBindingClass, &bindings, false); err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+// PermanentSubscriptions returns all the bindings joined with their filters and
+// consumers (see `ResolvePermanentSubscriptions`).
+func (s *SWbemServicesConnection) PermanentSubscriptions() ([]PermanentSubscription, error) {
+	filters, err := s.EventFilters()
+	if err != nil {
+		return nil, err
+	}
+	consumers, err := s.EventConsumers()
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := s.FilterToConsumerBindings()
+	if err != nil {
+		return nil, err
+	}
+	return ResolvePermanentSubscriptions(filters, consumers, bindings), nil
+}
+
+// CreateEventFilter creates the event filter @f and returns its object path.
+// `ErrAlreadyExists` is returned if the filter of the same name exists.
+func (s *SWbemServicesConnection) CreateEventFilter(f EventFilter) (string, error) {
+	if f.QueryLanguage == "" {
+		f.QueryLanguage = "WQL"
+	}
+	return s.PutInstanceOf(EventFilterClass, f, PutCreateOnly)
+}
+
+// CreateEventConsumer creates the event consumer @c and returns its object
+// path. `ErrAlreadyExists` is returned if the consumer of the same class and
+// name exists.
+func (s *SWbemServicesConnection) CreateEventConsumer(c EventConsumer) (string, error) {
+	return s.PutInstanceOf(c.ConsumerClass(), c, PutCreateOnly)
+}
+
+// CreateFilterToConsumerBinding creates the binding @b and returns its object
+// path.
+func (s *SWbemServicesConnection) CreateFilterToConsumerBinding(b FilterToConsumerBinding) (string, error) {
+	return s.PutInstanceOf(FilterToConsumerBindingClass, b, PutCreateOnly)
+}
+
+// CreatePermanentSubscription creates the filter @f, the consumer @c and the
+// binding between them. Objects already created are deleted if the rest of
+// them fail to be created.
+func (s *SWbemServicesConnection) CreatePermanentSubscription(
+	f EventFilter,
+	c EventConsumer,
+) (sub PermanentSubscription, err error) {
+	var created []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(created) - 1; i >= 0; i-- {
+			if delErr := s.Delete(created[i]); delErr != nil {
+				err = multierror.Append(err, delErr)
+			}
+		}
+	}()
+
+	filterPath, err := s.CreateEventFilter(f)
+	if err != nil {
+		return sub, fmt.Errorf("wmi: failed to create filter; %w", err)
+	}
+	created = append(created, filterPath)
+	consumerPath, err := s.CreateEventConsumer(c)
+	if err != nil {
+		return sub, fmt.Errorf("wmi: failed to create consumer; %w", err)
+	}
+	created = append(created, consumerPath)
+	binding := FilterToConsumerBinding{Filter: f.Path(), Consumer: EventConsumerPath(c)}
+	if _, err := s.CreateFilterToConsumerBinding(binding); err != nil {
+		return sub, fmt.Errorf("wmi: failed to create binding; %w", err)
+	}
+	return PermanentSubscription{Binding: binding, Filter: &f, Consumer: c}, nil
+}
+
+// DeletePermanentSubscription deletes the binding of the @sub along with its
+// filter and consumer (if they are resolved). Use `Delete` with the
+// `FilterToConsumerBinding.Path` to delete the binding only, e.g. if the
+// filter or consumer is shared with other bindings.
+func (s *SWbemServicesConnection) DeletePermanentSubscription(sub PermanentSubscription) error {
+	if err := s.Delete(sub.Binding.Path()); err != nil {
+		return fmt.Errorf("wmi: failed to delete binding; %w", err)
+	}
+	var result error
+	if sub.Filter != nil {
+		if err := s.Delete(sub.Filter.Path()); err != nil {
+			result = multierror.Append(result, fmt.Errorf("wmi: failed to delete filter; %w", err))
+		}
+	}
+	if sub.Consumer != nil {
+		if err := s.Delete(EventConsumerPath(sub.Consumer)); err != nil {
+			result = multierror.Append(result, fmt.Errorf("wmi: failed to delete consumer; %w", err))
+		}
+	}
+	return result
+}
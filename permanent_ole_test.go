@@ -0,0 +1,74 @@
+// +build windows
+
+package wmi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPermanentSubscription(t *testing.T) {
+	s, err := ConnectSWbemServices(".", SubscriptionNamespace)
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	filter := EventFilter{
+		Name:  "wmi_test_filter",
+		Query: "SELECT * FROM __InstanceModificationEvent WITHIN 60 WHERE TargetInstance ISA 'Win32_LocalTime'",
+		// Events are delivered from the other namespace.
+		EventNamespace: `root\cimv2`,
+	}
+	consumer := &LogFileEventConsumer{
+		Name:     "wmi_test_consumer",
+		Filename: filepath.Join(os.TempDir(), "wmi_test_consumer.log"),
+		Text:     "%TargetInstance.Second%",
+	}
+	created, err := s.CreatePermanentSubscription(filter, consumer)
+	if errors.Is(err, ErrAccessDenied) {
+		t.Skip("Permanent subscriptions require administrator rights")
+	}
+	if err != nil {
+		t.Fatalf("CreatePermanentSubscription: %s", err)
+	}
+
+	if _, err := s.CreateEventFilter(filter); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Unexpected error of the existing filter creation %v", err)
+	}
+
+	subs, err := s.PermanentSubscriptions()
+	if err != nil {
+		t.Fatalf("PermanentSubscriptions: %s", err)
+	}
+	var found *PermanentSubscription
+	for i := range subs {
+		if subs[i].Filter != nil && subs[i].Filter.Name == filter.Name {
+			found = &subs[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("Created subscription isn't found")
+	}
+	if found.Filter.QueryLanguage != "WQL" || len(found.Filter.CreatorSID) == 0 {
+		t.Errorf("Unexpected filter %+v", found.Filter)
+	}
+	if c, ok := found.Consumer.(*LogFileEventConsumer); !ok || c.Filename != consumer.Filename {
+		t.Errorf("Unexpected consumer %+v", found.Consumer)
+	}
+
+	if err := s.DeletePermanentSubscription(created); err != nil {
+		t.Fatalf("DeletePermanentSubscription: %s", err)
+	}
+	bindings, err := s.FilterToConsumerBindings()
+	if err != nil {
+		t.Fatalf("FilterToConsumerBindings: %s", err)
+	}
+	for _, b := range ResolvePermanentSubscriptions([]EventFilter{filter}, nil, bindings) {
+		if b.Filter != nil {
+			t.Errorf("Binding %s isn't deleted", b.Binding.Path())
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package wmi
+
+import (
+	"testing"
+)
+
+func TestEventObjectPaths(t *testing.T) {
+	f := EventFilter{Name: `a "quoted" \ name`}
+	if p := f.Path(); p != `__EventFilter.Name="a \"quoted\" \\ name"` {
+		t.Errorf("Unexpected filter path %s", p)
+	}
+	c := &CommandLineEventConsumer{Name: "cmd"}
+	if p := EventConsumerPath(c); p != `CommandLineEventConsumer.Name="cmd"` {
+		t.Errorf("Unexpected consumer path %s", p)
+	}
+	b := FilterToConsumerBinding{Filter: f.Path(), Consumer: EventConsumerPath(c)}
+	expected := `__FilterToConsumerBinding.Consumer="CommandLineEventConsumer.Name=\"cmd\"",` +
+		`Filter="__EventFilter.Name=\"a \\\"quoted\\\" \\\\ name\""`
+	if p := b.Path(); p != expected {
+		t.Errorf("Unexpected binding path %s; expected %s", p, expected)
+	}
+}
+
+func TestObjectPathClass(t *testing.T) {
+	tests := []struct {
+		path  string
+		class string
+	}{
+		{"Win32_Process", "Win32_Process"},
+		{`Win32_Process.Handle="4"`, "Win32_Process"},
+		{`Win32_Process.Handle="4".Terminate`, "Win32_Process"},
+		{"Win32_Process.Create", "Win32_Process"},
+		{"Win32_OperatingSystem=@", "Win32_OperatingSystem"},
+		{`\\host.domain\root\cimv2:Win32_Directory.Name="c:\\windows"`, "Win32_Directory"},
+		{`Win32_Directory.Name="c:\\windows"`, "Win32_Directory"},
+		{`root\subscription:__EventFilter.Name='a:b'`, "__EventFilter"},
+		{`"broken`, ""},
+	}
+	for _, test := range tests {
+		if class := ObjectPathClass(test.path); class != test.class {
+			t.Errorf("Unexpected class of %q; got %q, want %q", test.path, class, test.class)
+		}
+	}
+}
+
+func TestObjectPathKey(t *testing.T) {
+	tests := []struct {
+		path string
+		key  string
+	}{
+		{`__EventFilter.Name="Test"`, `__eventfilter.name=test`},
+		{`\\HOST.corp\ROOT\subscription:__EventFilter.Name="Test"`, `__eventfilter.name=test`},
+		{`__EventFilter.Name="a:b,c=\"d\""`, `__eventfilter.name=a:b,c="d"`},
+		{`Win32_Process.Handle=4`, `win32_process.handle=4`},
+		{`B.Y="2",X=1`, `b.x=1,y=2`},
+		{`Win32_OperatingSystem=@`, `win32_operatingsystem=@`},
+		{`root\cimv2:Win32_Process`, `win32_process`},
+	}
+	for _, test := range tests {
+		key, err := objectPathKey(test.path)
+		if err != nil || key != test.key {
+			t.Errorf("Unexpected key of %s: %q; %v; expected %q", test.path, key, err, test.key)
+		}
+	}
+
+	for _, path := range []string{`A.Name="unterminated`, `A.Name`, `A.Name="a"b`, `.Name="a"`} {
+		if _, err := objectPathKey(path); err == nil {
+			t.Errorf("Invalid path %s is accepted", path)
+		}
+	}
+}
+
+func TestResolvePermanentSubscriptions(t *testing.T) {
+	filters := []EventFilter{{Name: "Filter"}, {Name: "Other"}}
+	consumers := []EventConsumer{
+		&CommandLineEventConsumer{Name: "Consumer"},
+		&LogFileEventConsumer{Name: "Consumer"},
+	}
+	bindings := []FilterToConsumerBinding{
+		{
+			Filter:   `\\HOST\ROOT\subscription:__EventFilter.Name="filter"`,
+			Consumer: `\\HOST\ROOT\subscription:LogFileEventConsumer.Name="Consumer"`,
+		},
+		{Filter: `__EventFilter.Name="Missing"`, Consumer: `CommandLineEventConsumer.Name="Consumer"`},
+		{Filter: `__EventFilter.Name="Other"`, Consumer: `Custom_Consumer.Name="Consumer"`},
+	}
+
+	subs := ResolvePermanentSubscriptions(filters, consumers, bindings)
+	if len(subs) != len(bindings) {
+		t.Fatalf("Unexpected subscriptions %+v", subs)
+	}
+	if subs[0].Filter != &filters[0] || subs[0].Consumer != consumers[1] {
+		t.Errorf("Unexpected subscription %+v", subs[0])
+	}
+	if subs[1].Filter != nil || subs[1].Consumer != consumers[0] {
+		t.Errorf("Unexpected subscription %+v", subs[1])
+	}
+	if subs[2].Filter != &filters[1] || subs[2].Consumer != nil {
+		t.Errorf("Unexpected subscription %+v", subs[2])
+	}
+}
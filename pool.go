@@ -0,0 +1,317 @@
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// DefaultMaxIdle is the maximum number of idle connections kept per
+// `PoolKey` if `Pool.MaxIdle` is zero.
+const DefaultMaxIdle = 2
+
+// ErrPoolClosed is returned by the closed `Pool`.
+var ErrPoolClosed = errors.New("wmi: connection pool has been closed")
+
+// PoolKey identifies the pooled connections. Connections are reused only for
+// the same server, namespace and credentials.
+//
+// Fields correspond to the `SWbemLocator.ConnectServer` arguments, empty
+// values mean the defaults (e.g. the local server).
+type PoolKey struct {
+	Server    string
+	Namespace string
+	User      string
+	Password  string
+	Locale    string
+	Authority string
+}
+
+// NewPoolKey returns the pool key for `SWbemLocator.ConnectServer` args
+// (the same ones `Query` accepts). Only string (or nil) args up to strAuthority
+// are supported.
+func NewPoolKey(connectServerArgs ...interface{}) (PoolKey, error) {
+	var key PoolKey
+	fields := []*string{&key.Server, &key.Namespace, &key.User, &key.Password, &key.Locale, &key.Authority}
+	if len(connectServerArgs) > len(fields) {
+		return key, fmt.Errorf("wmi: %d connect args are not supported by the pool", len(connectServerArgs))
+	}
+	for i, arg := range connectServerArgs {
+		switch arg := arg.(type) {
+		case nil:
+		case string:
+			*fields[i] = arg
+		default:
+			return key, fmt.Errorf("wmi: connect arg %d of type %T is not supported by the pool", i, arg)
+		}
+	}
+	return key, nil
+}
+
+// connectServerArgs returns the key as `SWbemLocator.ConnectServer` args.
+func (k PoolKey) connectServerArgs() []interface{} {
+	args := []interface{}{k.Server, k.Namespace, k.User, k.Password, k.Locale, k.Authority}
+	for len(args) > 0 && args[len(args)-1] == "" {
+		args = args[:len(args)-1]
+	}
+	return args
+}
+
+// PoolStats is a snapshot of the pool state.
+type PoolStats struct {
+	Open    int // Number of open connections (both in use and idle).
+	Idle    int // Number of idle connections.
+	Evicted int // Total number of connections evicted because of the lost connection, failed probe or panic.
+}
+
+// Pool is a pool of SWbemServicesConnection connections to multiple servers
+// and namespaces. A connection is used by a single caller at a time. Its zero
+// value is a usable pool with default limits.
+//
+// Connections failed with disconnect errors (see `IsDisconnectError`) are
+// evicted from the pool. Idle connections are closed after `IdleTimeout` on
+// the next pool access.
+type Pool struct {
+	// MaxIdle is the maximum number of idle connections per key. If zero,
+	// `DefaultMaxIdle` is used, if negative - idle connections are not kept.
+	MaxIdle int
+	// MaxOpen is the maximum number of open connections per key. Callers
+	// are blocked until a connection is released if the limit is reached.
+	// Zero means no limit.
+	MaxOpen int
+	// IdleTimeout is the maximum time a connection may be idle. Zero means
+	// no limit.
+	IdleTimeout time.Duration
+	// ProbeAfter enables liveness probes. Connections idle for at least
+	// ProbeAfter are pinged before reuse and evicted if the ping fails.
+	ProbeAfter time.Duration
+
+	// RetryPolicy is set to the new pooled connections.
+	RetryPolicy *RetryPolicy
+	// Security is set to the new pooled connections.
+	Security SecurityOptions
+
+	// Clock is used to track idle time. If nil, the system clock is used.
+	Clock Clock
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	closed  bool
+	hosts   map[PoolKey]*poolHost
+	evicted int
+}
+
+// poolConn is a pooled connection.
+type poolConn interface {
+	Ping() error
+	Close() error
+}
+
+type poolHost struct {
+	open int
+	idle []*poolItem // The most recently used are last.
+}
+
+type poolItem struct {
+	key       PoolKey
+	conn      poolConn
+	idleSince time.Time
+}
+
+// Stats returns the pool state summed over all keys.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := PoolStats{Evicted: p.evicted}
+	for _, h := range p.hosts {
+		s.Open += h.open
+		s.Idle += len(h.idle)
+	}
+	return s
+}
+
+// CloseIdle closes all idle connections.
+func (p *Pool) CloseIdle() error {
+	p.mu.Lock()
+	var idle []*poolItem
+	for _, h := range p.hosts {
+		idle = append(idle, h.idle...)
+		h.open -= len(h.idle)
+		h.idle = nil
+	}
+	if p.cond != nil {
+		p.cond.Broadcast()
+	}
+	p.mu.Unlock()
+	return closeItems(idle)
+}
+
+// Close closes all idle connections and marks the pool closed. Connections
+// in use are closed when released.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	return p.CloseIdle()
+}
+
+// acquire returns an idle connection for the @key or creates a new one using
+// @dial. The result should be returned with `release`.
+func (p *Pool) acquire(key PoolKey, dial func(key PoolKey) (poolConn, error)) (*poolItem, error) {
+	p.mu.Lock()
+	if p.cond == nil {
+		p.cond = sync.NewCond(&p.mu)
+		p.hosts = make(map[PoolKey]*poolHost)
+	}
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		h := p.hosts[key]
+		if h == nil {
+			h = &poolHost{}
+			p.hosts[key] = h
+		}
+		now := p.now()
+		if expired := p.expireLocked(now); len(expired) > 0 {
+			p.mu.Unlock()
+			_ = closeItems(expired)
+			p.mu.Lock()
+			continue
+		}
+
+		if n := len(h.idle); n > 0 {
+			item := h.idle[n-1]
+			h.idle = h.idle[:n-1]
+			p.mu.Unlock()
+			if p.ProbeAfter <= 0 || now.Sub(item.idleSince) < p.ProbeAfter {
+				return item, nil
+			}
+			if err := item.conn.Ping(); err == nil {
+				return item, nil
+			}
+			p.evict(item)
+			p.mu.Lock()
+			continue
+		}
+
+		if p.MaxOpen <= 0 || h.open < p.MaxOpen {
+			h.open++
+			p.mu.Unlock()
+			conn, err := dial(key)
+			if err != nil {
+				p.mu.Lock()
+				h.open--
+				p.cond.Broadcast()
+				p.mu.Unlock()
+				return nil, err
+			}
+			return &poolItem{key: key, conn: conn}, nil
+		}
+		p.cond.Wait()
+	}
+}
+
+// do invokes @f with the connection for the @key acquired with @dial and
+// releases it after @f returns. The connection is evicted if @f panics.
+func (p *Pool) do(key PoolKey, dial func(key PoolKey) (poolConn, error), f func(conn poolConn) error) error {
+	item, err := p.acquire(key, dial)
+	if err != nil {
+		return err
+	}
+	returned := false
+	defer func() {
+		if returned {
+			p.release(item, err)
+		} else {
+			p.evict(item) // @f panicked, the connection state is unknown.
+		}
+	}()
+	err = f(item.conn)
+	returned = true
+	return err
+}
+
+// release returns the @item acquired before. @err is the result of the last
+// call made with the connection, the connection is evicted if it's a
+// disconnect error.
+func (p *Pool) release(item *poolItem, err error) {
+	if IsDisconnectError(err) {
+		p.evict(item)
+		return
+	}
+
+	maxIdle := p.MaxIdle
+	if maxIdle == 0 {
+		maxIdle = DefaultMaxIdle
+	}
+	p.mu.Lock()
+	h := p.hosts[item.key]
+	if p.closed || len(h.idle) >= maxIdle {
+		h.open--
+		p.cond.Broadcast()
+		p.mu.Unlock()
+		_ = item.conn.Close()
+		return
+	}
+	item.idleSince = p.now()
+	h.idle = append(h.idle, item)
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// evict closes the acquired @item connection.
+func (p *Pool) evict(item *poolItem) {
+	p.mu.Lock()
+	p.hosts[item.key].open--
+	p.evicted++
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	_ = item.conn.Close()
+}
+
+// expireLocked removes the connections idle for longer than `IdleTimeout`
+// from the pool and returns them.
+func (p *Pool) expireLocked(now time.Time) (expired []*poolItem) {
+	if p.IdleTimeout <= 0 {
+		return nil
+	}
+	for _, h := range p.hosts {
+		// The oldest connections are first.
+		n := 0
+		for n < len(h.idle) && now.Sub(h.idle[n].idleSince) >= p.IdleTimeout {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		expired = append(expired, h.idle[:n]...)
+		h.idle = append(h.idle[:0], h.idle[n:]...)
+		h.open -= n
+	}
+	if len(expired) > 0 {
+		p.cond.Broadcast()
+	}
+	return expired
+}
+
+func (p *Pool) now() time.Time {
+	if p.Clock == nil {
+		return time.Now()
+	}
+	return p.Clock.Now()
+}
+
+func closeItems(items []*poolItem) error {
+	var err error
+	for _, item := range items {
+		if clErr := item.conn.Close(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}
+	return err
+}
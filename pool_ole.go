@@ -0,0 +1,61 @@
+// +build windows
+
+package wmi
+
+// Do invokes @f with a pooled connection for the @key. The connection is
+// exclusively used by @f and is returned to the pool after @f returns. The
+// connection is evicted from the pool if @f fails with a disconnect error or
+// panics.
+//
+// @f shouldn't keep the connection or close it.
+func (p *Pool) Do(key PoolKey, f func(conn *SWbemServicesConnection) error) error {
+	return p.do(key, p.dial, func(conn poolConn) error {
+		return f(conn.(*SWbemServicesConnection))
+	})
+}
+
+// Query runs the WQL query using a pooled connection for the @key. See
+// `SWbemServicesConnection.Query` for details.
+func (p *Pool) Query(key PoolKey, query string, dst interface{}) error {
+	return p.Do(key, func(conn *SWbemServicesConnection) error {
+		return conn.Query(query, dst)
+	})
+}
+
+// Get retrieves a single object using a pooled connection for the @key. See
+// `SWbemServicesConnection.Get` for details.
+func (p *Pool) Get(key PoolKey, path string, dst interface{}) error {
+	return p.Do(key, func(conn *SWbemServicesConnection) error {
+		return conn.Get(path, dst)
+	})
+}
+
+// ExecMethod executes a method using a pooled connection for the @key. See
+// `SWbemServicesConnection.ExecMethod` for details.
+func (p *Pool) ExecMethod(key PoolKey, objectPath, method string, in, out interface{}) error {
+	return p.Do(key, func(conn *SWbemServicesConnection) error {
+		return conn.ExecMethod(objectPath, method, in, out)
+	})
+}
+
+func (p *Pool) dial(key PoolKey) (poolConn, error) {
+	conn, err := ConnectSWbemServices(key.connectServerArgs()...)
+	if err != nil {
+		return nil, err
+	}
+	conn.RetryPolicy = p.RetryPolicy
+	if err := conn.SetSecurity(p.Security); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Ping checks that the connection is alive by retrieving a system class.
+func (s *SWbemServicesConnection) Ping() error {
+	v, err := s.Dereference("__SystemClass")
+	if err != nil {
+		return err
+	}
+	return v.Clear()
+}
@@ -0,0 +1,58 @@
+// +build windows
+
+package wmi
+
+import (
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	var p Pool
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		var dst []Win32_OperatingSystem
+		if err := p.Query(PoolKey{}, CreateQuery(&dst, ""), &dst); err != nil || len(dst) != 1 {
+			t.Fatalf("Failed to query; %v", err)
+		}
+	}
+	if stats := p.Stats(); stats != (PoolStats{Open: 1, Idle: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	err := p.Do(PoolKey{}, func(conn *SWbemServicesConnection) error {
+		return conn.Ping()
+	})
+	if err != nil {
+		t.Errorf("Failed to ping; %s", err)
+	}
+
+	c := Client{Pool: &p}
+	var dst []Win32_OperatingSystem
+	if err := c.Query(CreateQuery(&dst, ""), &dst, nil, `root\cimv2`); err != nil {
+		t.Errorf("Failed to query with pooled client; %s", err)
+	}
+	if stats := p.Stats(); stats != (PoolStats{Open: 2, Idle: 2}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestClient_PoolSettingsRestored(t *testing.T) {
+	var p Pool
+	defer p.Close()
+
+	c := Client{Pool: &p, Decoder: Decoder{AllowMissingFields: true}, Observer: &recordingObserver{}}
+	var dst []Win32_OperatingSystem
+	if err := c.Query(CreateQuery(&dst, ""), &dst); err != nil {
+		t.Fatalf("Failed to query with pooled client; %s", err)
+	}
+	err := p.Do(PoolKey{}, func(conn *SWbemServicesConnection) error {
+		if conn.AllowMissingFields || conn.Observer != nil {
+			t.Errorf("Client settings are left on the pooled connection")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Do: %s", err)
+	}
+}
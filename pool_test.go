@@ -0,0 +1,259 @@
+package wmi
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakePoolConn struct {
+	id      int
+	pingErr error
+	closed  bool
+}
+
+func (c *fakePoolConn) Ping() error  { return c.pingErr }
+func (c *fakePoolConn) Close() error { c.closed = true; return nil }
+
+// fakeDialer creates fakePoolConn connections and remembers them.
+type fakeDialer struct {
+	mu    sync.Mutex
+	conns []*fakePoolConn
+	err   error
+}
+
+func (d *fakeDialer) dial(PoolKey) (poolConn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	c := &fakePoolConn{id: len(d.conns)}
+	d.conns = append(d.conns, c)
+	return c, nil
+}
+
+func (d *fakeDialer) dialed() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.conns)
+}
+
+func connID(item *poolItem) int {
+	return item.conn.(*fakePoolConn).id
+}
+
+func TestPool_Reuse(t *testing.T) {
+	var p Pool
+	d := &fakeDialer{}
+	local, remote := PoolKey{}, PoolKey{Server: "remote", User: "admin"}
+
+	a, _ := p.acquire(local, d.dial)
+	b, _ := p.acquire(local, d.dial)
+	c, _ := p.acquire(remote, d.dial)
+	if connID(a) == connID(b) || d.dialed() != 3 {
+		t.Fatalf("Connections are shared; dialed %d", d.dialed())
+	}
+	p.release(a, nil)
+	p.release(c, errors.New("query failed"))
+	if stats := p.Stats(); stats != (PoolStats{Open: 3, Idle: 2}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	if item, _ := p.acquire(local, d.dial); connID(item) != connID(a) {
+		t.Errorf("Idle connection hasn't been reused")
+	}
+	if item, _ := p.acquire(remote, d.dial); connID(item) != connID(c) {
+		t.Errorf("Idle connection of other key hasn't been reused")
+	}
+	if d.dialed() != 3 {
+		t.Errorf("Unexpected dial")
+	}
+	p.release(b, nil)
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Failed to close the pool; %s", err)
+	}
+	if !d.conns[connID(b)].closed {
+		t.Errorf("Idle connection hasn't been closed")
+	}
+	if _, err := p.acquire(local, d.dial); err != ErrPoolClosed {
+		t.Errorf("Unexpected error of closed pool; %v", err)
+	}
+}
+
+func TestPool_MaxIdle(t *testing.T) {
+	p := Pool{MaxIdle: 1}
+	d := &fakeDialer{}
+	a, _ := p.acquire(PoolKey{}, d.dial)
+	b, _ := p.acquire(PoolKey{}, d.dial)
+	p.release(a, nil)
+	p.release(b, nil)
+	if !d.conns[connID(b)].closed || d.conns[connID(a)].closed {
+		t.Errorf("Unexpected connections closed")
+	}
+	if stats := p.Stats(); stats != (PoolStats{Open: 1, Idle: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestPool_MaxOpen(t *testing.T) {
+	p := Pool{MaxOpen: 2}
+	d := &fakeDialer{}
+	a, _ := p.acquire(PoolKey{}, d.dial)
+	b, _ := p.acquire(PoolKey{}, d.dial)
+
+	acquired := make(chan *poolItem)
+	go func() {
+		item, _ := p.acquire(PoolKey{}, d.dial)
+		acquired <- item
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("Acquired connection above the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.release(b, nil)
+	if item := <-acquired; connID(item) != connID(b) {
+		t.Errorf("Released connection hasn't been reused")
+	}
+	// Other keys are not limited by the key.
+	if _, err := p.acquire(PoolKey{Namespace: `root\default`}, d.dial); err != nil {
+		t.Errorf("Failed to acquire connection of other key; %s", err)
+	}
+	p.release(a, nil)
+}
+
+func TestPool_Eviction(t *testing.T) {
+	p := Pool{MaxOpen: 1}
+	d := &fakeDialer{}
+	a, _ := p.acquire(PoolKey{}, d.dial)
+	p.release(a, &WbemError{HResult: ErrRPCDisconnected.HResult, Operation: "SWbemServices ExecQuery"})
+	if !d.conns[connID(a)].closed {
+		t.Errorf("Disconnected connection hasn't been closed")
+	}
+	if stats := p.Stats(); stats != (PoolStats{Evicted: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if b, _ := p.acquire(PoolKey{}, d.dial); connID(b) == connID(a) {
+		t.Errorf("Disconnected connection has been reused")
+	}
+}
+
+func TestPool_DoPanic(t *testing.T) {
+	p := Pool{MaxOpen: 1}
+	d := &fakeDialer{}
+	func() {
+		defer func() {
+			if r := recover(); r != "test panic" {
+				t.Errorf("Unexpected panic %v", r)
+			}
+		}()
+		_ = p.do(PoolKey{}, d.dial, func(conn poolConn) error {
+			panic("test panic")
+		})
+	}()
+	if !d.conns[0].closed {
+		t.Errorf("Connection of panicked call hasn't been closed")
+	}
+	if stats := p.Stats(); stats != (PoolStats{Evicted: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// The open connection is released, so MaxOpen doesn't block.
+	queryErr := errors.New("query failed")
+	err := p.do(PoolKey{}, d.dial, func(conn poolConn) error {
+		return queryErr
+	})
+	if err != queryErr {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if stats := p.Stats(); stats != (PoolStats{Open: 1, Idle: 1, Evicted: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestPool_IdleTimeout(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	p := Pool{IdleTimeout: time.Minute, ProbeAfter: 10 * time.Second, Clock: clock}
+	d := &fakeDialer{}
+
+	a, _ := p.acquire(PoolKey{}, d.dial)
+	b, _ := p.acquire(PoolKey{}, d.dial)
+	c, _ := p.acquire(PoolKey{Server: "remote"}, d.dial)
+	p.release(a, nil)
+	p.release(c, nil)
+	clock.now = clock.now.Add(30 * time.Second)
+	p.release(b, nil)
+
+	clock.now = clock.now.Add(15 * time.Second)
+
+	// The most recently used connection should be probed first.
+	d.conns[connID(b)].pingErr = ErrRPCServerUnavailable
+	if item, _ := p.acquire(PoolKey{}, d.dial); connID(item) != connID(a) {
+		t.Errorf("Connection failed to ping has been reused")
+	} else {
+		p.release(item, nil)
+	}
+	if !d.conns[connID(b)].closed {
+		t.Errorf("Connection failed to ping hasn't been closed")
+	}
+
+	// Connection of the other key should expire.
+	clock.now = clock.now.Add(45 * time.Second)
+	if item, _ := p.acquire(PoolKey{}, d.dial); connID(item) != connID(a) {
+		t.Errorf("Idle connection hasn't been reused")
+	} else {
+		p.release(item, nil)
+	}
+	if !d.conns[connID(c)].closed {
+		t.Errorf("Expired connection hasn't been closed")
+	}
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	if item, _ := p.acquire(PoolKey{}, d.dial); connID(item) != 3 || !d.conns[connID(a)].closed {
+		t.Errorf("Expired connection has been reused")
+	}
+	if stats := p.Stats(); stats != (PoolStats{Open: 1, Evicted: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestPool_DialError(t *testing.T) {
+	p := Pool{MaxOpen: 1}
+	d := &fakeDialer{err: ErrAccessDenied}
+	if _, err := p.acquire(PoolKey{}, d.dial); err != ErrAccessDenied {
+		t.Errorf("Unexpected dial error %v", err)
+	}
+	d.err = nil
+	if _, err := p.acquire(PoolKey{}, d.dial); err != nil {
+		t.Errorf("Failed dial holds the open limit; %v", err)
+	}
+}
+
+func TestNewPoolKey(t *testing.T) {
+	key, err := NewPoolKey("server", `root\cimv2`, nil, "", "MS_409")
+	if err != nil {
+		t.Fatalf("Failed to create key; %s", err)
+	}
+	if key != (PoolKey{Server: "server", Namespace: `root\cimv2`, Locale: "MS_409"}) {
+		t.Errorf("Unexpected key %+v", key)
+	}
+	expectedArgs := []interface{}{"server", `root\cimv2`, "", "", "MS_409"}
+	if args := key.connectServerArgs(); !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("Unexpected args %v", args)
+	}
+	if args := (PoolKey{}).connectServerArgs(); len(args) != 0 {
+		t.Errorf("Unexpected args of default key %v", args)
+	}
+
+	if _, err := NewPoolKey(".", "", "", "", "", "", 0); err == nil {
+		t.Errorf("No error for security flags")
+	}
+	if _, err := NewPoolKey(".", 42); err == nil {
+		t.Errorf("No error for non string arg")
+	}
+}
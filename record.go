@@ -0,0 +1,258 @@
+package wmi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordedObject is a WMI object captured by the `Recorder` with all its
+// properties, including the system ones (e.g. `__CLASS`).
+type RecordedObject struct {
+	Class      string
+	Properties []RecordedProperty
+}
+
+// RecordedProperty is a property of the RecordedObject.
+//
+// `Value` holds the same Go types the COM object property has, so the
+// recorded objects are decoded the same way as the live ones:
+//   - nil for NULL values
+//   - int16 for sint8, sint16 and char16
+//   - uint8 for uint8
+//   - int32 for uint16, sint32 and uint32
+//   - float32 and float64 for real32 and real64
+//   - bool for boolean
+//   - string for string, datetime, reference, sint64 and uint64
+//   - *RecordedObject for the embedded objects
+//   - []interface{} of the types above for arrays.
+type RecordedProperty struct {
+	Name    string
+	CIMType CIMType
+	IsArray bool        `json:",omitempty"`
+	Value   interface{} `json:",omitempty"`
+}
+
+// RecordedEvent is an event captured by the `Recorder`.
+type RecordedEvent struct {
+	// Time is the time the event has been received.
+	Time time.Time
+
+	// Query is the notification query the event has been received by.
+	Query string `json:",omitempty"`
+
+	Object *RecordedObject
+}
+
+// RecordedUnmarshaler is the interface implemented by types that can unmarshal
+// the recorded object of themselves. It's the `Unmarshaler` counterpart for
+// the replayed events.
+type RecordedUnmarshaler interface {
+	UnmarshalRecorded(d Decoder, src *RecordedObject) error
+}
+
+// UnmarshalRecorded loads the recorded object into a struct pointer the same
+// way as `Unmarshal` does for the live objects. Types implementing
+// `Unmarshaler` should implement `RecordedUnmarshaler` to be decoded.
+func (d Decoder) UnmarshalRecorded(src *RecordedObject, dst interface{}) error {
+	return d.unmarshal(src, dst)
+}
+
+// UnmarshalJSON restores the Go types of the property value.
+func (p *RecordedProperty) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name    string
+		CIMType CIMType
+		IsArray bool
+		Value   json.RawMessage
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	p.Name, p.CIMType, p.IsArray, p.Value = raw.Name, raw.CIMType, raw.IsArray, nil
+	if isJSONNull(raw.Value) {
+		return nil
+	}
+
+	var err error
+	if raw.IsArray {
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw.Value, &elems); err != nil {
+			return fmt.Errorf("wmi: invalid %s[] value of %q; %w", p.CIMType, p.Name, err)
+		}
+		values := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			if values[i], err = recordedValue(p.CIMType, elem); err != nil {
+				return fmt.Errorf("wmi: invalid %s[] value of %q; %w", p.CIMType, p.Name, err)
+			}
+		}
+		p.Value = values
+		return nil
+	}
+	if p.Value, err = recordedValue(p.CIMType, raw.Value); err != nil {
+		return fmt.Errorf("wmi: invalid %s value of %q; %w", p.CIMType, p.Name, err)
+	}
+	return nil
+}
+
+func isJSONNull(data json.RawMessage) bool {
+	return len(data) == 0 || bytes.Equal(data, []byte("null"))
+}
+
+// recordedValue decodes the JSON @data of the @t CIM type to the Go type of
+// the COM object property.
+func recordedValue(t CIMType, data json.RawMessage) (interface{}, error) {
+	if isJSONNull(data) {
+		return nil, nil
+	}
+	switch t {
+	case CIMTypeObject:
+		var obj RecordedObject
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, err
+		}
+		return &obj, nil
+	case CIMTypeString, CIMTypeDateTime, CIMTypeReference, CIMTypeSint64, CIMTypeUint64:
+		var v string
+		err := json.Unmarshal(data, &v)
+		return v, err
+	case CIMTypeBoolean:
+		var v bool
+		err := json.Unmarshal(data, &v)
+		return v, err
+	case CIMTypeReal32:
+		var v float32
+		err := json.Unmarshal(data, &v)
+		return v, err
+	case CIMTypeReal64:
+		var v float64
+		err := json.Unmarshal(data, &v)
+		return v, err
+	case CIMTypeUint8:
+		var v uint8
+		err := json.Unmarshal(data, &v)
+		return v, err
+	case CIMTypeSint8, CIMTypeSint16, CIMTypeChar16:
+		var v int16
+		err := json.Unmarshal(data, &v)
+		return v, err
+	case CIMTypeUint16, CIMTypeSint32, CIMTypeUint32:
+		var v int32
+		err := json.Unmarshal(data, &v)
+		return v, err
+	}
+	return nil, fmt.Errorf("unsupported CIM type %s", t)
+}
+
+// Property returns the property with the @name (case insensitive).
+func (o *RecordedObject) Property(name string) (*RecordedProperty, bool) {
+	for i := range o.Properties {
+		if strings.EqualFold(o.Properties[i].Name, name) {
+			return &o.Properties[i], true
+		}
+	}
+	return nil, false
+}
+
+func (o *RecordedObject) property(name string) (propertyValue, error) {
+	p, ok := o.Property(name)
+	if !ok {
+		return nil, fmt.Errorf("no property %q in the recorded %s object", name, o.Class)
+	}
+	return recordedPropertyValue{p}, nil
+}
+
+func (o *RecordedObject) unmarshalSelf(d Decoder, dst interface{}) (bool, error) {
+	switch u := dst.(type) {
+	case RecordedUnmarshaler:
+		return true, u.UnmarshalRecorded(d, o)
+	case Unmarshaler:
+		return true, fmt.Errorf("wmi: %T doesn't implement RecordedUnmarshaler", dst)
+	}
+	return false, nil
+}
+
+// recordedPropertyValue is a propertyValue of the RecordedObject property.
+type recordedPropertyValue struct {
+	*RecordedProperty
+}
+
+func (v recordedPropertyValue) String() string {
+	if v.IsArray {
+		return v.CIMType.String() + "[]"
+	}
+	return v.CIMType.String()
+}
+
+func (v recordedPropertyValue) isNull() bool {
+	return v.Value == nil
+}
+
+func (v recordedPropertyValue) value() interface{} {
+	return v.Value
+}
+
+func (v recordedPropertyValue) array() ([]interface{}, bool) {
+	arr, ok := v.Value.([]interface{})
+	return arr, ok
+}
+
+func (v recordedPropertyValue) object() (propertySource, bool) {
+	obj, ok := v.Value.(*RecordedObject)
+	return obj, ok && obj != nil
+}
+
+func (recordedPropertyValue) release() error {
+	return nil
+}
+
+// Recorder writes the recorded events to the NDJSON stream, an event per
+// line. It's safe for concurrent use.
+//
+// Recorder is usually set to `SubscribeOptions.Recorder` or
+// `NotificationQuery.Recorder` to capture the events received. The first
+// failure to capture or write an event is kept and reported by `Err`, the
+// following events are not recorded.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder returns the Recorder writing to @w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Record writes the event @e.
+func (r *Recorder) Record(e RecordedEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	if err := r.enc.Encode(e); err != nil {
+		r.err = fmt.Errorf("wmi: failed to record event; %w", err)
+	}
+	return r.err
+}
+
+// Err returns the first error of the event recording.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// fail keeps the @err if it's the first one.
+func (r *Recorder) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
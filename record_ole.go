@@ -0,0 +1,141 @@
+// +build windows
+
+package wmi
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/bi-zone/go-ole"
+	"github.com/bi-zone/go-ole/oleutil"
+	"github.com/hashicorp/go-multierror"
+)
+
+// recordDispatch records the event object @src received by the @query.
+func (r *Recorder) recordDispatch(query string, src *ole.IDispatch) {
+	if r.Err() != nil {
+		return
+	}
+	obj, err := RecordObject(src)
+	if err != nil {
+		r.fail(fmt.Errorf("wmi: failed to capture event; %w", err))
+		return
+	}
+	_ = r.Record(RecordedEvent{Time: time.Now(), Query: query, Object: obj})
+}
+
+// RecordObject captures all the properties of the SWbemObject @src including
+// the system ones. Embedded objects and arrays of them are captured
+// recursively.
+func RecordObject(src *ole.IDispatch) (*RecordedObject, error) {
+	var obj RecordedObject
+	for _, collection := range []string{"SystemProperties_", "Properties_"} {
+		err := forEachItem(src, collection, func(item *ole.IDispatch) error {
+			var p struct {
+				Name    string
+				CIMType CIMType
+				IsArray bool
+			}
+			if err := (Decoder{}).Unmarshal(item, &p); err != nil {
+				return err
+			}
+			value, err := recordValue(item)
+			if err != nil {
+				return fmt.Errorf("failed to capture %q; %w", p.Name, err)
+			}
+			obj.Properties = append(obj.Properties, RecordedProperty{
+				Name:    p.Name,
+				CIMType: p.CIMType,
+				IsArray: p.IsArray,
+				Value:   value,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if class, ok := obj.Property("__CLASS"); ok {
+		obj.Class, _ = class.Value.(string)
+	}
+	return &obj, nil
+}
+
+// recordValue returns the Go value of the SWbemProperty @item value.
+func recordValue(item *ole.IDispatch) (val interface{}, err error) {
+	v, err := oleutil.GetProperty(item, "Value")
+	if err != nil {
+		return nil, newWbemError("GetProperty Value", err)
+	}
+	defer func() {
+		if clErr := v.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+
+	switch {
+	case v.VT&ole.VT_ARRAY != 0:
+		return recordArray(v)
+	case v.VT == ole.VT_DISPATCH:
+		return RecordObject(v.ToIDispatch())
+	case v.VT == ole.VT_NULL || v.VT == ole.VT_EMPTY:
+		return nil, nil
+	}
+	return v.Value(), nil
+}
+
+var procSafeArrayGetElement = syscall.NewLazyDLL("oleaut32.dll").NewProc("SafeArrayGetElement")
+
+// recordArray returns the Go values of the @v array elements. Embedded objects
+// are captured with `RecordObject`.
+func recordArray(v *ole.VARIANT) ([]interface{}, error) {
+	safeArray := v.ToArray()
+	if safeArray == nil {
+		return nil, nil
+	}
+
+	if v.VT&^ole.VT_ARRAY == ole.VT_DISPATCH {
+		// `ToValueArray` doesn't support the arrays of objects.
+		n, err := safeArray.TotalElements(0)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := int32(0); i < n; i++ {
+			var elem *ole.IDispatch
+			hr, _, _ := procSafeArrayGetElement.Call(
+				uintptr(unsafe.Pointer(safeArray.Array)),
+				uintptr(unsafe.Pointer(&i)),
+				uintptr(unsafe.Pointer(&elem)))
+			if hr != 0 {
+				return nil, newWbemError("SafeArrayGetElement", ole.NewError(hr))
+			}
+			if elem == nil {
+				continue
+			}
+			obj, err := RecordObject(elem)
+			elem.Release()
+			if err != nil {
+				return nil, err
+			}
+			values[i] = obj
+		}
+		return values, nil
+	}
+
+	// Objects of the VARIANT arrays stay referenced by the array until @v is
+	// cleared.
+	values := safeArray.ToValueArray()
+	for i, elem := range values {
+		if dispatch, ok := elem.(*ole.IDispatch); ok && dispatch != nil {
+			obj, err := RecordObject(dispatch)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = obj
+		}
+	}
+	return values, nil
+}
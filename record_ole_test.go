@@ -0,0 +1,56 @@
+// +build windows
+
+package wmi
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	type Win32_LocalTime struct {
+		Year   uint32
+		Second uint32
+	}
+	type event struct {
+		TargetInstance Win32_LocalTime
+	}
+
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events := make(chan event)
+	sub, err := Subscribe(ctx, InstanceEventQuery(Win32_LocalTime{}, InstanceModified, 0), events,
+		&SubscribeOptions{PollTimeout: 100 * time.Millisecond, Recorder: recorder})
+	if err != nil {
+		t.Fatalf("Subscribe: %s", err)
+	}
+	var live event
+	select {
+	case live = <-events:
+	case <-sub.Done():
+		t.Fatalf("Subscription is done; %v", sub.Err())
+	}
+	if err := sub.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatalf("Recorder: %s", err)
+	}
+
+	replayed := make(chan event, 2)
+	sub, err = Replay(context.Background(), &buf, replayed, &ReplayOptions{Speed: -1})
+	if err != nil {
+		t.Fatalf("Replay: %s", err)
+	}
+	waitDone(t, sub)
+	if err := sub.Err(); err != nil {
+		t.Errorf("Replay: %s", err)
+	}
+	if e := <-replayed; e != live {
+		t.Errorf("Unexpected replayed event %+v; expected %+v", e, live)
+	}
+}
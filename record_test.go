@@ -0,0 +1,184 @@
+package wmi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordedService returns the recorded Win32_Service instance.
+func recordedService(name, state string) *RecordedObject {
+	return &RecordedObject{
+		Class: "Win32_Service",
+		Properties: []RecordedProperty{
+			{Name: "__CLASS", CIMType: CIMTypeString, Value: "Win32_Service"},
+			{Name: "Name", CIMType: CIMTypeString, Value: name},
+			{Name: "State", CIMType: CIMTypeString, Value: state},
+			{Name: "Started", CIMType: CIMTypeBoolean, Value: state == "Running"},
+			{Name: "StartTime", CIMType: CIMTypeDateTime, Value: "20200101000000.000000+000"},
+		},
+	}
+}
+
+func TestRecordedProperty_UnmarshalJSON(t *testing.T) {
+	obj := &RecordedObject{
+		Class: "Test",
+		Properties: []RecordedProperty{
+			{Name: "Null", CIMType: CIMTypeString},
+			{Name: "Sint8", CIMType: CIMTypeSint8, Value: int16(-8)},
+			{Name: "Uint8", CIMType: CIMTypeUint8, Value: uint8(8)},
+			{Name: "Uint32", CIMType: CIMTypeUint32, Value: int32(32)},
+			{Name: "Uint64", CIMType: CIMTypeUint64, Value: "18446744073709551615"},
+			{Name: "Real32", CIMType: CIMTypeReal32, Value: float32(0.5)},
+			{Name: "Real64", CIMType: CIMTypeReal64, Value: 0.25},
+			{Name: "Boolean", CIMType: CIMTypeBoolean, Value: true},
+			{Name: "Strings", CIMType: CIMTypeString, IsArray: true, Value: []interface{}{"a", nil, "b"}},
+			{Name: "Object", CIMType: CIMTypeObject, Value: recordedService("svc", "Running")},
+			{Name: "Objects", CIMType: CIMTypeObject, IsArray: true, Value: []interface{}{
+				recordedService("a", "Running"), nil, recordedService("b", "Stopped"),
+			}},
+		},
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	var decoded RecordedObject
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if !reflect.DeepEqual(&decoded, obj) {
+		t.Errorf("Unexpected decoded object\n%+v\nexpected\n%+v", decoded, *obj)
+	}
+
+	invalid := []string{
+		`{"Name": "Bad", "CIMType": 11, "Value": "true"}`,
+		`{"Name": "Bad", "CIMType": 8, "IsArray": true, "Value": "a"}`,
+		`{"Name": "Bad", "CIMType": 13, "Value": 1}`,
+	}
+	for _, data := range invalid {
+		var p RecordedProperty
+		if err := json.Unmarshal([]byte(data), &p); err == nil {
+			t.Errorf("Invalid property %s is accepted", data)
+		}
+	}
+}
+
+func TestDecoder_UnmarshalRecorded(t *testing.T) {
+	obj := recordedService("svc", "Running")
+	obj.Properties = append(obj.Properties,
+		RecordedProperty{Name: "ProcessId", CIMType: CIMTypeUint32, Value: int32(42)},
+		RecordedProperty{Name: "Memory", CIMType: CIMTypeUint64, Value: "1024"},
+		RecordedProperty{Name: "Dependencies", CIMType: CIMTypeString, IsArray: true, Value: []interface{}{"a", "b"}},
+		RecordedProperty{Name: "Parent", CIMType: CIMTypeObject, Value: recordedService("parent", "Stopped")},
+		RecordedProperty{Name: "Description", CIMType: CIMTypeString},
+	)
+
+	var dst struct {
+		Name         string
+		Started      bool
+		StartTime    time.Time
+		ProcessId    uint32
+		Memory       uint64
+		Dependencies []string
+		Parent       *Win32_Service
+		Description  *string
+	}
+	if err := (Decoder{}).UnmarshalRecorded(obj, &dst); err != nil {
+		t.Fatalf("UnmarshalRecorded: %s", err)
+	}
+	if dst.Name != "svc" || !dst.Started || !dst.StartTime.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected service %+v", dst)
+	}
+	if dst.ProcessId != 42 || dst.Memory != 1024 || !reflect.DeepEqual(dst.Dependencies, []string{"a", "b"}) {
+		t.Errorf("Unexpected values %+v", dst)
+	}
+	if dst.Parent == nil || dst.Parent.Name != "parent" || dst.Parent.Started {
+		t.Errorf("Unexpected embedded object %+v", dst.Parent)
+	}
+	if dst.Description != nil {
+		t.Errorf("Unexpected null value %q", *dst.Description)
+	}
+
+	var missing struct{ Missing string }
+	if err := (Decoder{}).UnmarshalRecorded(obj, &missing); err == nil {
+		t.Errorf("Missing property is accepted")
+	}
+	if err := (Decoder{AllowMissingFields: true}).UnmarshalRecorded(obj, &missing); err != nil {
+		t.Errorf("Missing property isn't allowed; %s", err)
+	}
+}
+
+func TestInstanceEvent_UnmarshalRecorded(t *testing.T) {
+	obj := &RecordedObject{
+		Class: "__InstanceModificationEvent",
+		Properties: []RecordedProperty{
+			{Name: "__CLASS", CIMType: CIMTypeString, Value: "__InstanceModificationEvent"},
+			{Name: "TIME_CREATED", CIMType: CIMTypeUint64, Value: "132223104000000000"},
+			{Name: "TargetInstance", CIMType: CIMTypeObject, Value: recordedService("svc", "Running")},
+			{Name: "PreviousInstance", CIMType: CIMTypeObject, Value: recordedService("svc", "Stopped")},
+		},
+	}
+	e := NewInstanceEvent(Win32_Service{})
+	if err := (Decoder{}).UnmarshalRecorded(obj, e); err != nil {
+		t.Fatalf("UnmarshalRecorded: %s", err)
+	}
+	if e.Kind != InstanceModified || !e.Time.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if e.Target.(*Win32_Service).State != "Running" || e.Previous.(*Win32_Service).State != "Stopped" {
+		t.Errorf("Unexpected instances %+v %+v", e.Target, e.Previous)
+	}
+}
+
+// failingWriter fails all the writes with the err.
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	received := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"a", "b"} {
+		err := r.Record(RecordedEvent{
+			Time:   received.Add(time.Duration(i) * time.Second),
+			Query:  "SELECT * FROM Win32_Service",
+			Object: recordedService(name, "Running"),
+		})
+		if err != nil {
+			t.Fatalf("Record: %s", err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Unexpected recording %s", buf.String())
+	}
+	var e RecordedEvent
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if !e.Time.Equal(received.Add(time.Second)) || !reflect.DeepEqual(e.Object, recordedService("b", "Running")) {
+		t.Errorf("Unexpected recorded event %+v", e)
+	}
+
+	testErr := errors.New("test")
+	r = NewRecorder(failingWriter{testErr})
+	for i := 0; i < 2; i++ {
+		if err := r.Record(RecordedEvent{Object: recordedService("a", "Running")}); !errors.Is(err, testErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+	r.fail(errors.New("another"))
+	if !errors.Is(r.Err(), testErr) {
+		t.Errorf("The first error isn't kept; %v", r.Err())
+	}
+}
@@ -0,0 +1,129 @@
+package wmi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ReplayOptions are optional parameters of `Replay`. A nil *ReplayOptions
+// means the defaults.
+type ReplayOptions struct {
+	// SubscribeOptions are the options of the replay subscription.
+	// `Resubscribe` is ignored.
+	SubscribeOptions
+
+	// Decoder is used to decode the recorded events.
+	Decoder Decoder
+
+	// Speed is the replay speed factor relative to the recorded one, e.g. 2
+	// replays the events twice faster. Zero means the original speed,
+	// negative - no delays between the events at all.
+	Speed float64
+
+	// Clock is used to wait between the events. If nil, the system clock is
+	// used.
+	Clock Clock
+}
+
+// Replay reads the events recorded by the `Recorder` from @r and delivers
+// them to @eventCh the same way as `Subscribe` does. Events are decoded with
+// `ReplayOptions.Decoder` through the same decoding rules as the live ones,
+// decoding failures and malformed events are reported over
+// `Subscription.Errors` channel. Replay doesn't need WMI, so it works on any
+// OS.
+//
+// The subscription is done after the last event is delivered, `Err` is nil in
+// that case. It's stopped earlier if the @ctx is done, `Subscription.Close`
+// is called or the recording is malformed.
+func Replay(ctx context.Context, r io.Reader, eventCh interface{}, opts *ReplayOptions) (*Subscription, error) {
+	var subOpts *SubscribeOptions
+	src := replaySource{
+		dec:   json.NewDecoder(r),
+		clock: systemClock{},
+	}
+	if opts != nil {
+		subOpts = &opts.SubscribeOptions
+		src.decoder = opts.Decoder
+		src.speed = opts.Speed
+		if opts.Clock != nil {
+			src.clock = opts.Clock
+		}
+	}
+	sub, ctx, err := newSubscription(ctx, "", eventCh, subOpts)
+	if err != nil {
+		return nil, err
+	}
+	sub.resubscribe = nil
+	sub.start(ctx, &src, nil)
+	return sub, nil
+}
+
+// replaySource is an eventSource of the recorded events.
+type replaySource struct {
+	dec     *json.Decoder
+	decoder Decoder
+	speed   float64
+	clock   Clock
+
+	started  bool
+	recorded time.Time // Recording time of the first event.
+	replayed time.Time // Replay time of the first event.
+	pending  *RecordedEvent
+}
+
+// next waits for the time of the next event scaled by the replay speed and
+// decodes it.
+func (src *replaySource) next(timeout time.Duration, dst interface{}) error {
+	if src.pending == nil {
+		var e RecordedEvent
+		if err := src.dec.Decode(&e); err != nil {
+			var syntaxErr *json.SyntaxError
+			switch {
+			case err == io.EOF:
+				return errSourceDone
+			case errors.As(err, &syntaxErr) || err == io.ErrUnexpectedEOF:
+				return fmt.Errorf("wmi: failed to read recorded event; %w", err)
+			}
+			// The malformed event is skipped, the stream is fine.
+			return eventDecodeError{err: err}
+		}
+		if !src.started {
+			src.started = true
+			src.recorded, src.replayed = e.Time, src.clock.Now()
+		}
+		src.pending = &e
+	}
+
+	if src.speed >= 0 {
+		speed := src.speed
+		if speed == 0 {
+			speed = 1
+		}
+		due := src.replayed.Add(time.Duration(float64(src.pending.Time.Sub(src.recorded)) / speed))
+		if wait := due.Sub(src.clock.Now()); wait > 0 {
+			if timeout >= 0 && timeout < wait {
+				<-src.clock.After(timeout)
+				return errNoEvents
+			}
+			<-src.clock.After(wait)
+		}
+	}
+
+	e := src.pending
+	src.pending = nil
+	if e.Object == nil {
+		return eventDecodeError{err: fmt.Errorf("wmi: recorded event of %s has no object", e.Time)}
+	}
+	if err := src.decoder.UnmarshalRecorded(e.Object, dst); err != nil {
+		return eventDecodeError{err: err}
+	}
+	return nil
+}
+
+func (src *replaySource) close() error {
+	return nil
+}
@@ -0,0 +1,169 @@
+package wmi
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recording returns the NDJSON recording of the services events received
+// every @interval.
+func recording(t *testing.T, interval time.Duration, events ...*RecordedObject) *bytes.Buffer {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	received := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, obj := range events {
+		if err := r.Record(RecordedEvent{Time: received.Add(time.Duration(i) * interval), Object: obj}); err != nil {
+			t.Fatalf("Record: %s", err)
+		}
+	}
+	return &buf
+}
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		speed float64
+		delay time.Duration
+	}{
+		{0, 10 * time.Second},
+		{2, 5 * time.Second},
+		{-1, 0},
+	}
+	for _, test := range tests {
+		clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+		src := recording(t, 10*time.Second,
+			recordedService("a", "Running"), recordedService("b", "Stopped"), recordedService("c", "Running"))
+		events := make(chan Win32_Service, 3)
+		sub, err := Replay(context.Background(), src, events, &ReplayOptions{
+			SubscribeOptions: SubscribeOptions{PollTimeout: -1},
+			Speed:            test.speed,
+			Clock:            clock,
+		})
+		if err != nil {
+			t.Fatalf("Replay: %s", err)
+		}
+		waitDone(t, sub)
+		if err := sub.Err(); err != nil {
+			t.Errorf("Unexpected error of the finished replay %s", err)
+		}
+
+		for _, name := range []string{"a", "b", "c"} {
+			if e := <-events; e.Name != name {
+				t.Errorf("Unexpected event %+v; expected %q", e, name)
+			}
+		}
+		var expected []time.Duration
+		if test.delay > 0 {
+			expected = []time.Duration{test.delay, test.delay}
+		}
+		if len(clock.delays) != len(expected) {
+			t.Errorf("Unexpected delays %v at speed %v; expected %v", clock.delays, test.speed, expected)
+			continue
+		}
+		for i, d := range clock.delays {
+			if d != expected[i] {
+				t.Errorf("Unexpected delays %v at speed %v; expected %v", clock.delays, test.speed, expected)
+				break
+			}
+		}
+	}
+}
+
+func TestReplay_PollTimeout(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	src := recording(t, 3*time.Second, recordedService("a", "Running"), recordedService("b", "Running"))
+	events := make(chan Win32_Service, 2)
+	sub, err := Replay(context.Background(), src, events, &ReplayOptions{
+		SubscribeOptions: SubscribeOptions{PollTimeout: time.Second},
+		Clock:            clock,
+	})
+	if err != nil {
+		t.Fatalf("Replay: %s", err)
+	}
+	waitDone(t, sub)
+	if len(events) != 2 {
+		t.Errorf("Unexpected number of events %d", len(events))
+	}
+	for i, d := range clock.delays {
+		if d != time.Second {
+			t.Errorf("Unexpected delay %d: %s", i, d)
+		}
+	}
+}
+
+func TestReplay_Errors(t *testing.T) {
+	bad := recordedService("b", "Running")
+	bad.Properties = bad.Properties[:2] // No State.
+	src := recording(t, 0, recordedService("a", "Running"), bad, recordedService("c", "Running"))
+	src.WriteString(`{"Object": {"Properties": [{"Name": "Started", "CIMType": 11, "Value": "yes"}]}}` + "\n")
+	src.WriteString(recording(t, 0, recordedService("d", "Running")).String())
+	events := make(chan Win32_Service, 4)
+	sub, err := Replay(context.Background(), src, events, nil)
+	if err != nil {
+		t.Fatalf("Replay: %s", err)
+	}
+	waitDone(t, sub)
+	if err := sub.Err(); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	if len(events) != 3 {
+		t.Errorf("Unexpected number of events %d", len(events))
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-sub.Errors(); err == nil {
+			t.Errorf("Decoding error isn't reported")
+		}
+	}
+
+	sub, err = Replay(context.Background(), bytes.NewBufferString("{bad"), events, nil)
+	if err != nil {
+		t.Fatalf("Replay: %s", err)
+	}
+	waitDone(t, sub)
+	if sub.Err() == nil {
+		t.Errorf("Malformed recording is accepted")
+	}
+}
+
+func TestReplay_Delivery(t *testing.T) {
+	for _, mode := range []DeliveryMode{DeliveryBlock, DeliveryDropOldest, DeliveryDropNewest, DeliveryBatch} {
+		src := recording(t, time.Second,
+			recordedService("a", "Running"), recordedService("b", "Stopped"), recordedService("c", "Running"))
+		events, batches := make(chan Win32_Service), make(chan []Win32_Service)
+		var eventCh interface{} = events
+		if mode == DeliveryBatch {
+			eventCh = batches
+		}
+		sub, err := Replay(context.Background(), src, eventCh, &ReplayOptions{
+			SubscribeOptions: SubscribeOptions{Delivery: DeliveryPolicy{Mode: mode, BufferSize: 10}},
+			Speed:            -1,
+		})
+		if err != nil {
+			t.Fatalf("Replay: %s", err)
+		}
+
+		// The events are still pending when the recording ends.
+		var names []string
+		for len(names) < 3 {
+			select {
+			case e := <-events:
+				names = append(names, e.Name)
+			case batch := <-batches:
+				for _, e := range batch {
+					names = append(names, e.Name)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: only %v events are received", mode, names)
+			}
+		}
+		if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+			t.Errorf("%s: unexpected events %v", mode, names)
+		}
+		waitDone(t, sub)
+		if err := sub.Err(); err != nil {
+			t.Errorf("%s: unexpected error %s", mode, err)
+		}
+	}
+}
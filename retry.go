@@ -0,0 +1,182 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Clock is a source of time for the time dependent logic of the package
+// (e.g. retry backoff). It's replaceable to make such logic testable.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// RetryPolicy specifies how calls failed with transient errors are retried.
+//
+// Attempt N (starting from 1) is followed by a delay of
+// `InitialBackoff * Multiplier^(N-1)` limited by `MaxBackoff`. The delay is
+// randomly reduced by up to `Jitter` fraction of it, so simultaneous clients
+// don't retry in lockstep.
+//
+// A nil *RetryPolicy disables retries.
+//
+// N.B. Method calls are retried too, so be careful with the methods which are
+// not idempotent.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	// Values less than 2 disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay after the first failed attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff limits the delay between attempts (if not zero).
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after every attempt. Zero
+	// value means 2.
+	Multiplier float64
+	// Jitter is a fraction of the delay in [0, 1] which is randomized.
+	Jitter float64
+
+	// Retryable reports whether the call failed with @err should be retried.
+	// If nil, `IsTransientError` is used.
+	Retryable func(err error) bool
+
+	// Reconnect enables reconnecting to the server when the call failed
+	// because of the lost connection (see `IsDisconnectError`). Reconnect is
+	// followed by a retry.
+	Reconnect bool
+
+	// Clock is used to wait between attempts. If nil, the system clock is used.
+	Clock Clock
+}
+
+// DefaultRetryPolicy returns a policy of 5 attempts with the backoff from
+// 100ms to 5s and reconnecting to the server on disconnect.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Reconnect:      true,
+	}
+}
+
+// IsTransientError reports whether @err is caused by the temporary server
+// conditions, so the call is likely to succeed on retry, e.g.
+// RPC_E_CALL_REJECTED, RPC_S_SERVER_TOO_BUSY or WBEM_E_QUOTA_VIOLATION.
+func IsTransientError(err error) bool {
+	for _, target := range []error{
+		ErrRPCCallRejected,
+		ErrRPCServerTooBusy,
+		ErrRPCCallFailedDNE,
+		ErrServerTooBusy,
+		ErrQuotaViolation,
+		ErrResourceContention,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDisconnectError reports whether @err is caused by the lost connection to
+// the server, e.g. RPC_E_DISCONNECTED or RPC_S_SERVER_UNAVAILABLE. Such
+// connection should be reestablished before the next call.
+func IsDisconnectError(err error) bool {
+	for _, target := range []error{
+		ErrRPCDisconnected,
+		ErrRPCServerUnavailable,
+		ErrRPCCallFailed,
+		ErrTransportFailure,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay after the @attempt (starting from 1) failed.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || d < float64(p.MaxBackoff)); i++ {
+		d *= multiplier
+	}
+	if p.MaxBackoff != 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// do invokes @call until it succeeds or the policy allows no more attempts.
+// @reconnect (optional) reestablishes the connection used by @call after the
+// disconnect. For a nil policy @call is invoked once. The backoff is
+// interrupted by the @ctx cancellation, its error is returned as is.
+func (p *RetryPolicy) do(ctx context.Context, call func() error, reconnect func() error) error {
+	if p == nil {
+		return call()
+	}
+
+	reconnectNeeded := false
+	for attempt := 1; ; attempt++ {
+		var err error
+		if reconnectNeeded {
+			err = reconnect()
+		}
+		if err == nil {
+			if err = call(); err == nil {
+				return nil
+			}
+		}
+
+		reconnectNeeded = p.Reconnect && reconnect != nil && IsDisconnectError(err)
+		if !reconnectNeeded && !p.retryable(err) {
+			return err
+		}
+		if attempt >= p.MaxAttempts {
+			if attempt > 1 {
+				return fmt.Errorf("wmi: %d attempts failed; %w", attempt, err)
+			}
+			return err
+		}
+		select {
+		case <-p.clock().After(p.Backoff(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// retryable reports whether the call failed with @err should be retried.
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable == nil {
+		return IsTransientError(err)
+	}
+	return p.Retryable(err)
+}
+
+func (p *RetryPolicy) clock() Clock {
+	if p == nil || p.Clock == nil {
+		return systemClock{}
+	}
+	return p.Clock
+}
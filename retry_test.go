@@ -0,0 +1,201 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock which doesn't wait but records the requested delays.
+type fakeClock struct {
+	now    time.Time
+	delays []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.delays = append(c.delays, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// fakeBackend fails calls with the scripted errors and counts reconnects.
+type fakeBackend struct {
+	errs       []error
+	calls      int
+	reconnects int
+	connected  bool
+}
+
+func (b *fakeBackend) call() error {
+	if !b.connected {
+		return ErrRPCDisconnected
+	}
+	b.calls++
+	if len(b.errs) == 0 {
+		return nil
+	}
+	err := b.errs[0]
+	b.errs = b.errs[1:]
+	if IsDisconnectError(err) {
+		b.connected = false
+	}
+	return err
+}
+
+func (b *fakeBackend) reconnect() error {
+	b.reconnects++
+	b.connected = true
+	return nil
+}
+
+func TestRetryPolicy(t *testing.T) {
+	rpcErr := func(e *WbemError) error {
+		return fmt.Errorf("query; %w", &WbemError{HResult: e.HResult, Operation: "SWbemServices ExecQuery"})
+	}
+	fatal := errors.New("fatal")
+
+	tests := []struct {
+		name       string
+		policy     RetryPolicy
+		errs       []error
+		err        error
+		calls      int
+		reconnects int
+		delays     []time.Duration
+	}{
+		{
+			name:   "success",
+			policy: RetryPolicy{MaxAttempts: 3},
+			calls:  1,
+		},
+		{
+			name:   "transient errors",
+			policy: RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second},
+			errs:   []error{rpcErr(ErrRPCCallRejected), rpcErr(ErrRPCServerTooBusy), rpcErr(ErrQuotaViolation)},
+			calls:  4,
+			delays: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name:   "max backoff",
+			policy: RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second, Multiplier: 3},
+			errs:   []error{ErrServerTooBusy, ErrServerTooBusy, ErrServerTooBusy, ErrServerTooBusy},
+			err:    ErrServerTooBusy,
+			calls:  4,
+			delays: []time.Duration{time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:   "not retryable",
+			policy: RetryPolicy{MaxAttempts: 5},
+			errs:   []error{ErrRPCCallRejected, rpcErr(ErrNotFound)},
+			err:    ErrNotFound,
+			calls:  2,
+			delays: []time.Duration{0},
+		},
+		{
+			name:   "custom classifier",
+			policy: RetryPolicy{MaxAttempts: 5, Retryable: func(err error) bool { return err != fatal }},
+			errs:   []error{ErrNotFound, fatal},
+			err:    fatal,
+			calls:  2,
+			delays: []time.Duration{0},
+		},
+		{
+			name:       "reconnect",
+			policy:     RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, Reconnect: true},
+			errs:       []error{rpcErr(ErrRPCDisconnected), rpcErr(ErrRPCServerUnavailable)},
+			calls:      3,
+			reconnects: 2,
+			delays:     []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:   "no reconnect",
+			policy: RetryPolicy{MaxAttempts: 3},
+			errs:   []error{ErrRPCDisconnected},
+			err:    ErrRPCDisconnected,
+			calls:  1,
+		},
+		{
+			name:   "disabled",
+			policy: RetryPolicy{},
+			errs:   []error{ErrRPCCallRejected},
+			err:    ErrRPCCallRejected,
+			calls:  1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := &fakeClock{}
+			backend := &fakeBackend{errs: test.errs, connected: true}
+			policy := test.policy
+			policy.Clock = clock
+
+			err := policy.do(context.Background(), backend.call, backend.reconnect)
+			if !errors.Is(err, test.err) {
+				t.Errorf("Unexpected error %v; expected %v", err, test.err)
+			}
+			if backend.calls != test.calls || backend.reconnects != test.reconnects {
+				t.Errorf("Unexpected %d calls and %d reconnects; expected %d and %d",
+					backend.calls, backend.reconnects, test.calls, test.reconnects)
+			}
+			if !reflect.DeepEqual(clock.delays, test.delays) {
+				t.Errorf("Unexpected delays %v; expected %v", clock.delays, test.delays)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Nil(t *testing.T) {
+	var policy *RetryPolicy
+	backend := &fakeBackend{errs: []error{ErrRPCCallRejected}, connected: true}
+	if err := policy.do(context.Background(), backend.call, backend.reconnect); err != ErrRPCCallRejected || backend.calls != 1 {
+		t.Errorf("Unexpected result of nil policy; %v after %d calls", err, backend.calls)
+	}
+}
+
+// cancelClock is a Clock which cancels the context on the wait and never
+// fires.
+type cancelClock struct {
+	fakeClock
+	cancel context.CancelFunc
+}
+
+func (c *cancelClock) After(d time.Duration) <-chan time.Time {
+	c.fakeClock.After(d)
+	c.cancel()
+	return nil
+}
+
+func TestRetryPolicy_CancelBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := &cancelClock{cancel: cancel}
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, Clock: clock}
+	backend := &fakeBackend{errs: []error{ErrRPCCallRejected, ErrRPCCallRejected}, connected: true}
+
+	if err := policy.do(ctx, backend.call, backend.reconnect); err != context.Canceled {
+		t.Errorf("Unexpected error %v; expected %v", err, context.Canceled)
+	}
+	if backend.calls != 1 || len(clock.delays) != 1 {
+		t.Errorf("Unexpected %d calls and %d delays after cancel", backend.calls, len(clock.delays))
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Jitter: 0.5}
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		for i := 0; i < 100; i++ {
+			if d := p.Backoff(attempt + 1); d > max || d < max/2 {
+				t.Fatalf("Backoff of attempt %d is %s; expected in [%s, %s]", attempt+1, d, max/2, max)
+			}
+		}
+	}
+}
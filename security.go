@@ -0,0 +1,170 @@
+package wmi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ImpersonationLevel is the COM impersonation level of the WMI calls.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/setting-the-default-process-security-level-using-vbscript
+type ImpersonationLevel int
+
+// Impersonation levels (WbemImpersonationLevelEnum).
+const (
+	ImpersonationAnonymous   ImpersonationLevel = 1
+	ImpersonationIdentify    ImpersonationLevel = 2
+	ImpersonationImpersonate ImpersonationLevel = 3
+	ImpersonationDelegate    ImpersonationLevel = 4
+)
+
+// AuthenticationLevel is the COM authentication level of the WMI calls.
+type AuthenticationLevel int
+
+// Authentication levels (WbemAuthenticationLevelEnum).
+const (
+	AuthenticationDefault      AuthenticationLevel = 0
+	AuthenticationNone         AuthenticationLevel = 1
+	AuthenticationConnect      AuthenticationLevel = 2
+	AuthenticationCall         AuthenticationLevel = 3
+	AuthenticationPkt          AuthenticationLevel = 4
+	AuthenticationPktIntegrity AuthenticationLevel = 5
+	AuthenticationPktPrivacy   AuthenticationLevel = 6
+)
+
+// Names of the commonly used privileges.
+const (
+	PrivilegeSecurity       = "SeSecurityPrivilege"
+	PrivilegeTakeOwnership  = "SeTakeOwnershipPrivilege"
+	PrivilegeSystemtime     = "SeSystemtimePrivilege"
+	PrivilegeBackup         = "SeBackupPrivilege"
+	PrivilegeRestore        = "SeRestorePrivilege"
+	PrivilegeShutdown       = "SeShutdownPrivilege"
+	PrivilegeDebug          = "SeDebugPrivilege"
+	PrivilegeRemoteShutdown = "SeRemoteShutdownPrivilege"
+)
+
+// privileges are the names of the privileges supported by WMI
+// (WbemPrivilegeEnum).
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/privilege-constants
+var privileges = []string{
+	"SeCreateTokenPrivilege",
+	"SePrimaryTokenPrivilege",
+	"SeLockMemoryPrivilege",
+	"SeIncreaseQuotaPrivilege",
+	"SeMachineAccountPrivilege",
+	"SeTcbPrivilege",
+	"SeSecurityPrivilege",
+	"SeTakeOwnershipPrivilege",
+	"SeLoadDriverPrivilege",
+	"SeSystemProfilePrivilege",
+	"SeSystemtimePrivilege",
+	"SeProfileSingleProcessPrivilege",
+	"SeIncreaseBasePriorityPrivilege",
+	"SeCreatePagefilePrivilege",
+	"SeCreatePermanentPrivilege",
+	"SeBackupPrivilege",
+	"SeRestorePrivilege",
+	"SeShutdownPrivilege",
+	"SeDebugPrivilege",
+	"SeAuditPrivilege",
+	"SeSystemEnvironmentPrivilege",
+	"SeChangeNotifyPrivilege",
+	"SeRemoteShutdownPrivilege",
+	"SeUndockPrivilege",
+	"SeSyncAgentPrivilege",
+	"SeEnableDelegationPrivilege",
+	"SeManageVolumePrivilege",
+}
+
+// SecurityOptions are the security settings of the connection.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemsecurity
+type SecurityOptions struct {
+	// ImpersonationLevel is set if not zero.
+	ImpersonationLevel ImpersonationLevel
+	// AuthenticationLevel is set if not zero (`AuthenticationDefault`).
+	AuthenticationLevel AuthenticationLevel
+	// Privileges are the names of the privileges to be enabled for the
+	// calls, e.g. `PrivilegeSecurity`. Names are case insensitive.
+	Privileges []string
+}
+
+// Validate checks the levels and privilege names.
+func (o SecurityOptions) Validate() error {
+	if o.ImpersonationLevel < 0 || o.ImpersonationLevel > ImpersonationDelegate {
+		return fmt.Errorf("wmi: invalid impersonation level %d", o.ImpersonationLevel)
+	}
+	if o.AuthenticationLevel < 0 || o.AuthenticationLevel > AuthenticationPktPrivacy {
+		return fmt.Errorf("wmi: invalid authentication level %d", o.AuthenticationLevel)
+	}
+	for _, name := range o.Privileges {
+		if _, ok := lookupPrivilege(name); !ok {
+			return fmt.Errorf("wmi: unknown privilege %q", name)
+		}
+	}
+	return nil
+}
+
+// merge returns the settings @next applied over @o. Privileges are added
+// to the ones of @o.
+func (o SecurityOptions) merge(next SecurityOptions) SecurityOptions {
+	if next.ImpersonationLevel == 0 {
+		next.ImpersonationLevel = o.ImpersonationLevel
+	}
+	if next.AuthenticationLevel == AuthenticationDefault {
+		next.AuthenticationLevel = o.AuthenticationLevel
+	}
+	privileges := append([]string(nil), o.Privileges...)
+	for _, name := range next.Privileges {
+		if canonical, ok := lookupPrivilege(name); ok {
+			name = canonical
+		}
+		if !containsString(privileges, name) {
+			privileges = append(privileges, name)
+		}
+	}
+	next.Privileges = privileges
+	return next
+}
+
+func (o SecurityOptions) isEmpty() bool {
+	return o.ImpersonationLevel == 0 && o.AuthenticationLevel == AuthenticationDefault && len(o.Privileges) == 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupPrivilege returns the canonical privilege name.
+func lookupPrivilege(name string) (string, bool) {
+	for _, p := range privileges {
+		if strings.EqualFold(p, name) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// PrivilegeError is returned if the privileges can't be enabled or the call
+// failed because the privileges are not held by the caller.
+type PrivilegeError struct {
+	Privileges []string
+	Err        error
+}
+
+func (e *PrivilegeError) Error() string {
+	return fmt.Sprintf("wmi: failed to enable privilege(s) %s; %s",
+		strings.Join(e.Privileges, ", "), e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PrivilegeError) Unwrap() error {
+	return e.Err
+}
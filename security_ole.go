@@ -0,0 +1,100 @@
+// +build windows
+
+package wmi
+
+import (
+	"fmt"
+
+	"github.com/bi-zone/go-ole/oleutil"
+	"github.com/hashicorp/go-multierror"
+)
+
+// SetSecurity sets the security settings of the connection. The settings
+// apply to all following calls and are kept on reconnect. Privileges are
+// added to the ones set before. If the call fails, the settings applied
+// before the failure are kept.
+//
+// If the privileges are not held by the caller, the calls fail with
+// `PrivilegeError` wrapping `ErrPrivilegeNotHeld`.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemservices-security-
+func (s *SWbemServicesConnection) SetSecurity(opts SecurityOptions) (err error) {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if opts.isEmpty() {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.sWbemServices == nil {
+		return ErrConnectionClosed
+	}
+
+	// Remember the settings applied even if the rest of them fail, so they
+	// are reapplied on reconnect as well.
+	var applied SecurityOptions
+	defer func() {
+		s.security = s.security.merge(applied)
+	}()
+
+	//  Be aware of reflections and COM usage.
+	defer func() {
+		if r := recover(); r != nil {
+			err = multierror.Append(err, fmt.Errorf("runtime panic; %v", r))
+		}
+	}()
+
+	securityRaw, err := oleutil.GetProperty(s.sWbemServices, "Security_")
+	if err != nil {
+		return newWbemError("GetProperty Security_", err)
+	}
+	defer func() {
+		if clErr := securityRaw.Clear(); clErr != nil {
+			err = multierror.Append(err, clErr)
+		}
+	}()
+	security := securityRaw.ToIDispatch()
+
+	if opts.ImpersonationLevel != 0 {
+		if _, err := oleutil.PutProperty(security, "ImpersonationLevel", int32(opts.ImpersonationLevel)); err != nil {
+			return newWbemError("SWbemSecurity ImpersonationLevel", err)
+		}
+		applied.ImpersonationLevel = opts.ImpersonationLevel
+	}
+	if opts.AuthenticationLevel != AuthenticationDefault {
+		if _, err := oleutil.PutProperty(security, "AuthenticationLevel", int32(opts.AuthenticationLevel)); err != nil {
+			return newWbemError("SWbemSecurity AuthenticationLevel", err)
+		}
+		applied.AuthenticationLevel = opts.AuthenticationLevel
+	}
+
+	if len(opts.Privileges) > 0 {
+		privilegesRaw, err := oleutil.GetProperty(security, "Privileges")
+		if err != nil {
+			return newWbemError("GetProperty Privileges", err)
+		}
+		defer func() {
+			if clErr := privilegesRaw.Clear(); clErr != nil {
+				err = multierror.Append(err, clErr)
+			}
+		}()
+
+		for _, name := range opts.Privileges {
+			name, _ = lookupPrivilege(name)
+			privilegeRaw, err := oleutil.CallMethod(privilegesRaw.ToIDispatch(), "AddAsString", name, true)
+			if err != nil {
+				return &PrivilegeError{
+					Privileges: []string{name},
+					Err:        newWbemError("SWbemPrivilegeSet AddAsString", err),
+				}
+			}
+			applied.Privileges = append(applied.Privileges, name)
+			if clErr := privilegeRaw.Clear(); clErr != nil {
+				return clErr
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// +build windows
+
+package wmi
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSWbemServicesConnection_SetSecurity(t *testing.T) {
+	s, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer s.Close()
+
+	opts := SecurityOptions{
+		ImpersonationLevel:  ImpersonationImpersonate,
+		AuthenticationLevel: AuthenticationPktPrivacy,
+		Privileges:          []string{PrivilegeSecurity},
+	}
+	if err := s.SetSecurity(opts); err != nil {
+		t.Fatalf("Failed to set security; %s", err)
+	}
+
+	// Security log requires SeSecurityPrivilege. It's fine to fail with the
+	// privilege error if the test is run without admin rights.
+	var events []struct {
+		RecordNumber uint32
+	}
+	err = s.Query("SELECT RecordNumber FROM Win32_NTLogEvent WHERE Logfile = 'Security' AND RecordNumber < 10", &events)
+	var privErr *PrivilegeError
+	if err != nil && !errors.As(err, &privErr) {
+		t.Errorf("Failed to query Security log; %s", err)
+	}
+
+	// Security should be kept on reconnect.
+	if err := s.reconnect(); err != nil {
+		t.Fatalf("Failed to reconnect; %s", err)
+	}
+	if security := s.Security(); security.ImpersonationLevel != ImpersonationImpersonate || len(security.Privileges) != 1 {
+		t.Errorf("Unexpected security after reconnect %+v", security)
+	}
+
+	if err := s.SetSecurity(SecurityOptions{Privileges: []string{"SeNoSuchPrivilege"}}); err == nil {
+		t.Errorf("No error for unknown privilege")
+	}
+}
@@ -0,0 +1,75 @@
+package wmi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSecurityOptions_Validate(t *testing.T) {
+	valid := []SecurityOptions{
+		{},
+		{
+			ImpersonationLevel:  ImpersonationImpersonate,
+			AuthenticationLevel: AuthenticationPktPrivacy,
+			Privileges:          []string{PrivilegeSecurity, "sedebugprivilege", "SeManageVolumePrivilege"},
+		},
+	}
+	for _, opts := range valid {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("Valid options %+v are invalid; %s", opts, err)
+		}
+	}
+
+	invalid := []SecurityOptions{
+		{ImpersonationLevel: 5},
+		{ImpersonationLevel: -1},
+		{AuthenticationLevel: 7},
+		{Privileges: []string{"SeSecurity"}},
+		{Privileges: []string{PrivilegeDebug, ""}},
+	}
+	for _, opts := range invalid {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Invalid options %+v are valid", opts)
+		}
+	}
+}
+
+func TestSecurityOptions_Merge(t *testing.T) {
+	var opts SecurityOptions
+	if !opts.isEmpty() {
+		t.Errorf("Zero options are not empty")
+	}
+	opts = opts.merge(SecurityOptions{
+		ImpersonationLevel: ImpersonationImpersonate,
+		Privileges:         []string{"sesecurityprivilege"},
+	})
+	opts = opts.merge(SecurityOptions{
+		AuthenticationLevel: AuthenticationPktPrivacy,
+		Privileges:          []string{PrivilegeSecurity, PrivilegeDebug},
+	})
+	expected := SecurityOptions{
+		ImpersonationLevel:  ImpersonationImpersonate,
+		AuthenticationLevel: AuthenticationPktPrivacy,
+		Privileges:          []string{PrivilegeSecurity, PrivilegeDebug},
+	}
+	if !reflect.DeepEqual(opts, expected) || opts.isEmpty() {
+		t.Errorf("Unexpected merge result %+v", opts)
+	}
+}
+
+func TestPrivilegeError(t *testing.T) {
+	err := error(&PrivilegeError{
+		Privileges: []string{PrivilegeSecurity, PrivilegeDebug},
+		Err:        &WbemError{HResult: ErrPrivilegeNotHeld.HResult, Operation: "SWbemServices ExecQuery"},
+	})
+	expected := "wmi: failed to enable privilege(s) SeSecurityPrivilege, SeDebugPrivilege; " +
+		"SWbemServices ExecQuery error; WBEM_E_PRIVILEGE_NOT_HELD (0x80041062): Operation failed because the client did not have the necessary security privilege"
+	if err.Error() != expected {
+		t.Errorf("Unexpected error text %q", err.Error())
+	}
+	var privErr *PrivilegeError
+	if !errors.Is(err, ErrPrivilegeNotHeld) || !errors.As(err, &privErr) {
+		t.Errorf("Error doesn't match")
+	}
+}
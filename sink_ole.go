@@ -0,0 +1,299 @@
+// +build windows
+
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/bi-zone/go-ole"
+	"github.com/bi-zone/go-ole/oleutil"
+	"github.com/hashicorp/go-multierror"
+)
+
+// iidSWbemSinkEvents is the ISWbemSinkEvents dispatch interface ID.
+var iidSWbemSinkEvents = ole.NewGUID("{75718CA0-F029-11D1-A1AC-00C04FB6C223}")
+
+// ISWbemSinkEvents dispatch IDs.
+const (
+	dispidOnObjectReady = 1
+	dispidOnCompleted   = 2
+)
+
+// querySink is the SWbemSink receiving the results of an asynchronous call.
+// Objects are delivered over `objects` one by one, the call result is sent
+// to `completed` after the last object.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemsink
+type querySink struct {
+	sink   *ole.IDispatch
+	point  *ole.IConnectionPoint
+	cookie uint32
+	events *sinkEvents
+}
+
+// newQuerySink creates the SWbemSink object and connects to its events.
+func newQuerySink() (_ *querySink, err error) {
+	unknown, err := oleutil.CreateObject("WbemScripting.SWbemSink")
+	if err != nil {
+		return nil, newWbemError("SWbemSink create", err)
+	}
+	defer unknown.Release()
+	sink, err := unknown.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return nil, newWbemError("SWbemSink QueryInterface", err)
+	}
+	defer func() {
+		if err != nil {
+			sink.Release()
+		}
+	}()
+
+	containerRaw, err := sink.QueryInterface(ole.IID_IConnectionPointContainer)
+	if err != nil {
+		return nil, newWbemError("SWbemSink QueryInterface", err)
+	}
+	container := (*ole.IConnectionPointContainer)(unsafe.Pointer(containerRaw))
+	defer container.Release()
+	var point *ole.IConnectionPoint
+	if err := container.FindConnectionPoint(iidSWbemSinkEvents, &point); err != nil {
+		return nil, newWbemError("SWbemSink FindConnectionPoint", err)
+	}
+
+	events := newSinkEvents()
+	cookie, err := point.Advise((*ole.IUnknown)(unsafe.Pointer(events)))
+	if err != nil {
+		events.release()
+		point.Release()
+		return nil, newWbemError("SWbemSink Advise", err)
+	}
+	return &querySink{sink: sink, point: point, cookie: cookie, events: events}, nil
+}
+
+// objects returns the channel of the objects received by the sink. The
+// receiver owns the objects and should release them.
+func (s *querySink) objects() <-chan *ole.IDispatch {
+	return s.events.objects
+}
+
+// completed returns the channel of the call result.
+func (s *querySink) completed() <-chan error {
+	return s.events.completed
+}
+
+// close cancels the call if it's not completed yet and disconnects from the
+// sink events.
+func (s *querySink) close() error {
+	// Unblock the events waiting for the receiver first.
+	s.events.stop()
+
+	var err error
+	select {
+	case <-s.events.completed:
+	default:
+		// Cancels all the calls of the sink, the same as
+		// IWbemServices::CancelAsyncCall.
+		if _, clErr := oleutil.CallMethod(s.sink, "Cancel"); clErr != nil {
+			err = multierror.Append(err, newWbemError("SWbemSink Cancel", clErr))
+		}
+	}
+	if clErr := s.point.Unadvise(s.cookie); clErr != nil {
+		err = multierror.Append(err, newWbemError("SWbemSink Unadvise", clErr))
+	}
+	s.point.Release()
+	s.sink.Release()
+	s.events.release()
+	return err
+}
+
+// sinkEvents implements ISWbemSinkEvents dispatch interface. COM calls it on
+// its own threads, the events are passed to the sink receiver over channels.
+type sinkEvents struct {
+	vtbl *sinkEventsVtbl // The first for COM.
+	ref  int32           // Accessed atomically.
+
+	objects   chan *ole.IDispatch
+	completed chan error
+	stopOnce  sync.Once
+	stopped   chan struct{}
+}
+
+type sinkEventsVtbl struct {
+	queryInterface   uintptr
+	addRef           uintptr
+	release          uintptr
+	getTypeInfoCount uintptr
+	getTypeInfo      uintptr
+	getIDsOfNames    uintptr
+	invoke           uintptr
+}
+
+var (
+	sinkEventsVtblOnce sync.Once
+	sinkEventsVtblPtr  *sinkEventsVtbl
+
+	// liveSinkEvents keeps the events referenced by COM from being collected.
+	liveSinkEvents sync.Map
+)
+
+// newSinkEvents returns the new events object with a single reference.
+func newSinkEvents() *sinkEvents {
+	// Callbacks are never freed, so they are created once.
+	sinkEventsVtblOnce.Do(func() {
+		sinkEventsVtblPtr = &sinkEventsVtbl{
+			queryInterface:   syscall.NewCallback(sinkEventsQueryInterface),
+			addRef:           syscall.NewCallback(sinkEventsAddRef),
+			release:          syscall.NewCallback(sinkEventsRelease),
+			getTypeInfoCount: syscall.NewCallback(sinkEventsGetTypeInfoCount),
+			getTypeInfo:      syscall.NewCallback(sinkEventsNotImplemented),
+			getIDsOfNames:    syscall.NewCallback(sinkEventsGetIDsOfNames),
+			invoke:           syscall.NewCallback(sinkEventsInvoke),
+		}
+	})
+	e := &sinkEvents{
+		vtbl:      sinkEventsVtblPtr,
+		objects:   make(chan *ole.IDispatch),
+		completed: make(chan error, 1),
+		stopped:   make(chan struct{}),
+	}
+	e.addRef()
+	return e
+}
+
+func (e *sinkEvents) addRef() int32 {
+	ref := atomic.AddInt32(&e.ref, 1)
+	if ref == 1 {
+		liveSinkEvents.Store(e, struct{}{})
+	}
+	return ref
+}
+
+func (e *sinkEvents) release() int32 {
+	ref := atomic.AddInt32(&e.ref, -1)
+	if ref == 0 {
+		liveSinkEvents.Delete(e)
+	}
+	return ref
+}
+
+// stop drops the objects received after it.
+func (e *sinkEvents) stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopped)
+	})
+}
+
+// objectReady passes the received object to the receiver blocking until it's
+// taken, so the objects are delivered before the completion.
+func (e *sinkEvents) objectReady(v *ole.VARIANT) {
+	obj := v.ToIDispatch()
+	if obj == nil {
+		return
+	}
+	obj.AddRef()
+	select {
+	case e.objects <- obj:
+	case <-e.stopped:
+		obj.Release()
+	}
+}
+
+// complete passes the call result @err to the receiver. Only the first
+// result is kept.
+func (e *sinkEvents) complete(err error) {
+	select {
+	case e.completed <- err:
+	default:
+	}
+}
+
+// dispParams is DISPPARAMS structure.
+type dispParams struct {
+	args      *ole.VARIANT
+	namedArgs *int32
+	argsNum   uint32
+	namedNum  uint32
+}
+
+// arg returns the @i-th argument of the call. The arguments are stored in
+// the reverse order.
+func (p *dispParams) arg(i int) *ole.VARIANT {
+	if p == nil || i >= int(p.argsNum) {
+		return nil
+	}
+	idx := uintptr(int(p.argsNum) - 1 - i)
+	return (*ole.VARIANT)(unsafe.Pointer(uintptr(unsafe.Pointer(p.args)) + idx*unsafe.Sizeof(ole.VARIANT{})))
+}
+
+func sinkEventsQueryInterface(this *sinkEvents, iid *ole.GUID, obj **sinkEvents) uintptr {
+	if !ole.IsEqualGUID(iid, ole.IID_IUnknown) && !ole.IsEqualGUID(iid, ole.IID_IDispatch) &&
+		!ole.IsEqualGUID(iid, iidSWbemSinkEvents) {
+		*obj = nil
+		return ole.E_NOINTERFACE
+	}
+	this.addRef()
+	*obj = this
+	return ole.S_OK
+}
+
+func sinkEventsAddRef(this *sinkEvents) uintptr {
+	return uintptr(this.addRef())
+}
+
+func sinkEventsRelease(this *sinkEvents) uintptr {
+	return uintptr(this.release())
+}
+
+func sinkEventsGetTypeInfoCount(_ *sinkEvents, count *uint32) uintptr {
+	*count = 0
+	return ole.S_OK
+}
+
+func sinkEventsNotImplemented(_ *sinkEvents, _, _, _ uintptr) uintptr {
+	return ole.E_NOTIMPL
+}
+
+func sinkEventsGetIDsOfNames(_ *sinkEvents, _ *ole.GUID, _, _, _, _ uintptr) uintptr {
+	return ole.E_NOTIMPL
+}
+
+func sinkEventsInvoke(
+	this *sinkEvents,
+	dispid uintptr,
+	_ *ole.GUID,
+	_, _ uintptr,
+	params *dispParams,
+	_ *ole.VARIANT,
+	_ *ole.EXCEPINFO,
+	_ *uint32,
+) (hr uintptr) {
+	// Panics can't cross the COM boundary.
+	defer func() {
+		if r := recover(); r != nil {
+			this.complete(fmt.Errorf("runtime panic; %v", r))
+			hr = ole.E_UNEXPECTED
+		}
+	}()
+	switch int32(dispid) {
+	case dispidOnObjectReady:
+		// OnObjectReady(objWbemObject, objWbemAsyncContext)
+		if v := params.arg(0); v != nil {
+			this.objectReady(v)
+		}
+	case dispidOnCompleted:
+		// OnCompleted(iHResult, objWbemErrorObject, objWbemAsyncContext)
+		v := params.arg(0)
+		if v == nil {
+			this.complete(errors.New("SWbemSink OnCompleted result is missing"))
+		} else if code := uint32(v.Val); code != 0 {
+			this.complete(newWbemError("SWbemServices ExecQueryAsync", ole.NewError(uintptr(code))))
+		} else {
+			this.complete(nil)
+		}
+	}
+	return ole.S_OK
+}
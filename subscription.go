@@ -0,0 +1,529 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultNotificationTimeout = time.Second
+	defaultErrorsBuffer        = 16
+)
+
+var (
+	// errNoEvents is returned by `eventSource.next` if there's no events in
+	// time.
+	errNoEvents = errors.New("wmi: no events")
+
+	// errSourceDone is returned by `eventSource.next` if the source has no
+	// more events, e.g. the replay is over. The subscription is done then.
+	errSourceDone = errors.New("wmi: no more events")
+)
+
+// SubscribeOptions are optional parameters of `Subscribe`. A nil
+// *SubscribeOptions means the defaults.
+type SubscribeOptions struct {
+	// PollTimeout is the longest time to wait for the next event in a single
+	// call. It's the time the subscription could take to react to the
+	// cancellation at the worst. Default is 1s, negative means infinite.
+	PollTimeout time.Duration
+
+	// ErrorsBuffer is the size of the `Subscription.Errors` channel buffer,
+	// default is 16. Errors are dropped if the buffer is full.
+	ErrorsBuffer int
+
+	// Resubscribe is an optional policy of reestablishing the subscription
+	// lost because of the disconnect, WMI service restart (see
+	// `IsSubscriptionLostError`) or the errors the policy considers retryable.
+	// The connection is reestablished and the query is executed anew waiting
+	// for the policy backoff before every attempt. `MaxAttempts` limits the
+	// number of consecutive failed attempts, zero means no limit.
+	// `RetryPolicy.Reconnect` is ignored.
+	//
+	// Events are lost while the subscription is being reestablished, so the
+	// `Gap` is reported after that.
+	Resubscribe *RetryPolicy
+
+	// Delivery is the policy of the events delivery to the slow consumer,
+	// default is `DeliveryBlock`. `DeliveryBatch` requires @eventCh to be a
+	// channel of slices.
+	Delivery DeliveryPolicy
+
+	// Recorder is an optional recorder of the raw events received (see
+	// `Replay`). Events are recorded before decoding, so the ones failed to
+	// be decoded are recorded as well.
+	Recorder *Recorder
+
+	// Filter is an optional policy of filtering, deduplication and sampling
+	// of the decoded events in Go before they are delivered.
+	Filter *FilterPolicy
+}
+
+func (o *SubscribeOptions) pollTimeout() time.Duration {
+	if o == nil || o.PollTimeout == 0 {
+		return defaultNotificationTimeout
+	}
+	return o.PollTimeout
+}
+
+func (o *SubscribeOptions) errorsBuffer() int {
+	if o == nil || o.ErrorsBuffer <= 0 {
+		return defaultErrorsBuffer
+	}
+	return o.ErrorsBuffer
+}
+
+// IsSubscriptionLostError reports whether @err means the events subscription
+// is lost and could be reestablished, e.g. because of the disconnect (see
+// `IsDisconnectError`) or WMI service shutdown.
+func IsSubscriptionLostError(err error) bool {
+	if IsDisconnectError(err) {
+		return true
+	}
+	for _, target := range []error{
+		ErrShuttingDown,
+		ErrCallCancelled,
+		ErrConnectionFailed,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscriptionState is the state of the subscription.
+type SubscriptionState int
+
+// Subscription states.
+const (
+	// SubscriptionConnecting means the subscription is being established.
+	SubscriptionConnecting SubscriptionState = iota
+	// SubscriptionActive means the events are being received.
+	SubscriptionActive
+	// SubscriptionResubscribing means the subscription has been lost and is
+	// being reestablished, so the events are missed.
+	SubscriptionResubscribing
+	// SubscriptionDone means the subscription is done.
+	SubscriptionDone
+)
+
+var subscriptionStateNames = map[SubscriptionState]string{
+	SubscriptionConnecting:    "connecting",
+	SubscriptionActive:        "active",
+	SubscriptionResubscribing: "resubscribing",
+	SubscriptionDone:          "done",
+}
+
+func (s SubscriptionState) String() string {
+	if name, ok := subscriptionStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("SubscriptionState(%d)", int(s))
+}
+
+// SubscriptionHealth describes the subscription health.
+type SubscriptionHealth struct {
+	State SubscriptionState
+	// Since is the time of the last State change.
+	Since time.Time
+	// Resubscriptions is the number of times the subscription has been
+	// reestablished.
+	Resubscriptions int
+	// LastError is the last error the subscription has been lost with or the
+	// last failed resubscription attempt error.
+	LastError error
+}
+
+// Gap is a period of time the subscription has been lost, so the events of
+// that period are missed.
+type Gap struct {
+	From time.Time
+	To   time.Time
+	// Err is the error the subscription has been lost with.
+	Err error
+}
+
+// eventSource is a source of the subscription events. It's used from the
+// single goroutine.
+type eventSource interface {
+	// next waits for the next event no longer than @timeout (infinitely if
+	// it's negative) and decodes it into @dst. Returns errNoEvents if there's
+	// no events in time. Decoding failures should be returned as
+	// `eventDecodeError`.
+	next(timeout time.Duration, dst interface{}) error
+	// close releases the source.
+	close() error
+}
+
+// eventDecodeError is a failure to decode a single event. Such failures don't
+// stop the subscription.
+type eventDecodeError struct {
+	err error
+}
+
+func (e eventDecodeError) Error() string {
+	return fmt.Sprintf("failed to unmarshal event; %s", e.err)
+}
+
+func (e eventDecodeError) Unwrap() error {
+	return e.err
+}
+
+// Subscription is a running event subscription. Events are delivered over the
+// channel given to `Subscribe` until the subscription context is done or the
+// subscription is closed. The subscription result is available with `Err`
+// after that.
+type Subscription struct {
+	// filtered is accessed atomically, so it's the first field to be 64-bit
+	// aligned.
+	filtered uint64
+
+	query       string
+	delivery    deliverer
+	elemType    reflect.Type
+	isPtr       bool
+	errors      chan error
+	done        chan struct{}
+	cancel      context.CancelFunc
+	pollTimeout func() time.Duration
+
+	// prepareEvent is an optional hook invoked on the new event pointer
+	// before decoding.
+	prepareEvent func(ev reflect.Value)
+
+	// failOnDecodeError stops the subscription on the first decode error
+	// instead of reporting it over `errors`.
+	failOnDecodeError bool
+
+	// reopen reestablishes the lost subscription according to the
+	// resubscribe policy (if both are set).
+	reopen      func() (eventSource, error)
+	resubscribe *RetryPolicy
+	gaps        chan Gap
+	recorder    *Recorder
+	filter      *eventFilter
+
+	observer Observer
+	info     CallInfo
+
+	mu     sync.Mutex
+	err    error
+	health SubscriptionHealth
+}
+
+// newSubscription creates a Subscription delivering events of the @query to
+// the @eventCh. Returns the subscription context which is cancelled by
+// `Subscription.Close`.
+func newSubscription(
+	ctx context.Context,
+	query string,
+	eventCh interface{},
+	opts *SubscribeOptions,
+) (*Subscription, context.Context, error) {
+	var policy DeliveryPolicy
+	if opts != nil {
+		policy = opts.Delivery
+	}
+	elemType, isPtr, err := policy.eventType(eventCh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var filter *eventFilter
+	if opts != nil {
+		if filter, err = newEventFilter(opts.Filter, elemType); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pollTimeout := opts.pollTimeout()
+	s := Subscription{
+		query:       query,
+		delivery:    newDeliverer(ctx, policy, reflect.ValueOf(eventCh)),
+		elemType:    elemType,
+		isPtr:       isPtr,
+		errors:      make(chan error, opts.errorsBuffer()),
+		done:        make(chan struct{}),
+		cancel:      cancel,
+		pollTimeout: func() time.Duration { return pollTimeout },
+		gaps:        make(chan Gap, 1),
+		filter:      filter,
+		info:        CallInfo{Context: ctx},
+	}
+	if opts != nil {
+		s.resubscribe = opts.Resubscribe
+		s.recorder = opts.Recorder
+	}
+	return &s, ctx, nil
+}
+
+// start runs the subscription in the background reading the events from the
+// @src. @release is invoked when the subscription is done.
+func (s *Subscription) start(ctx context.Context, src eventSource, release func() error) {
+	s.setState(SubscriptionActive, nil)
+	go func() {
+		defer s.cancel()
+		s.finish(s.run(ctx, src), release)
+	}()
+}
+
+// finish stops the delivery, invokes the @release and marks the subscription
+// done with the @err. It's also used for the subscriptions failed before
+// start to unblock their `Close`.
+func (s *Subscription) finish(err error, release func() error) {
+	s.delivery.stop()
+	if release != nil {
+		if clErr := release(); clErr != nil && err == nil {
+			err = clErr
+		}
+	}
+
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	s.setState(SubscriptionDone, nil)
+	close(s.errors)
+	close(s.gaps)
+	close(s.done)
+}
+
+// run receives the events from the @src and its replacements until the
+// subscription is done.
+func (s *Subscription) run(ctx context.Context, src eventSource) error {
+	for {
+		err := s.receive(ctx, src)
+		if clErr := src.close(); clErr != nil && err == nil {
+			err = clErr
+		}
+		if err == nil || ctx.Err() != nil || !s.canResubscribe(err) {
+			return err
+		}
+		if src, err = s.resubscribeSource(ctx, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Subscription) receive(ctx context.Context, src eventSource) error {
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		ev := reflect.New(s.elemType)
+		if s.prepareEvent != nil {
+			s.prepareEvent(ev)
+		}
+		err := src.next(s.pollTimeout(), ev.Interface())
+		var decodeErr eventDecodeError
+		switch {
+		case err == errNoEvents:
+			continue
+		case err == errSourceDone:
+			// Unlike cancellation the pending events are delivered.
+			if !s.delivery.flush(ctx) {
+				return ctx.Err()
+			}
+			return nil
+		case errors.As(err, &decodeErr) && !s.failOnDecodeError:
+			s.reportError(err)
+			continue
+		case err != nil:
+			return err
+		}
+		if s.filter != nil && !s.filter.accept(ev) {
+			atomic.AddUint64(&s.filtered, 1)
+			continue
+		}
+		if !s.isPtr {
+			ev = ev.Elem()
+		}
+
+		// Events dropped by the delivery policy are not counted.
+		done := observe(s.observer, s.info.withOp(OpEvent, s.query))
+		queued, ok := s.delivery.deliver(ctx, ev)
+		if !ok {
+			done(0, nil)
+			return ctx.Err()
+		}
+		if queued {
+			done(1, nil)
+		} else {
+			done(0, nil)
+		}
+	}
+}
+
+// canResubscribe reports whether the subscription lost with @err should be
+// reestablished.
+func (s *Subscription) canResubscribe(err error) bool {
+	if s.resubscribe == nil || s.reopen == nil {
+		return false
+	}
+	var decodeErr eventDecodeError
+	if errors.As(err, &decodeErr) {
+		return false
+	}
+	return IsSubscriptionLostError(err) || s.resubscribe.retryable(err)
+}
+
+// resubscribeSource reestablishes the subscription lost with @cause and
+// returns the new source of the events. Failed attempts are reported over the
+// errors channel.
+func (s *Subscription) resubscribeSource(ctx context.Context, cause error) (eventSource, error) {
+	clock := s.resubscribe.clock()
+	from := clock.Now()
+	s.setState(SubscriptionResubscribing, cause)
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-clock.After(s.resubscribe.Backoff(attempt)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		src, err := s.reopen()
+		if err == nil {
+			s.mu.Lock()
+			s.health.Resubscriptions++
+			s.mu.Unlock()
+			s.setState(SubscriptionActive, nil)
+			s.reportGap(Gap{From: from, To: clock.Now(), Err: cause})
+			return src, nil
+		}
+
+		err = fmt.Errorf("wmi: resubscription attempt %d failed; %w", attempt, err)
+		s.setState(SubscriptionResubscribing, err)
+		if !IsSubscriptionLostError(err) && !s.resubscribe.retryable(err) {
+			return nil, err
+		}
+		if s.resubscribe.MaxAttempts > 0 && attempt >= s.resubscribe.MaxAttempts {
+			return nil, err
+		}
+		s.reportError(err)
+	}
+}
+
+// setState updates the subscription health with the @state caused by @err
+// (if any).
+func (s *Subscription) setState(state SubscriptionState, err error) {
+	now := s.resubscribe.clock().Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.health.State != state || s.health.Since.IsZero() {
+		s.health.Since = now
+	}
+	s.health.State = state
+	if err != nil {
+		s.health.LastError = err
+	}
+}
+
+// reportGap sends the @gap to the gaps channel. The gap not read yet is merged
+// with the new one, so nobody is blocked on it.
+func (s *Subscription) reportGap(gap Gap) {
+	select {
+	case prev := <-s.gaps:
+		gap.From = prev.From
+	default:
+	}
+	s.gaps <- gap
+}
+
+// reportError sends the non-fatal @err to the errors channel dropping it if
+// the channel is full.
+func (s *Subscription) reportError(err error) {
+	select {
+	case s.errors <- err:
+	default:
+	}
+}
+
+// Query returns the subscription query.
+func (s *Subscription) Query() string {
+	return s.query
+}
+
+// Errors returns the channel of non-fatal subscription errors, e.g. failures
+// to decode a single event. Errors are dropped if the channel buffer is full,
+// so it's fine not to read it at all. The channel is closed when the
+// subscription is done.
+func (s *Subscription) Errors() <-chan error {
+	return s.errors
+}
+
+// Gaps returns the channel of the periods the events have been missed because
+// the subscription has been lost and reestablished (see
+// `SubscribeOptions.Resubscribe`). A gap is sent before the events of the
+// reestablished subscription. Only the latest gap is kept (the unread ones are
+// merged into it), so it's fine not to read it at all. The channel is closed
+// when the subscription is done.
+func (s *Subscription) Gaps() <-chan Gap {
+	return s.gaps
+}
+
+// Health returns the current subscription health.
+func (s *Subscription) Health() SubscriptionHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health
+}
+
+// Dropped returns the number of the events dropped by the delivery policy
+// (see `SubscribeOptions.Delivery`).
+func (s *Subscription) Dropped() uint64 {
+	return s.delivery.dropped()
+}
+
+// Filtered returns the number of the events rejected by the filter policy
+// (see `SubscribeOptions.Filter`).
+func (s *Subscription) Filtered() uint64 {
+	return atomic.LoadUint64(&s.filtered)
+}
+
+// Done returns the channel which is closed when the subscription is done.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the subscription error. It's nil until the subscription is
+// done, then it's `context.Canceled` (or `DeadlineExceeded`) if the
+// subscription has been cancelled or closed, or the error stopped the
+// subscription. It stays nil if the subscription is done because there are no
+// more events (see `Replay`).
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the subscription waiting until everything is released. Returns
+// the subscription error if it had been stopped by an error before.
+func (s *Subscription) Close() error {
+	s.cancel()
+	<-s.done
+	if err := s.Err(); !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
+
+func isChannelTypeOK(eventCh interface{}) bool {
+	chT := reflect.TypeOf(eventCh)
+	if chT.Kind() != reflect.Chan {
+		return false
+	}
+	elemT := chT.Elem()
+	switch elemT.Kind() {
+	case reflect.Struct:
+		return true
+	case reflect.Ptr:
+		return elemT.Elem().Kind() == reflect.Struct
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bi-zone/go-ole"
+	"github.com/bi-zone/go-ole/oleutil"
+	"github.com/hashicorp/go-multierror"
+	"github.com/jeffreystoke/comshim"
+)
+
+// Subscribe is a wrapper around DefaultClient.Subscribe.
+func Subscribe(
+	ctx context.Context,
+	query string,
+	eventCh interface{},
+	opts *SubscribeOptions,
+	connectServerArgs ...interface{},
+) (*Subscription, error) {
+	return DefaultClient.Subscribe(ctx, query, eventCh, opts, connectServerArgs...)
+}
+
+// Subscribe connects to the server defined by @connectServerArgs and
+// subscribes to the events of the @query the same way as
+// `SWbemServicesConnection.Subscribe` does. The connection is closed when the
+// subscription is done.
+func (c *Client) Subscribe(
+	ctx context.Context,
+	query string,
+	eventCh interface{},
+	opts *SubscribeOptions,
+	connectServerArgs ...interface{},
+) (*Subscription, error) {
+	sub, ctx, err := newSubscription(ctx, query, eventCh, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.startSubscription(ctx, sub, func(conn *SWbemServicesConnection) error {
+		return conn.subscribe(ctx, sub, conn.Close)
+	}, connectServerArgs...)
+}
+
+// startSubscription connects to the server defined by @connectServerArgs and
+// starts the @sub subscription with @start. @start should close the connection
+// when the subscription is done.
+func (c *Client) startSubscription(
+	ctx context.Context,
+	sub *Subscription,
+	start func(conn *SWbemServicesConnection) error,
+	connectServerArgs ...interface{},
+) (*Subscription, error) {
+	services, err := NewSWbemServices()
+	if err != nil {
+		sub.cancel()
+		return nil, err
+	}
+	services.Decoder = c.Decoder
+	services.Observer = withContext(ctx, c.observer())
+	conn, err := services.ConnectServer(connectServerArgs...)
+	if clErr := services.Close(); clErr != nil {
+		err = multierror.Append(err, clErr)
+	}
+	if err != nil {
+		sub.cancel()
+		return nil, err
+	}
+
+	if err := start(conn); err != nil {
+		sub.cancel()
+		return nil, multierror.Append(err, conn.Close())
+	}
+	return sub, nil
+}
+
+// Subscribe subscribes to the events of the notification @query and returns
+// once the subscription is established, e.g.
+//
+//	events := make(chan Win32_ProcessStartTrace)
+//	sub, err := conn.Subscribe(ctx, "SELECT * FROM Win32_ProcessStartTrace", events, nil)
+//	if err != nil {
+//		...
+//	}
+//	defer sub.Close()
+//	for {
+//		select {
+//		case e := <-events:
+//			...
+//		case err := <-sub.Errors():
+//			log.Printf("bad event; %s", err)
+//		case <-sub.Done():
+//			return sub.Err()
+//		}
+//	}
+//
+// @eventCh should be a channel of structures or structure pointers. Events are
+// decoded using the connection `Decoder`. Failures to decode an event don't
+// stop the subscription and are reported over `Subscription.Errors` channel.
+//
+// The subscription is stopped if the @ctx is done or `Subscription.Close` is
+// called. The connection should stay open until the subscription is done. If
+// the subscription is lost and `SubscribeOptions.Resubscribe` is set, the
+// connection is reestablished (see `SubscribeOptions`).
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wmisdk/swbemservices-execnotificationquery
+func (s *SWbemServicesConnection) Subscribe(
+	ctx context.Context,
+	query string,
+	eventCh interface{},
+	opts *SubscribeOptions,
+) (*Subscription, error) {
+	sub, ctx, err := newSubscription(ctx, query, eventCh, opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSubscription(ctx, sub)
+}
+
+// startSubscription starts the @sub subscription on the connection.
+func (s *SWbemServicesConnection) startSubscription(ctx context.Context, sub *Subscription) (*Subscription, error) {
+	if err := s.subscribe(ctx, sub, nil); err != nil {
+		sub.cancel()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// subscribe executes the @sub query and starts the subscription. @release is
+// invoked when the subscription is done.
+func (s *SWbemServicesConnection) subscribe(ctx context.Context, sub *Subscription, release func() error) error {
+	s.Lock()
+	if s.sWbemServices == nil {
+		s.Unlock()
+		return ErrConnectionClosed
+	}
+	s.Unlock()
+
+	sub.observer = withContext(ctx, MultiObserver(&s.stats, s.Observer))
+	sub.info = s.callInfo(OpEvent, sub.query)
+	src, err := s.execNotificationQuery(sub)
+	if err != nil {
+		return err
+	}
+	sub.reopen = func() (eventSource, error) {
+		if err := s.reconnect(); err != nil {
+			return nil, err
+		}
+		return s.execNotificationQuery(sub)
+	}
+	sub.start(ctx, src, release)
+	return nil
+}
+
+// notificationSource is an eventSource of the `SWbemEventSource` object.
+type notificationSource struct {
+	decoder     Decoder
+	eventSource *ole.IDispatch
+	observer    Observer
+	info        CallInfo
+	recorder    *Recorder
+}
+
+// execNotificationQuery executes the notification query of the @sub returning
+// the source of its events.
+func (s *SWbemServicesConnection) execNotificationQuery(sub *Subscription) (*notificationSource, error) {
+	services, err := s.acquireServices()
+	if err != nil {
+		return nil, err
+	}
+	defer services.Release()
+
+	// ExecNotificationQuery call must have that flags and no other.
+	info := s.callInfo(OpExecNotificationQuery, sub.query)
+	done := observe(sub.observer, info)
+	eventSourceRaw, err := oleutil.CallMethod(services, "ExecNotificationQuery",
+		sub.query, "WQL", wbemFlagReturnImmediately|wbemFlagForwardOnly)
+	err = newWbemError("SWbemServices ExecNotificationQuery", err)
+	done(0, err)
+	if err != nil {
+		return nil, err
+	}
+	comshim.Add(1) // Released by the source.
+	return &notificationSource{
+		decoder:     s.Decoder,
+		eventSource: eventSourceRaw.ToIDispatch(),
+		observer:    sub.observer,
+		info:        info,
+		recorder:    sub.recorder,
+	}, nil
+}
+
+func (src *notificationSource) next(timeout time.Duration, dst interface{}) error {
+	timeoutMs := int64(-1)
+	if timeout >= 0 {
+		timeoutMs = int64(timeout / time.Millisecond)
+	}
+	eventRaw, err := src.eventSource.CallMethod("NextEvent", timeoutMs)
+	if err != nil {
+		err = newWbemError("SWbemEventSource NextEvent", err)
+		if errors.Is(err, ErrRetryLater) {
+			return errNoEvents // Timeout.
+		}
+		return err
+	}
+	defer func() {
+		_ = eventRaw.Clear() // Nah. We can't handle it anyway.
+	}()
+	if src.recorder != nil {
+		src.recorder.recordDispatch(src.info.Query, eventRaw.ToIDispatch())
+	}
+
+	done := observe(src.observer, src.info.withOp(OpDecode, src.info.Query))
+	err = src.decoder.Unmarshal(eventRaw.ToIDispatch(), dst)
+	done(1, err)
+	if err != nil {
+		return eventDecodeError{err: err}
+	}
+	return nil
+}
+
+func (src *notificationSource) close() error {
+	src.eventSource.Release()
+	comshim.Done()
+	return nil
+}
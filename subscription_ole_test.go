@@ -0,0 +1,126 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const localTimeEventQuery = `SELECT * FROM __InstanceModificationEvent WHERE TargetInstance ISA 'Win32_LocalTime'`
+
+func TestSubscribe(t *testing.T) {
+	type event struct {
+		Created  uint64 `wmi:"TIME_CREATED"`
+		Instance struct {
+			Year uint32
+		} `wmi:"TargetInstance"`
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events := make(chan *event)
+	sub, err := Subscribe(ctx, localTimeEventQuery, events, &SubscribeOptions{PollTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Subscribe: %s", err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Created == 0 || e.Instance.Year != uint32(time.Now().Year()) {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	case <-sub.Done():
+		t.Fatalf("Subscription is done; %v", sub.Err())
+	}
+
+	if err := sub.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Errorf("Unexpected subscription error %v", sub.Err())
+	}
+	if stats := DefaultClient.Stats(); stats[OpEvent].Objects == 0 {
+		t.Errorf("Events aren't observed; %+v", stats)
+	}
+}
+
+func TestSWbemServicesConnection_Subscribe(t *testing.T) {
+	// A struct with incorrect fields that can't be unmarshaled.
+	type event struct {
+		StrangeField uint64 `wmi:"me_should_not_be_in_event"`
+	}
+
+	conn, err := ConnectSWbemServices()
+	if err != nil {
+		t.Fatalf("ConnectSWbemServices: %s", err)
+	}
+	defer conn.Close()
+
+	events := make(chan event)
+	sub, err := conn.Subscribe(context.Background(), localTimeEventQuery, events,
+		&SubscribeOptions{PollTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Subscribe: %s", err)
+	}
+
+	// Decoding errors don't stop the subscription.
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-sub.Errors():
+			if !errors.As(err, &ErrFieldMismatch{}) {
+				t.Errorf("Unexpected error %v", err)
+			}
+		case e := <-events:
+			t.Errorf("Unexpected event %+v", e)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("No errors reported")
+		}
+	}
+	if err := sub.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+
+	_, err = conn.Subscribe(context.Background(), "SELECT * FROM NoSuchEventClass", events, nil)
+	if err == nil {
+		t.Errorf("No error of invalid query")
+	}
+}
+
+func TestNotificationQuery_Health(t *testing.T) {
+	type event struct {
+		Created uint64 `wmi:"TIME_CREATED"`
+	}
+
+	events := make(chan event)
+	query, err := NewNotificationQuery(events, localTimeEventQuery)
+	if err != nil {
+		t.Fatalf("NewNotificationQuery: %s", err)
+	}
+	query.Resubscribe = DefaultRetryPolicy()
+	if h := query.Health(); h.State != SubscriptionConnecting {
+		t.Errorf("Unexpected health of not started query %+v", h)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- query.StartNotifications()
+	}()
+	<-events
+	if h := query.Health(); h.State != SubscriptionActive || h.Resubscriptions != 0 {
+		t.Errorf("Unexpected health of running query %+v", h)
+	}
+
+	query.Stop()
+	if err := <-errCh; err != nil {
+		t.Errorf("StartNotifications: %s", err)
+	}
+	if h := query.Health(); h.State != SubscriptionDone {
+		t.Errorf("Unexpected health of stopped query %+v", h)
+	}
+	if _, ok := <-query.Gaps(); ok {
+		t.Errorf("Unexpected gap")
+	}
+}
@@ -0,0 +1,370 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeEvent struct {
+	ID int
+}
+
+// fakeEventSource is an eventSource delivering the values sent to @events.
+// Errors are returned by `next` as is.
+type fakeEventSource struct {
+	events chan interface{}
+	closed int32
+}
+
+func newFakeEventSource() *fakeEventSource {
+	return &fakeEventSource{events: make(chan interface{})}
+}
+
+func (f *fakeEventSource) next(timeout time.Duration, dst interface{}) error {
+	var timer <-chan time.Time
+	if timeout >= 0 {
+		timer = time.After(timeout)
+	}
+	select {
+	case ev := <-f.events:
+		if err, ok := ev.(error); ok {
+			return err
+		}
+		reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(ev))
+		return nil
+	case <-timer:
+		return errNoEvents
+	}
+}
+
+func (f *fakeEventSource) close() error {
+	atomic.AddInt32(&f.closed, 1)
+	return nil
+}
+
+// startFakeSubscription starts the subscription reading events from the
+// fake source. Returns the counter of the subscription releases.
+func startFakeSubscription(
+	t *testing.T,
+	ctx context.Context,
+	eventCh interface{},
+	opts *SubscribeOptions,
+) (*Subscription, *fakeEventSource, *int32) {
+	sub, ctx, err := newSubscription(ctx, "SELECT * FROM fakeEvent", eventCh, opts)
+	if err != nil {
+		t.Fatalf("newSubscription: %s", err)
+	}
+	src := newFakeEventSource()
+	var released int32
+	sub.start(ctx, src, func() error {
+		atomic.AddInt32(&released, 1)
+		return nil
+	})
+	return sub, src, &released
+}
+
+func waitDone(t *testing.T, sub *Subscription) {
+	t.Helper()
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Subscription isn't done")
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	events := make(chan *fakeEvent)
+	sub, src, released := startFakeSubscription(t, context.Background(), events,
+		&SubscribeOptions{PollTimeout: 10 * time.Millisecond})
+
+	for i := 1; i <= 3; i++ {
+		src.events <- fakeEvent{ID: i}
+		if e := <-events; e.ID != i {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	}
+
+	// Decoding errors are reported, but don't stop the subscription.
+	decodeErr := eventDecodeError{err: ErrFieldMismatch{FieldName: "ID", Reason: "test"}}
+	src.events <- decodeErr
+	if err := <-sub.Errors(); !errors.As(err, &ErrFieldMismatch{}) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	src.events <- fakeEvent{ID: 4}
+	if e := <-events; e.ID != 4 {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	if sub.Err() != nil {
+		t.Errorf("Unexpected error of the running subscription; %s", sub.Err())
+	}
+	if err := sub.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Errorf("Unexpected error of the closed subscription; %v", sub.Err())
+	}
+	if _, ok := <-sub.Errors(); ok {
+		t.Errorf("Errors channel isn't closed")
+	}
+	if atomic.LoadInt32(&src.closed) != 1 || atomic.LoadInt32(released) != 1 {
+		t.Errorf("Subscription isn't released")
+	}
+}
+
+func TestSubscription_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan fakeEvent) // Nobody reads it.
+	rec := &recordingObserver{}
+	sub, src, _ := startFakeSubscription(t, ctx, events, nil)
+	sub.observer = rec
+
+	src.events <- fakeEvent{ID: 1}
+	cancel()
+	waitDone(t, sub)
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Errorf("Unexpected error %v", sub.Err())
+	}
+	if len(rec.done) != 1 || rec.done[0].Operation != OpEvent || rec.done[0].Objects != 0 {
+		t.Errorf("Unexpected observed calls %+v", rec.done)
+	}
+}
+
+func TestSubscription_Error(t *testing.T) {
+	events := make(chan fakeEvent, 1)
+	sub, src, released := startFakeSubscription(t, context.Background(), events, nil)
+
+	src.events <- fakeEvent{ID: 1}
+	src.events <- ErrTransportFailure
+	waitDone(t, sub)
+	if !errors.Is(sub.Err(), ErrTransportFailure) {
+		t.Errorf("Unexpected error %v", sub.Err())
+	}
+	if err := sub.Close(); !errors.Is(err, ErrTransportFailure) {
+		t.Errorf("Unexpected Close error %v", err)
+	}
+	if atomic.LoadInt32(released) != 1 {
+		t.Errorf("Subscription isn't released")
+	}
+	if e := <-events; e.ID != 1 {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestSubscription_FailOnDecodeError(t *testing.T) {
+	events := make(chan fakeEvent)
+	sub, ctx, err := newSubscription(context.Background(), "", events, nil)
+	if err != nil {
+		t.Fatalf("newSubscription: %s", err)
+	}
+	sub.failOnDecodeError = true
+	src := newFakeEventSource()
+	sub.start(ctx, src, nil)
+
+	src.events <- eventDecodeError{err: errors.New("bad event")}
+	waitDone(t, sub)
+	var decodeErr eventDecodeError
+	if !errors.As(sub.Err(), &decodeErr) {
+		t.Errorf("Unexpected error %v", sub.Err())
+	}
+}
+
+func TestSubscription_ErrorsDropped(t *testing.T) {
+	events := make(chan fakeEvent)
+	sub, src, _ := startFakeSubscription(t, context.Background(), events,
+		&SubscribeOptions{ErrorsBuffer: 1, PollTimeout: 10 * time.Millisecond})
+	defer sub.Close()
+
+	for i := 0; i < 3; i++ {
+		src.events <- eventDecodeError{err: errors.New("bad event")}
+	}
+	src.events <- fakeEvent{ID: 1}
+	<-events
+
+	if len(sub.Errors()) != 1 {
+		t.Errorf("Unexpected number of errors %d", len(sub.Errors()))
+	}
+}
+
+func TestNewSubscription(t *testing.T) {
+	for _, eventCh := range []interface{}{nil, 1, make(chan int), make(chan *int), []fakeEvent{}} {
+		if _, _, err := newSubscription(context.Background(), "", eventCh, nil); err == nil {
+			t.Errorf("No error for %T", eventCh)
+		}
+	}
+}
+
+// fakeReopen returns the sources and errors from @results one by one.
+func fakeReopen(results ...interface{}) func() (eventSource, error) {
+	return func() (eventSource, error) {
+		res := results[0]
+		results = results[1:]
+		if err, ok := res.(error); ok {
+			return nil, err
+		}
+		return res.(eventSource), nil
+	}
+}
+
+func TestSubscription_Resubscribe(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	policy := &RetryPolicy{InitialBackoff: time.Second, Clock: clock}
+	events := make(chan fakeEvent)
+	sub, ctx, err := newSubscription(context.Background(), "", events, &SubscribeOptions{Resubscribe: policy, PollTimeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("newSubscription: %s", err)
+	}
+	src1, src2 := newFakeEventSource(), newFakeEventSource()
+	sub.reopen = fakeReopen(ErrRPCServerUnavailable, src2)
+	sub.start(ctx, src1, nil)
+	defer sub.Close()
+	if h := sub.Health(); h.State != SubscriptionActive || !h.Since.Equal(clock.now) {
+		t.Errorf("Unexpected health %+v", h)
+	}
+
+	src1.events <- fakeEvent{ID: 1}
+	<-events
+	src1.events <- ErrRPCDisconnected
+
+	// The failed attempt is reported.
+	if err := <-sub.Errors(); !errors.Is(err, ErrRPCServerUnavailable) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	src2.events <- fakeEvent{ID: 2}
+	if e := <-events; e.ID != 2 {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	gap := <-sub.Gaps()
+	if !errors.Is(gap.Err, ErrRPCDisconnected) || gap.To.Sub(gap.From) != 3*time.Second {
+		t.Errorf("Unexpected gap %+v", gap)
+	}
+	if !reflect.DeepEqual(clock.delays, []time.Duration{time.Second, 2 * time.Second}) {
+		t.Errorf("Unexpected delays %v", clock.delays)
+	}
+	h := sub.Health()
+	if h.State != SubscriptionActive || h.Resubscriptions != 1 || !h.Since.Equal(gap.To) ||
+		!errors.Is(h.LastError, ErrRPCServerUnavailable) {
+		t.Errorf("Unexpected health %+v", h)
+	}
+	if atomic.LoadInt32(&src1.closed) != 1 || atomic.LoadInt32(&src2.closed) != 0 {
+		t.Errorf("Unexpected sources closed")
+	}
+}
+
+func TestSubscription_ResubscribeFailed(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		lostErr error
+		results []interface{}
+		err     error
+	}{
+		{
+			name:    "not retryable",
+			lostErr: ErrShuttingDown,
+			results: []interface{}{ErrRPCServerUnavailable, ErrAccessDenied},
+			err:     ErrAccessDenied,
+		},
+		{
+			name:    "max attempts",
+			policy:  RetryPolicy{MaxAttempts: 2},
+			lostErr: ErrRPCCallFailed,
+			results: []interface{}{ErrServerTooBusy, ErrRPCServerUnavailable},
+			err:     ErrRPCServerUnavailable,
+		},
+		{
+			name:    "not lost",
+			lostErr: ErrInvalidQuery,
+			err:     ErrInvalidQuery,
+		},
+		{
+			name:    "decoding",
+			lostErr: eventDecodeError{err: ErrRPCDisconnected},
+			err:     ErrRPCDisconnected,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := test.policy
+			policy.Clock = &fakeClock{}
+			events := make(chan fakeEvent)
+			sub, ctx, err := newSubscription(context.Background(), "", events,
+				&SubscribeOptions{Resubscribe: &policy})
+			if err != nil {
+				t.Fatalf("newSubscription: %s", err)
+			}
+			sub.failOnDecodeError = true
+			sub.reopen = fakeReopen(test.results...)
+			src := newFakeEventSource()
+			sub.start(ctx, src, nil)
+
+			src.events <- test.lostErr
+			waitDone(t, sub)
+			if !errors.Is(sub.Err(), test.err) {
+				t.Errorf("Unexpected error %v", sub.Err())
+			}
+			if h := sub.Health(); h.State != SubscriptionDone {
+				t.Errorf("Unexpected health %+v", h)
+			}
+			if _, ok := <-sub.Gaps(); ok {
+				t.Errorf("Unexpected gap")
+			}
+		})
+	}
+}
+
+func TestSubscription_ResubscribeCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan fakeEvent)
+	policy := &RetryPolicy{InitialBackoff: time.Hour}
+	sub, ctx, err := newSubscription(ctx, "", events, &SubscribeOptions{Resubscribe: policy, PollTimeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("newSubscription: %s", err)
+	}
+	sub.reopen = fakeReopen(newFakeEventSource())
+	src := newFakeEventSource()
+	sub.start(ctx, src, nil)
+
+	src.events <- ErrRPCDisconnected
+	for sub.Health().State != SubscriptionResubscribing {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	waitDone(t, sub)
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Errorf("Unexpected error %v", sub.Err())
+	}
+}
+
+func TestSubscription_ReportGap(t *testing.T) {
+	sub, _, err := newSubscription(context.Background(), "", make(chan fakeEvent), nil)
+	if err != nil {
+		t.Fatalf("newSubscription: %s", err)
+	}
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sub.reportGap(Gap{From: t0, To: t0.Add(time.Second), Err: ErrRPCDisconnected})
+	sub.reportGap(Gap{From: t0.Add(time.Minute), To: t0.Add(2 * time.Minute), Err: ErrShuttingDown})
+	gap := <-sub.Gaps()
+	if !gap.From.Equal(t0) || !gap.To.Equal(t0.Add(2*time.Minute)) || gap.Err != ErrShuttingDown {
+		t.Errorf("Unexpected merged gap %+v", gap)
+	}
+}
+
+func TestIsSubscriptionLostError(t *testing.T) {
+	for _, err := range []error{ErrRPCDisconnected, ErrShuttingDown, ErrCallCancelled, ErrConnectionFailed} {
+		if !IsSubscriptionLostError(fmt.Errorf("wrapped; %w", err)) {
+			t.Errorf("%v isn't a lost subscription error", err)
+		}
+	}
+	for _, err := range []error{nil, ErrInvalidQuery, ErrAccessDenied, errNoEvents} {
+		if IsSubscriptionLostError(err) {
+			t.Errorf("%v is a lost subscription error", err)
+		}
+	}
+}
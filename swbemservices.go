@@ -21,6 +21,10 @@ type SWbemServices struct {
 	sync.Mutex
 	Decoder
 
+	// Observer is an optional observer of the connect calls. It's passed to
+	// the connections created.
+	Observer Observer
+
 	sWbemLocator *ole.IDispatch
 }
 
@@ -42,7 +46,7 @@ func NewSWbemServices() (s *SWbemServices, err error) {
 
 	locatorIUnknown, err := oleutil.CreateObject("WbemScripting.SWbemLocator")
 	if err != nil {
-		return nil, fmt.Errorf("CreateObject SWbemLocator error; %v", err)
+		return nil, newWbemError("CreateObject SWbemLocator", err)
 	} else if locatorIUnknown == nil {
 		return nil, ErrNilCreateObject
 	}
@@ -50,7 +54,7 @@ func NewSWbemServices() (s *SWbemServices, err error) {
 
 	sWbemLocator, err := locatorIUnknown.QueryInterface(ole.IID_IDispatch)
 	if err != nil {
-		return nil, fmt.Errorf("SWbemLocator QueryInterface error; %v", err)
+		return nil, newWbemError("SWbemLocator QueryInterface", err)
 	}
 
 	res := SWbemServices{
@@ -94,6 +98,18 @@ func (s *SWbemServices) Close() error {
 //
 // Ref: https://docs.microsoft.com/en-us/windows/desktop/wmisdk/swbemlocator-connectserver
 func (s *SWbemServices) Query(query string, dst interface{}, connectServerArgs ...interface{}) (err error) {
+	return s.query(s.Decoder, s.Observer, query, dst, connectServerArgs...)
+}
+
+// query is like Query but uses the @decoder and @observer instead of the
+// SWbemServices ones, so the concurrent calls don't interfere.
+func (s *SWbemServices) query(
+	decoder Decoder,
+	observer Observer,
+	query string,
+	dst interface{},
+	connectServerArgs ...interface{},
+) (err error) {
 	s.Lock()
 	if s.sWbemLocator == nil {
 		s.Unlock()
@@ -101,7 +117,7 @@ func (s *SWbemServices) Query(query string, dst interface{}, connectServerArgs .
 	}
 	s.Unlock()
 
-	connection, err := s.ConnectServer(connectServerArgs...)
+	connection, err := s.connectServer(decoder, observer, connectServerArgs...)
 	if err != nil {
 		return err
 	}
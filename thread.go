@@ -0,0 +1,88 @@
+package wmi
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ErrExecutorClosed is returned for calls made to the closed `Executor`.
+var ErrExecutorClosed = errors.New("wmi: executor has been closed")
+
+// lockedThread runs functions one by one on a single goroutine locked to its
+// OS thread.
+type lockedThread struct {
+	requests chan func()
+	done     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// startThread starts a new locked thread and runs @init on it. If @init
+// fails, the thread is stopped and the error is returned. @uninit is called
+// on the thread when it's stopped (if @init succeeded).
+func startThread(init func() error, uninit func()) (*lockedThread, error) {
+	t := &lockedThread{
+		requests: make(chan func()),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	initErr := make(chan error, 1)
+	go func() {
+		defer close(t.stopped)
+
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		if err := init(); err != nil {
+			initErr <- err
+			return
+		}
+		defer uninit()
+		initErr <- nil
+
+		for {
+			select {
+			case f := <-t.requests:
+				f()
+			case <-t.done:
+				return
+			}
+		}
+	}()
+	if err := <-initErr; err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// run runs @f on the thread and waits for the result. Requests are served in
+// the order they are made. Panics of @f are returned as errors.
+func (t *lockedThread) run(f func() error) error {
+	result := make(chan error, 1)
+	request := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("runtime panic; %v", r)
+			}
+		}()
+		result <- f()
+	}
+	select {
+	case t.requests <- request:
+		return <-result
+	case <-t.done:
+		return ErrExecutorClosed
+	}
+}
+
+// stop stops the thread after the current request is done and waits until
+// the thread uninitialization is finished. Pending requests fail with
+// `ErrExecutorClosed`.
+func (t *lockedThread) stop() {
+	t.stopOnce.Do(func() {
+		close(t.done)
+	})
+	<-t.stopped
+}
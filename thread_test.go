@@ -0,0 +1,72 @@
+package wmi
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestLockedThread(t *testing.T) {
+	var events []string
+	thread, err := startThread(func() error {
+		events = append(events, "init")
+		return nil
+	}, func() {
+		events = append(events, "uninit")
+	})
+	if err != nil {
+		t.Fatalf("Failed to start; %s", err)
+	}
+
+	// Concurrent requests are serialized, so no sync is needed inside them.
+	counter := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = thread.run(func() error {
+				counter++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if counter != 100 {
+		t.Errorf("Unexpected counter %d", counter)
+	}
+
+	callErr := errors.New("call failed")
+	if err := thread.run(func() error { return callErr }); err != callErr {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := thread.run(func() error { panic("oops") }); err == nil || err.Error() != "runtime panic; oops" {
+		t.Errorf("Unexpected panic error %v", err)
+	}
+	if err := thread.run(func() error { return nil }); err != nil {
+		t.Errorf("Thread is broken after panic; %v", err)
+	}
+
+	thread.stop()
+	thread.stop()
+	if err := thread.run(func() error { return nil }); err != ErrExecutorClosed {
+		t.Errorf("Unexpected error of stopped thread %v", err)
+	}
+	if !reflect.DeepEqual(events, []string{"init", "uninit"}) {
+		t.Errorf("Unexpected events %v", events)
+	}
+}
+
+func TestLockedThread_InitError(t *testing.T) {
+	initErr := errors.New("init failed")
+	uninitCalled := false
+	_, err := startThread(func() error {
+		return initErr
+	}, func() {
+		uninitCalled = true
+	})
+	if err != initErr || uninitCalled {
+		t.Errorf("Unexpected result of failed init; %v, uninit called: %v", err, uninitCalled)
+	}
+}
@@ -0,0 +1,283 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const defaultWatchInterval = 10 * time.Second
+
+// relPathProperty is the name of the system property of the instance relative
+// path.
+const relPathProperty = "__RELPATH"
+
+// WatchOptions are optional parameters of `Watch`. A nil *WatchOptions means
+// the defaults.
+type WatchOptions struct {
+	// SubscribeOptions are the options of the watch subscription. The
+	// polling interval is checked every `PollTimeout`, so it's the time the
+	// watch could take to react to the cancellation at the worst.
+	SubscribeOptions
+
+	// Interval is the interval between the queries, default is 10s.
+	Interval time.Duration
+
+	// Keys are the names of the properties identifying the instance. If
+	// empty, the class key properties are used if all of them are mapped to
+	// the structure fields, otherwise the structure should have a field of
+	// `__RELPATH` property.
+	Keys []string
+
+	// Clock is used to wait for the next query and to timestamp the events.
+	// If nil, the system clock is used.
+	Clock Clock
+}
+
+func (o *WatchOptions) subscribeOptions() *SubscribeOptions {
+	if o == nil {
+		return nil
+	}
+	return &o.SubscribeOptions
+}
+
+func (o *WatchOptions) interval() time.Duration {
+	if o == nil || o.Interval <= 0 {
+		return defaultWatchInterval
+	}
+	return o.Interval
+}
+
+func (o *WatchOptions) clock() Clock {
+	if o == nil || o.Clock == nil {
+		return systemClock{}
+	}
+	return o.Clock
+}
+
+// pollingSource is an eventSource of the instance changes found by the
+// periodical queries.
+type pollingSource struct {
+	// query runs the query appending the results to @dst.
+	query     func(dst interface{}) error
+	sliceType reflect.Type
+	keys      []string // Key properties from the options.
+	key       func(v reflect.Value) string
+	interval  time.Duration
+	clock     Clock
+
+	polled   bool
+	nextPoll time.Time
+	order    []string // Keys of the previous result in the query order.
+	prev     map[string]reflect.Value
+	pending  []InstanceEvent
+}
+
+// resolveKey sets the function building the instance key. `WatchOptions.Keys`
+// are preferred, then @classKeys if all of them are mapped to the structure
+// fields, then `__RELPATH`.
+func (src *pollingSource) resolveKey(classKeys []string) error {
+	t := src.sliceType.Elem()
+	keys := src.keys
+	if len(keys) == 0 && hasFields(t, classKeys) {
+		keys = classKeys
+	}
+	key, err := instanceKeyFunc(t, keys)
+	if err != nil {
+		return err
+	}
+	src.key = key
+	return nil
+}
+
+// next returns the next change. Instances are queried when there are no
+// pending changes and the interval has passed since the previous query. The
+// first query result is the baseline and doesn't produce changes.
+func (src *pollingSource) next(timeout time.Duration, dst interface{}) error {
+	for len(src.pending) == 0 {
+		if src.polled {
+			wait := src.nextPoll.Sub(src.clock.Now())
+			if timeout >= 0 && timeout < wait {
+				<-src.clock.After(timeout)
+				return errNoEvents
+			}
+			if wait > 0 {
+				<-src.clock.After(wait)
+			}
+		}
+		if err := src.poll(); err != nil {
+			return err
+		}
+	}
+	*dst.(*InstanceEvent) = src.pending[0]
+	src.pending = src.pending[1:]
+	return nil
+}
+
+// poll runs the query and finds the changes since the previous one.
+func (src *pollingSource) poll() error {
+	now := src.clock.Now()
+	src.nextPoll = now.Add(src.interval)
+	res := reflect.New(src.sliceType)
+	if err := src.query(res.Interface()); err != nil {
+		return err
+	}
+	res = res.Elem()
+
+	cur := make(map[string]reflect.Value, res.Len())
+	order := make([]string, 0, res.Len())
+	for i := 0; i < res.Len(); i++ {
+		v := res.Index(i)
+		k := src.key(v)
+		if _, ok := cur[k]; ok {
+			continue // Keep the first one.
+		}
+		cur[k] = v
+		order = append(order, k)
+	}
+
+	if src.polled {
+		src.pending = diffInstances(now, src.order, src.prev, order, cur)
+	}
+	src.polled = true
+	src.order, src.prev = order, cur
+	return nil
+}
+
+// diffInstances returns the events of the changes between the previous and
+// the current instances keyed in the @prevKeys and @curKeys order. Created and
+// modified instances are reported in the current order, then the deleted
+// ones.
+func diffInstances(
+	now time.Time,
+	prevKeys []string,
+	prev map[string]reflect.Value,
+	curKeys []string,
+	cur map[string]reflect.Value,
+) []InstanceEvent {
+	var events []InstanceEvent
+	for _, k := range curKeys {
+		v := cur[k]
+		p, ok := prev[k]
+		switch {
+		case !ok:
+			events = append(events, InstanceEvent{Kind: InstanceCreated, Time: now, Target: addressable(v)})
+		case len(changedProperties(p.Interface(), v.Interface())) > 0:
+			events = append(events, InstanceEvent{
+				Kind:     InstanceModified,
+				Time:     now,
+				Target:   addressable(v),
+				Previous: addressable(p),
+			})
+		}
+	}
+	for _, k := range prevKeys {
+		if _, ok := cur[k]; !ok {
+			events = append(events, InstanceEvent{Kind: InstanceDeleted, Time: now, Target: addressable(prev[k])})
+		}
+	}
+	return events
+}
+
+// addressable returns the pointer to the copy of the structure value @v.
+func addressable(v reflect.Value) interface{} {
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface()
+}
+
+func (src *pollingSource) close() error {
+	return nil
+}
+
+// nilKeyValue is the key part of the unset (nil pointer) key property.
+const nilKeyValue = "<nil>"
+
+// instanceKeyFunc returns the function building the key of the structure
+// @t instance from the @keys properties. If @keys is empty, `__RELPATH`
+// property is used. Unset key properties are encoded as `<nil>`.
+func instanceKeyFunc(t reflect.Type, keys []string) (func(v reflect.Value) string, error) {
+	fields := make(map[string][]int)
+	for _, f := range structFields(t) {
+		fields[strings.ToLower(f.Name)] = f.Index
+	}
+	if len(keys) == 0 {
+		keys = []string{relPathProperty}
+	}
+
+	indexes := make([][]int, 0, len(keys))
+	for _, key := range keys {
+		index, ok := fields[strings.ToLower(key)]
+		if !ok {
+			return nil, fmt.Errorf("wmi: key property %q isn't mapped to the %s field", key, t)
+		}
+		indexes = append(indexes, index)
+	}
+	return func(v reflect.Value) string {
+		values := make([]string, len(indexes))
+		for i, index := range indexes {
+			if f := indirectValue(v.FieldByIndex(index)); f.IsValid() {
+				values[i] = fmt.Sprint(f.Interface())
+			} else {
+				values[i] = nilKeyValue
+			}
+		}
+		return strings.Join(values, ",")
+	}, nil
+}
+
+// hasFields reports whether all the @names properties are mapped to the
+// structure @t fields.
+func hasFields(t reflect.Type, names []string) bool {
+	fields := make(map[string]bool)
+	for _, f := range structFields(t) {
+		fields[strings.ToLower(f.Name)] = true
+	}
+	for _, name := range names {
+		if !fields[strings.ToLower(name)] {
+			return false
+		}
+	}
+	return len(names) > 0
+}
+
+// newWatchSubscription creates the subscription to the changes of the @src
+// class instances returned by the @query. The source query function should be
+// set by the caller, as well as the key function unless `WatchOptions.Keys`
+// are set.
+func newWatchSubscription(
+	ctx context.Context,
+	query string,
+	src interface{},
+	eventCh interface{},
+	opts *WatchOptions,
+) (*Subscription, *pollingSource, context.Context, error) {
+	t := structType(src)
+	if t.Kind() != reflect.Struct {
+		return nil, nil, nil, ErrInvalidEntityType
+	}
+	source := pollingSource{
+		sliceType: reflect.SliceOf(t),
+		interval:  opts.interval(),
+		clock:     opts.clock(),
+	}
+	if opts != nil && len(opts.Keys) > 0 {
+		source.keys = opts.Keys
+		if err := source.resolveKey(nil); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	sub, ctx, err := newSubscription(ctx, query, eventCh, opts.subscribeOptions())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if sub.elemType != instanceEventType {
+		sub.cancel()
+		return nil, nil, nil, errors.New("eventCh has incorrect type; should be `chan InstanceEvent` or `chan *InstanceEvent`")
+	}
+	return sub, &source, ctx, nil
+}
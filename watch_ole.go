@@ -0,0 +1,118 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+)
+
+// Watch is a wrapper around DefaultClient.Watch.
+func Watch(
+	ctx context.Context,
+	query string,
+	src interface{},
+	eventCh interface{},
+	opts *WatchOptions,
+	connectServerArgs ...interface{},
+) (*Subscription, error) {
+	return DefaultClient.Watch(ctx, query, src, eventCh, opts, connectServerArgs...)
+}
+
+// Watch connects to the server defined by @connectServerArgs and watches the
+// changes of the @query results the same way as `SWbemServicesConnection.Watch`
+// does. The connection is closed when the watch is done.
+func (c *Client) Watch(
+	ctx context.Context,
+	query string,
+	src interface{},
+	eventCh interface{},
+	opts *WatchOptions,
+	connectServerArgs ...interface{},
+) (*Subscription, error) {
+	sub, source, ctx, err := newWatchSubscription(ctx, query, src, eventCh, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.startSubscription(ctx, sub, func(conn *SWbemServicesConnection) error {
+		return conn.watch(ctx, sub, source, conn.Close)
+	}, connectServerArgs...)
+}
+
+// Watch periodically runs the data @query and reports the changes of its
+// results as the intrinsic instance events. It's a fallback for the classes
+// without event providers or when `WITHIN` polling of `SubscribeInstanceEvents`
+// is too expensive, e.g.
+//
+//	events := make(chan wmi.InstanceEvent)
+//	var dst []Win32_Service
+//	query := wmi.CreateQuery(&dst, "")
+//	sub, err := conn.Watch(ctx, query, dst, events, &wmi.WatchOptions{Interval: time.Minute})
+//	...
+//	defer sub.Close()
+//	for {
+//		select {
+//		case e := <-events:
+//			service := e.Target.(*Win32_Service)
+//			log.Printf("%s %s %v", service.Name, e.Kind, e.ChangedProperties())
+//		case <-sub.Done():
+//			return sub.Err()
+//		}
+//	}
+//
+// @src could be T, *T, []T or *[]T, the query results are decoded into T.
+// Instances are identified by `WatchOptions.Keys`, the key properties of the
+// class with T structure name or `__RELPATH` property (see `WatchOptions`).
+// @eventCh should be a channel of `InstanceEvent` or `*InstanceEvent`.
+//
+// The query is run once before the call returns to get the baseline, the
+// instances existing at that time are not reported. Query failures stop the
+// watch unless `SubscribeOptions.Resubscribe` policy reestablishes it, the
+// baseline is kept in that case.
+func (s *SWbemServicesConnection) Watch(
+	ctx context.Context,
+	query string,
+	src interface{},
+	eventCh interface{},
+	opts *WatchOptions,
+) (*Subscription, error) {
+	sub, source, ctx, err := newWatchSubscription(ctx, query, src, eventCh, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.watch(ctx, sub, source, nil); err != nil {
+		sub.cancel()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// watch runs the baseline query of the @source and starts the @sub
+// subscription. @release is invoked when the subscription is done.
+func (s *SWbemServicesConnection) watch(ctx context.Context, sub *Subscription, source *pollingSource, release func() error) error {
+	if source.key == nil {
+		var classKeys []string
+		if class, err := s.GetClassDefinition(source.sliceType.Elem().Name(), false); err == nil {
+			classKeys = class.Keys()
+		}
+		if err := source.resolveKey(classKeys); err != nil {
+			return err
+		}
+	}
+
+	sub.observer = withContext(ctx, MultiObserver(&s.stats, s.Observer))
+	sub.info = s.callInfo(OpEvent, sub.query)
+	source.query = func(dst interface{}) error {
+		return s.Query(sub.query, dst)
+	}
+	if err := source.poll(); err != nil {
+		return err
+	}
+	sub.reopen = func() (eventSource, error) {
+		if err := s.reconnect(); err != nil {
+			return nil, err
+		}
+		return source, nil
+	}
+	sub.start(ctx, source, release)
+	return nil
+}
@@ -0,0 +1,41 @@
+// +build windows
+
+package wmi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	type Win32_LocalTime struct {
+		RelPath string `wmi:"__RELPATH"`
+		Second  uint32
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events := make(chan *InstanceEvent)
+	var dst []Win32_LocalTime
+	sub, err := Watch(ctx, CreateQuery(&dst, ""), dst, events, &WatchOptions{
+		SubscribeOptions: SubscribeOptions{PollTimeout: 100 * time.Millisecond},
+		Interval:         500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+	defer sub.Close()
+
+	select {
+	case e := <-events:
+		if e.Kind != InstanceModified {
+			t.Errorf("Unexpected event %+v", e)
+		}
+		if changed := e.ChangedProperties(); len(changed) != 1 || changed[0] != "Second" {
+			t.Errorf("Unexpected changed properties %v", changed)
+		}
+	case <-sub.Done():
+		t.Fatalf("Watch is done; %v", sub.Err())
+	}
+}
@@ -0,0 +1,199 @@
+package wmi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeQuery returns the query function returning @results one by one, the last
+// one is repeated.
+func fakeQuery(results ...interface{}) func(dst interface{}) error {
+	return func(dst interface{}) error {
+		res := results[0]
+		if len(results) > 1 {
+			results = results[1:]
+		}
+		if err, ok := res.(error); ok {
+			return err
+		}
+		v := reflect.ValueOf(dst).Elem()
+		v.Set(reflect.AppendSlice(v, reflect.ValueOf(res)))
+		return nil
+	}
+}
+
+func startFakeWatch(t *testing.T, opts *WatchOptions, results ...interface{}) (*Subscription, chan InstanceEvent) {
+	return startFakeWatchOf(t, Win32_Service{}, opts, results...)
+}
+
+// startFakeWatchOf starts the watch of the @src structure instances returned
+// by the fake query.
+func startFakeWatchOf(t *testing.T, src interface{}, opts *WatchOptions, results ...interface{}) (*Subscription, chan InstanceEvent) {
+	events := make(chan InstanceEvent)
+	sub, source, ctx, err := newWatchSubscription(context.Background(), "SELECT * FROM Win32_Service",
+		src, events, opts)
+	if err != nil {
+		t.Fatalf("newWatchSubscription: %s", err)
+	}
+	source.query = fakeQuery(results...)
+	if source.key == nil {
+		if err := source.resolveKey(nil); err != nil {
+			t.Fatalf("resolveKey: %s", err)
+		}
+	}
+	if err := source.poll(); err != nil {
+		t.Fatalf("poll: %s", err)
+	}
+	sub.start(ctx, source, nil)
+	return sub, events
+}
+
+func TestPollingSource(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	sub, events := startFakeWatch(t, &WatchOptions{
+		SubscribeOptions: SubscribeOptions{PollTimeout: time.Second},
+		Interval:         10 * time.Second,
+		Keys:             []string{"Name"},
+		Clock:            clock,
+	},
+		[]Win32_Service{{Name: "a", State: "Stopped"}, {Name: "b", State: "Running"}},
+		[]Win32_Service{{Name: "c", State: "Running"}, {Name: "a", State: "Running", Started: true}},
+	)
+	defer sub.Close()
+
+	expected := []struct {
+		kind     InstanceEventKind
+		name     string
+		previous string
+		changed  []string
+	}{
+		{InstanceCreated, "c", "", []string{"Name", "State", "Started", "StartTime"}},
+		{InstanceModified, "a", "Stopped", []string{"State", "Started"}},
+		{InstanceDeleted, "b", "", []string{"Name", "State", "Started", "StartTime"}},
+	}
+	for _, exp := range expected {
+		e := <-events
+		if e.Kind != exp.kind || e.Target.(*Win32_Service).Name != exp.name || !e.Time.Equal(start.Add(10*time.Second)) {
+			t.Errorf("Unexpected event %+v; expected %s of %q", e, exp.kind, exp.name)
+		}
+		if prev, _ := e.Previous.(*Win32_Service); (prev == nil) != (exp.previous == "") ||
+			prev != nil && prev.State != exp.previous {
+			t.Errorf("Unexpected previous instance %+v", e.Previous)
+		}
+		if changed := e.ChangedProperties(); !reflect.DeepEqual(changed, exp.changed) {
+			t.Errorf("Unexpected changed properties %v; expected %v", changed, exp.changed)
+		}
+	}
+
+	// The interval is waited by the poll timeouts.
+	if err := sub.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+	for i, d := range clock.delays[:10] {
+		if d != time.Second {
+			t.Errorf("Unexpected delay %d: %s", i, d)
+		}
+	}
+}
+
+func TestPollingSource_Error(t *testing.T) {
+	testErr := errors.New("test")
+	sub, _ := startFakeWatch(t, &WatchOptions{
+		Keys:  []string{"Name"},
+		Clock: &fakeClock{},
+	}, []Win32_Service{{Name: "a"}}, testErr)
+	waitDone(t, sub)
+	if !errors.Is(sub.Err(), testErr) {
+		t.Errorf("Unexpected error %v", sub.Err())
+	}
+}
+
+func TestPollingSource_NilKey(t *testing.T) {
+	type service struct {
+		Name  *string
+		State string
+	}
+	name := "a"
+	sub, events := startFakeWatchOf(t, service{}, &WatchOptions{
+		Keys:  []string{"Name"},
+		Clock: &fakeClock{},
+	},
+		[]service{{State: "Stopped"}, {Name: &name, State: "Stopped"}},
+		[]service{{State: "Running"}, {Name: &name, State: "Stopped"}},
+	)
+	defer sub.Close()
+
+	e := <-events
+	if e.Kind != InstanceModified || e.Target.(*service).Name != nil || e.Target.(*service).State != "Running" {
+		t.Errorf("Unexpected event %+v; expected modification of the unnamed instance", e)
+	}
+	if err := sub.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+}
+
+func TestInstanceKeyFunc(t *testing.T) {
+	type instance struct {
+		RelPath string `wmi:"__RELPATH"`
+		Domain  string
+		Name    *string
+		Port    uint16
+	}
+	name := "svc"
+	v := reflect.ValueOf(instance{RelPath: `Win32_Service.Name="svc"`, Domain: "corp", Name: &name, Port: 80})
+
+	tests := []struct {
+		keys []string
+		key  string
+	}{
+		{nil, `Win32_Service.Name="svc"`},
+		{[]string{"name"}, "svc"},
+		{[]string{"Domain", "Name", "Port"}, "corp,svc,80"},
+	}
+	for _, test := range tests {
+		key, err := instanceKeyFunc(v.Type(), test.keys)
+		if err != nil {
+			t.Errorf("instanceKeyFunc(%v): %s", test.keys, err)
+			continue
+		}
+		if k := key(v); k != test.key {
+			t.Errorf("Unexpected key %q of %v; expected %q", k, test.keys, test.key)
+		}
+	}
+
+	key, err := instanceKeyFunc(v.Type(), []string{"Domain", "Name"})
+	if err != nil {
+		t.Fatalf("instanceKeyFunc: %s", err)
+	}
+	if k := key(reflect.ValueOf(instance{Domain: "corp"})); k != "corp,<nil>" {
+		t.Errorf("Unexpected key %q of the unset property", k)
+	}
+
+	if _, err := instanceKeyFunc(v.Type(), []string{"Missing"}); err == nil {
+		t.Errorf("Missing key property is accepted")
+	}
+	if _, err := instanceKeyFunc(reflect.TypeOf(Win32_Service{}), nil); err == nil {
+		t.Errorf("Missing __RELPATH is accepted")
+	}
+}
+
+func TestPollingSource_ResolveKey(t *testing.T) {
+	source := pollingSource{sliceType: reflect.TypeOf([]Win32_Service{})}
+	if err := source.resolveKey([]string{"Name"}); err != nil {
+		t.Errorf("Class keys aren't used; %s", err)
+	}
+	if err := source.resolveKey([]string{"Name", "SystemName"}); err == nil {
+		t.Errorf("Class keys missed in the structure are used")
+	}
+	source.keys = []string{"State"}
+	if err := source.resolveKey([]string{"Name"}); err != nil {
+		t.Errorf("Keys from the options aren't used; %s", err)
+	}
+	if k := source.key(reflect.ValueOf(Win32_Service{Name: "a", State: "Running"})); k != "Running" {
+		t.Errorf("Unexpected key %q", k)
+	}
+}
@@ -3,19 +3,13 @@
 package wmi
 
 import (
-	"bytes"
+	"context"
 	"errors"
-	"reflect"
-	"strings"
 
 	"github.com/hashicorp/go-multierror"
 )
 
 var (
-	// ErrInvalidEntityType is returned in case of unsupported destination type
-	// given to the `Query` call.
-	ErrInvalidEntityType = errors.New("wmi: invalid entity type")
-
 	// ErrNilCreateObject is the error returned if CreateObject returns nil even
 	// if the error was nil.
 	ErrNilCreateObject = errors.New("wmi: create object returned nil")
@@ -40,61 +34,6 @@ func Query(query string, dst interface{}, connectServerArgs ...interface{}) erro
 	return DefaultClient.Query(query, dst, connectServerArgs...)
 }
 
-// CreateQuery returns a WQL query string that queries all columns of @src.
-//
-// @src could be T, *T, []T, or *[]T;
-//
-// @where is an optional string that is appended to the query, to be used with
-// WHERE clauses. In such a case, the "WHERE" string should appear at
-// the beginning.
-//
-//   type Win32_Product struct {
-//   	Name            string
-//   	InstallLocation string
-//   }
-//   var dst []Win32_Product
-//   query := wmi.CreateQuery(&dst, "WHERE InstallLocation != null")
-func CreateQuery(src interface{}, where string) string {
-	s := reflect.Indirect(reflect.ValueOf(src))
-	t := s.Type()
-	if s.Kind() == reflect.Slice {
-		t = t.Elem()
-	}
-	return CreateQueryFrom(src, t.Name(), where)
-}
-
-// CreateQuery returns a WQL query string that queries all columns of @src from
-// class @from with condition @where (optional).
-//
-// N.B. The call is the same as `CreateQuery` but uses @from instead of structure
-// name as a class name.
-func CreateQueryFrom(src interface{}, from, where string) string {
-	s := reflect.Indirect(reflect.ValueOf(src))
-	t := s.Type()
-	if s.Kind() == reflect.Slice {
-		t = t.Elem()
-	}
-	if t.Kind() != reflect.Struct {
-		return ""
-	}
-
-	var b bytes.Buffer
-	b.WriteString("SELECT ")
-	var fields []string
-	for i := 0; i < t.NumField(); i++ {
-		name, _ := getFieldName(t.Field(i))
-		if name == "-" {
-			continue
-		}
-		fields = append(fields, name)
-	}
-	b.WriteString(strings.Join(fields, ", "))
-	b.WriteString(" FROM ")
-	b.WriteString(from)
-	b.WriteString(" " + where)
-	return b.String()
-}
-
 // A Client is an WMI query client.
 //
 // Its zero value (`DefaultClient`) is a usable client.
@@ -113,6 +52,23 @@ type Client struct {
 	// initialized and then reused across multiple queries. If it is null
 	// then the method will initialize a new temporary client each time.
 	SWbemServicesClient *SWbemServices
+
+	// RetryPolicy is an optional policy of retrying queries failed with
+	// transient errors. Every attempt connects to the server anew, so
+	// disconnects are retried if `RetryPolicy.Reconnect` is set.
+	RetryPolicy *RetryPolicy
+
+	// Pool is an optional connection pool. If set, queries are performed
+	// using the pooled connections instead of connecting to the server on
+	// every call. Only string connectServerArgs are supported then (see
+	// `NewPoolKey`). `SWbemServicesClient` is ignored.
+	Pool *Pool
+
+	// Observer is an optional observer of the client calls. Calls are
+	// counted in `Stats` regardless of it.
+	Observer Observer
+
+	stats statsRecorder
 }
 
 // DefaultClient is the default Client and is used by Query, QueryNamespace
@@ -126,7 +82,25 @@ var DefaultClient = &Client{}
 // changed using connectServerArgs. See a reference below for details.
 //
 //   https://docs.microsoft.com/en-us/windows/desktop/wmisdk/swbemlocator-connectserver
-func (c *Client) Query(query string, dst interface{}, connectServerArgs ...interface{}) (err error) {
+func (c *Client) Query(query string, dst interface{}, connectServerArgs ...interface{}) error {
+	return c.QueryContext(context.Background(), query, dst, connectServerArgs...)
+}
+
+// QueryContext is like Query but the calls are observed with the @ctx (see
+// `CallInfo.Context`), e.g. to trace them as a part of the request. The @ctx
+// is checked before every query attempt and interrupts the backoff between
+// them, but doesn't interrupt the running attempt.
+func (c *Client) QueryContext(
+	ctx context.Context,
+	query string,
+	dst interface{},
+	connectServerArgs ...interface{},
+) (err error) {
+	observer := withContext(ctx, c.observer())
+	if c.Pool != nil {
+		return c.poolQuery(ctx, observer, query, dst, connectServerArgs...)
+	}
+
 	client := c.SWbemServicesClient
 	if client == nil {
 		client, err = NewSWbemServices()
@@ -139,6 +113,53 @@ func (c *Client) Query(query string, dst interface{}, connectServerArgs ...inter
 			}
 		}()
 	}
-	client.Decoder = c.Decoder // Patch decoder to use set decoder flags inside `Query`.
-	return client.Query(query, dst, connectServerArgs...)
+	return c.RetryPolicy.do(ctx, func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Use the client decoder flags and the observer of the call without
+		// patching the shared `SWbemServicesClient`.
+		return client.query(c.Decoder, observer, query, dst, connectServerArgs...)
+	}, func() error {
+		return nil // Query connects to the server by itself.
+	})
+}
+
+func (c *Client) poolQuery(
+	ctx context.Context,
+	observer Observer,
+	query string,
+	dst interface{},
+	connectServerArgs ...interface{},
+) error {
+	key, err := NewPoolKey(connectServerArgs...)
+	if err != nil {
+		return err
+	}
+	return c.RetryPolicy.do(ctx, func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return c.Pool.Do(key, func(conn *SWbemServicesConnection) error {
+			// The connection is used exclusively, so the client settings are
+			// applied for the call and restored for the other pool users.
+			prevDecoder, prevObserver := conn.Decoder, conn.Observer
+			defer func() { conn.Decoder, conn.Observer = prevDecoder, prevObserver }()
+			conn.Decoder = c.Decoder
+			conn.Decoder.Dereferencer = conn
+			conn.Observer = observer
+			return conn.Query(query, dst)
+		})
+	}, func() error {
+		return nil // Disconnected connections are evicted by the pool.
+	})
+}
+
+// Stats returns the counters of the client calls.
+func (c *Client) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+func (c *Client) observer() Observer {
+	return MultiObserver(&c.stats, c.Observer)
 }
@@ -120,6 +120,17 @@ func TestCreateQuery(t *testing.T) {
 	}
 }
 
+func TestCreateQueryUnexported(t *testing.T) {
+	type TestStruct struct {
+		Name     string
+		internal int
+	}
+	expected := "SELECT Name, internal FROM TestStruct "
+	if got := CreateQuery(TestStruct{}, ""); got != expected {
+		t.Errorf("Got unexpected query; got %q, expected %q", got, expected)
+	}
+}
+
 func TestCreateQueryTags(t *testing.T) {
 	type TestStruct struct {
 		Name      string
@@ -0,0 +1,26 @@
+module github.com/bi-zone/wmi/wmiotel
+
+go 1.21
+
+require (
+	github.com/bi-zone/wmi v0.0.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/metric v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/sdk/metric v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/bi-zone/go-ole v1.2.5 // indirect
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/jeffreystoke/comshim v0.0.0-20201112193758-b0afaf23e130 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+)
+
+// The module is built against the local wmi tree until the wmi release with
+// the observer API is tagged. Require that tag and drop the directive then.
+replace github.com/bi-zone/wmi => ../
@@ -0,0 +1,284 @@
+// Package wmiotel provides OpenTelemetry tracing and metrics of the WMI calls.
+//
+// The package is a separate module to keep OpenTelemetry out of the
+// dependencies of the wmi package. Calls are observed via the `wmi.Observer`
+// hooks, so the observer could be set to `wmi.Client`, `wmi.SWbemServices`,
+// connections and notification queries:
+//
+//	observer, err := wmiotel.NewObserver(wmiotel.Options{})
+//	if err != nil {
+//	    return err
+//	}
+//	client := &wmi.Client{Observer: observer}
+//
+//	func handler(w http.ResponseWriter, r *http.Request) {
+//	    var dst []Win32_Process
+//	    err := client.QueryContext(r.Context(), "SELECT * FROM Win32_Process", &dst)
+//	    ...
+//	}
+//
+// Spans of the calls done with a context (`wmi.CallInfo.Context`) are the
+// children of the span of the context, the other ones are the root spans.
+package wmiotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bi-zone/wmi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/bi-zone/wmi/wmiotel"
+
+// Attributes of the spans and metrics.
+const (
+	OperationKey = attribute.Key("wmi.operation")
+	HostKey      = attribute.Key("server.address")
+	NamespaceKey = attribute.Key("wmi.namespace")
+	ClassKey     = attribute.Key("wmi.class") // Parsed from the query or object path.
+	QueryKey     = attribute.Key("wmi.query") // Spans only.
+	RowsKey      = attribute.Key("wmi.rows")  // Spans only, number of objects returned.
+	HResultKey   = attribute.Key("wmi.hresult")
+	ErrorTypeKey = attribute.Key("error.type")
+)
+
+// Names of the metrics.
+const (
+	DurationMetric = "wmi.client.duration"
+	ErrorsMetric   = "wmi.client.errors"
+)
+
+// DefaultOperations are the operations observed by default. Decoding and
+// event delivery are too frequent to be traced by default.
+var DefaultOperations = []wmi.Operation{
+	wmi.OpConnect,
+	wmi.OpExecQuery,
+	wmi.OpEnumerate,
+	wmi.OpGet,
+	wmi.OpExecMethod,
+	wmi.OpExecNotificationQuery,
+}
+
+// Options are the settings of the Observer.
+type Options struct {
+	// TracerProvider is the provider of the tracer, the global one if nil.
+	TracerProvider trace.TracerProvider
+	// MeterProvider is the provider of the meter, the global one if nil.
+	MeterProvider metric.MeterProvider
+
+	// Operations are the observed operations, `DefaultOperations` if empty.
+	Operations []wmi.Operation
+
+	// OmitQuery disables recording of the query text (object paths, etc.),
+	// e.g. if they contain sensitive values.
+	OmitQuery bool
+}
+
+// Observer is a `wmi.Observer` emitting a span of every observed call and
+// recording the calls duration and errors metrics.
+type Observer struct {
+	tracer     trace.Tracer
+	duration   metric.Float64Histogram
+	errors     metric.Int64Counter
+	operations map[wmi.Operation]bool
+	omitQuery  bool
+}
+
+// NewObserver creates an Observer with the @opts.
+func NewObserver(opts Options) (*Observer, error) {
+	tp := opts.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	mp := opts.MeterProvider
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(instrumentationName)
+
+	duration, err := meter.Float64Histogram(DurationMetric,
+		metric.WithDescription("Duration of the WMI calls"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s histogram; %w", DurationMetric, err)
+	}
+	errorsCounter, err := meter.Int64Counter(ErrorsMetric,
+		metric.WithDescription("Number of the failed WMI calls"),
+		metric.WithUnit("{call}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s counter; %w", ErrorsMetric, err)
+	}
+
+	operations := opts.Operations
+	if len(operations) == 0 {
+		operations = DefaultOperations
+	}
+	o := Observer{
+		tracer:     tp.Tracer(instrumentationName),
+		duration:   duration,
+		errors:     errorsCounter,
+		operations: make(map[wmi.Operation]bool, len(operations)),
+		omitQuery:  opts.OmitQuery,
+	}
+	for _, op := range operations {
+		o.operations[op] = true
+	}
+	return &o, nil
+}
+
+// CallStarted implements `wmi.Observer`.
+func (o *Observer) CallStarted(info wmi.CallInfo) func(info wmi.CallInfo) {
+	if !o.operations[info.Operation] {
+		return nil
+	}
+	ctx := info.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	attrs := callAttributes(info)
+	spanAttrs := attrs
+	if info.Query != "" && !o.omitQuery {
+		spanAttrs = append(append([]attribute.KeyValue(nil), attrs...), QueryKey.String(info.Query))
+	}
+	ctx, span := o.tracer.Start(ctx, "WMI "+string(info.Operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(spanAttrs...))
+
+	return func(info wmi.CallInfo) {
+		if info.Objects > 0 || info.Operation == wmi.OpEnumerate {
+			span.SetAttributes(RowsKey.Int(info.Objects))
+		}
+		if info.Err != nil {
+			errAttrs := errorAttributes(info.Err)
+			attrs = append(attrs, errAttrs...)
+			span.SetAttributes(errAttrs...)
+			span.RecordError(info.Err)
+			span.SetStatus(codes.Error, info.Err.Error())
+			o.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+		}
+		span.End()
+		o.duration.Record(ctx, info.Duration.Seconds(), metric.WithAttributes(attrs...))
+	}
+}
+
+// callAttributes returns the attributes of the call common for spans and
+// metrics.
+func callAttributes(info wmi.CallInfo) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		OperationKey.String(string(info.Operation)),
+		HostKey.String(info.Host),
+		NamespaceKey.String(info.Namespace),
+	}
+	if class := callClass(info); class != "" {
+		attrs = append(attrs, ClassKey.String(class))
+	}
+	return attrs
+}
+
+// errorAttributes returns the attributes of the call failed with @err.
+func errorAttributes(err error) []attribute.KeyValue {
+	var wbemErr *wmi.WbemError
+	if !errors.As(err, &wbemErr) {
+		return []attribute.KeyValue{ErrorTypeKey.String(fmt.Sprintf("%T", err))}
+	}
+	errorType := wbemErr.Name()
+	if errorType == "" {
+		errorType = fmt.Sprintf("0x%08X", wbemErr.HResult)
+	}
+	return []attribute.KeyValue{
+		ErrorTypeKey.String(errorType),
+		HResultKey.String(fmt.Sprintf("0x%08X", wbemErr.HResult)),
+	}
+}
+
+// callClass returns the class of the call target or an empty string if it's
+// unknown.
+func callClass(info wmi.CallInfo) string {
+	switch info.Operation {
+	case wmi.OpGet, wmi.OpExecMethod:
+		// Method calls have the "<object path>.<method>" query, so the class
+		// is parsed the same.
+		return wmi.ObjectPathClass(info.Query)
+	case wmi.OpConnect:
+		return ""
+	}
+	if class := QueryClass(info.Query); class != "" {
+		return class
+	}
+	// Decoded objects could be obtained by the object path.
+	return wmi.ObjectPathClass(info.Query)
+}
+
+// QueryClass returns the class of the WQL @query, e.g. "Win32_Process" for
+// "SELECT Name FROM Win32_Process WHERE Handle = 4". For the `ASSOCIATORS OF`
+// and `REFERENCES OF` queries it's the class of the source object. Returns an
+// empty string if the query isn't recognized.
+func QueryClass(query string) string {
+	tokens := wqlTokens(query)
+	for i := 0; i < len(tokens)-1; i++ {
+		switch next := tokens[i+1]; {
+		case strings.EqualFold(tokens[i], "FROM") && isIdentifier(next):
+			return next
+		case strings.EqualFold(tokens[i], "OF") && strings.HasPrefix(next, "{"):
+			return wmi.ObjectPathClass(strings.Trim(next, "{}"))
+		}
+	}
+	return ""
+}
+
+// wqlTokens splits the @query into the whitespace separated tokens. Quoted
+// strings and `{...}` object paths are the single tokens.
+func wqlTokens(query string) []string {
+	var (
+		tokens []string
+		start  = -1
+		closer byte
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case closer != 0:
+			if c == closer {
+				closer = 0
+			}
+		case c == '"' || c == '\'':
+			closer = c
+		case c == '{':
+			closer = '}'
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ',' || c == '(' || c == ')':
+			if start >= 0 {
+				tokens = append(tokens, query[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, query[start:])
+	}
+	return tokens
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
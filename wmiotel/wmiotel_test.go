@@ -0,0 +1,195 @@
+package wmiotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bi-zone/wmi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type testEnv struct {
+	spans    *tracetest.SpanRecorder
+	metrics  *sdkmetric.ManualReader
+	tp       *sdktrace.TracerProvider
+	observer *Observer
+}
+
+func newTestEnv(t *testing.T, opts Options) *testEnv {
+	env := testEnv{
+		spans:   tracetest.NewSpanRecorder(),
+		metrics: sdkmetric.NewManualReader(),
+	}
+	env.tp = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(env.spans))
+	opts.TracerProvider = env.tp
+	opts.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(env.metrics))
+	var err error
+	if env.observer, err = NewObserver(opts); err != nil {
+		t.Fatalf("NewObserver: %s", err)
+	}
+	return &env
+}
+
+func (env *testEnv) call(info wmi.CallInfo, objects int, err error) {
+	if done := env.observer.CallStarted(info); done != nil {
+		info.Objects = objects
+		info.Err = err
+		info.Duration = 10 * time.Millisecond
+		done(info)
+	}
+}
+
+func (env *testEnv) collect(t *testing.T) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	if err := env.metrics.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %s", err)
+	}
+	res := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			res[m.Name] = m.Data
+		}
+	}
+	return res
+}
+
+func attributesMap(attrs []attribute.KeyValue) map[attribute.Key]string {
+	res := make(map[attribute.Key]string, len(attrs))
+	for _, kv := range attrs {
+		res[kv.Key] = kv.Value.Emit()
+	}
+	return res
+}
+
+func TestObserver_Spans(t *testing.T) {
+	env := newTestEnv(t, Options{})
+
+	ctx, parent := env.tp.Tracer("test").Start(context.Background(), "GET /processes")
+	query := "SELECT Name FROM Win32_Process WHERE Name = 'from.exe'"
+	info := wmi.CallInfo{Host: ".", Namespace: `root\cimv2`, Context: ctx}
+	env.call(withOp(info, wmi.OpExecQuery, query), 0, nil)
+	env.call(withOp(info, wmi.OpEnumerate, query), 3, nil)
+	env.call(withOp(info, wmi.OpDecode, query), 1, nil) // Not observed by default.
+	parent.End()
+
+	spans := env.spans.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Unexpected spans number %d", len(spans))
+	}
+	for i, name := range []string{"WMI ExecQuery", "WMI Enumerate", "GET /processes"} {
+		if spans[i].Name() != name {
+			t.Errorf("Unexpected span %d name %q", i, spans[i].Name())
+		}
+	}
+	for _, span := range spans[:2] {
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Span %q isn't a child of the request", span.Name())
+		}
+		attrs := attributesMap(span.Attributes())
+		if attrs[HostKey] != "." || attrs[NamespaceKey] != `root\cimv2` ||
+			attrs[ClassKey] != "Win32_Process" || attrs[QueryKey] != query {
+			t.Errorf("Unexpected span %q attributes %v", span.Name(), attrs)
+		}
+	}
+	if rows := attributesMap(spans[1].Attributes())[RowsKey]; rows != "3" {
+		t.Errorf("Unexpected rows number %q", rows)
+	}
+	if _, ok := attributesMap(spans[0].Attributes())[RowsKey]; ok {
+		t.Errorf("Unexpected rows number of ExecQuery")
+	}
+}
+
+func TestObserver_Errors(t *testing.T) {
+	env := newTestEnv(t, Options{OmitQuery: true, Operations: []wmi.Operation{wmi.OpGet}})
+
+	info := wmi.CallInfo{Host: "server", Namespace: `root\cimv2`}
+	notFound := fmt.Errorf("get failed; %w", &wmi.WbemError{HResult: 0x80041002})
+	env.call(withOp(info, wmi.OpGet, `Win32_Service.Name="foo"`), 0, notFound)
+	env.call(withOp(info, wmi.OpGet, `Win32_Service.Name="bar"`), 1, nil)
+	env.call(withOp(info, wmi.OpGet, `Win32_Service.Name="baz"`), 0, errors.New("boom"))
+	env.call(withOp(info, wmi.OpConnect, ""), 0, nil) // Not observed.
+
+	spans := env.spans.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Unexpected spans number %d", len(spans))
+	}
+	attrs := attributesMap(spans[0].Attributes())
+	if attrs[HResultKey] != "0x80041002" || attrs[ErrorTypeKey] != "WBEM_E_NOT_FOUND" ||
+		attrs[ClassKey] != "Win32_Service" {
+		t.Errorf("Unexpected error span attributes %v", attrs)
+	}
+	if _, ok := attrs[QueryKey]; ok {
+		t.Errorf("Query isn't omitted")
+	}
+	if spans[0].Status().Code != codes.Error || len(spans[0].Events()) != 1 {
+		t.Errorf("Error isn't recorded; %+v", spans[0].Status())
+	}
+	if spans[1].Status().Code != codes.Unset {
+		t.Errorf("Unexpected status %+v", spans[1].Status())
+	}
+	if attrs := attributesMap(spans[2].Attributes()); attrs[ErrorTypeKey] != "*errors.errorString" {
+		t.Errorf("Unexpected error type %q", attrs[ErrorTypeKey])
+	}
+
+	metrics := env.collect(t)
+	duration, ok := metrics[DurationMetric].(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("No duration histogram; %v", metrics)
+	}
+	var calls uint64
+	for _, dp := range duration.DataPoints {
+		calls += dp.Count
+		if dp.Sum != float64(dp.Count)*0.01 {
+			t.Errorf("Unexpected duration sum %v of %d calls", dp.Sum, dp.Count)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Unexpected calls number %d", calls)
+	}
+
+	errorsSum, ok := metrics[ErrorsMetric].(metricdata.Sum[int64])
+	if !ok || len(errorsSum.DataPoints) != 2 {
+		t.Fatalf("Unexpected errors counter; %v", metrics[ErrorsMetric])
+	}
+	for _, dp := range errorsSum.DataPoints {
+		class, _ := dp.Attributes.Value(ClassKey)
+		op, _ := dp.Attributes.Value(OperationKey)
+		if dp.Value != 1 || class.AsString() != "Win32_Service" || op.AsString() != "Get" {
+			t.Errorf("Unexpected errors data point %+v", dp)
+		}
+	}
+}
+
+func TestQueryClass(t *testing.T) {
+	tests := []struct {
+		query string
+		class string
+	}{
+		{"SELECT * FROM Win32_Process", "Win32_Process"},
+		{"select Name, Handle from\tWin32_Process where Name = 'a FROM b'", "Win32_Process"},
+		{"SELECT * FROM __InstanceCreationEvent WITHIN 5 WHERE TargetInstance ISA 'Win32_Process'", "__InstanceCreationEvent"},
+		{`ASSOCIATORS OF {Win32_LogicalDisk.DeviceID="C:"} WHERE ResultClass = Win32_Directory`, "Win32_LogicalDisk"},
+		{`REFERENCES OF {\\.\root\cimv2:Win32_Service.Name="from"}`, "Win32_Service"},
+		{"SELECT * FROM", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if class := QueryClass(test.query); class != test.class {
+			t.Errorf("Unexpected class of %q; got %q, want %q", test.query, class, test.class)
+		}
+	}
+}
+
+func withOp(info wmi.CallInfo, op wmi.Operation, query string) wmi.CallInfo {
+	info.Operation = op
+	info.Query = query
+	return info
+}